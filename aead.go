@@ -0,0 +1,62 @@
+package okapi
+
+// AEAD is an authenticated encryption algorithm with associated data.
+// Unlike Cipher, AEAD processes the whole message at once, because the authentication tag
+// must be verified before any of the decrypted data can be released.
+// The API follows the Seal/Open convention of crypto/cipher.AEAD, except that
+// the associated data can be provided as multiple separate components
+// (as long as the algorithm supports it, e.g. AES_SIV).
+type AEAD interface {
+	// Seal encrypts and authenticates the plain input and authenticates the associated data.
+	// The result is appended to dst and the updated slice is returned.
+	// The plain input can be empty, e.g. to authenticate the associated data only.
+	// Seal will panic if the nonce size or the number of associated data components is not supported.
+	Seal(dst, nonce, plain []byte, data ...[]byte) []byte
+	// Open authenticates and decrypts the encrypted input and authenticates the associated data.
+	// The decrypted result is appended to dst and the updated slice is returned.
+	// Open returns an error if authentication fails, dst is not modified in that case.
+	Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error)
+	// NonceSize returns the nonce size in bytes required by the algorithm.
+	// Zero means the nonce is optional and can be of arbitrary size (e.g. AES_SIV).
+	NonceSize() int
+	// Overhead returns the maximum difference between the sizes of encrypted and plain input.
+	Overhead() int
+	// KeySize returns the size of the encryption key in bytes.
+	KeySize() int
+	// Close MUST be called to securely discard and release any associated secrets and resources.
+	Close()
+}
+
+// AEADSpecs are used to create instances of AEADs from a secret key.
+type AEADSpec interface {
+	// New creates an AEAD from the AEADSpec and key.
+	New(key []byte) AEAD
+}
+
+// Predefined AEADSpecs for known authenticated encryption algorithms.
+// These are misuse resistant, i.e. reusing a nonce reveals only whether
+// the same plain input was encrypted with the same associated data, nothing else.
+// Implementations are provided by subpackages.
+// If given algorithm is not supported by the imported implementations,
+// the value of the corresponding variable will be nil.
+var (
+	// AES_SIV is the Synthetic IV mode from RFC 5297. It accepts key sizes 32, 48 and 64 bytes
+	// (two AES keys), any number of associated data components and an optional nonce.
+	AES_SIV,
+	// AES_GCM_SIV is the nonce misuse resistant GCM variant from RFC 8452.
+	// It accepts key sizes 16 and 32 bytes, 12 byte nonce and at most one associated data component.
+	AES_GCM_SIV AEADSpec
+)
+
+// Predefined AEADSpecs for authenticated encryption algorithms that are not misuse resistant,
+// i.e. the nonce MUST NOT be reused with the same key.
+var (
+	// AES_GCM_AEAD is the AES Galois/Counter Mode (NIST SP 800-38D) with 16 byte tag.
+	// It accepts key sizes 16, 24 and 32 bytes, 12 byte nonce and at most one associated data component.
+	// Note that the AES_GCM CipherSpec doesn't provide access to the authentication tag.
+	AES_GCM_AEAD,
+	// XChaCha20_Poly1305 is ChaCha20-Poly1305 (RFC 8439) with 24 byte nonce extended through HChaCha20.
+	// It accepts 32 byte keys and at most one associated data component.
+	// The nonce is large enough to be generated randomly for each message.
+	XChaCha20_Poly1305 AEADSpec
+)
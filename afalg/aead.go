@@ -0,0 +1,130 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+	"syscall"
+)
+
+func init() {
+	if AES_GCM_AEAD.available() {
+		okapi.Register(&okapi.AES_GCM_AEAD, AES_GCM_AEAD)
+	}
+}
+
+var (
+	AES_GCM_AEAD = AEADSpec{name: "gcm(aes)", nonceSize: 12, tagSize: 16}
+)
+
+var errOpen = errors.New("message authentication failed")
+
+// AEADSpec represents a kernel aead algorithm.
+// The whole message including the associated data is submitted to the kernel at once,
+// so it must fit into the socket send buffer, the size is limited to 64KB.
+type AEADSpec struct {
+	name      string
+	nonceSize int
+	tagSize   int
+}
+
+func (as AEADSpec) available() bool {
+	return available("aead", as.name)
+}
+
+func (as AEADSpec) New(key []byte) okapi.AEAD {
+	tfm, err := newTransform("aead", as.name, key)
+	if err != nil {
+		panic(err)
+	}
+	if err = setsockopt(tfm, algSetAEADAuthsize, nil, as.tagSize); err != nil {
+		syscall.Close(tfm)
+		panic(err)
+	}
+	op, err := accept(tfm)
+	if err != nil {
+		syscall.Close(tfm)
+		panic(err)
+	}
+	return &AEAD{spec: as, keySize: len(key), tfm: tfm, op: op}
+}
+
+// AEAD holds the keyed transform socket and an operation socket that processes one message at a time.
+type AEAD struct {
+	spec    AEADSpec
+	keySize int
+	tfm     int
+	op      int
+}
+
+func (a *AEAD) NonceSize() int {
+	return a.spec.nonceSize
+}
+
+func (a *AEAD) Overhead() int {
+	return a.spec.tagSize
+}
+
+func (a *AEAD) KeySize() int {
+	return a.keySize
+}
+
+// crypt submits the associated data followed by the input and reads the result
+// which has the same layout, the result size is adjusted by the tag size.
+func (a *AEAD) crypt(op uint32, nonce, input []byte, data [][]byte, resultSize int) ([]byte, error) {
+	if len(nonce) != a.spec.nonceSize {
+		panic("invalid nonce size")
+	}
+	if len(data) > 1 {
+		panic("too many associated data components")
+	}
+	var ad []byte
+	if len(data) == 1 {
+		ad = data[0]
+	}
+	if len(ad)+len(input)+a.spec.tagSize > maxRequest {
+		panic("message too large")
+	}
+	buffer := make([]byte, len(ad)+max(len(input), resultSize))
+	copy(buffer, ad)
+	copy(buffer[len(ad):], input)
+	if err := send(a.op, buffer[:len(ad)+len(input)], control(op, nonce, len(ad)), false); err != nil {
+		return nil, err
+	}
+	if err := read(a.op, buffer[:len(ad)+resultSize]); err != nil {
+		return nil, err
+	}
+	return buffer[len(ad) : len(ad)+resultSize], nil
+}
+
+func (a *AEAD) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	sealed, err := a.crypt(algOpEncrypt, nonce, plain, data, len(plain)+a.spec.tagSize)
+	if err != nil {
+		panic(err)
+	}
+	return append(dst, sealed...)
+}
+
+func (a *AEAD) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	if len(encrypted) < a.spec.tagSize {
+		return nil, errOpen
+	}
+	opened, err := a.crypt(algOpDecrypt, nonce, encrypted, data, len(encrypted)-a.spec.tagSize)
+	if err == syscall.EBADMSG {
+		return nil, errOpen
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, opened...), nil
+}
+
+func (a *AEAD) Close() {
+	if a.op < 0 {
+		return
+	}
+	syscall.Close(a.op)
+	syscall.Close(a.tfm)
+	a.op, a.tfm = -1, -1
+}
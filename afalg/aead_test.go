@@ -0,0 +1,50 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func h2b(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestAES_GCM_AEAD(t *testing.T) {
+	requires(t, AES_GCM_AEAD.available(), "gcm(aes)")
+	// NIST GCM test case 4 (McGrew & Viega)
+	key := h2b("feffe9928665731c6d6a8f9467308308")
+	nonce := h2b("cafebabefacedbaddecaf888")
+	data := h2b("feedfacedeadbeeffeedfacedeadbeefabaddad2")
+	plain := h2b("d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39")
+	gcm := AES_GCM_AEAD.New(key)
+	defer gcm.Close()
+	encrypted := gcm.Seal(nil, nonce, plain, data)
+	expected := "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091" +
+		"5bc94fbc3221a5db94fae95ae7121a47"
+	if hex.EncodeToString(encrypted) != expected {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	decrypted, err := gcm.Open(nil, nonce, encrypted, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	encrypted[0] ^= 1
+	if _, err = gcm.Open(nil, nonce, encrypted, data); err != errOpen {
+		t.Fatalf("Open of tampered input: %v", err)
+	}
+	// empty input and no associated data
+	encrypted = gcm.Seal(nil, nonce, nil)
+	if decrypted, err = gcm.Open(nil, nonce, encrypted); err != nil || len(decrypted) != 0 {
+		t.Fatalf("Open of empty input: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+// Package afalg implements okapi interfaces using the Linux kernel crypto API:
+// AF_ALG sockets for hashes, HMAC, symmetric ciphers and AEADs, and getrandom(2) for random bytes.
+// It doesn't require cgo. Algorithms are requested by their kernel names (e.g. "cbc(aes)"),
+// so the kernel picks the highest priority registered implementation, which can be a hardware accelerator.
+// Only the algorithms available in the running kernel are registered with okapi,
+// which requires CONFIG_CRYPTO_USER_API_HASH, CONFIG_CRYPTO_USER_API_SKCIPHER and CONFIG_CRYPTO_USER_API_AEAD.
+// Supported on 64-bit Linux architectures only (amd64, arm64, loong64, mips64, ppc64, riscv64 and s390x).
+package afalg
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// constants from linux/if_alg.h
+const (
+	solALG             = 279
+	algSetKey          = 1
+	algSetIV           = 2
+	algSetOp           = 3
+	algSetAEADAssoclen = 4
+	algSetAEADAuthsize = 5
+	algOpDecrypt       = 0
+	algOpEncrypt       = 1
+)
+
+// maxRequest is the maximum amount of data submitted to an operation socket before reading the result,
+// it must fit in the socket send buffer, otherwise the send would block.
+const maxRequest = 16 * 4096
+
+// sockaddrALG is struct sockaddr_alg from linux/if_alg.h
+type sockaddrALG struct {
+	family uint16
+	typ    [14]byte
+	feat   uint32
+	mask   uint32
+	name   [64]byte
+}
+
+// newTransform creates an AF_ALG socket bound to the algorithm of given type ("hash", "skcipher" or "aead").
+// The key is set if not nil. Operations are performed on the sockets returned by accept.
+func newTransform(typ, name string, key []byte) (fd int, err error) {
+	fd, err = syscall.Socket(syscall.AF_ALG, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	sa := sockaddrALG{family: syscall.AF_ALG}
+	copy(sa.typ[:], typ)
+	copy(sa.name[:], name)
+	if _, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(unsafe.Pointer(&sa)), unsafe.Sizeof(sa)); errno != 0 {
+		syscall.Close(fd)
+		return -1, errno
+	}
+	if key != nil {
+		if err = setsockopt(fd, algSetKey, key, len(key)); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	return fd, nil
+}
+
+// setsockopt sets the SOL_ALG option, some options use only the length (with nil value)
+func setsockopt(fd, option int, value []byte, length int) error {
+	var p unsafe.Pointer
+	if len(value) > 0 {
+		p = unsafe.Pointer(&value[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), solALG, uintptr(option), uintptr(p), uintptr(length), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// accept creates an operation socket from a transform socket. Accepting from a hash operation socket
+// creates a new operation socket with a copy of its state.
+// Note that AF_ALG sockets don't have a peer address, so the syscall.Accept wrappers cannot be used.
+func accept(fd int) (int, error) {
+	op, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4, uintptr(fd), 0, 0, syscall.SOCK_CLOEXEC, 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(op), nil
+}
+
+// available checks whether the kernel provides the algorithm
+func available(typ, name string) bool {
+	fd, err := newTransform(typ, name, nil)
+	if err != nil {
+		return false
+	}
+	syscall.Close(fd)
+	return true
+}
+
+// control builds the control messages of the first sendmsg of an operation: the operation,
+// the iv (omitted if nil) and the AEAD associated data length (omitted if negative)
+func control(op uint32, iv []byte, assoclen int) []byte {
+	size := syscall.CmsgSpace(4)
+	if iv != nil {
+		size += syscall.CmsgSpace(4 + len(iv))
+	}
+	if assoclen >= 0 {
+		size += syscall.CmsgSpace(4)
+	}
+	oob := make([]byte, size)
+	next := putCmsg(oob, algSetOp, 4)
+	*(*uint32)(unsafe.Pointer(&next[0])) = op
+	next = oob[syscall.CmsgSpace(4):]
+	if iv != nil {
+		data := putCmsg(next, algSetIV, 4+len(iv))
+		*(*uint32)(unsafe.Pointer(&data[0])) = uint32(len(iv))
+		copy(data[4:], iv)
+		next = next[syscall.CmsgSpace(4+len(iv)):]
+	}
+	if assoclen >= 0 {
+		data := putCmsg(next, algSetAEADAssoclen, 4)
+		*(*uint32)(unsafe.Pointer(&data[0])) = uint32(assoclen)
+	}
+	return oob
+}
+
+// putCmsg writes the SOL_ALG control message header at the start of oob and returns its data slice
+func putCmsg(oob []byte, typ int32, length int) []byte {
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = solALG
+	h.Type = typ
+	h.SetLen(syscall.CmsgLen(length))
+	return oob[syscall.CmsgLen(0):syscall.CmsgLen(length)]
+}
+
+// read reads exactly len(b) bytes of the operation result. It uses recvmsg,
+// because read(2) doesn't process requests with empty result (e.g. AEAD decryption of empty input).
+func read(fd int, b []byte) error {
+	for done := 0; ; {
+		var msg syscall.Msghdr
+		var iov syscall.Iovec
+		if rest := b[done:]; len(rest) > 0 {
+			iov.Base = &rest[0]
+			iov.SetLen(len(rest))
+			msg.Iov = &iov
+			msg.Iovlen = 1
+		}
+		n, _, errno := syscall.Syscall(syscall.SYS_RECVMSG, uintptr(fd), uintptr(unsafe.Pointer(&msg)), 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		done += int(n)
+		if done >= len(b) {
+			return nil
+		}
+		if n == 0 {
+			return syscall.EIO
+		}
+	}
+}
+
+// send submits the data to the operation socket, with MSG_MORE if more data follows.
+// Note that syscall.SendmsgN would add a dummy byte to empty data with control messages.
+func send(fd int, data, oob []byte, more bool) error {
+	flags := 0
+	if more {
+		flags = syscall.MSG_MORE
+	}
+	for {
+		var msg syscall.Msghdr
+		var iov syscall.Iovec
+		if len(data) > 0 {
+			iov.Base = &data[0]
+			iov.SetLen(len(data))
+			msg.Iov = &iov
+			msg.Iovlen = 1
+		}
+		if len(oob) > 0 {
+			msg.Control = &oob[0]
+			msg.SetControllen(len(oob))
+		}
+		n, _, errno := syscall.Syscall(syscall.SYS_SENDMSG, uintptr(fd), uintptr(unsafe.Pointer(&msg)), uintptr(flags))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		if int(n) == len(data) {
+			return nil
+		}
+		data, oob = data[n:], nil
+	}
+}
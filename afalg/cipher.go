@@ -0,0 +1,239 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"crypto/subtle"
+	"github.com/mkobetic/okapi"
+	"io"
+	"syscall"
+)
+
+func init() {
+	for _, c := range []struct {
+		spec   *okapi.CipherSpec
+		cipher CipherSpec
+	}{
+		{&okapi.AES_ECB, AES_ECB}, {&okapi.AES_CBC, AES_CBC}, {&okapi.AES_CTR, AES_CTR}, {&okapi.AES_OFB, AES_OFB},
+		{&okapi.DES3_ECB, DES3_ECB}, {&okapi.DES3_CBC, DES3_CBC}, {&okapi.DES3_OFB, DES3_OFB},
+		{&okapi.BF_ECB, BF_ECB}, {&okapi.BF_CBC, BF_CBC}, {&okapi.BF_OFB, BF_OFB},
+	} {
+		if c.cipher.available() {
+			okapi.Register(c.spec, c.cipher)
+		}
+	}
+}
+
+var (
+	AES_ECB  = CipherSpec{name: "ecb(aes)", blockSize: 16}
+	AES_CBC  = CipherSpec{name: "cbc(aes)", blockSize: 16, ivSize: 16}
+	AES_CTR  = CipherSpec{name: "ctr(aes)", blockSize: 16, ivSize: 16, stream: true}
+	AES_OFB  = CipherSpec{name: "ofb(aes)", blockSize: 16, ivSize: 16, stream: true}
+	DES3_ECB = CipherSpec{name: "ecb(des3_ede)", blockSize: 8}
+	DES3_CBC = CipherSpec{name: "cbc(des3_ede)", blockSize: 8, ivSize: 8}
+	DES3_OFB = CipherSpec{name: "ofb(des3_ede)", blockSize: 8, ivSize: 8, stream: true}
+	BF_ECB   = CipherSpec{name: "ecb(blowfish)", blockSize: 8}
+	BF_CBC   = CipherSpec{name: "cbc(blowfish)", blockSize: 8, ivSize: 8}
+	BF_OFB   = CipherSpec{name: "ofb(blowfish)", blockSize: 8, ivSize: 8, stream: true}
+)
+
+// CipherSpec represents a kernel skcipher algorithm.
+// The kernel processes only whole blocks until the end of the input,
+// so stream modes generate the key stream by encrypting zeros and XOR it with the input.
+type CipherSpec struct {
+	name      string
+	blockSize int
+	ivSize    int
+	stream    bool
+}
+
+func (cs CipherSpec) available() bool {
+	return available("skcipher", cs.name)
+}
+
+func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
+	if len(iv) != cs.ivSize && cs.ivSize > 0 {
+		panic("invalid iv size")
+	}
+	if cs.ivSize == 0 {
+		iv = nil
+	}
+	op := uint32(algOpDecrypt)
+	if encrypt || cs.stream {
+		op = algOpEncrypt
+	}
+	o, err := newOperation("skcipher", cs.name, key, control(op, iv, -1))
+	if err != nil {
+		panic(err)
+	}
+	if cs.stream {
+		return &StreamCipher{operation: o, keySize: len(key), blockSize: cs.blockSize}
+	}
+	return &BlockCipher{operation: o, keySize: len(key), blockSize: cs.blockSize, buffer: make([]byte, 0, cs.blockSize)}
+}
+
+func (cs CipherSpec) NewReader(in io.Reader, key, iv, buffer []byte) *okapi.CipherReader {
+	return okapi.NewCipherReader(in, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWriter(out io.Writer, key, iv, buffer []byte) *okapi.CipherWriter {
+	return okapi.NewCipherWriter(out, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWithKey(key *okapi.SecretKey, iv []byte, encrypt bool) (okapi.Cipher, error) {
+	return key.NewCipher(cs, iv, encrypt)
+}
+
+// operation is a keyed transform socket with an operation socket processing a single unfinished request,
+// the control messages configuring the request are sent with the first data
+type operation struct {
+	tfm int
+	op  int
+	oob []byte
+}
+
+func newOperation(typ, name string, key, oob []byte) (*operation, error) {
+	tfm, err := newTransform(typ, name, key)
+	if err != nil {
+		return nil, err
+	}
+	op, err := accept(tfm)
+	if err != nil {
+		syscall.Close(tfm)
+		return nil, err
+	}
+	return &operation{tfm: tfm, op: op, oob: oob}, nil
+}
+
+// crypt processes the data in place, the data must be whole blocks
+func (o *operation) crypt(data []byte) {
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxRequest {
+			chunk = chunk[:maxRequest]
+		}
+		if err := send(o.op, chunk, o.oob, true); err != nil {
+			panic(err)
+		}
+		o.oob = nil
+		if err := read(o.op, chunk); err != nil {
+			panic(err)
+		}
+		data = data[len(chunk):]
+	}
+}
+
+func (o *operation) close() {
+	if o.op < 0 {
+		return
+	}
+	syscall.Close(o.op)
+	syscall.Close(o.tfm)
+	o.op, o.tfm = -1, -1
+}
+
+type BlockCipher struct {
+	*operation
+	keySize   int
+	blockSize int
+	buffer    []byte
+}
+
+func (c *BlockCipher) KeySize() int {
+	return c.keySize
+}
+
+func (c *BlockCipher) BlockSize() int {
+	return c.blockSize
+}
+
+func (c *BlockCipher) BufferedSize() int {
+	return len(c.buffer)
+}
+
+func (c *BlockCipher) Update(in, out []byte) (int, int) {
+	if len(out) < c.blockSize {
+		return 0, 0
+	}
+	outs := min(len(out), len(c.buffer)+len(in)) / c.blockSize * c.blockSize
+	ins := 0
+	if outs > 0 {
+		copy(out, c.buffer)
+		ins = outs - len(c.buffer)
+		copy(out[len(c.buffer):outs], in[:ins])
+		c.buffer = c.buffer[:0]
+		c.crypt(out[:outs])
+	}
+	// buffer the leftover if it's less than a block
+	if rest := in[ins:]; len(c.buffer)+len(rest) < c.blockSize {
+		c.buffer = append(c.buffer, rest...)
+		ins += len(rest)
+	}
+	return ins, outs
+}
+
+func (c *BlockCipher) Finish(out []byte) int {
+	if len(c.buffer) == 0 {
+		return 0
+	}
+	panic("input is not multiple of cipher block size")
+}
+
+func (c *BlockCipher) Close() {
+	okapi.Zero(c.buffer[:cap(c.buffer)])
+	c.close()
+}
+
+type StreamCipher struct {
+	*operation
+	keySize   int
+	blockSize int
+	// keystream is the unused part of the key stream generated into the buffer
+	keystream []byte
+	buffer    []byte
+}
+
+func (c *StreamCipher) KeySize() int {
+	return c.keySize
+}
+
+func (c *StreamCipher) BlockSize() int {
+	return 1
+}
+
+func (c *StreamCipher) BufferedSize() int {
+	return 0
+}
+
+func (c *StreamCipher) Update(in, out []byte) (int, int) {
+	if len(in) > len(out) {
+		in = in[:len(out)]
+	}
+	for done := 0; done < len(in); {
+		if len(c.keystream) == 0 {
+			size := min(len(in)-done+c.blockSize-1, maxRequest) / c.blockSize * c.blockSize
+			if cap(c.buffer) < size {
+				okapi.Zero(c.buffer[:cap(c.buffer)])
+				c.buffer = make([]byte, size)
+			}
+			c.keystream = c.buffer[:size]
+			okapi.Zero(c.keystream)
+			c.crypt(c.keystream)
+		}
+		n := subtle.XORBytes(out[done:len(in)], in[done:], c.keystream)
+		okapi.Zero(c.keystream[:n])
+		c.keystream = c.keystream[n:]
+		done += n
+	}
+	return len(in), len(in)
+}
+
+func (c *StreamCipher) Finish(out []byte) int {
+	return 0
+}
+
+func (c *StreamCipher) Close() {
+	okapi.Zero(c.buffer[:cap(c.buffer)])
+	c.keystream = nil
+	c.close()
+}
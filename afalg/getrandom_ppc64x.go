@@ -0,0 +1,6 @@
+//go:build linux && (ppc64 || ppc64le)
+
+package afalg
+
+// sysGetrandom is missing from the syscall package on ppc64
+const sysGetrandom = 359
@@ -0,0 +1,148 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+	"syscall"
+)
+
+func init() {
+	for _, h := range []struct {
+		spec *okapi.HashSpec
+		hash HashSpec
+	}{
+		{&okapi.MD4, MD4}, {&okapi.MD5, MD5}, {&okapi.SHA1, SHA1},
+		{&okapi.SHA224, SHA224}, {&okapi.SHA256, SHA256}, {&okapi.SHA384, SHA384}, {&okapi.SHA512, SHA512},
+		{&okapi.RIPEMD160, RIPEMD160},
+	} {
+		if h.hash.available() {
+			okapi.Register(h.spec, h.hash)
+		}
+	}
+}
+
+var (
+	MD4       = HashSpec{"md4", 16, 64}
+	MD5       = HashSpec{"md5", 16, 64}
+	SHA1      = HashSpec{"sha1", 20, 64}
+	SHA224    = HashSpec{"sha224", 28, 64}
+	SHA256    = HashSpec{"sha256", 32, 64}
+	SHA384    = HashSpec{"sha384", 48, 128}
+	SHA512    = HashSpec{"sha512", 64, 128}
+	RIPEMD160 = HashSpec{"rmd160", 20, 64}
+)
+
+// HashSpec represents a hash algorithm by its kernel name.
+type HashSpec struct {
+	name      string
+	size      int
+	blockSize int
+}
+
+func (hs HashSpec) available() bool {
+	return available("hash", hs.name)
+}
+
+func (hs HashSpec) New() okapi.Hash {
+	return newHash(hs, hs.name, nil)
+}
+
+// newHash creates a Hash for the kernel algorithm, keyed if the key is not nil (HMAC)
+func newHash(hs HashSpec, name string, key []byte) *Hash {
+	tfm, err := newTransform("hash", name, key)
+	if err != nil {
+		panic(err)
+	}
+	op, err := accept(tfm)
+	if err != nil {
+		syscall.Close(tfm)
+		panic(err)
+	}
+	return &Hash{spec: hs, tfm: tfm, op: op}
+}
+
+// Hash holds the transform socket and the operation socket with the hash state.
+// The kernel finalizes the hash when the digest is read, the next write starts a new computation.
+type Hash struct {
+	spec   HashSpec
+	tfm    int
+	op     int
+	digest []byte
+}
+
+func (h *Hash) Size() int {
+	return h.spec.size
+}
+
+func (h *Hash) BlockSize() int {
+	return h.spec.blockSize
+}
+
+func (h *Hash) Write(data []byte) (int, error) {
+	if h.digest != nil {
+		return 0, errors.New("Cannot write into finalized hash")
+	}
+	for done := 0; done < len(data); {
+		chunk := data[done:]
+		if len(chunk) > maxRequest {
+			chunk = chunk[:maxRequest]
+		}
+		if err := send(h.op, chunk, nil, true); err != nil {
+			return done, err
+		}
+		done += len(chunk)
+	}
+	return len(data), nil
+}
+
+func (h *Hash) Digest() []byte {
+	if h.digest != nil {
+		return h.digest
+	}
+	digest := make([]byte, h.Size())
+	if err := read(h.op, digest); err != nil {
+		panic(err)
+	}
+	h.digest = digest
+	return h.digest
+}
+
+func (h *Hash) Clone() okapi.Hash {
+	op, err := accept(h.op)
+	if err != nil {
+		panic(err)
+	}
+	// the clone needs its own transform socket, because Close closes both
+	tfm, err := syscall.Dup(h.tfm)
+	if err != nil {
+		syscall.Close(op)
+		panic(err)
+	}
+	clone := &Hash{spec: h.spec, tfm: tfm, op: op}
+	if h.digest != nil {
+		clone.digest = append([]byte(nil), h.digest...)
+	}
+	return clone
+}
+
+// Reset replaces the operation socket, discarding any input that wasn't finalized yet
+func (h *Hash) Reset() {
+	op, err := accept(h.tfm)
+	if err != nil {
+		panic(err)
+	}
+	syscall.Close(h.op)
+	h.op = op
+	h.digest = nil
+}
+
+func (h *Hash) Close() {
+	if h.op < 0 {
+		return
+	}
+	syscall.Close(h.op)
+	syscall.Close(h.tfm)
+	h.op, h.tfm = -1, -1
+}
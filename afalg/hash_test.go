@@ -0,0 +1,60 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// requires skips the test if the kernel doesn't provide the algorithm
+func requires(t *testing.T, available bool, name string) {
+	t.Helper()
+	if !available {
+		t.Skipf("%s is not available in the kernel", name)
+	}
+}
+
+func TestHash(t *testing.T) {
+	requires(t, SHA256.available(), "sha256")
+	sha := SHA256.New()
+	defer sha.Close()
+	if sha.Size() != 32 || sha.BlockSize() != 64 {
+		t.Fatal("Wrong size")
+	}
+	sha.Write([]byte("te"))
+	clone := sha.Clone()
+	defer clone.Close()
+	sha.Write([]byte("st"))
+	digest := sha.Digest()
+	if hex.EncodeToString(digest) != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Fatalf("%x", digest)
+	}
+	count, err := sha.Write([]byte("test"))
+	if err == nil || count != 0 {
+		t.Fatalf("count=%d, err=%s", count, err)
+	}
+	clone.Write([]byte("st"))
+	if digest = clone.Digest(); hex.EncodeToString(digest) != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Fatalf("Clone: %x", digest)
+	}
+}
+
+func TestHashReset(t *testing.T) {
+	requires(t, SHA1.available(), "sha1")
+	sha := SHA1.New()
+	defer sha.Close()
+	sha.Write([]byte("discarded"))
+	sha.Reset()
+	if digest := sha.Digest(); hex.EncodeToString(digest) != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Fatalf("Empty: %x", digest)
+	}
+	sha.Reset()
+	count, err := sha.Write([]byte("test"))
+	if err != nil || count != 4 {
+		t.Fail()
+	}
+	if digest := sha.Digest(); hex.EncodeToString(digest) != "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3" {
+		t.Fatalf("%x", digest)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	if HMAC.available(SHA256) {
+		okapi.Register(&okapi.HMAC, HMAC)
+	}
+}
+
+// MACSpec creates keyed hashes of the kernel "hmac" template
+type MACSpec struct{}
+
+var (
+	HMAC = MACSpec{}
+)
+
+func (ms MACSpec) available(hs HashSpec) bool {
+	return available("hash", "hmac("+hs.name+")")
+}
+
+func (ms MACSpec) New(hs okapi.HashSpec, key []byte) okapi.Hash {
+	spec := hs.(HashSpec)
+	if key == nil {
+		key = []byte{}
+	}
+	return newHash(spec, "hmac("+spec.name+")", key)
+}
+
+func (ms MACSpec) NewWithKey(hash okapi.HashSpec, key *okapi.SecretKey) (okapi.Hash, error) {
+	return key.NewMAC(ms, hash)
+}
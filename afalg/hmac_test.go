@@ -0,0 +1,27 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestHMACHash(t *testing.T) {
+	requires(t, HMAC.available(MD5), "hmac(md5)")
+	key := []byte("Open Sesame!")
+	md5 := HMAC.New(MD5, key)
+	defer md5.Close()
+	if md5.Size() != 16 {
+		t.Fail()
+	}
+	md5.Write([]byte("test"))
+	digest := md5.Digest()
+	if hex.EncodeToString(digest) != "1c4bb1f739e4a8e2f61c3f74e538630b" {
+		t.Fatal(hex.EncodeToString(digest))
+	}
+	count, err := md5.Write([]byte("test"))
+	if err == nil || count != 0 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"github.com/mkobetic/okapi"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	okapi.Register(&okapi.DefaultRandom, DefaultRandom)
+}
+
+// RandomSpec reads random bytes with getrandom(2) from the kernel random number generator.
+type RandomSpec struct{}
+
+var (
+	DefaultRandom = RandomSpec{}
+)
+
+func (rs RandomSpec) New() okapi.Random {
+	return &Random{}
+}
+
+type Random struct {
+}
+
+// maxGetrandom is the maximum size of a single getrandom request
+const maxGetrandom = 1<<25 - 1
+
+// Read blocks until the kernel random number generator is initialized, then it always fills b.
+func (r *Random) Read(b []byte) (int, error) {
+	for done := 0; done < len(b); {
+		request := b[done:]
+		if len(request) > maxGetrandom {
+			request = request[:maxGetrandom]
+		}
+		n, _, errno := syscall.Syscall(sysGetrandom, uintptr(unsafe.Pointer(&request[0])), uintptr(len(request)), 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return done, errno
+		}
+		done += int(n)
+	}
+	return len(b), nil
+}
+
+func (r *Random) Close() {
+}
@@ -0,0 +1,24 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+
+package afalg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	random := DefaultRandom.New()
+	defer random.Close()
+	out := make([]byte, 100)
+	size, err := random.Read(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 100 {
+		t.Fatalf("Wrong result size %d, expected 100", size)
+	}
+	if bytes.Equal(out, make([]byte, 100)) {
+		t.Fatal("Random output is all zeros")
+	}
+}
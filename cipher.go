@@ -8,6 +8,8 @@ import (
 // to both encrypt and decrypt the data and therefore must be kept secret.
 // The Cipher API is deliberately simple and consequently somewhat less convenient,
 // CipherWriter and CipherReader should be used instead whenever possible.
+// The Ciphers created with the predefined CipherSpecs may be wrapped (see SetObserver and EnableLeakDetection),
+// the wrappers provide the GCM tag methods (GCMGetTag and GCMSetTag) if the implementation does (e.g. libcrypto.Cipher).
 type Cipher interface {
 	// Update processes (encrypts or decrypts) input slice and writes the result into the output slice.
 	// It returns the number of bytes read and written. The input and output may be the same slice.
@@ -33,6 +35,35 @@ type Cipher interface {
 	BufferedSize() int
 }
 
+// gcmCipher is a Cipher with the GCM tag methods, e.g. the libcrypto AES_GCM Cipher
+type gcmCipher interface {
+	Cipher
+	GCMGetTag(out []byte) int
+	GCMSetTag(in []byte) int
+}
+
+// gcmTagCipher forwards the GCM tag methods of the cipher wrapped by the wrapper
+type gcmTagCipher struct {
+	Cipher
+	gcm gcmCipher
+}
+
+// withGCMTag returns the wrapper of the cipher with the GCM tag methods if the cipher provides them
+func withGCMTag(wrapper, cipher Cipher) Cipher {
+	if gcm, ok := cipher.(gcmCipher); ok {
+		return &gcmTagCipher{wrapper, gcm}
+	}
+	return wrapper
+}
+
+func (c *gcmTagCipher) GCMGetTag(out []byte) int {
+	return c.gcm.GCMGetTag(out)
+}
+
+func (c *gcmTagCipher) GCMSetTag(in []byte) int {
+	return c.gcm.GCMSetTag(in)
+}
+
 // CipherSpecs are used to create instances of Ciphers from a secret key and
 // an optional initialization vector (iv).
 type CipherSpec interface {
@@ -49,6 +80,9 @@ type CipherSpec interface {
 	// The optional buffer is used internally. If buffer is not provided,
 	// it will be created with DefaultBufferSize.
 	NewWriter(out io.Writer, key, iv, buffer []byte) *CipherWriter
+	// NewWithKey creates a Cipher from the CipherSpec, SecretKey and iv,
+	// the key must allow encryption or decryption respectively (see SecretKey.NewCipher).
+	NewWithKey(key *SecretKey, iv []byte, encrypt bool) (Cipher, error)
 }
 
 // Predefined CipherSpecs for known encryption algorithms and modes.
@@ -60,5 +94,9 @@ var (
 	AES_ECB, AES_CBC, AES_OFB, AES_CFB, AES_CTR, AES_GCM,
 	BF_ECB, BF_CBC, BF_OFB, BF_CFB,
 	DES3_ECB, DES3_CBC, DES3_OFB, DES3_CFB,
-	RC4 CipherSpec
+	// RC2 uses effective key bits equal to the key size (RFC 2268)
+	RC2_CBC,
+	RC4,
+	// XSalsa20 is the Salsa20 stream cipher with 32 byte key and 24 byte nonce (provided as the iv)
+	XSalsa20 CipherSpec
 )
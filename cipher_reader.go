@@ -72,9 +72,10 @@ func (r *CipherReader) bufferRead(buffer, out []byte) (int, error) {
 	return outs, err
 }
 
-// Close checks that there isn't any pending input left, then releases any associated resources, e.g. the cipher.
-// If the underlying Reader is a Closer, then it Closes it as well.
+// Close checks that there isn't any pending input left, then releases any associated resources, e.g. the cipher,
+// and zeroes the buffer. If the underlying Reader is a Closer, then it Closes it as well.
 func (r *CipherReader) Close() error {
+	defer Zero(r.buffer)
 	defer r.cipher.Close()
 	outs := r.cipher.Finish(r.buffer)
 	if outs != 0 {
@@ -42,9 +42,10 @@ func (w *CipherWriter) Write(in []byte) (int, error) {
 }
 
 // Close finishes encryption of any pending input and writes it into the underlying Writer.
-// Then it releases associated resources, e.g. the cipher.
+// Then it releases associated resources, e.g. the cipher, and zeroes the buffer.
 // If the underlying Writer is a Closer, it will close it as well.
 func (w *CipherWriter) Close() error {
+	defer Zero(w.buffer)
 	defer w.cipher.Close()
 	encrypted := w.cipher.Finish(w.buffer)
 	if encrypted != 0 {
@@ -0,0 +1,244 @@
+// Package cms implements the SignedData and EnvelopedData content types
+// of the Cryptographic Message Syntax (RFC 5652) using okapi keys, hashes and ciphers,
+// so that it works with any imported implementation.
+// Only DER encoded input is supported (BER indefinite length encodings are not).
+package cms
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAES_OAEP    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidECPublicKey   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// hashAlgorithm maps a predefined HashSpec to the related algorithm identifiers.
+type hashAlgorithm struct {
+	name     string
+	spec     *okapi.HashSpec
+	oid      asn1.ObjectIdentifier
+	rsa      *okapi.KeyConstructor
+	rsaOID   asn1.ObjectIdentifier
+	ecdsa    *okapi.KeyConstructor
+	ecdsaOID asn1.ObjectIdentifier
+	// dhSinglePass-stdDH-*kdf-scheme from RFC 5753
+	ecdhOID asn1.ObjectIdentifier
+}
+
+var hashAlgorithms = []hashAlgorithm{
+	{"SHA1", &okapi.SHA1, asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26},
+		&okapi.RSA_SHA1, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5},
+		&okapi.ECDSA_SHA1, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1},
+		asn1.ObjectIdentifier{1, 3, 133, 16, 840, 63, 0, 2}},
+	{"SHA224", &okapi.SHA224, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4},
+		&okapi.RSA_SHA224, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 14},
+		&okapi.ECDSA_224, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 1},
+		asn1.ObjectIdentifier{1, 3, 132, 1, 11, 0}},
+	{"SHA256", &okapi.SHA256, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+		&okapi.RSA_SHA256, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11},
+		&okapi.ECDSA_SHA256, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2},
+		asn1.ObjectIdentifier{1, 3, 132, 1, 11, 1}},
+	{"SHA384", &okapi.SHA384, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2},
+		&okapi.RSA_SHA384, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12},
+		&okapi.ECDSA_384, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3},
+		asn1.ObjectIdentifier{1, 3, 132, 1, 11, 2}},
+	{"SHA512", &okapi.SHA512, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3},
+		&okapi.RSA_SHA512, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13},
+		&okapi.ECDSA_SHA512, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4},
+		asn1.ObjectIdentifier{1, 3, 132, 1, 11, 3}},
+}
+
+func hashByName(name string) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; h.name == name && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash %s", name)
+}
+
+func hashByOID(oid asn1.ObjectIdentifier) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; (h.oid.Equal(oid) || h.ecdhOID.Equal(oid)) && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %v", oid)
+}
+
+func (h *hashAlgorithm) digest(data []byte) []byte {
+	hash := (*h.spec).New()
+	defer hash.Close()
+	hash.Write(data)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+// contentInfo is the outermost CMS structure,
+// the content is explicitly tagged which is handled manually.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content interface{}) ([]byte, error) {
+	der, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: contentType,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+	})
+}
+
+func unmarshalContentInfo(der []byte, contentType asn1.ObjectIdentifier, content interface{}) error {
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("trailing data after CMS content")
+	}
+	if !info.ContentType.Equal(contentType) {
+		return fmt.Errorf("unexpected CMS content type %v", info.ContentType)
+	}
+	if info.Content.Class != asn1.ClassContextSpecific || info.Content.Tag != 0 {
+		return errors.New("invalid CMS content")
+	}
+	_, err := asn1.Unmarshal(info.Content.Bytes, content)
+	return err
+}
+
+// Identifier identifies the key of a signer or recipient, either by the issuer
+// and serial number of its certificate, or by its subject key identifier.
+type Identifier struct {
+	// Issuer is the DER encoded issuer name of the certificate
+	Issuer       []byte
+	SerialNumber *big.Int
+	// SubjectKeyID is set if the key is identified by the subject key identifier
+	SubjectKeyID []byte
+}
+
+// Matches returns whether the certificate has the key identified by the Identifier.
+func (id Identifier) Matches(certificate *x509.Certificate) bool {
+	if id.SubjectKeyID != nil {
+		if len(certificate.SubjectKeyId) > 0 {
+			return bytes.Equal(id.SubjectKeyID, certificate.SubjectKeyId)
+		}
+		ski, err := subjectKeyID(certificate.RawSubjectPublicKeyInfo)
+		return err == nil && bytes.Equal(id.SubjectKeyID, ski)
+	}
+	return id.SerialNumber != nil && bytes.Equal(id.Issuer, certificate.RawIssuer) &&
+		id.SerialNumber.Cmp(certificate.SerialNumber) == 0
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type recipientKeyIdentifier struct {
+	SubjectKeyIdentifier []byte
+	Date                 asn1.RawValue `asn1:"optional"`
+	Other                asn1.RawValue `asn1:"optional"`
+}
+
+// marshal encodes the Identifier as SignerIdentifier or RecipientIdentifier,
+// or as KeyAgreeRecipientIdentifier if keyAgreement is set.
+func (id Identifier) marshal(keyAgreement bool) (asn1.RawValue, error) {
+	var der []byte
+	var err error
+	switch {
+	case id.SubjectKeyID == nil:
+		der, err = asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: id.Issuer}, SerialNumber: id.SerialNumber})
+	case keyAgreement:
+		der, err = asn1.MarshalWithParams(recipientKeyIdentifier{SubjectKeyIdentifier: id.SubjectKeyID}, "tag:0")
+	default:
+		der, err = asn1.MarshalWithParams(id.SubjectKeyID, "tag:0")
+	}
+	return asn1.RawValue{FullBytes: der}, err
+}
+
+func unmarshalIdentifier(raw asn1.RawValue) (id Identifier, err error) {
+	switch {
+	case raw.Class == asn1.ClassUniversal && raw.Tag == asn1.TagSequence:
+		var ias issuerAndSerialNumber
+		_, err = asn1.Unmarshal(raw.FullBytes, &ias)
+		id.Issuer, id.SerialNumber = ias.Issuer.FullBytes, ias.SerialNumber
+	case raw.Class == asn1.ClassContextSpecific && raw.Tag == 0 && raw.IsCompound:
+		var rki recipientKeyIdentifier
+		_, err = asn1.UnmarshalWithParams(raw.FullBytes, &rki, "tag:0")
+		id.SubjectKeyID = rki.SubjectKeyIdentifier
+	case raw.Class == asn1.ClassContextSpecific && raw.Tag == 0:
+		id.SubjectKeyID = raw.Bytes
+	default:
+		err = errors.New("unsupported CMS key identifier")
+	}
+	return id, err
+}
+
+// newIdentifier identifies the key by the certificate if provided,
+// otherwise by the subject key identifier.
+func newIdentifier(key okapi.PublicKey, certificate []byte) (id Identifier, err error) {
+	if certificate != nil {
+		cert, err := x509.ParseCertificate(certificate)
+		if err != nil {
+			return id, err
+		}
+		return Identifier{Issuer: cert.RawIssuer, SerialNumber: cert.SerialNumber}, nil
+	}
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		return id, err
+	}
+	id.SubjectKeyID, err = subjectKeyID(der)
+	return id, err
+}
+
+// SubjectKeyID computes the subject key identifier of the key as the SHA1 digest
+// of the subject public key bits (RFC 5280, section 4.2.1.2, method 1).
+func SubjectKeyID(key okapi.PublicKey) ([]byte, error) {
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return subjectKeyID(der)
+}
+
+func subjectKeyID(der []byte) ([]byte, error) {
+	info, err := parsePublicKeyInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	sha1, err := hashByName("SHA1")
+	if err != nil {
+		return nil, err
+	}
+	return sha1.digest(info.PublicKey.Bytes), nil
+}
+
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func parsePublicKeyInfo(der []byte) (info publicKeyInfo, err error) {
+	_, err = asn1.Unmarshal(der, &info)
+	return info, err
+}
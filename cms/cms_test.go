@@ -0,0 +1,176 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/gocrypto"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// certificate issues a certificate for the key from a throwaway CA
+func certificate(t *testing.T, key okapi.PublicKey, serial int64) []byte {
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Issuer:       pkix.Name{CommonName: "Test CA"},
+		Subject:      pkix.Name{CommonName: "Test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	parent := &x509.Certificate{Subject: template.Issuer}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, parent, public, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func TestSignedData(t *testing.T) {
+	rsa, err := okapi.RSA_SHA256(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsa.Close()
+	rsaPub := rsa.PublicKey()
+	defer rsaPub.Close()
+	ec, err := okapi.ECDSA_384(384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ec.Close()
+	ecPub := ec.PublicKey()
+	defer ecPub.Close()
+	signers := []Signer{
+		{Key: rsa, Hash: "SHA256"},
+		{Key: ec, Hash: "SHA384", Certificate: certificate(t, ecPub, 42)},
+	}
+	ski, _ := SubjectKeyID(rsaPub)
+	keys := func(id Identifier) okapi.PublicKey {
+		if bytes.Equal(id.SubjectKeyID, ski) {
+			return rsaPub
+		}
+		return nil
+	}
+	content := []byte("Message in a bottle!")
+	for _, detached := range []bool{false, true} {
+		signed, err := Sign(content, detached, signers...)
+		if err != nil {
+			t.Fatalf("Sign failed: %s", err)
+		}
+		var verified []byte
+		if detached {
+			if _, err = Verify(signed, nil, keys); err == nil {
+				t.Fatal("Verify without detached content succeeded")
+			}
+			verified, err = Verify(signed, content, keys)
+		} else {
+			verified, err = Verify(signed, nil, keys)
+		}
+		if err != nil {
+			t.Fatalf("Verify failed (detached %v): %s", detached, err)
+		}
+		if !bytes.Equal(verified, content) {
+			t.Fatalf("Content mismatch: %q", verified)
+		}
+		if _, err = Verify(signed, nil, nil); err == nil {
+			t.Fatal("Verify without the RSA key succeeded")
+		}
+		if detached {
+			if _, err = Verify(signed, []byte("Message in a bottle?"), keys); err == nil {
+				t.Fatal("Verify of modified content succeeded")
+			}
+		} else {
+			signed[bytes.Index(signed, content)] ^= 1
+			if _, err = Verify(signed, nil, keys); err == nil {
+				t.Fatal("Verify of modified content succeeded")
+			}
+		}
+	}
+}
+
+func TestEnvelopedData(t *testing.T) {
+	rsa, err := okapi.RSA_OAEP(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsa.Close()
+	rsaPub := rsa.PublicKey()
+	defer rsaPub.Close()
+	ec, err := okapi.ECDH(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ec.Close()
+	ecPub := ec.PublicKey()
+	defer ecPub.Close()
+	ecCertificate := certificate(t, ecPub, 7)
+	ecCert, _ := x509.ParseCertificate(ecCertificate)
+	recipients := []Recipient{{Key: rsaPub}, {Key: ecPub, Certificate: ecCertificate}}
+	ski, _ := SubjectKeyID(rsaPub)
+	for _, cipher := range []string{"AES128_CBC", "AES256_CBC", "DES3_CBC"} {
+		for _, content := range [][]byte{[]byte("Message in a bottle!"), make([]byte, 32), {}} {
+			enveloped, err := Encrypt(content, cipher, recipients...)
+			if err != nil {
+				t.Fatalf("Encrypt failed: %s", err)
+			}
+			decrypted, err := Decrypt(enveloped, func(id Identifier) okapi.PrivateKey {
+				if bytes.Equal(id.SubjectKeyID, ski) {
+					return rsa
+				}
+				return nil
+			})
+			if err != nil || !bytes.Equal(decrypted, content) {
+				t.Fatalf("RSA recipient failed (%s): %v", cipher, err)
+			}
+			decrypted, err = Decrypt(enveloped, func(id Identifier) okapi.PrivateKey {
+				if id.Matches(ecCert) {
+					return ec
+				}
+				return nil
+			})
+			if err != nil || !bytes.Equal(decrypted, content) {
+				t.Fatalf("EC recipient failed (%s): %v", cipher, err)
+			}
+			if _, err = Decrypt(enveloped, func(Identifier) okapi.PrivateKey { return nil }); err == nil {
+				t.Fatal("Decrypt without a key succeeded")
+			}
+		}
+	}
+}
+
+func TestEnvelopedDataFailures(t *testing.T) {
+	rsa, _ := okapi.RSA_OAEP(1024)
+	defer rsa.Close()
+	rsaPub := rsa.PublicKey()
+	defer rsaPub.Close()
+	other, _ := okapi.RSA_OAEP(1024)
+	defer other.Close()
+	enveloped, err := Encrypt([]byte("Message in a bottle!"), "AES128_CBC", Recipient{Key: rsaPub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a wrong key continues with a random content encryption key
+	if _, err = Decrypt(enveloped, func(Identifier) okapi.PrivateKey { return other }); err != nil && err != errDecrypt {
+		t.Fatalf("Key transport failure revealed: %v", err)
+	}
+	// the last byte of the second to last block modifies the padding
+	enveloped[len(enveloped)-17] ^= 1
+	if _, err = Decrypt(enveloped, func(Identifier) okapi.PrivateKey { return rsa }); err != errDecrypt {
+		t.Fatalf("Padding failure revealed: %v", err)
+	}
+}
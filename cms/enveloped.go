@@ -0,0 +1,496 @@
+package cms
+
+import (
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+)
+
+var (
+	oidAES128_Wrap = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 5}
+	oidAES192_Wrap = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 25}
+	oidAES256_Wrap = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 45}
+)
+
+// Recipient describes a recipient of EnvelopedData.
+type Recipient struct {
+	// Key is the public key of the recipient, it can have any configuration,
+	// it is only used to obtain the key material.
+	// RSA keys use key transport with RSAES-OAEP,
+	// EC keys use ephemeral-static ECDH key agreement (RFC 5753)
+	// with the X9.63 KDF using SHA256 and AES-256 key wrap.
+	Key okapi.PublicKey
+	// Certificate is the optional DER encoded certificate of the recipient.
+	// If provided, it identifies the recipient by its issuer and serial number.
+	// Otherwise the recipient is identified by the subject key identifier (see SubjectKeyID).
+	Certificate []byte
+}
+
+// contentCipher maps a predefined CipherSpec and key size to the algorithm identifier.
+type contentCipher struct {
+	name    string
+	spec    *okapi.CipherSpec
+	keySize int
+	ivSize  int
+	oid     asn1.ObjectIdentifier
+}
+
+var contentCiphers = []contentCipher{
+	{"AES128_CBC", &okapi.AES_CBC, 16, 16, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}},
+	{"AES192_CBC", &okapi.AES_CBC, 24, 16, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}},
+	{"AES256_CBC", &okapi.AES_CBC, 32, 16, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}},
+	{"DES3_CBC", &okapi.DES3_CBC, 24, 8, asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}},
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"optional,tag:0"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// keyAgreeRecipientInfo is implicitly tagged [1] in RecipientInfo,
+// the originator is an explicitly tagged choice which is handled manually.
+type keyAgreeRecipientInfo struct {
+	Version                int
+	Originator             asn1.RawValue
+	UKM                    []byte `asn1:"optional,explicit,tag:1"`
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	RecipientEncryptedKeys []recipientEncryptedKey
+}
+
+type recipientEncryptedKey struct {
+	RID          asn1.RawValue
+	EncryptedKey []byte
+}
+
+// eccCMSSharedInfo is the SharedInfo input of the X9.63 KDF (RFC 5753, section 7.2).
+type eccCMSSharedInfo struct {
+	KeyInfo     pkix.AlgorithmIdentifier
+	EntityUInfo []byte `asn1:"optional,explicit,tag:0"`
+	SuppPubInfo []byte `asn1:"explicit,tag:2"`
+}
+
+// Encrypt creates DER encoded EnvelopedData (wrapped in ContentInfo) of the content
+// encrypted for all the recipients. The cipher is one of AES128_CBC, AES192_CBC, AES256_CBC
+// or DES3_CBC. The content encryption key and iv are generated with okapi.DefaultRandom.
+func Encrypt(content []byte, cipher string, recipients ...Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("EnvelopedData requires at least one recipient")
+	}
+	var cc *contentCipher
+	for i := range contentCiphers {
+		if contentCiphers[i].name == cipher && *contentCiphers[i].spec != nil {
+			cc = &contentCiphers[i]
+		}
+	}
+	if cc == nil {
+		return nil, fmt.Errorf("unsupported content cipher %s", cipher)
+	}
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	key := make([]byte, cc.keySize)
+	defer okapi.Zero(key)
+	if _, err := random.Read(key); err != nil {
+		return nil, err
+	}
+	ed := envelopedData{Version: 0}
+	for _, recipient := range recipients {
+		info, version, err := newRecipientInfo(recipient, key)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 {
+			ed.Version = 2
+		}
+		ed.RecipientInfos = append(ed.RecipientInfos, info)
+	}
+	iv := make([]byte, cc.ivSize)
+	if _, err := random.Read(iv); err != nil {
+		return nil, err
+	}
+	parameters, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	padding := cc.ivSize - len(content)%cc.ivSize
+	padded := append(append([]byte{}, content...), make([]byte, padding)...)
+	for i := len(content); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+	ed.EncryptedContentInfo = encryptedContentInfo{
+		ContentType:                oidData,
+		ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: cc.oid, Parameters: asn1.RawValue{FullBytes: parameters}},
+		EncryptedContent:           crypt(*cc.spec, key, iv, padded, true),
+	}
+	return marshalContentInfo(oidEnvelopedData, ed)
+}
+
+func newRecipientInfo(recipient Recipient, key []byte) (info asn1.RawValue, version int, err error) {
+	der, err := okapi.ExportKey(recipient.Key)
+	if err != nil {
+		return info, 0, err
+	}
+	public, err := parsePublicKeyInfo(der)
+	if err != nil {
+		return info, 0, err
+	}
+	id, err := newIdentifier(recipient.Key, recipient.Certificate)
+	if err != nil {
+		return info, 0, err
+	}
+	switch {
+	case public.Algorithm.Algorithm.Equal(oidRSAEncryption):
+		ktri, err := newKeyTransRecipientInfo(der, id, key)
+		if err != nil {
+			return info, 0, err
+		}
+		info.FullBytes, err = asn1.Marshal(*ktri)
+		return info, ktri.Version, err
+	case public.Algorithm.Algorithm.Equal(oidECPublicKey):
+		kari, err := newKeyAgreeRecipientInfo(der, id, key)
+		if err != nil {
+			return info, 0, err
+		}
+		info.FullBytes, err = asn1.MarshalWithParams(*kari, "tag:1")
+		return info, kari.Version, err
+	}
+	return info, 0, fmt.Errorf("unsupported recipient key algorithm %v", public.Algorithm.Algorithm)
+}
+
+func newKeyTransRecipientInfo(der []byte, id Identifier, key []byte) (*keyTransRecipientInfo, error) {
+	if okapi.RSA_OAEP == nil {
+		return nil, errors.New("key transport requires RSA_OAEP")
+	}
+	recipient, err := okapi.RSA_OAEP(der)
+	if err != nil {
+		return nil, err
+	}
+	defer recipient.Close()
+	pub := recipient.PublicKey()
+	defer pub.Close()
+	ktri := &keyTransRecipientInfo{Version: 0}
+	if id.SubjectKeyID != nil {
+		ktri.Version = 2
+	}
+	if ktri.RID, err = id.marshal(false); err != nil {
+		return nil, err
+	}
+	// RSAES-OAEP-params with all defaults (SHA1, MGF1 with SHA1, empty label)
+	ktri.KeyEncryptionAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAES_OAEP, Parameters: asn1.RawValue{FullBytes: []byte{0x30, 0}}}
+	if ktri.EncryptedKey, err = pub.Encrypt(key); err != nil {
+		return nil, err
+	}
+	return ktri, nil
+}
+
+func newKeyAgreeRecipientInfo(der []byte, id Identifier, key []byte) (*keyAgreeRecipientInfo, error) {
+	if okapi.ECDH == nil || okapi.AES_KW == nil {
+		return nil, errors.New("key agreement requires ECDH and AES_KW")
+	}
+	hash, err := hashByName("SHA256")
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := okapi.ECDH(der)
+	if err != nil {
+		return nil, err
+	}
+	defer recipient.Close()
+	peer := recipient.PublicKey()
+	defer peer.Close()
+	ephemeral, err := okapi.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	defer ephemeral.Close()
+	pub := ephemeral.PublicKey()
+	defer pub.Close()
+	ephemeralDER, err := okapi.ExportKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	originator, err := parsePublicKeyInfo(ephemeralDER)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ephemeral.Derive(peer)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(secret)
+	wrap := pkix.AlgorithmIdentifier{Algorithm: oidAES256_Wrap}
+	kek, err := deriveKEK(secret, nil, hash, wrap, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Close()
+	kari := &keyAgreeRecipientInfo{Version: 3}
+	originatorKey, err := asn1.MarshalWithParams(originator, "tag:1")
+	if err != nil {
+		return nil, err
+	}
+	kari.Originator = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: originatorKey}
+	wrapDER, err := asn1.Marshal(wrap)
+	if err != nil {
+		return nil, err
+	}
+	kari.KeyEncryptionAlgorithm = pkix.AlgorithmIdentifier{Algorithm: hash.ecdhOID, Parameters: asn1.RawValue{FullBytes: wrapDER}}
+	rek := recipientEncryptedKey{}
+	if rek.RID, err = id.marshal(true); err != nil {
+		return nil, err
+	}
+	if rek.EncryptedKey, err = kek.Wrap(key); err != nil {
+		return nil, err
+	}
+	kari.RecipientEncryptedKeys = []recipientEncryptedKey{rek}
+	return kari, nil
+}
+
+// deriveKEK derives the key-encryption key with the X9.63 KDF and creates the key wrap from it.
+func deriveKEK(secret, ukm []byte, hash *hashAlgorithm, wrap pkix.AlgorithmIdentifier, size int) (okapi.KeyWrap, error) {
+	info := eccCMSSharedInfo{KeyInfo: wrap, EntityUInfo: ukm, SuppPubInfo: make([]byte, 4)}
+	binary.BigEndian.PutUint32(info.SuppPubInfo, uint32(size*8))
+	sharedInfo, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := okapi.X963KDF{Hash: *hash.spec, SharedInfo: sharedInfo}.Derive(secret, size)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(kek)
+	return okapi.AES_KW.New(kek), nil
+}
+
+// errDecrypt is returned for all failures of the decryption of the key and content,
+// the content is not authenticated, so distinct errors would make Decrypt a padding oracle
+var errDecrypt = errors.New("content decryption failed")
+
+// Decrypt decrypts the DER encoded EnvelopedData (wrapped in ContentInfo) and returns the content.
+// The keys function is called with the identifiers of the recipients until it returns
+// a non-nil PrivateKey. The key must be created with okapi.RSA_OAEP (or okapi.RSA
+// for PKCS#1 v1.5 key transport) for RSA recipients, or with okapi.ECDH for EC recipients.
+// The key remains owned by the caller, Decrypt doesn't close it.
+// Note that the content is not authenticated, a signature must be verified (e.g. with SignedData)
+// to detect modifications. To avoid revealing anything about the plain content, all decryption
+// failures are reported with the same error and a failed key transport decryption continues
+// with a random key (RFC 3218, section 2.3).
+func Decrypt(enveloped []byte, keys func(id Identifier) okapi.PrivateKey) ([]byte, error) {
+	var ed envelopedData
+	if err := unmarshalContentInfo(enveloped, oidEnvelopedData, &ed); err != nil {
+		return nil, err
+	}
+	eci := ed.EncryptedContentInfo
+	var cc *contentCipher
+	for i := range contentCiphers {
+		if contentCiphers[i].oid.Equal(eci.ContentEncryptionAlgorithm.Algorithm) && *contentCiphers[i].spec != nil {
+			cc = &contentCiphers[i]
+		}
+	}
+	if cc == nil {
+		return nil, fmt.Errorf("unsupported content encryption algorithm %v", eci.ContentEncryptionAlgorithm.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != cc.ivSize || len(eci.EncryptedContent) == 0 || len(eci.EncryptedContent)%cc.ivSize != 0 {
+		return nil, errors.New("invalid encrypted content")
+	}
+	var key []byte
+	var err error
+	for _, info := range ed.RecipientInfos {
+		if key, err = openRecipientInfo(info, keys, cc.keySize); key != nil || err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.New("no matching recipient key")
+	}
+	defer okapi.Zero(key)
+	if len(key) != cc.keySize {
+		return nil, errDecrypt
+	}
+	padded := crypt(*cc.spec, key, iv, eci.EncryptedContent, false)
+	padding := unpad(padded, cc.ivSize)
+	if padding == 0 {
+		okapi.Zero(padded)
+		return nil, errDecrypt
+	}
+	return padded[:len(padded)-padding], nil
+}
+
+// unpad returns the size of the PKCS#7 padding, or 0 if the padding is invalid,
+// in constant time with respect to the padding
+func unpad(padded []byte, blockSize int) int {
+	padding := int(padded[len(padded)-1])
+	valid := subtle.ConstantTimeLessOrEq(1, padding) & subtle.ConstantTimeLessOrEq(padding, blockSize)
+	for i := 1; i <= blockSize; i++ {
+		inPadding := subtle.ConstantTimeLessOrEq(i, padding)
+		matches := subtle.ConstantTimeByteEq(padded[len(padded)-i], byte(padding))
+		valid &= subtle.ConstantTimeSelect(inPadding, matches, 1)
+	}
+	return subtle.ConstantTimeSelect(valid, padding, 0)
+}
+
+// openRecipientInfo returns the content encryption key if a key for the recipient is available,
+// unsupported recipient types are skipped. If the key transport decryption fails,
+// it returns a random key of given size, so that the failure is indistinguishable
+// from a content decryption failure.
+func openRecipientInfo(info asn1.RawValue, keys func(id Identifier) okapi.PrivateKey, keySize int) ([]byte, error) {
+	switch {
+	case info.Class == asn1.ClassUniversal && info.Tag == asn1.TagSequence:
+		var ktri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(info.FullBytes, &ktri); err != nil {
+			return nil, err
+		}
+		id, err := unmarshalIdentifier(ktri.RID)
+		if err != nil {
+			return nil, err
+		}
+		algorithm := ktri.KeyEncryptionAlgorithm
+		if !algorithm.Algorithm.Equal(oidRSAEncryption) && !algorithm.Algorithm.Equal(oidRSAES_OAEP) {
+			return nil, fmt.Errorf("unsupported key encryption algorithm %v", algorithm.Algorithm)
+		}
+		if algorithm.Algorithm.Equal(oidRSAES_OAEP) && len(algorithm.Parameters.Bytes) > 0 {
+			return nil, errors.New("only default RSAES-OAEP parameters are supported")
+		}
+		if key := keys(id); key != nil {
+			cek, err := key.Decrypt(ktri.EncryptedKey)
+			if err != nil || len(cek) != keySize {
+				okapi.Zero(cek)
+				return randomKey(keySize)
+			}
+			return cek, nil
+		}
+	case info.Class == asn1.ClassContextSpecific && info.Tag == 1:
+		var kari keyAgreeRecipientInfo
+		if _, err := asn1.UnmarshalWithParams(info.FullBytes, &kari, "tag:1"); err != nil {
+			return nil, err
+		}
+		for _, rek := range kari.RecipientEncryptedKeys {
+			id, err := unmarshalIdentifier(rek.RID)
+			if err != nil {
+				return nil, err
+			}
+			if key := keys(id); key != nil {
+				return kari.open(key, rek.EncryptedKey)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (kari *keyAgreeRecipientInfo) open(key okapi.PrivateKey, encrypted []byte) ([]byte, error) {
+	if okapi.ECDH == nil || okapi.AES_KW == nil {
+		return nil, errors.New("key agreement requires ECDH and AES_KW")
+	}
+	hash, err := hashByOID(kari.KeyEncryptionAlgorithm.Algorithm)
+	if err != nil || !hash.ecdhOID.Equal(kari.KeyEncryptionAlgorithm.Algorithm) {
+		return nil, fmt.Errorf("unsupported key agreement algorithm %v", kari.KeyEncryptionAlgorithm.Algorithm)
+	}
+	var wrap pkix.AlgorithmIdentifier
+	if _, err = asn1.Unmarshal(kari.KeyEncryptionAlgorithm.Parameters.FullBytes, &wrap); err != nil {
+		return nil, err
+	}
+	var size int
+	switch {
+	case wrap.Algorithm.Equal(oidAES128_Wrap):
+		size = 16
+	case wrap.Algorithm.Equal(oidAES192_Wrap):
+		size = 24
+	case wrap.Algorithm.Equal(oidAES256_Wrap):
+		size = 32
+	default:
+		return nil, fmt.Errorf("unsupported key wrap algorithm %v", wrap.Algorithm)
+	}
+	if kari.Originator.Class != asn1.ClassContextSpecific || kari.Originator.Tag != 0 {
+		return nil, errors.New("invalid key agreement originator")
+	}
+	var originator publicKeyInfo
+	if _, err = asn1.UnmarshalWithParams(kari.Originator.Bytes, &originator, "tag:1"); err != nil {
+		return nil, errors.New("only originator public keys are supported")
+	}
+	if len(originator.Algorithm.Parameters.FullBytes) == 0 || originator.Algorithm.Parameters.Tag == asn1.TagNull {
+		// the curve parameters can be omitted, they are the same as for the recipient key
+		pub := key.PublicKey()
+		der, err := okapi.ExportKey(pub)
+		pub.Close()
+		if err != nil {
+			return nil, err
+		}
+		recipient, err := parsePublicKeyInfo(der)
+		if err != nil {
+			return nil, err
+		}
+		originator.Algorithm = recipient.Algorithm
+	}
+	der, err := asn1.Marshal(originator)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := okapi.ECDH(der)
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+	pub := peer.PublicKey()
+	defer pub.Close()
+	secret, err := key.Derive(pub)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(secret)
+	kek, err := deriveKEK(secret, kari.UKM, hash, wrap, size)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Close()
+	cek, err := kek.Unwrap(encrypted)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return cek, nil
+}
+
+// crypt processes the input, which must be a multiple of the block size, with the cipher.
+func crypt(spec okapi.CipherSpec, key, iv, in []byte, encrypt bool) []byte {
+	c := spec.New(key, iv, encrypt)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out
+}
+
+func randomKey(size int) ([]byte, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	key := make([]byte, size)
+	if _, err := random.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,295 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"time"
+)
+
+// Signer describes a signer of SignedData.
+type Signer struct {
+	// Key is the signing key, it must be configured for signing with the Hash,
+	// e.g. created with okapi.RSA_SHA256 or okapi.ECDSA_SHA256 for SHA256.
+	// RSA keys produce PKCS#1 v1.5 signatures, EC keys produce ECDSA signatures.
+	Key okapi.PrivateKey
+	// Hash is the name of the predefined HashSpec variable used for the digests:
+	// SHA1, SHA224, SHA256, SHA384 or SHA512.
+	Hash string
+	// Certificate is the optional DER encoded certificate of the signer.
+	// If provided, it is included in the SignedData and identifies the signer
+	// by its issuer and serial number. Otherwise the signer is identified
+	// by the subject key identifier (see SubjectKeyID).
+	Certificate []byte
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             []asn1.RawValue `asn1:"optional,set,tag:1"`
+	SignerInfos      []signerInfo    `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"optional,explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+func newAttribute(oid asn1.ObjectIdentifier, value interface{}) (attribute, error) {
+	der, err := asn1.Marshal(value)
+	return attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: der}}}, err
+}
+
+// Sign creates DER encoded SignedData (wrapped in ContentInfo) of the content signed by all the signers.
+// If detached is set, the content is not included and must be provided separately to Verify.
+// The signatures cover the signed attributes: content type, signing time and message digest.
+func Sign(content []byte, detached bool, signers ...Signer) ([]byte, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("SignedData requires at least one signer")
+	}
+	sd := signedData{Version: 1, EncapContentInfo: encapsulatedContentInfo{EContentType: oidData}}
+	if !detached {
+		sd.EncapContentInfo.EContent = append([]byte{}, content...)
+	}
+	for _, signer := range signers {
+		hash, err := hashByName(signer.Hash)
+		if err != nil {
+			return nil, err
+		}
+		si, err := newSignerInfo(content, signer, hash)
+		if err != nil {
+			return nil, err
+		}
+		if si.Version == 3 {
+			sd.Version = 3
+		}
+		sd.SignerInfos = append(sd.SignerInfos, *si)
+		if !containsAlgorithm(sd.DigestAlgorithms, hash.oid) {
+			sd.DigestAlgorithms = append(sd.DigestAlgorithms, pkix.AlgorithmIdentifier{Algorithm: hash.oid})
+		}
+		if signer.Certificate != nil {
+			sd.Certificates = append(sd.Certificates, asn1.RawValue{FullBytes: signer.Certificate})
+		}
+	}
+	return marshalContentInfo(oidSignedData, sd)
+}
+
+func newSignerInfo(content []byte, signer Signer, hash *hashAlgorithm) (*signerInfo, error) {
+	pub := signer.Key.PublicKey()
+	defer pub.Close()
+	der, err := okapi.ExportKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parsePublicKeyInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	si := &signerInfo{Version: 1, DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hash.oid}}
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidRSAEncryption):
+		si.SignatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case info.Algorithm.Algorithm.Equal(oidECPublicKey):
+		si.SignatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: hash.ecdsaOID}
+	default:
+		return nil, fmt.Errorf("unsupported signer key algorithm %v", info.Algorithm.Algorithm)
+	}
+	id, err := newIdentifier(pub, signer.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	if id.SubjectKeyID != nil {
+		si.Version = 3
+	}
+	if si.SID, err = id.marshal(false); err != nil {
+		return nil, err
+	}
+	var attributes []attribute
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, time.Now().UTC()},
+		{oidMessageDigest, hash.digest(content)},
+	} {
+		attr, err := newAttribute(a.oid, a.value)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attr)
+	}
+	set, err := asn1.MarshalWithParams(attributes, "set")
+	if err != nil {
+		return nil, err
+	}
+	var raw asn1.RawValue
+	if _, err = asn1.Unmarshal(set, &raw); err != nil {
+		return nil, err
+	}
+	si.SignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes}
+	if si.Signature, err = signer.Key.Sign(hash.digest(set)); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// Verify verifies all signatures of the DER encoded SignedData (wrapped in ContentInfo)
+// and returns the signed content. The content must be provided if the signatures are detached,
+// otherwise it should be nil.
+// The keys function is used to find the public key of each signer, the key can have any configuration,
+// it is only used to obtain the key material. If keys is nil or returns nil,
+// the signer key is taken from the matching certificate included in the SignedData.
+// Note that Verify doesn't validate the included certificates in any way.
+func Verify(signed, content []byte, keys func(id Identifier) okapi.PublicKey) ([]byte, error) {
+	var sd signedData
+	if err := unmarshalContentInfo(signed, oidSignedData, &sd); err != nil {
+		return nil, err
+	}
+	if sd.EncapContentInfo.EContent != nil {
+		if content != nil && !bytes.Equal(content, sd.EncapContentInfo.EContent) {
+			return nil, errors.New("provided content doesn't match the signed content")
+		}
+		content = sd.EncapContentInfo.EContent
+	} else if content == nil {
+		return nil, errors.New("detached signature requires the content")
+	}
+	var certificates []*x509.Certificate
+	for _, raw := range sd.Certificates {
+		// other certificate formats are ignored
+		if certificate, err := x509.ParseCertificate(raw.FullBytes); err == nil {
+			certificates = append(certificates, certificate)
+		}
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, errors.New("SignedData has no signers")
+	}
+	for _, si := range sd.SignerInfos {
+		id, err := unmarshalIdentifier(si.SID)
+		if err != nil {
+			return nil, err
+		}
+		key, err := signerKey(id, keys, certificates)
+		if err != nil {
+			return nil, err
+		}
+		if err = si.verify(content, sd.EncapContentInfo.EContentType, key); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+func signerKey(id Identifier, keys func(id Identifier) okapi.PublicKey, certificates []*x509.Certificate) ([]byte, error) {
+	if keys != nil {
+		if key := keys(id); key != nil {
+			return okapi.ExportKey(key)
+		}
+	}
+	for _, certificate := range certificates {
+		if id.Matches(certificate) {
+			return certificate.RawSubjectPublicKeyInfo, nil
+		}
+	}
+	return nil, errors.New("signer key not found")
+}
+
+func (si *signerInfo) verify(content []byte, contentType asn1.ObjectIdentifier, der []byte) error {
+	hash, err := hashByOID(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	digest := hash.digest(content)
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+		if err != nil {
+			return err
+		}
+		var attributes []attribute
+		if _, err = asn1.UnmarshalWithParams(set, &attributes, "set"); err != nil {
+			return err
+		}
+		var messageDigest []byte
+		var signedType asn1.ObjectIdentifier
+		for _, attr := range attributes {
+			if len(attr.Values) != 1 {
+				continue
+			}
+			if attr.Type.Equal(oidMessageDigest) {
+				asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest)
+			} else if attr.Type.Equal(oidContentType) {
+				asn1.Unmarshal(attr.Values[0].FullBytes, &signedType)
+			}
+		}
+		if subtle.ConstantTimeCompare(messageDigest, digest) != 1 {
+			return errors.New("message digest mismatch")
+		}
+		if !signedType.Equal(contentType) {
+			return errors.New("content type mismatch")
+		}
+		digest = hash.digest(set)
+	}
+	info, err := parsePublicKeyInfo(der)
+	if err != nil {
+		return err
+	}
+	algorithm := si.SignatureAlgorithm.Algorithm
+	var constructor okapi.KeyConstructor
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidRSAEncryption) && (algorithm.Equal(oidRSAEncryption) || algorithm.Equal(hash.rsaOID)):
+		constructor = *hash.rsa
+	case info.Algorithm.Algorithm.Equal(oidECPublicKey) && algorithm.Equal(hash.ecdsaOID):
+		constructor = *hash.ecdsa
+	default:
+		return fmt.Errorf("unsupported signature algorithm %v", algorithm)
+	}
+	if constructor == nil {
+		return fmt.Errorf("signature algorithm %v is not available", algorithm)
+	}
+	key, err := constructor(der)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	pub := key.PublicKey()
+	defer pub.Close()
+	valid, err := pub.Verify(si.Signature, digest)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func containsAlgorithm(algorithms []pkix.AlgorithmIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, algorithm := range algorithms {
+		if algorithm.Algorithm.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package okapi
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Shared building blocks of the encrypted containers (PasswordWriter, EnvelopeWriter).
+// A container consists of a header describing the encryption parameters and ending with
+// an HMAC of the header, followed by data encrypted with a stream cipher mode
+// and terminated by an HMAC of the header and the encrypted data.
+
+// containerCipher describes the iv size and the valid key sizes (from minKey to maxKey by keyStep) of a cipher
+type containerCipher struct {
+	spec                    *CipherSpec
+	ivSize                  int
+	minKey, maxKey, keyStep int
+}
+
+var containerCiphers = map[string]containerCipher{
+	"AES_CTR":  {&AES_CTR, 16, 16, 32, 8},
+	"AES_OFB":  {&AES_OFB, 16, 16, 32, 8},
+	"AES_CFB":  {&AES_CFB, 16, 16, 32, 8},
+	"DES3_OFB": {&DES3_OFB, 8, 24, 24, 1},
+	"DES3_CFB": {&DES3_CFB, 8, 24, 24, 1},
+	"BF_OFB":   {&BF_OFB, 8, 4, 56, 1},
+	"BF_CFB":   {&BF_CFB, 8, 4, 56, 1},
+}
+
+// checkKey returns an error if the cipher doesn't accept keys of given size in bytes or ivs of given size
+func (c containerCipher) checkKey(keySize, ivSize int) error {
+	if keySize < c.minKey || keySize > c.maxKey || (keySize-c.minKey)%c.keyStep != 0 {
+		return fmt.Errorf("invalid container key size %d", keySize)
+	}
+	if ivSize != c.ivSize {
+		return fmt.Errorf("invalid container iv size %d", ivSize)
+	}
+	return nil
+}
+
+var containerHashes = map[string]*HashSpec{
+	"SHA1":   &SHA1,
+	"SHA224": &SHA224,
+	"SHA256": &SHA256,
+	"SHA384": &SHA384,
+	"SHA512": &SHA512,
+}
+
+func containerSpecs(cipherName, hashName string) (cipher containerCipher, hash HashSpec, err error) {
+	cipher, ok := containerCiphers[cipherName]
+	if !ok || *cipher.spec == nil {
+		return cipher, nil, fmt.Errorf("unsupported container cipher %s", cipherName)
+	}
+	spec, ok := containerHashes[hashName]
+	if !ok || *spec == nil {
+		return cipher, nil, fmt.Errorf("unsupported container hash %s", hashName)
+	}
+	return cipher, *spec, nil
+}
+
+func hashSize(spec HashSpec) int {
+	hash := spec.New()
+	defer hash.Close()
+	return hash.Size()
+}
+
+// newContainerWriter appends the header check to the header and writes it into the output.
+// The returned CipherWriter encrypts the data and appends the trailing HMAC when closed.
+func newContainerWriter(out io.Writer, header *bytes.Buffer, mac Hash, cipher containerCipher, key, iv, buffer []byte) (*CipherWriter, error) {
+	mac.Write(header.Bytes())
+	header.Write(mac.Digest())
+	mac.Reset()
+	output := &macWriter{output: out, mac: mac}
+	if _, err := output.Write(header.Bytes()); err != nil {
+		mac.Close()
+		return nil, err
+	}
+	w := NewCipherWriter(output, *cipher.spec, key, iv, buffer)
+	if w.cipher.BlockSize() != 1 {
+		w.cipher.Close()
+		mac.Close()
+		return nil, errors.New("container cipher requires padding")
+	}
+	return w, nil
+}
+
+// newContainerReader reads and verifies the header check, returning errCheck if it doesn't match.
+// The returned CipherReader decrypts the data and verifies the trailing HMAC when closed.
+func newContainerReader(in io.Reader, header *headerReader, mac Hash, cipher containerCipher, key, iv, buffer []byte, errCheck error) (*CipherReader, error) {
+	mac.Write(header.bytes)
+	check := mac.Digest()
+	if subtle.ConstantTimeCompare(check, header.read(len(check))) != 1 {
+		mac.Close()
+		if header.err != nil {
+			return nil, header.err
+		}
+		return nil, errCheck
+	}
+	mac.Reset()
+	mac.Write(header.bytes)
+	input := &macReader{input: in, mac: mac, buffer: make([]byte, mac.Size()+DefaultBufferSize)}
+	return NewCipherReader(input, *cipher.spec, key, iv, buffer), nil
+}
+
+func writeField(out *bytes.Buffer, field []byte) {
+	out.WriteByte(byte(len(field)))
+	out.Write(field)
+}
+
+func writeLongField(out *bytes.Buffer, field []byte) {
+	binary.Write(out, binary.BigEndian, uint16(len(field)))
+	out.Write(field)
+}
+
+// headerReader reads header fields from the underlying Reader and keeps the bytes read.
+// It records the first error encountered, after that all reads return zero filled slices.
+type headerReader struct {
+	input io.Reader
+	bytes []byte
+	err   error
+}
+
+func (r *headerReader) read(size int) []byte {
+	b := make([]byte, size)
+	if r.err != nil {
+		return b
+	}
+	if _, r.err = io.ReadFull(r.input, b); r.err != nil {
+		if r.err == io.EOF {
+			r.err = io.ErrUnexpectedEOF
+		}
+		return b
+	}
+	r.bytes = append(r.bytes, b...)
+	return b
+}
+
+func (r *headerReader) field() []byte {
+	return r.read(int(r.read(1)[0]))
+}
+
+func (r *headerReader) longField() []byte {
+	return r.read(int(binary.BigEndian.Uint16(r.read(2))))
+}
+
+// macWriter writes into the underlying Writer and computes a MAC of everything written.
+// When closed, it appends the MAC digest and closes the underlying Writer if it is a Closer.
+type macWriter struct {
+	output io.Writer
+	mac    Hash
+}
+
+func (w *macWriter) Write(in []byte) (int, error) {
+	if len(in) == 0 {
+		return 0, nil
+	}
+	w.mac.Write(in)
+	return w.output.Write(in)
+}
+
+func (w *macWriter) Close() error {
+	defer w.mac.Close()
+	if _, err := w.output.Write(w.mac.Digest()); err != nil {
+		return err
+	}
+	if closer, ok := w.output.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// macReader reads from the underlying Reader and computes a MAC of everything read,
+// except the trailing MAC digest, which is held back.
+// When closed, it reads any remaining input and verifies the trailing MAC digest,
+// then closes the underlying Reader if it is a Closer.
+type macReader struct {
+	input   io.Reader
+	mac     Hash
+	buffer  []byte
+	pending []byte // unprocessed part of buffer
+	eof     bool
+}
+
+func (r *macReader) Read(out []byte) (int, error) {
+	size := r.mac.Size()
+	for len(out) > 0 {
+		if len(r.pending) > size {
+			n := copy(out, r.pending[:len(r.pending)-size])
+			r.mac.Write(r.pending[:n])
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+		if r.eof {
+			return 0, io.EOF
+		}
+		kept := copy(r.buffer, r.pending)
+		read, err := r.input.Read(r.buffer[kept:])
+		r.pending = r.buffer[:kept+read]
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func (r *macReader) Close() error {
+	defer r.mac.Close()
+	discard := make([]byte, 1024)
+	for {
+		_, err := r.Read(discard)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if subtle.ConstantTimeCompare(r.pending, r.mac.Digest()) != 1 {
+		return errors.New("container integrity check failed")
+	}
+	if closer, ok := r.input.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,570 @@
+package okapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DRBG is a deterministic random bit generator as specified in NIST SP 800-90A.
+// It is seeded from an entropy source when it is instantiated (created by its RandomSpec)
+// and can be explicitly reseeded. Read generates output without additional input,
+// splitting reads larger than MaxDRBGRequest into multiple requests.
+type DRBG interface {
+	Random
+	// Generate fills the out slice with pseudo-random bytes, mixing the optional additional input into the state.
+	// It reseeds first if prediction resistance is enabled or the reseed interval was reached.
+	// A single request can generate at most MaxDRBGRequest bytes.
+	Generate(out, additionalInput []byte) error
+	// Reseed mixes fresh input from the entropy source and the optional additional input into the state.
+	Reseed(additionalInput []byte) error
+}
+
+const (
+	// MaxDRBGRequest is the maximum number of bytes generated by a single DRBG request (2^19 bits).
+	MaxDRBGRequest = 1 << 16
+	// maxReseedInterval is the maximum number of requests between reseeds (2^48).
+	maxReseedInterval = 1 << 48
+)
+
+// HMAC_DRBG is the HMAC based DRBG (SP 800-90A, section 10.1.2) using HMAC with the configured Hash.
+// It is implemented generically using the HMAC MACSpec of imported implementations.
+// Its security strength is 128 bits with SHA1, 192 bits with SHA224 and 256 bits with larger hashes.
+// New panics if the DRBG cannot be instantiated, e.g. if the entropy source fails.
+type HMAC_DRBG struct {
+	Hash HashSpec
+	// Entropy is the entropy source, defaults to DefaultRandom.
+	Entropy RandomSpec
+	// Nonce is used in instantiation, if empty half of the security strength
+	// worth of additional bytes is read from the entropy source instead.
+	Nonce []byte
+	// Personalization is the optional personalization string.
+	Personalization []byte
+	// PredictionResistance makes every Generate request reseed first.
+	PredictionResistance bool
+	// ReseedInterval is the number of Generate requests between automatic reseeds, defaults to 2^48.
+	ReseedInterval uint64
+}
+
+func (spec HMAC_DRBG) New() Random {
+	size := hashSize(spec.Hash)
+	d := &hmacDRBG{hash: spec.Hash, k: make([]byte, size), v: bytes.Repeat([]byte{1}, size)}
+	strength := hashStrength(size)
+	return newDRBG(d, drbgConfig{
+		name:                 "HMAC_DRBG",
+		entropySize:          strength,
+		nonceSize:            strength / 2,
+		entropy:              spec.Entropy,
+		nonce:                spec.Nonce,
+		personalization:      spec.Personalization,
+		predictionResistance: spec.PredictionResistance,
+		reseedInterval:       spec.ReseedInterval,
+	})
+}
+
+// Hash_DRBG is the hash function based DRBG (SP 800-90A, section 10.1.1) using the configured Hash.
+// It is implemented generically using the HashSpec of imported implementations.
+// Its security strength is 128 bits with SHA1, 192 bits with SHA224 and 256 bits with larger hashes.
+// New panics if the DRBG cannot be instantiated, e.g. if the entropy source fails.
+type Hash_DRBG struct {
+	Hash HashSpec
+	// Entropy is the entropy source, defaults to DefaultRandom.
+	Entropy RandomSpec
+	// Nonce is used in instantiation, if empty half of the security strength
+	// worth of additional bytes is read from the entropy source instead.
+	Nonce []byte
+	// Personalization is the optional personalization string.
+	Personalization []byte
+	// PredictionResistance makes every Generate request reseed first.
+	PredictionResistance bool
+	// ReseedInterval is the number of Generate requests between automatic reseeds, defaults to 2^48.
+	ReseedInterval uint64
+}
+
+func (spec Hash_DRBG) New() Random {
+	size := hashSize(spec.Hash)
+	// seedlen is 440 bits for hashes up to 256 bits and 888 bits for larger ones (table 2)
+	seedSize := 55
+	if size > 32 {
+		seedSize = 111
+	}
+	d := &hashDRBG{hash: spec.Hash.New(), seedSize: seedSize}
+	strength := hashStrength(size)
+	return newDRBG(d, drbgConfig{
+		name:                 "Hash_DRBG",
+		entropySize:          strength,
+		nonceSize:            strength / 2,
+		entropy:              spec.Entropy,
+		nonce:                spec.Nonce,
+		personalization:      spec.Personalization,
+		predictionResistance: spec.PredictionResistance,
+		reseedInterval:       spec.ReseedInterval,
+	})
+}
+
+// CTR_DRBG is the block cipher based DRBG (SP 800-90A, section 10.2.1) using AES with the configured KeySize.
+// It is implemented generically using the AES_CTR and AES_CBC CipherSpecs of imported implementations.
+// Its security strength is the AES key size.
+// New panics if the DRBG cannot be instantiated, e.g. if the entropy source fails.
+type CTR_DRBG struct {
+	// KeySize is the AES key size in bytes (16, 24 or 32).
+	KeySize int
+	// NoDerivationFunction disables the block cipher derivation function.
+	// The entropy input is then the full seed length (key size + 16 bytes),
+	// the nonce is not used and the personalization string and additional inputs
+	// must not be longer than the seed length.
+	NoDerivationFunction bool
+	// Entropy is the entropy source, defaults to DefaultRandom.
+	Entropy RandomSpec
+	// Nonce is used in instantiation, if empty half of the security strength
+	// worth of additional bytes is read from the entropy source instead.
+	Nonce []byte
+	// Personalization is the optional personalization string.
+	Personalization []byte
+	// PredictionResistance makes every Generate request reseed first.
+	PredictionResistance bool
+	// ReseedInterval is the number of Generate requests between automatic reseeds, defaults to 2^48.
+	ReseedInterval uint64
+}
+
+func (spec CTR_DRBG) New() Random {
+	if spec.KeySize != 16 && spec.KeySize != 24 && spec.KeySize != 32 {
+		panic(fmt.Sprintf("Invalid CTR_DRBG key size: %d", spec.KeySize))
+	}
+	d := &ctrDRBG{key: make([]byte, spec.KeySize), v: make([]byte, 16), df: !spec.NoDerivationFunction}
+	config := drbgConfig{
+		name:                 "CTR_DRBG",
+		entropySize:          spec.KeySize,
+		nonceSize:            spec.KeySize / 2,
+		entropy:              spec.Entropy,
+		nonce:                spec.Nonce,
+		personalization:      spec.Personalization,
+		predictionResistance: spec.PredictionResistance,
+		reseedInterval:       spec.ReseedInterval,
+	}
+	if spec.NoDerivationFunction {
+		config.entropySize, config.nonceSize, config.nonce = d.seedSize(), 0, nil
+	}
+	return newDRBG(d, config)
+}
+
+// drbgMechanism is the DRBG algorithm specific part of a DRBG.
+type drbgMechanism interface {
+	instantiate(entropy, nonce, personalization []byte) error
+	reseed(entropy, additionalInput []byte) error
+	generate(out, additionalInput []byte, counter uint64) error
+	close()
+}
+
+type drbgConfig struct {
+	name                   string
+	entropySize, nonceSize int
+	entropy                RandomSpec
+	nonce, personalization []byte
+	predictionResistance   bool
+	reseedInterval         uint64
+}
+
+// drbg implements the DRBG functions common to all mechanisms (SP 800-90A, section 9).
+type drbg struct {
+	mechanism            drbgMechanism
+	source               Random
+	entropySize          int
+	counter, interval    uint64
+	predictionResistance bool
+	tracked              *tracked
+}
+
+func newDRBG(mechanism drbgMechanism, config drbgConfig) *drbg {
+	d := &drbg{
+		mechanism:            mechanism,
+		entropySize:          config.entropySize,
+		counter:              1,
+		interval:             config.reseedInterval,
+		predictionResistance: config.predictionResistance,
+	}
+	if d.interval == 0 || d.interval > maxReseedInterval {
+		d.interval = maxReseedInterval
+	}
+	if config.entropy == nil {
+		config.entropy = DefaultRandom
+	}
+	d.tracked = track("Random", config.name)
+	finalize(d.tracked, d, (*drbg).Close)
+	d.source = config.entropy.New()
+	size := d.entropySize
+	if len(config.nonce) == 0 {
+		size += config.nonceSize
+	}
+	entropy, err := d.entropy(size)
+	if err == nil {
+		defer Zero(entropy)
+		nonce := config.nonce
+		if len(nonce) == 0 {
+			entropy, nonce = entropy[:d.entropySize], entropy[d.entropySize:]
+		}
+		err = mechanism.instantiate(entropy, nonce, config.personalization)
+	}
+	if err != nil {
+		d.Close()
+		panic(err)
+	}
+	return d
+}
+
+func (d *drbg) entropy(size int) ([]byte, error) {
+	entropy := make([]byte, size)
+	if _, err := io.ReadFull(d.source, entropy); err != nil {
+		return nil, fmt.Errorf("DRBG entropy source failed: %s", err)
+	}
+	return entropy, nil
+}
+
+func (d *drbg) Reseed(additionalInput []byte) error {
+	entropy, err := d.entropy(d.entropySize)
+	if err != nil {
+		return err
+	}
+	defer Zero(entropy)
+	if err = d.mechanism.reseed(entropy, additionalInput); err != nil {
+		return err
+	}
+	d.counter = 1
+	return nil
+}
+
+func (d *drbg) Generate(out, additionalInput []byte) error {
+	if len(out) > MaxDRBGRequest {
+		return errors.New("DRBG request too large")
+	}
+	if d.predictionResistance || d.counter > d.interval {
+		if err := d.Reseed(additionalInput); err != nil {
+			return err
+		}
+		additionalInput = nil
+	}
+	if err := d.mechanism.generate(out, additionalInput, d.counter); err != nil {
+		return err
+	}
+	d.counter++
+	return nil
+}
+
+func (d *drbg) Read(b []byte) (int, error) {
+	for i := 0; i < len(b); i += MaxDRBGRequest {
+		end := i + MaxDRBGRequest
+		if end > len(b) {
+			end = len(b)
+		}
+		if err := d.Generate(b[i:end], nil); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+func (d *drbg) Close() {
+	if d.source == nil {
+		return
+	}
+	d.tracked.untrack()
+	d.mechanism.close()
+	d.source.Close()
+	d.source = nil
+}
+
+// hashStrength returns the DRBG security strength in bytes for the hash size (SP 800-57, table 3)
+func hashStrength(size int) int {
+	switch {
+	case size < 20:
+		panic(fmt.Sprintf("Hash size %d is too small for a DRBG", size))
+	case size < 28:
+		return 16
+	case size < 32:
+		return 24
+	}
+	return 32
+}
+
+// add adds y to x modulo 2^(8*len(x)), y must not be longer than x
+func add(x, y []byte) {
+	carry := 0
+	for i, j := len(x)-1, len(y)-1; i >= 0; i, j = i-1, j-1 {
+		carry += int(x[i])
+		if j >= 0 {
+			carry += int(y[j])
+		}
+		x[i] = byte(carry)
+		carry >>= 8
+	}
+}
+
+type hmacDRBG struct {
+	hash HashSpec
+	k, v []byte
+}
+
+// update is HMAC_DRBG_Update, the provided data is the concatenation of the slices
+func (d *hmacDRBG) update(provided ...[]byte) {
+	empty := true
+	for _, p := range provided {
+		empty = empty && len(p) == 0
+	}
+	for _, b := range []byte{0, 1} {
+		mac := HMAC.New(d.hash, d.k)
+		mac.Write(d.v)
+		mac.Write([]byte{b})
+		for _, p := range provided {
+			mac.Write(p)
+		}
+		k := append([]byte(nil), mac.Digest()...)
+		mac.Close()
+		Zero(d.k)
+		d.k = k
+		mac = HMAC.New(d.hash, d.k)
+		mac.Write(d.v)
+		copy(d.v, mac.Digest())
+		mac.Close()
+		if empty {
+			return
+		}
+	}
+}
+
+func (d *hmacDRBG) instantiate(entropy, nonce, personalization []byte) error {
+	d.update(entropy, nonce, personalization)
+	return nil
+}
+
+func (d *hmacDRBG) reseed(entropy, additionalInput []byte) error {
+	d.update(entropy, additionalInput)
+	return nil
+}
+
+func (d *hmacDRBG) generate(out, additionalInput []byte, counter uint64) error {
+	if len(additionalInput) > 0 {
+		d.update(additionalInput)
+	}
+	mac := HMAC.New(d.hash, d.k)
+	for i := 0; i < len(out); {
+		mac.Reset()
+		mac.Write(d.v)
+		copy(d.v, mac.Digest())
+		i += copy(out[i:], d.v)
+	}
+	mac.Close()
+	d.update(additionalInput)
+	return nil
+}
+
+func (d *hmacDRBG) close() {
+	Zero(d.k)
+	Zero(d.v)
+}
+
+type hashDRBG struct {
+	hash     Hash
+	seedSize int
+	v, c     []byte
+}
+
+func (d *hashDRBG) digest(inputs ...[]byte) []byte {
+	d.hash.Reset()
+	for _, input := range inputs {
+		d.hash.Write(input)
+	}
+	return append([]byte(nil), d.hash.Digest()...)
+}
+
+// derive is the Hash_df derivation function producing seed size bytes
+func (d *hashDRBG) derive(inputs ...[]byte) []byte {
+	out := make([]byte, 0, d.seedSize+d.hash.Size())
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(d.seedSize*8))
+	for counter := byte(1); len(out) < d.seedSize; counter++ {
+		prefix[0] = counter
+		out = append(out, d.digest(append([][]byte{prefix}, inputs...)...)...)
+	}
+	Zero(out[d.seedSize:])
+	return out[:d.seedSize]
+}
+
+func (d *hashDRBG) instantiate(entropy, nonce, personalization []byte) error {
+	d.v = d.derive(entropy, nonce, personalization)
+	d.c = d.derive([]byte{0}, d.v)
+	return nil
+}
+
+func (d *hashDRBG) reseed(entropy, additionalInput []byte) error {
+	v := d.derive([]byte{1}, d.v, entropy, additionalInput)
+	Zero(d.v)
+	Zero(d.c)
+	d.v, d.c = v, d.derive([]byte{0}, v)
+	return nil
+}
+
+func (d *hashDRBG) generate(out, additionalInput []byte, counter uint64) error {
+	if len(additionalInput) > 0 {
+		add(d.v, d.digest([]byte{2}, d.v, additionalInput))
+	}
+	// Hashgen
+	data := append([]byte(nil), d.v...)
+	for i := 0; i < len(out); {
+		i += copy(out[i:], d.digest(data))
+		add(data, []byte{1})
+	}
+	Zero(data)
+	add(d.v, d.digest([]byte{3}, d.v))
+	add(d.v, d.c)
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, counter)
+	add(d.v, count)
+	return nil
+}
+
+func (d *hashDRBG) close() {
+	Zero(d.v)
+	Zero(d.c)
+	d.hash.Close()
+}
+
+type ctrDRBG struct {
+	key, v []byte
+	df     bool
+}
+
+func (d *ctrDRBG) seedSize() int {
+	return len(d.key) + 16
+}
+
+// keystream fills out with encrypted successive increments of V and advances V accordingly
+func (d *ctrDRBG) keystream(out []byte) {
+	iv := append([]byte(nil), d.v...)
+	add(iv, []byte{1})
+	Zero(out)
+	c := AES_CTR.New(d.key, iv, true)
+	c.Update(out, out)
+	c.Close()
+	blocks := make([]byte, 8)
+	binary.BigEndian.PutUint64(blocks, uint64((len(out)+15)/16))
+	add(d.v, blocks)
+}
+
+// update is CTR_DRBG_Update, provided data must be either empty or seed size bytes
+func (d *ctrDRBG) update(provided []byte) {
+	temp := make([]byte, d.seedSize())
+	d.keystream(temp)
+	for i := range provided {
+		temp[i] ^= provided[i]
+	}
+	Zero(d.key)
+	copy(d.key, temp)
+	copy(d.v, temp[len(d.key):])
+	Zero(temp)
+}
+
+// derive is the Block_Cipher_df derivation function producing seed size bytes
+func (d *ctrDRBG) derive(inputs ...[]byte) []byte {
+	// IV || L || N || input || 0x80 || padding
+	block := make([]byte, 24, 64)
+	for _, input := range inputs {
+		block = append(block, input...)
+	}
+	binary.BigEndian.PutUint32(block[16:], uint32(len(block)-24))
+	binary.BigEndian.PutUint32(block[20:], uint32(d.seedSize()))
+	block = append(block, 0x80)
+	for len(block)%16 != 0 {
+		block = append(block, 0)
+	}
+	defer Zero(block)
+	key := make([]byte, len(d.key))
+	for i := range key {
+		key[i] = byte(i)
+	}
+	// BCC is CBC-MAC, i.e. the last block of CBC encryption with zero IV
+	temp := make([]byte, 0, d.seedSize()+16)
+	for i := uint32(0); len(temp) < d.seedSize(); i++ {
+		binary.BigEndian.PutUint32(block, i)
+		encrypted := encryptCBC(key, make([]byte, 16), block)
+		temp = append(temp, encrypted[len(encrypted)-16:]...)
+		Zero(encrypted)
+	}
+	defer Zero(temp)
+	// successive encryptions of X are CBC encryption of zeros with X as the IV
+	out := encryptCBC(temp[:len(d.key)], temp[len(d.key):len(d.key)+16], make([]byte, (d.seedSize()+15)/16*16))
+	Zero(out[d.seedSize():])
+	return out[:d.seedSize()]
+}
+
+func encryptCBC(key, iv, in []byte) []byte {
+	c := AES_CBC.New(key, iv, true)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out
+}
+
+// input returns the seed size input, derived or padded depending on the derivation function use
+func (d *ctrDRBG) input(inputs ...[]byte) ([]byte, error) {
+	if d.df {
+		return d.derive(inputs...), nil
+	}
+	seed := make([]byte, d.seedSize())
+	for _, input := range inputs {
+		if len(input) > len(seed) {
+			return nil, errors.New("CTR_DRBG input longer than seed length")
+		}
+		for i := range input {
+			seed[i] ^= input[i]
+		}
+	}
+	return seed, nil
+}
+
+func (d *ctrDRBG) instantiate(entropy, nonce, personalization []byte) error {
+	var seed []byte
+	var err error
+	if d.df {
+		seed, err = d.input(entropy, nonce, personalization)
+	} else {
+		seed, err = d.input(entropy, personalization)
+	}
+	if err != nil {
+		return err
+	}
+	d.update(seed)
+	Zero(seed)
+	return nil
+}
+
+func (d *ctrDRBG) reseed(entropy, additionalInput []byte) error {
+	seed, err := d.input(entropy, additionalInput)
+	if err != nil {
+		return err
+	}
+	d.update(seed)
+	Zero(seed)
+	return nil
+}
+
+func (d *ctrDRBG) generate(out, additionalInput []byte, counter uint64) error {
+	var input []byte
+	if len(additionalInput) > 0 {
+		var err error
+		if input, err = d.input(additionalInput); err != nil {
+			return err
+		}
+		d.update(input)
+	}
+	d.keystream(out)
+	d.update(input)
+	return nil
+}
+
+func (d *ctrDRBG) close() {
+	Zero(d.key)
+	Zero(d.v)
+}
@@ -0,0 +1,383 @@
+package okapi
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+EnvelopeWriter and EnvelopeReader implement public key encryption of a stream for multiple recipients.
+The data is encrypted with a random content key and each recipient gets a copy
+of the content key encrypted with their public key, depending on the key type:
+* RSA keys: the content key is encrypted with RSA_OAEP (key transport)
+* EC keys: ephemeral-static ECDH, the shared secret is fed through HKDF to derive
+a key-encryption key, which wraps the content key with AES_KWP (key agreement)
+
+The envelope header has the following format:
+
+	magic      "OKEV"
+	version    1 byte
+	cipher     name of the predefined CipherSpec (1 byte length + bytes), e.g. "AES_CTR"
+	key size   1 byte
+	iv         1 byte length + bytes
+	hash       name of the predefined HashSpec (1 byte length + bytes), e.g. "SHA256"
+	recipients 1 byte count, followed by the recipient records:
+		type       1 byte, 1 = key transport, 2 = key agreement
+		key id     1 byte length + bytes, see EnvelopeKeyID
+		ephemeral  2 byte length + bytes, ephemeral ECDH public key (key agreement only)
+		key        2 byte length + bytes, encrypted or wrapped content key
+	check      HMAC of the preceding header bytes
+
+The header is followed by the encrypted data and the envelope ends with an HMAC
+of the header and the encrypted data, the same way as the password container.
+The content key consists of the encryption key followed by the HMAC key.
+The key agreement KEK is derived with HKDF using the configured hash,
+no salt and the recipient key id as the info.
+*/
+
+// EnvelopeParameters configure the encryption performed by EnvelopeWriter.
+type EnvelopeParameters struct {
+	// Cipher is the name of the predefined CipherSpec variable used for encryption.
+	// Only modes that don't require padding are supported: AES_CTR, AES_OFB, AES_CFB,
+	// DES3_OFB, DES3_CFB, BF_OFB and BF_CFB.
+	Cipher string
+	// KeySize is the size of the encryption key in bytes, it must be valid for the cipher
+	// (16, 24 or 32 for AES, 24 for DES3, 4 to 56 for BF).
+	KeySize int
+	// Hash is the name of the predefined HashSpec variable used by HMAC and HKDF:
+	// SHA1, SHA224, SHA256, SHA384 or SHA512.
+	Hash string
+	// Random generates the content key, iv and ephemeral ECDH keys and it is used
+	// for the RSA_OAEP padding, if nil DefaultRandom is used. It remains owned by the caller.
+	Random Random
+}
+
+// DefaultEnvelopeParameters are used by NewEnvelopeWriter if parameters are not provided.
+var DefaultEnvelopeParameters = EnvelopeParameters{
+	Cipher:  "AES_CTR",
+	KeySize: 32,
+	Hash:    "SHA256",
+}
+
+const (
+	envelopeMagic        = "OKEV"
+	envelopeVersion      = 1
+	envelopeKeyTransport = 1
+	envelopeKeyAgreement = 2
+	envelopeKEKSize      = 32
+)
+
+var errEnvelope = errors.New("corrupted envelope header")
+
+// EnvelopeKeyID returns the identifier of the recipient key used in envelope headers.
+// It is the SHA256 digest of the X.509 DER encoding of the key (see Exporter).
+func EnvelopeKeyID(key PublicKey) ([]byte, error) {
+	der, err := ExportKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return envelopeKeyID(der), nil
+}
+
+// EnvelopeWriter encrypts written bytes with a random content key and writes them
+// into the underlying Writer, preceded by a header with the content key encrypted
+// for each recipient.
+// EnvelopeWriter MUST be closed before it's discarded.
+type EnvelopeWriter struct {
+	cipher *CipherWriter
+}
+
+// NewEnvelopeWriter writes the envelope header for the recipients into the provided Writer
+// and creates an EnvelopeWriter wrapped around it. The recipients must be RSA or EC keys,
+// RSA keys are always used with RSA_OAEP and EC keys with ECDH regardless of their configured purpose.
+// The content key, iv and ephemeral ECDH keys are generated with the Random of the parameters or DefaultRandom.
+// If parameters are nil, DefaultEnvelopeParameters are used.
+// The optional buffer is used internally. If buffer is not provided,
+// it will be created with DefaultBufferSize.
+func NewEnvelopeWriter(out io.Writer, recipients []PublicKey, parameters *EnvelopeParameters, buffer []byte) (*EnvelopeWriter, error) {
+	if parameters == nil {
+		parameters = &DefaultEnvelopeParameters
+	}
+	if len(recipients) == 0 || len(recipients) > 255 {
+		return nil, errors.New("envelope requires 1 to 255 recipients")
+	}
+	cipher, hash, err := containerSpecs(parameters.Cipher, parameters.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := cipher.checkKey(parameters.KeySize, cipher.ivSize); err != nil {
+		return nil, err
+	}
+	keys := make([]byte, parameters.KeySize+hashSize(hash))
+	defer Zero(keys)
+	iv := make([]byte, cipher.ivSize)
+	random := parameters.Random
+	if random == nil {
+		random = DefaultRandom.New()
+		defer random.Close()
+	}
+	if _, err = random.Read(keys); err != nil {
+		return nil, err
+	}
+	if _, err = random.Read(iv); err != nil {
+		return nil, err
+	}
+	header := new(bytes.Buffer)
+	header.WriteString(envelopeMagic)
+	header.WriteByte(envelopeVersion)
+	writeField(header, []byte(parameters.Cipher))
+	header.WriteByte(byte(parameters.KeySize))
+	writeField(header, iv)
+	writeField(header, []byte(parameters.Hash))
+	header.WriteByte(byte(len(recipients)))
+	for _, recipient := range recipients {
+		if err = writeRecipient(header, recipient, keys, hash, parameters.Random); err != nil {
+			return nil, err
+		}
+	}
+	mac := HMAC.New(hash, keys[parameters.KeySize:])
+	w, err := newContainerWriter(out, header, mac, cipher, keys[:parameters.KeySize], iv, buffer)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvelopeWriter{cipher: w}, nil
+}
+
+// Write encrypts bytes from the provided slice and writes the encrypted bytes into the underlying writer.
+func (w *EnvelopeWriter) Write(in []byte) (int, error) {
+	return w.cipher.Write(in)
+}
+
+// Close finishes the encryption and writes the trailing HMAC into the underlying Writer.
+// Then it releases associated resources.
+// If the underlying Writer is a Closer, it will close it as well.
+func (w *EnvelopeWriter) Close() error {
+	return w.cipher.Close()
+}
+
+// EnvelopeReader decrypts bytes read from the underlying Reader with the content key
+// recovered from the envelope header using the private key of one of the recipients.
+// Note that the integrity of the decrypted bytes is verified by Close,
+// so the decrypted bytes must not be trusted before Close returns successfully.
+// EnvelopeReader MUST be closed before it's discarded.
+type EnvelopeReader struct {
+	cipher *CipherReader
+}
+
+// NewEnvelopeReader reads the envelope header from the provided Reader and creates
+// an EnvelopeReader wrapped around it. The keys function is called with the key id (see EnvelopeKeyID)
+// of each recipient listed in the header until it returns a non-nil PrivateKey.
+// The private key must be created with RSA_OAEP or ECDH, matching the type of the key.
+// The key remains owned by the caller, EnvelopeReader doesn't close it.
+// The optional buffer is used internally. If buffer is not provided,
+// it will be created with DefaultBufferSize.
+func NewEnvelopeReader(in io.Reader, keys func(id []byte) PrivateKey, buffer []byte) (*EnvelopeReader, error) {
+	header := &headerReader{input: in}
+	magic := header.read(len(envelopeMagic))
+	version := header.read(1)
+	if header.err != nil {
+		return nil, header.err
+	}
+	if string(magic) != envelopeMagic {
+		return nil, errors.New("invalid envelope")
+	}
+	if version[0] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", version[0])
+	}
+	cipherName := string(header.field())
+	keySize := int(header.read(1)[0])
+	iv := header.field()
+	hashName := string(header.field())
+	count := int(header.read(1)[0])
+	if header.err != nil {
+		return nil, header.err
+	}
+	cipher, hash, err := containerSpecs(cipherName, hashName)
+	if err != nil {
+		return nil, err
+	}
+	if err := cipher.checkKey(keySize, len(iv)); err != nil {
+		return nil, err
+	}
+	var content []byte
+	for i := 0; i < count; i++ {
+		kind := header.read(1)[0]
+		id := header.field()
+		var ephemeral []byte
+		if kind == envelopeKeyAgreement {
+			ephemeral = header.longField()
+		}
+		encrypted := header.longField()
+		if header.err != nil {
+			return nil, header.err
+		}
+		if kind != envelopeKeyTransport && kind != envelopeKeyAgreement {
+			return nil, fmt.Errorf("unsupported envelope recipient type %d", kind)
+		}
+		if content != nil {
+			continue
+		}
+		if key := keys(id); key != nil {
+			if content, err = openRecipient(kind, id, ephemeral, encrypted, key, hash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if content == nil {
+		return nil, errors.New("no matching envelope recipient key")
+	}
+	defer Zero(content)
+	if len(content) != keySize+hashSize(hash) {
+		return nil, errEnvelope
+	}
+	mac := HMAC.New(hash, content[keySize:])
+	r, err := newContainerReader(in, header, mac, cipher, content[:keySize], iv, buffer, errEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvelopeReader{cipher: r}, nil
+}
+
+// Read reads necessary amount of input from the underlying Reader and decrypts it
+// into the provided slice. It conforms to the io.Reader interface.
+func (r *EnvelopeReader) Read(out []byte) (int, error) {
+	return r.cipher.Read(out)
+}
+
+// Close reads any remaining input and verifies the trailing HMAC, returning an error
+// if the verification fails. Then it releases any associated resources.
+// If the underlying Reader is a Closer, then it Closes it as well.
+func (r *EnvelopeReader) Close() error {
+	return r.cipher.Close()
+}
+
+// helpers
+
+func envelopeKeyID(der []byte) []byte {
+	hash := SHA256.New()
+	defer hash.Close()
+	hash.Write(der)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+// envelopeKEK derives the key agreement key-encryption key from the ECDH shared secret.
+func envelopeKEK(secret, id []byte, hash HashSpec) (KeyWrap, error) {
+	if AES_KWP == nil {
+		return nil, errors.New("envelope key agreement requires AES_KWP")
+	}
+	kek, err := HKDF{Hash: hash, Info: id}.Derive(secret, envelopeKEKSize)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(kek)
+	return AES_KWP.New(kek), nil
+}
+
+// writeRecipient writes the recipient record with the content key encrypted for the recipient.
+func writeRecipient(header *bytes.Buffer, recipient PublicKey, content []byte, hash HashSpec, random Random) error {
+	der, err := ExportKey(recipient)
+	if err != nil {
+		return err
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("unsupported envelope recipient key: %v", err)
+	}
+	id := envelopeKeyID(der)
+	switch public.(type) {
+	case *rsa.PublicKey:
+		if RSA_OAEP == nil {
+			return errors.New("envelope key transport requires RSA_OAEP")
+		}
+		key, err := RSA_OAEP(KeyParameters{Parameters: der, Random: random})
+		if err != nil {
+			return err
+		}
+		defer key.Close()
+		pub := key.PublicKey()
+		defer pub.Close()
+		encrypted, err := pub.Encrypt(content)
+		if err != nil {
+			return err
+		}
+		header.WriteByte(envelopeKeyTransport)
+		writeField(header, id)
+		writeLongField(header, encrypted)
+	case *ecdsa.PublicKey:
+		if ECDH == nil {
+			return errors.New("envelope key agreement requires ECDH")
+		}
+		key, err := ECDH(der)
+		if err != nil {
+			return err
+		}
+		defer key.Close()
+		peer := key.PublicKey()
+		defer peer.Close()
+		ephemeral, err := ECDH(KeyParameters{Parameters: peer, Random: random})
+		if err != nil {
+			return err
+		}
+		defer ephemeral.Close()
+		pub := ephemeral.PublicKey()
+		defer pub.Close()
+		ephemeralDER, err := ExportKey(pub)
+		if err != nil {
+			return err
+		}
+		secret, err := ephemeral.Derive(peer)
+		if err != nil {
+			return err
+		}
+		defer Zero(secret)
+		kek, err := envelopeKEK(secret, id, hash)
+		if err != nil {
+			return err
+		}
+		defer kek.Close()
+		wrapped, err := kek.Wrap(content)
+		if err != nil {
+			return err
+		}
+		header.WriteByte(envelopeKeyAgreement)
+		writeField(header, id)
+		writeLongField(header, ephemeralDER)
+		writeLongField(header, wrapped)
+	default:
+		return fmt.Errorf("unsupported envelope recipient key type %T", public)
+	}
+	return nil
+}
+
+// openRecipient recovers the content key from the recipient record using the recipient private key.
+func openRecipient(kind byte, id, ephemeral, encrypted []byte, key PrivateKey, hash HashSpec) ([]byte, error) {
+	if kind == envelopeKeyTransport {
+		return key.Decrypt(encrypted)
+	}
+	if ECDH == nil {
+		return nil, errors.New("envelope key agreement requires ECDH")
+	}
+	peer, err := ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+	pub := peer.PublicKey()
+	defer pub.Close()
+	secret, err := key.Derive(pub)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(secret)
+	kek, err := envelopeKEK(secret, id, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Close()
+	return kek.Unwrap(encrypted)
+}
@@ -0,0 +1,171 @@
+package okapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// FIPSError is returned by the key constructors and private key operations when an algorithm is refused in FIPS mode,
+// and by EnableFIPS for each failed self-test. The specs of the refused algorithms (including DES3 encryption)
+// panic with it in their New methods.
+type FIPSError struct {
+	// Algorithm is the name of the predefined variable, e.g. "MD5" or "RSA_SHA256".
+	Algorithm string
+	// Reason describes why the algorithm was refused.
+	Reason string
+}
+
+func (e *FIPSError) Error() string {
+	return e.Algorithm + " " + e.Reason
+}
+
+// fipsApproval is the status of an algorithm in FIPS mode
+type fipsApproval int
+
+const (
+	notApproved fipsApproval = iota
+	approved
+	// decryptionOnly algorithms can still process existing data (e.g. DES3)
+	decryptionOnly
+	// verificationOnly algorithms can still verify existing signatures (e.g. DSA or SHA1 signatures)
+	verificationOnly
+)
+
+// fipsMinKeySize is the minimum size of RSA, DSA and DH keys in FIPS mode (SP 800-131A)
+const fipsMinKeySize = 2048
+
+var fips struct {
+	sync.Mutex
+	err error
+}
+
+var (
+	fipsEnabled atomic.Bool
+	// fipsFailed is set when a self-test fails, all algorithms are refused from then on
+	fipsFailed atomic.Bool
+)
+
+// EnableFIPS switches the process into FIPS mode, it cannot be switched off.
+// It runs the power-on self-tests first, i.e. the known-answer tests of the DRBGs and of the implementations
+// of the approved algorithms, both those currently assigned to the predefined variables
+// and those of the other providers that were registered with Register,
+// then the guards of the predefined variables (see Register):
+// * refuse the algorithms that are not approved, e.g. MD4, MD5, RC4, Blowfish or RSA PKCS#1 v1.5 encryption
+// * refuse DES3 encryption, decryption of existing data is still allowed
+// * refuse signing with DSA keys (FIPS 186-5) and signing SHA1 digests, verification of existing signatures is still allowed
+// * refuse RSA, DSA and DH keys smaller than 2048 bits
+// The specs of the refused algorithms panic with a *FIPSError in their New methods, as do DES3 specs
+// when they are asked to encrypt, the refused key constructors and Sign methods return it.
+// If any self-test fails, EnableFIPS returns the errors of the failed tests and all algorithms are refused.
+// Repeated calls return the result of the first one.
+//
+// EnableFIPS must be called after the implementations are imported (or registered, e.g. by pkcs11 Session.Register),
+// implementations registered later are not tested, implementations assigned to the predefined variables
+// without Register are neither tested nor guarded.
+// Only the predefined variables are guarded, the specs and key constructors of the implementation packages
+// used directly (e.g. libcrypto.AES_CBC or libcrypto.MD5) are self-tested, but not checked,
+// so FIPS compliant applications must use the predefined variables only.
+// Note that DefaultRandom is not tested, it can be replaced with a tested DRBG, e.g.
+//
+//	okapi.DefaultRandom = okapi.CTR_DRBG{KeySize: 32, Entropy: okapi.HealthTested{Source: okapi.DefaultRandom}}
+func EnableFIPS() error {
+	fips.Lock()
+	defer fips.Unlock()
+	if fipsEnabled.Load() {
+		return fips.err
+	}
+	var errs []error
+	for _, v := range variables {
+		if err := v.selfTest(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		fipsFailed.Store(true)
+		fips.err = errors.Join(errs...)
+	}
+	fipsEnabled.Store(true)
+	return fips.err
+}
+
+// FIPSEnabled reports whether the process is in FIPS mode.
+func FIPSEnabled() bool {
+	return fipsEnabled.Load()
+}
+
+// selfTest runs the known-answer test of each implementation of the variable
+func (v variable) selfTest() error {
+	if v.test == nil {
+		return nil
+	}
+	if v.pointer == nil {
+		return v.selfTestImplementation("", nil)
+	}
+	implementations := v.implementations()
+	providers := make([]string, 0, len(implementations))
+	for provider := range implementations {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	var errs []error
+	for _, provider := range providers {
+		if err := v.selfTestImplementation(provider, implementations[provider]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selfTestImplementation runs the known-answer test,
+// the errors and panics of the implementation are reported as a FIPSError
+func (v variable) selfTestImplementation(provider string, implementation interface{}) (err error) {
+	failed := "self-test failed: "
+	if provider != "" {
+		failed = "self-test of " + provider + " failed: "
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &FIPSError{v.name, fmt.Sprintf("%s%v", failed, r)}
+		}
+	}()
+	if err := v.test(implementation); err != nil {
+		return &FIPSError{v.name, failed + err.Error()}
+	}
+	return nil
+}
+
+// fipsCheck returns the error refusing the algorithm in FIPS mode,
+// if it is not approved or a self-test failed
+func (a algorithm) fipsCheck() error {
+	if !fipsEnabled.Load() {
+		return nil
+	}
+	if a.approval == notApproved {
+		return &FIPSError{a.name, "is not approved in FIPS mode"}
+	}
+	if fipsFailed.Load() {
+		return &FIPSError{a.name, "is disabled after a FIPS self-test failure"}
+	}
+	return nil
+}
+
+// verificationOnlyKey refuses signing in FIPS mode with the keys of the algorithms approved only for verification
+type verificationOnlyKey struct {
+	PrivateKey
+	name string
+}
+
+func (k *verificationOnlyKey) Sign(digest []byte) ([]byte, error) {
+	return nil, &FIPSError{k.name, "is approved only for signature verification in FIPS mode"}
+}
+
+func (k *verificationOnlyKey) KeySize() int {
+	return keySize(k.PrivateKey)
+}
+
+func (k *verificationOnlyKey) Export() ([]byte, error) {
+	return ExportKey(k.PrivateKey)
+}
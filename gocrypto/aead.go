@@ -0,0 +1,55 @@
+package gocrypto
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.AES_SIV, AES_SIV)
+	okapi.Register(&okapi.AES_GCM_SIV, AES_GCM_SIV)
+	okapi.Register(&okapi.AES_GCM_AEAD, AES_GCM_AEAD)
+}
+
+var (
+	AES_SIV     = AEADSpec{aead: newSIV}
+	AES_GCM_SIV = AEADSpec{aead: newGCMSIV}
+
+	AES_GCM_AEAD = AEADSpec{aead: newGCM}
+)
+
+var errOpen = errors.New("message authentication failed")
+
+// AEADSpec represents an authenticated encryption algorithm.
+type AEADSpec struct {
+	aead func(key []byte) (okapi.AEAD, error)
+}
+
+func (as AEADSpec) New(key []byte) okapi.AEAD {
+	a, err := as.aead(key)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// helpers
+
+// grow extends the slice by n bytes, returning the extended slice
+// and the tail slice corresponding to the extension
+func grow(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// xor sets out to a^b for the length of the shorter input and returns the number of bytes written.
+func xor(out, a, b []byte) int {
+	return subtle.XORBytes(out, a, b)
+}
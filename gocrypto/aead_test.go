@@ -0,0 +1,128 @@
+package gocrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func h2b(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestAES_SIV(t *testing.T) {
+	// RFC 5297, A.1 Deterministic Authenticated Encryption Example
+	key := h2b("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	data := h2b("101112131415161718191a1b1c1d1e1f2021222324252627")
+	plain := h2b("112233445566778899aabbccddee")
+	siv := AES_SIV.New(key)
+	defer siv.Close()
+	encrypted := siv.Seal(nil, nil, plain, data)
+	if hex.EncodeToString(encrypted) != "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	decrypted, err := siv.Open(nil, nil, encrypted, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	if _, err = siv.Open(nil, nil, encrypted, data, data); err == nil {
+		t.Fatal("Open succeeded with wrong associated data")
+	}
+}
+
+func TestAES_SIVNonce(t *testing.T) {
+	siv := AES_SIV.New(make([]byte, 64))
+	defer siv.Close()
+	nonce := []byte("0123456789")
+	plain := make([]byte, 100)
+	encrypted := siv.Seal(nil, nonce, plain, []byte("header"), []byte("more header"))
+	if len(encrypted) != len(plain)+siv.Overhead() {
+		t.Fatalf("Wrong encrypted size: %d", len(encrypted))
+	}
+	decrypted, err := siv.Open(nil, nonce, encrypted, []byte("header"), []byte("more header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	encrypted[20] ^= 1
+	if _, err = siv.Open(nil, nonce, encrypted, []byte("header"), []byte("more header")); err == nil {
+		t.Fatal("Open succeeded with tampered input")
+	}
+}
+
+func TestAES_GCM_SIV(t *testing.T) {
+	// RFC 8452, Appendix C
+	for _, v := range []struct{ key, nonce, data, plain, result string }{
+		{"01000000000000000000000000000000", "030000000000000000000000", "", "",
+			"dc20e2d83f25705bb49e439eca56de25"},
+		{"01000000000000000000000000000000", "030000000000000000000000", "", "0100000000000000",
+			"b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "",
+			"07f5f4169bbf55a8400cd47ea6fd400f"},
+	} {
+		gcm := AES_GCM_SIV.New(h2b(v.key))
+		defer gcm.Close()
+		var data [][]byte
+		if v.data != "" {
+			data = append(data, h2b(v.data))
+		}
+		encrypted := gcm.Seal(nil, h2b(v.nonce), h2b(v.plain), data...)
+		if hex.EncodeToString(encrypted) != v.result {
+			t.Fatalf("Wrong encryption: %x", encrypted)
+		}
+		decrypted, err := gcm.Open(nil, h2b(v.nonce), encrypted, data...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, h2b(v.plain)) {
+			t.Fatal("Decrypted does not match plain")
+		}
+	}
+}
+
+func TestAES_GCM_SIVTampered(t *testing.T) {
+	gcm := AES_GCM_SIV.New(make([]byte, 32))
+	defer gcm.Close()
+	nonce := make([]byte, gcm.NonceSize())
+	plain := make([]byte, 155) // intentionally not a multiple of block length
+	encrypted := gcm.Seal(nil, nonce, plain, []byte("header"))
+	if _, err := gcm.Open(nil, nonce, encrypted, []byte("header")); err != nil {
+		t.Fatal(err)
+	}
+	encrypted[0] ^= 1
+	if _, err := gcm.Open(nil, nonce, encrypted, []byte("header")); err == nil {
+		t.Fatal("Open succeeded with tampered input")
+	}
+}
+
+func TestAES_GCM_AEAD(t *testing.T) {
+	// GCM specification, Test Case 2
+	gcm := AES_GCM_AEAD.New(make([]byte, 16))
+	defer gcm.Close()
+	nonce := make([]byte, gcm.NonceSize())
+	plain := make([]byte, 16)
+	encrypted := gcm.Seal(nil, nonce, plain)
+	if hex.EncodeToString(encrypted) != "0388dace60b6a392f328c2b971b2fe78ab6e47d42cec13bdf53a67b21257bddf" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	encrypted = gcm.Seal(nil, nonce, plain, []byte("header"))
+	decrypted, err := gcm.Open(nil, nonce, encrypted, []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	if _, err = gcm.Open(nil, nonce, encrypted); err == nil {
+		t.Fatal("Open succeeded with wrong associated data")
+	}
+}
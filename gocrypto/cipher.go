@@ -10,16 +10,17 @@ import (
 )
 
 func init() {
-	okapi.RC4 = RC4
+	okapi.Register(&okapi.RC4, RC4)
 	//okapi.DES3_ECB = DES3_ECB
-	okapi.DES3_CBC = DES3_CBC
-	//okapi.DES3_CFB = DES3_CFB
-	okapi.DES3_OFB = DES3_OFB
+	okapi.Register(&okapi.DES3_CBC, DES3_CBC)
+	okapi.Register(&okapi.DES3_CFB, DES3_CFB)
+	okapi.Register(&okapi.DES3_OFB, DES3_OFB)
+	okapi.Register(&okapi.RC2_CBC, RC2_CBC)
 	//okapi.AES_ECB = AES_ECB
-	okapi.AES_CBC = AES_CBC
-	okapi.AES_OFB = AES_OFB
-	//okapi.AES_CFB = AES_CFB
-	okapi.AES_CTR = AES_CTR
+	okapi.Register(&okapi.AES_CBC, AES_CBC)
+	okapi.Register(&okapi.AES_OFB, AES_OFB)
+	okapi.Register(&okapi.AES_CFB, AES_CFB)
+	okapi.Register(&okapi.AES_CTR, AES_CTR)
 	//okapi.AES_GCM = AES_GCM
 }
 
@@ -27,9 +28,12 @@ var (
 	RC4      = CipherSpec{stream: func(k []byte) (cipher.Stream, error) { return rc4.NewCipher(k) }}
 	AES_CBC  = CipherSpec{block: aes.NewCipher, modeEncrypt: cipher.NewCBCEncrypter, modeDecrypt: cipher.NewCBCDecrypter}
 	AES_OFB  = CipherSpec{block: aes.NewCipher, mode: cipher.NewOFB}
+	AES_CFB  = CipherSpec{block: aes.NewCipher, streamEncrypt: cipher.NewCFBEncrypter, streamDecrypt: cipher.NewCFBDecrypter}
 	AES_CTR  = CipherSpec{block: aes.NewCipher, mode: cipher.NewCTR}
 	DES3_CBC = CipherSpec{block: des.NewTripleDESCipher, modeEncrypt: cipher.NewCBCEncrypter, modeDecrypt: cipher.NewCBCDecrypter}
 	DES3_OFB = CipherSpec{block: des.NewTripleDESCipher, mode: cipher.NewOFB}
+	DES3_CFB = CipherSpec{block: des.NewTripleDESCipher, streamEncrypt: cipher.NewCFBEncrypter, streamDecrypt: cipher.NewCFBDecrypter}
+	RC2_CBC  = CipherSpec{block: newRC2, modeEncrypt: cipher.NewCBCEncrypter, modeDecrypt: cipher.NewCBCDecrypter}
 )
 
 // CipherSpec represents a cipher algorithm.
@@ -39,6 +43,9 @@ type CipherSpec struct {
 	modeEncrypt func(c cipher.Block, iv []byte) cipher.BlockMode
 	modeDecrypt func(c cipher.Block, iv []byte) cipher.BlockMode
 	mode        func(c cipher.Block, iv []byte) cipher.Stream
+	// stream modes that differ for encryption and decryption (CFB)
+	streamEncrypt func(c cipher.Block, iv []byte) cipher.Stream
+	streamDecrypt func(c cipher.Block, iv []byte) cipher.Stream
 }
 
 func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
@@ -56,6 +63,12 @@ func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
 	if cs.mode != nil {
 		return &StreamCipher{cipher: cs.mode(c, iv), keySize: len(key)}
 	}
+	if cs.streamEncrypt != nil {
+		if encrypt {
+			return &StreamCipher{cipher: cs.streamEncrypt(c, iv), keySize: len(key)}
+		}
+		return &StreamCipher{cipher: cs.streamDecrypt(c, iv), keySize: len(key)}
+	}
 	var bc *BlockCipher
 	if encrypt {
 		bc = &BlockCipher{cipher: cs.modeEncrypt(c, iv), keySize: len(key)}
@@ -74,6 +87,10 @@ func (cs CipherSpec) NewWriter(out io.Writer, key, iv, buffer []byte) *okapi.Cip
 	return okapi.NewCipherWriter(out, cs, key, iv, buffer)
 }
 
+func (cs CipherSpec) NewWithKey(key *okapi.SecretKey, iv []byte, encrypt bool) (okapi.Cipher, error) {
+	return key.NewCipher(cs, iv, encrypt)
+}
+
 type BlockCipher struct {
 	cipher  cipher.BlockMode
 	keySize int
@@ -135,6 +152,7 @@ func (c *BlockCipher) Finish(out []byte) int {
 }
 
 func (c *BlockCipher) Close() {
+	okapi.Zero(c.buffer[:cap(c.buffer)])
 }
 
 type StreamCipher struct {
@@ -155,6 +173,9 @@ func (c *StreamCipher) BufferedSize() int {
 }
 
 func (c *StreamCipher) Update(in, out []byte) (int, int) {
+	if len(in) > len(out) {
+		in = in[:len(out)]
+	}
 	c.cipher.XORKeyStream(out, in)
 	return len(in), len(in)
 }
@@ -2,6 +2,7 @@ package gocrypto
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 )
 
@@ -125,6 +126,55 @@ func TestAES_CTR(t *testing.T) {
 	}
 }
 
+func TestAES_CFB(t *testing.T) {
+	// NIST SP 800-38A, F.3.13 CFB128-AES128.Encrypt
+	key := h2b("2b7e151628aed2a6abf7158809cf4f3c")
+	iv := h2b("000102030405060708090a0b0c0d0e0f")
+	plain := h2b("6bc1bee22e409f96e93d7e117393172aae2d")
+	aes := AES_CFB.New(key, iv, true)
+	defer aes.Close()
+	encrypted := make([]byte, len(plain))
+	aes.Update(plain, encrypted)
+	if hex.EncodeToString(encrypted) != "3b3fd92eb72dad20333449f8e83cfb4ac8a6" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	aes = AES_CFB.New(key, iv, false)
+	defer aes.Close()
+	decrypted := make([]byte, len(plain))
+	aes.Update(encrypted, decrypted)
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+}
+
+func TestRC2(t *testing.T) {
+	// RFC 2268, section 5
+	for _, v := range []struct {
+		key, plain, encrypted string
+		bits                  int
+	}{
+		{"0000000000000000", "0000000000000000", "ebb773f993278eff", 63},
+		{"ffffffffffffffff", "ffffffffffffffff", "278b27e42e2f0d49", 64},
+		{"3000000000000000", "1000000000000001", "30649edf9be7d2c2", 64},
+		{"88bca90e90875a7f0f79c384627bafb2", "0000000000000000", "2269552ab0f85ca6", 128},
+	} {
+		rc2, err := newRC2Bits(h2b(v.key), v.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted := make([]byte, 8)
+		rc2.Encrypt(encrypted, h2b(v.plain))
+		if hex.EncodeToString(encrypted) != v.encrypted {
+			t.Fatalf("Wrong encryption with key %s: %x", v.key, encrypted)
+		}
+		decrypted := make([]byte, 8)
+		rc2.Decrypt(decrypted, encrypted)
+		if hex.EncodeToString(decrypted) != v.plain {
+			t.Fatalf("Wrong decryption with key %s: %x", v.key, decrypted)
+		}
+	}
+}
+
 //func TestAES_GCM(t *testing.T) {
 //	key := make([]byte, 16)
 //	// In GCM mode the IV is the counter
@@ -159,3 +209,17 @@ func TestAES_CTR(t *testing.T) {
 //		t.Fatal("Decrypted does not match plain")
 //	}
 //}
+
+func TestBlockCipherCloseZeroesBuffer(t *testing.T) {
+	c := AES_CBC.New(make([]byte, 16), make([]byte, 16), true).(*BlockCipher)
+	out := make([]byte, 16)
+	c.Update([]byte("0123456789abcdef0123"), out)
+	if c.BufferedSize() != 4 {
+		t.Fatalf("Unexpected buffered size %d", c.BufferedSize())
+	}
+	buffer := c.buffer[:cap(c.buffer)]
+	c.Close()
+	if !bytes.Equal(buffer, make([]byte, len(buffer))) {
+		t.Fatalf("Buffer not zeroed: %x", buffer)
+	}
+}
@@ -0,0 +1,100 @@
+package gocrypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.ECDH, ECDH.constructor())
+}
+
+type ecdhParameters struct{}
+
+var (
+	ECDH = ecdhParameters{}
+)
+
+// size2curve maps key sizes in bits to the supported NIST curves
+var size2curve = map[int]ecdh.Curve{256: ecdh.P256(), 384: ecdh.P384(), 521: ecdh.P521()}
+
+func curveSize(curve ecdh.Curve) int {
+	for size, c := range size2curve {
+		if c == curve {
+			return size
+		}
+	}
+	return 0
+}
+
+func (p ecdhParameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+func (p ecdhParameters) isForEncryption() bool   { return false }
+func (p ecdhParameters) isForSigning() bool      { return false }
+func (p ecdhParameters) isForKeyAgreement() bool { return true }
+
+func (p ecdhParameters) generate(size int, random okapi.Random) (*PKey, error) {
+	curve, ok := size2curve[size]
+	if !ok {
+		return nil, errors.New("Unsupported curve size")
+	}
+	var pri *ecdh.PrivateKey
+	var err error
+	random, release := customRandom(random)
+	defer release()
+	if random != nil {
+		err = generateScalar(random, size, func(d []byte) (err error) {
+			pri, err = curve.NewPrivateKey(d)
+			return err
+		})
+	} else {
+		pri, err = curve.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PKey{private: pri, public: pri.PublicKey()}, nil
+}
+
+func (p ecdhParameters) regenerate(key *PKey, random okapi.Random) (*PKey, error) {
+	return p.generate(key.KeySize(), random)
+}
+
+func (p ecdhParameters) accept(private, public interface{}) (*PKey, error) {
+	switch key := private.(type) {
+	case *ecdh.PrivateKey:
+		return &PKey{private: key, public: key.PublicKey()}, nil
+	case *ecdsa.PrivateKey:
+		pri, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return &PKey{private: pri, public: pri.PublicKey()}, nil
+	}
+	switch key := public.(type) {
+	case *ecdh.PublicKey:
+		return &PKey{public: key}, nil
+	case *ecdsa.PublicKey:
+		pub, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return &PKey{public: pub}, nil
+	}
+	return nil, errors.New("Not an EC key")
+}
+
+func (p ecdhParameters) derive(private, peer interface{}) ([]byte, error) {
+	pub, ok := peer.(*ecdh.PublicKey)
+	if !ok {
+		return nil, errors.New("Peer key is not an EC key")
+	}
+	return private.(*ecdh.PrivateKey).ECDH(pub)
+}
@@ -0,0 +1,151 @@
+package gocrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"github.com/mkobetic/okapi"
+	"io"
+	"math/big"
+)
+
+func init() {
+	okapi.Register(&okapi.ECDSA_SHA1, ECDSA_SHA1.constructor())
+	okapi.Register(&okapi.ECDSA_224, ECDSA_SHA224.constructor())
+	okapi.Register(&okapi.ECDSA_SHA256, ECDSA_SHA256.constructor())
+	okapi.Register(&okapi.ECDSA_384, ECDSA_SHA384.constructor())
+	okapi.Register(&okapi.ECDSA_SHA512, ECDSA_SHA512.constructor())
+}
+
+// ECDSA signatures are DER encoded (r, s) pairs as defined by X9.62
+type ecdsaParameters struct {
+	hash crypto.Hash
+}
+
+var (
+	ECDSA_SHA1   = ecdsaParameters{crypto.SHA1}
+	ECDSA_SHA224 = ecdsaParameters{crypto.SHA224}
+	ECDSA_SHA256 = ecdsaParameters{crypto.SHA256}
+	ECDSA_SHA384 = ecdsaParameters{crypto.SHA384}
+	ECDSA_SHA512 = ecdsaParameters{crypto.SHA512}
+)
+
+var size2ellipticCurve = map[int]elliptic.Curve{224: elliptic.P224(), 256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+
+func (p ecdsaParameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+func (p ecdsaParameters) isForEncryption() bool   { return false }
+func (p ecdsaParameters) isForSigning() bool      { return true }
+func (p ecdsaParameters) isForKeyAgreement() bool { return false }
+
+func (p ecdsaParameters) generate(size int, random okapi.Random) (*PKey, error) {
+	curve, ok := size2ellipticCurve[size]
+	if !ok {
+		return nil, errors.New("Unsupported curve size")
+	}
+	var pri *ecdsa.PrivateKey
+	var err error
+	random, release := customRandom(random)
+	defer release()
+	if random != nil {
+		err = generateScalar(random, size, func(d []byte) (err error) {
+			pri, err = ecdsa.ParseRawPrivateKey(curve, d)
+			return err
+		})
+	} else {
+		pri, err = ecdsa.GenerateKey(curve, rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PKey{private: pri, public: &pri.PublicKey}, nil
+}
+
+// generateScalar reads private scalar candidates of the curve size from random
+// until the accept function doesn't reject one as out of range (FIPS 186-5, A.2.2).
+func generateScalar(random io.Reader, size int, accept func(d []byte) error) error {
+	d := make([]byte, (size+7)/8)
+	for {
+		if _, err := io.ReadFull(random, d); err != nil {
+			return err
+		}
+		d[0] &= 0xff >> uint(len(d)*8-size)
+		if accept(d) == nil {
+			return nil
+		}
+	}
+}
+
+func (p ecdsaParameters) regenerate(key *PKey, random okapi.Random) (*PKey, error) {
+	return p.generate(key.KeySize(), random)
+}
+
+func (p ecdsaParameters) accept(private, public interface{}) (*PKey, error) {
+	if pri, ok := private.(*ecdsa.PrivateKey); ok {
+		return &PKey{private: pri, public: &pri.PublicKey}, nil
+	}
+	if pub, ok := public.(*ecdsa.PublicKey); ok {
+		return &PKey{public: pub}, nil
+	}
+	return nil, errors.New("Not an EC key")
+}
+
+func (p ecdsaParameters) sign(private interface{}, digest []byte, random okapi.Random) ([]byte, error) {
+	random, release := customRandom(random)
+	defer release()
+	if random != nil {
+		return signECDSA(random, private.(*ecdsa.PrivateKey), digest)
+	}
+	return ecdsa.SignASN1(rand.Reader, private.(*ecdsa.PrivateKey), digest)
+}
+
+// signECDSA signs the digest with the per-message secret read from random (FIPS 186-5, 6.4.1)
+func signECDSA(random io.Reader, pri *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	n := pri.Curve.Params().N
+	size := n.BitLen()
+	// e is the leftmost size bits of the digest
+	if len(digest) > (size+7)/8 {
+		digest = digest[:(size+7)/8]
+	}
+	e := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - size; excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+	for {
+		var k *big.Int
+		err := generateScalar(random, size, func(d []byte) error {
+			k = new(big.Int).SetBytes(d)
+			if k.Sign() == 0 || k.Cmp(n) >= 0 {
+				return errors.New("Scalar out of range")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		x, _ := pri.Curve.ScalarBaseMult(k.Bytes())
+		r := x.Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(pri.D, r)
+		s.Add(s, e)
+		s.Mul(s, k.ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	}
+}
+
+func (p ecdsaParameters) verify(public interface{}, signature, digest []byte) (bool, error) {
+	return ecdsa.VerifyASN1(public.(*ecdsa.PublicKey), digest, signature), nil
+}
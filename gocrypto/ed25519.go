@@ -0,0 +1,75 @@
+package gocrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"github.com/mkobetic/okapi"
+	"io"
+)
+
+func init() {
+	okapi.Register(&okapi.Ed25519, Ed25519.constructor())
+}
+
+// Ed25519 signatures are computed over the message itself (pure EdDSA, RFC 8032)
+// and they are deterministic, so signing doesn't use the random of the key
+type ed25519Parameters struct{}
+
+var (
+	Ed25519 = ed25519Parameters{}
+)
+
+// ed25519Size is the key size reported for Ed25519 keys, it matches OpenSSL
+const ed25519Size = 253
+
+func (p ed25519Parameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+func (p ed25519Parameters) isForEncryption() bool   { return false }
+func (p ed25519Parameters) isForSigning() bool      { return true }
+func (p ed25519Parameters) isForKeyAgreement() bool { return false }
+
+// generate ignores the size, Ed25519 keys have fixed size
+func (p ed25519Parameters) generate(size int, random okapi.Random) (*PKey, error) {
+	random, release := customRandom(random)
+	defer release()
+	if random != nil {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := io.ReadFull(random, seed); err != nil {
+			return nil, err
+		}
+		pri := ed25519.NewKeyFromSeed(seed)
+		return &PKey{private: pri, public: pri.Public()}, nil
+	}
+	pub, pri, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &PKey{private: pri, public: pub}, nil
+}
+
+func (p ed25519Parameters) regenerate(key *PKey, random okapi.Random) (*PKey, error) {
+	return p.generate(ed25519Size, random)
+}
+
+func (p ed25519Parameters) accept(private, public interface{}) (*PKey, error) {
+	if pri, ok := private.(ed25519.PrivateKey); ok {
+		return &PKey{private: pri, public: pri.Public()}, nil
+	}
+	if pub, ok := public.(ed25519.PublicKey); ok {
+		return &PKey{public: pub}, nil
+	}
+	return nil, errors.New("Not an Ed25519 key")
+}
+
+func (p ed25519Parameters) sign(private interface{}, message []byte, random okapi.Random) ([]byte, error) {
+	return ed25519.Sign(private.(ed25519.PrivateKey), message), nil
+}
+
+func (p ed25519Parameters) verify(public interface{}, signature, message []byte) (bool, error) {
+	return ed25519.Verify(public.(ed25519.PublicKey), message, signature), nil
+}
@@ -0,0 +1,71 @@
+package gocrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"github.com/mkobetic/okapi"
+)
+
+// gcm adapts the standard AES-GCM implementation to the AEAD interface.
+type gcm struct {
+	aead    cipher.AEAD
+	keySize int
+}
+
+func newGCM(key []byte) (okapi.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES_GCM_AEAD key size: %d", len(key))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &gcm{aead: aead, keySize: len(key)}, nil
+}
+
+func (g *gcm) NonceSize() int {
+	return g.aead.NonceSize()
+}
+
+func (g *gcm) Overhead() int {
+	return g.aead.Overhead()
+}
+
+func (g *gcm) KeySize() int {
+	return g.keySize
+}
+
+func (g *gcm) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	return g.aead.Seal(dst, g.check(nonce), plain, g.data(data))
+}
+
+func (g *gcm) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	out, err := g.aead.Open(dst, g.check(nonce), encrypted, g.data(data))
+	if err != nil {
+		return nil, errOpen
+	}
+	return out, nil
+}
+
+func (g *gcm) Close() {
+	g.aead = nil
+}
+
+func (g *gcm) check(nonce []byte) []byte {
+	if len(nonce) != g.aead.NonceSize() {
+		panic(fmt.Sprintf("invalid AES_GCM_AEAD nonce size: %d", len(nonce)))
+	}
+	return nonce
+}
+
+func (g *gcm) data(data [][]byte) []byte {
+	switch len(data) {
+	case 0:
+		return nil
+	case 1:
+		return data[0]
+	}
+	panic("AES_GCM_AEAD supports at most one associated data component")
+}
@@ -0,0 +1,183 @@
+package gocrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"github.com/mkobetic/okapi"
+)
+
+const gcmSIVNonceSize = 12
+
+// gcmSIV implements AES-GCM-SIV as specified in RFC 8452.
+type gcmSIV struct {
+	key []byte // key-generating key
+}
+
+func newGCMSIV(key []byte) (okapi.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("invalid AES_GCM_SIV key size: %d", len(key))
+	}
+	return &gcmSIV{key: append([]byte(nil), key...)}, nil
+}
+
+func (g *gcmSIV) NonceSize() int {
+	return gcmSIVNonceSize
+}
+
+func (g *gcmSIV) Overhead() int {
+	return aes.BlockSize
+}
+
+func (g *gcmSIV) KeySize() int {
+	return len(g.key)
+}
+
+func (g *gcmSIV) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	ad := g.check(nonce, data)
+	auth, enc := g.deriveKeys(nonce)
+	tag := g.tag(auth, enc, nonce, plain, ad)
+	out, tail := grow(dst, len(plain)+len(tag))
+	g.crypt(enc, tail, plain, tag)
+	copy(tail[len(plain):], tag)
+	return out
+}
+
+func (g *gcmSIV) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	ad := g.check(nonce, data)
+	if len(encrypted) < aes.BlockSize {
+		return nil, errOpen
+	}
+	tag := encrypted[len(encrypted)-aes.BlockSize:]
+	encrypted = encrypted[:len(encrypted)-aes.BlockSize]
+	auth, enc := g.deriveKeys(nonce)
+	out, plain := grow(dst, len(encrypted))
+	g.crypt(enc, plain, encrypted, tag)
+	if subtle.ConstantTimeCompare(tag, g.tag(auth, enc, nonce, plain, ad)) != 1 {
+		for i := range plain {
+			plain[i] = 0
+		}
+		return nil, errOpen
+	}
+	return out, nil
+}
+
+func (g *gcmSIV) Close() {
+	for i := range g.key {
+		g.key[i] = 0
+	}
+}
+
+func (g *gcmSIV) check(nonce []byte, data [][]byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic(fmt.Sprintf("invalid AES_GCM_SIV nonce size: %d", len(nonce)))
+	}
+	switch len(data) {
+	case 0:
+		return nil
+	case 1:
+		return data[0]
+	}
+	panic("AES_GCM_SIV supports at most one associated data component")
+}
+
+// deriveKeys derives the per-nonce message authentication key and the message encryption cipher.
+func (g *gcmSIV) deriveKeys(nonce []byte) (auth []byte, enc cipher.Block) {
+	kgk, err := aes.NewCipher(g.key)
+	if err != nil {
+		panic(err)
+	}
+	var in, out [aes.BlockSize]byte
+	copy(in[4:], nonce)
+	keys := make([]byte, 16+len(g.key))
+	for i := 0; i < len(keys)/8; i++ {
+		binary.LittleEndian.PutUint32(in[:4], uint32(i))
+		kgk.Encrypt(out[:], in[:])
+		copy(keys[i*8:], out[:8])
+	}
+	enc, err = aes.NewCipher(keys[16:])
+	if err != nil {
+		panic(err)
+	}
+	return keys[:16], enc
+}
+
+func (g *gcmSIV) tag(auth []byte, enc cipher.Block, nonce, plain, ad []byte) []byte {
+	p := newPolyval(auth)
+	p.update(ad)
+	p.update(plain)
+	var lengths [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(ad))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plain))*8)
+	p.update(lengths[:])
+	s := p.sum()
+	xor(s[:gcmSIVNonceSize], s[:gcmSIVNonceSize], nonce)
+	s[15] &= 0x7f
+	tag := make([]byte, aes.BlockSize)
+	enc.Encrypt(tag, s[:])
+	return tag
+}
+
+// crypt runs the CTR mode variant of GCM-SIV with 32-bit little endian counter.
+func (g *gcmSIV) crypt(enc cipher.Block, out, in, tag []byte) {
+	var counter, stream [aes.BlockSize]byte
+	copy(counter[:], tag)
+	counter[15] |= 0x80
+	ctr := binary.LittleEndian.Uint32(counter[:4])
+	for len(in) > 0 {
+		enc.Encrypt(stream[:], counter[:])
+		n := xor(out, in, stream[:])
+		out, in = out[n:], in[n:]
+		ctr++
+		binary.LittleEndian.PutUint32(counter[:4], ctr)
+	}
+}
+
+// polyval implements the POLYVAL universal hash from RFC 8452.
+// Field elements are 128-bit little endian integers, h[0] holding the low 64 bits.
+type polyval struct {
+	h, s [2]uint64
+}
+
+func newPolyval(key []byte) *polyval {
+	return &polyval{h: [2]uint64{binary.LittleEndian.Uint64(key[:8]), binary.LittleEndian.Uint64(key[8:])}}
+}
+
+// update processes the input, zero padding it to a multiple of block size.
+func (p *polyval) update(in []byte) {
+	var block [aes.BlockSize]byte
+	for len(in) > 0 {
+		n := copy(block[:], in)
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		in = in[n:]
+		p.s[0] ^= binary.LittleEndian.Uint64(block[:8])
+		p.s[1] ^= binary.LittleEndian.Uint64(block[8:])
+		p.s = dot(p.s, p.h)
+	}
+}
+
+func (p *polyval) sum() (out [aes.BlockSize]byte) {
+	binary.LittleEndian.PutUint64(out[:8], p.s[0])
+	binary.LittleEndian.PutUint64(out[8:], p.s[1])
+	return
+}
+
+// dot computes a*b*x^-128 modulo x^128 + x^127 + x^126 + x^121 + 1.
+func dot(a, b [2]uint64) (r [2]uint64) {
+	for i := 0; i < 128; i++ {
+		if b[i/64]>>(uint(i)%64)&1 == 1 {
+			r[0] ^= a[0]
+			r[1] ^= a[1]
+		}
+		// multiply r by x^-1: add the polynomial if r is odd, then divide by x
+		odd := r[0] & 1
+		r[0] = r[0]>>1 | r[1]<<63
+		r[1] = r[1] >> 1
+		r[1] ^= -odd & (1<<63 | 1<<62 | 1<<61 | 1<<56)
+	}
+	return
+}
@@ -12,13 +12,13 @@ import (
 )
 
 func init() {
-	okapi.MD5 = MD5
-	okapi.SHA1 = SHA1
-	okapi.SHA224 = SHA224
-	okapi.SHA256 = SHA256
-	okapi.SHA384 = SHA384
-	okapi.SHA512 = SHA512
-	okapi.RIPEMD160 = RIPEMD160
+	okapi.Register(&okapi.MD5, MD5)
+	okapi.Register(&okapi.SHA1, SHA1)
+	okapi.Register(&okapi.SHA224, SHA224)
+	okapi.Register(&okapi.SHA256, SHA256)
+	okapi.Register(&okapi.SHA384, SHA384)
+	okapi.Register(&okapi.SHA512, SHA512)
+	okapi.Register(&okapi.RIPEMD160, RIPEMD160)
 }
 
 var (
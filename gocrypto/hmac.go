@@ -6,7 +6,7 @@ import (
 )
 
 func init() {
-	okapi.HMAC = HMAC
+	okapi.Register(&okapi.HMAC, HMAC)
 }
 
 type MACSpec struct{}
@@ -18,3 +18,7 @@ var (
 func (ms MACSpec) New(hs okapi.HashSpec, key []byte) okapi.Hash {
 	return &Hash{Hash: hmac.New(hs.(HashSpec).hash.New, key)}
 }
+
+func (ms MACSpec) NewWithKey(hash okapi.HashSpec, key *okapi.SecretKey) (okapi.Hash, error) {
+	return key.NewMAC(ms, hash)
+}
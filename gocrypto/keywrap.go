@@ -0,0 +1,162 @@
+package gocrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.AES_KW, AES_KW)
+	okapi.Register(&okapi.AES_KWP, AES_KWP)
+}
+
+var (
+	AES_KW  = KeyWrapSpec{block: aes.NewCipher}
+	AES_KWP = KeyWrapSpec{block: aes.NewCipher, padded: true}
+)
+
+var (
+	errWrapSize   = errors.New("invalid key size for key wrap")
+	errUnwrapSize = errors.New("invalid wrapped key size")
+	errIntegrity  = errors.New("key unwrap integrity check failed")
+)
+
+// default initial value from RFC 3394
+var kwIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// alternative initial value prefix from RFC 5649
+var kwpIV = []byte{0xA6, 0x59, 0x59, 0xA6}
+
+// KeyWrapSpec represents a key wrapping algorithm over a 128-bit block cipher.
+type KeyWrapSpec struct {
+	block  func(key []byte) (cipher.Block, error)
+	padded bool
+}
+
+func (ks KeyWrapSpec) New(kek []byte) okapi.KeyWrap {
+	c, err := ks.block(kek)
+	if err != nil {
+		panic(err)
+	}
+	return &KeyWrap{cipher: c, keySize: len(kek), padded: ks.padded}
+}
+
+type KeyWrap struct {
+	cipher  cipher.Block
+	keySize int
+	padded  bool
+}
+
+func (kw *KeyWrap) KeySize() int {
+	return kw.keySize
+}
+
+func (kw *KeyWrap) Wrap(key []byte) ([]byte, error) {
+	if !kw.padded {
+		if len(key) < 16 || len(key)%8 != 0 {
+			return nil, errWrapSize
+		}
+		return kw.wrap(kwIV, key), nil
+	}
+	if len(key) == 0 || uint64(len(key)) > 0xFFFFFFFF {
+		return nil, errWrapSize
+	}
+	iv := make([]byte, 8)
+	copy(iv, kwpIV)
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(key)))
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+	if len(padded) == 8 {
+		// single block is encrypted directly (RFC 5649, section 4.1)
+		out := make([]byte, 16)
+		copy(out, iv)
+		copy(out[8:], padded)
+		kw.cipher.Encrypt(out, out)
+		return out, nil
+	}
+	return kw.wrap(iv, padded), nil
+}
+
+func (kw *KeyWrap) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errUnwrapSize
+	}
+	var iv, key []byte
+	if kw.padded && len(wrapped) == 16 {
+		out := make([]byte, 16)
+		kw.cipher.Decrypt(out, wrapped)
+		iv, key = out[:8], out[8:]
+	} else {
+		if !kw.padded && len(wrapped) < 24 {
+			return nil, errUnwrapSize
+		}
+		iv, key = kw.unwrap(wrapped)
+	}
+	if !kw.padded {
+		if subtle.ConstantTimeCompare(iv, kwIV) != 1 {
+			return nil, errIntegrity
+		}
+		return key, nil
+	}
+	if subtle.ConstantTimeCompare(iv[:4], kwpIV) != 1 {
+		return nil, errIntegrity
+	}
+	size := int(binary.BigEndian.Uint32(iv[4:]))
+	if size > len(key) || size <= len(key)-8 {
+		return nil, errIntegrity
+	}
+	for _, b := range key[size:] {
+		if b != 0 {
+			return nil, errIntegrity
+		}
+	}
+	return key[:size], nil
+}
+
+func (kw *KeyWrap) Close() {
+	kw.cipher = nil
+}
+
+// wrap implements the wrapping process W from RFC 3394, section 2.2.1.
+func (kw *KeyWrap) wrap(iv, key []byte) []byte {
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out[8:], key)
+	var b [16]byte
+	copy(b[:8], iv)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[8:], out[i*8:])
+			kw.cipher.Encrypt(b[:], b[:])
+			t := binary.BigEndian.Uint64(b[:8]) ^ uint64(n*j+i)
+			binary.BigEndian.PutUint64(b[:8], t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	copy(out, b[:8])
+	return out
+}
+
+// unwrap implements the unwrapping process W-1 from RFC 3394, section 2.2.2.
+// It returns the recovered initial value and key material.
+func (kw *KeyWrap) unwrap(wrapped []byte) (iv, key []byte) {
+	n := len(wrapped)/8 - 1
+	key = make([]byte, len(wrapped)-8)
+	copy(key, wrapped[8:])
+	var b [16]byte
+	copy(b[:8], wrapped)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := binary.BigEndian.Uint64(b[:8]) ^ uint64(n*j+i)
+			binary.BigEndian.PutUint64(b[:8], t)
+			copy(b[8:], key[(i-1)*8:])
+			kw.cipher.Decrypt(b[:], b[:])
+			copy(key[(i-1)*8:], b[8:])
+		}
+	}
+	return b[:8], key
+}
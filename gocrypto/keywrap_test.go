@@ -0,0 +1,64 @@
+package gocrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAES_KW(t *testing.T) {
+	// RFC 3394, 4.1 Wrap 128 bits of Key Data with a 128-bit KEK
+	kw := AES_KW.New(h2b("000102030405060708090A0B0C0D0E0F"))
+	defer kw.Close()
+	key := h2b("00112233445566778899AABBCCDDEEFF")
+	wrapped, err := kw.Wrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(wrapped) != "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5" {
+		t.Fatalf("Wrong wrapped key: %x", wrapped)
+	}
+	unwrapped, err := kw.Unwrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, key) {
+		t.Fatal("Unwrapped does not match key")
+	}
+	wrapped[5] ^= 1
+	if _, err = kw.Unwrap(wrapped); err == nil {
+		t.Fatal("Unwrap of corrupted input succeeded")
+	}
+	if _, err = kw.Wrap(key[:12]); err == nil {
+		t.Fatal("Wrap of invalid key size succeeded")
+	}
+}
+
+func TestAES_KWP(t *testing.T) {
+	// RFC 5649, section 6
+	kw := AES_KWP.New(h2b("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8"))
+	defer kw.Close()
+	for _, v := range []struct{ key, wrapped string }{
+		{"c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	} {
+		wrapped, err := kw.Wrap(h2b(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(wrapped) != v.wrapped {
+			t.Fatalf("Wrong wrapped key: %x", wrapped)
+		}
+		unwrapped, err := kw.Unwrap(wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(unwrapped) != v.key {
+			t.Fatal("Unwrapped does not match key")
+		}
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err = kw.Unwrap(wrapped); err == nil {
+			t.Fatal("Unwrap of corrupted input succeeded")
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package gocrypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+type algorithmParameters interface {
+	// generate creates a new key of given size, the random is nil unless provided with the key parameters
+	generate(size int, random okapi.Random) (key *PKey, err error)
+	// regenerate creates a new key with the same parameters as the provided key
+	regenerate(key *PKey, random okapi.Random) (*PKey, error)
+	// accept validates imported key material and converts it to the form used by the algorithm
+	accept(private, public interface{}) (*PKey, error)
+	isForSigning() bool
+	isForEncryption() bool
+	isForKeyAgreement() bool
+}
+
+type encrypter interface {
+	encrypt(public interface{}, plain []byte, random okapi.Random) ([]byte, error)
+	decrypt(private interface{}, encrypted []byte) ([]byte, error)
+}
+
+type signer interface {
+	sign(private interface{}, digest []byte, random okapi.Random) ([]byte, error)
+	verify(public interface{}, signature, digest []byte) (bool, error)
+}
+
+type deriver interface {
+	derive(private, peer interface{}) ([]byte, error)
+}
+
+// PKey is a public or private key of any of the supported algorithms.
+// The key material is held in the corresponding crypto package types,
+// the private field is nil for public keys.
+// The random is the source of randomness provided with okapi.KeyParameters, if any.
+type PKey struct {
+	private    interface{}
+	public     interface{}
+	parameters algorithmParameters
+	random     okapi.Random
+}
+
+func (key *PKey) Decrypt(encrypted []byte) (decrypted []byte, err error) {
+	if key.private == nil {
+		return nil, errors.New("Public key cannot decrypt!")
+	}
+	if !key.parameters.isForEncryption() {
+		return nil, errors.New("Key is not configured for encryption!")
+	}
+	return key.parameters.(encrypter).decrypt(key.private, encrypted)
+}
+
+func (key *PKey) Sign(digest []byte) (signature []byte, err error) {
+	if key.private == nil {
+		return nil, errors.New("Public key cannot sign!")
+	}
+	if !key.parameters.isForSigning() {
+		return nil, errors.New("Key is not configured for signing!")
+	}
+	return key.parameters.(signer).sign(key.private, digest, key.random)
+}
+
+func (key *PKey) Derive(peer okapi.PublicKey) (secret []byte, err error) {
+	if key.private == nil {
+		return nil, errors.New("Public key cannot derive!")
+	}
+	if !key.parameters.isForKeyAgreement() {
+		return nil, errors.New("Key is not configured for key agreement!")
+	}
+	other, ok := peer.(*PKey)
+	if !ok {
+		return nil, errors.New("Peer key is not a gocrypto key!")
+	}
+	return key.parameters.(deriver).derive(key.private, other.public)
+}
+
+// PublicKey returns a new public key, closing it doesn't affect the original key.
+func (key *PKey) PublicKey() okapi.PublicKey {
+	return &PKey{public: key.public, parameters: key.parameters, random: key.random}
+}
+
+func (key *PKey) Encrypt(plain []byte) (encrypted []byte, err error) {
+	if !key.parameters.isForEncryption() {
+		return nil, errors.New("Key is not configured for encryption!")
+	}
+	return key.parameters.(encrypter).encrypt(key.public, plain, key.random)
+}
+
+func (key *PKey) Verify(signature []byte, digest []byte) (valid bool, err error) {
+	if !key.parameters.isForSigning() {
+		return false, errors.New("Key is not configured for signing!")
+	}
+	return key.parameters.(signer).verify(key.public, signature, digest)
+}
+
+func (key *PKey) Export() ([]byte, error) {
+	if key.private != nil {
+		return x509.MarshalPKCS8PrivateKey(key.private)
+	}
+	return x509.MarshalPKIXPublicKey(key.public)
+}
+
+func (key *PKey) Close() {
+	key.private = nil
+	key.public = nil
+	key.random = nil
+}
+
+func (key *PKey) KeySize() int {
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		return public.N.BitLen()
+	case *ecdh.PublicKey:
+		return curveSize(public.Curve())
+	case *ecdsa.PublicKey:
+		return public.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return ed25519Size
+	}
+	return 0
+}
+
+// NewPKey creates a key from the key parameters (kps) configured with the algorithm parameters (aps).
+// The key parameters can be:
+// * int: generates a new key of given size in bits
+// * string: reads the key from PEM encoding
+// * []byte: reads the key from DER encoding (PKCS#8, PKCS#1 or SEC 1 private key, or X.509 public key)
+// * *PKey: generates a new key with the same parameters (size or curve) as the provided key
+// * okapi.KeyParameters: any of the above with the Random used by the key
+func NewPKey(kps interface{}, aps algorithmParameters) (key *PKey, err error) {
+	var random okapi.Random
+	if p, ok := kps.(okapi.KeyParameters); ok {
+		kps, random = p.Parameters, p.Random
+	}
+	switch kps := kps.(type) {
+	case int:
+		key, err = aps.generate(kps, random)
+	case string:
+		block, _ := pem.Decode([]byte(kps))
+		if block == nil {
+			return nil, errors.New("Invalid PEM input")
+		}
+		key, err = newPKeyFromDER(block.Bytes, aps)
+	case []byte:
+		key, err = newPKeyFromDER(kps, aps)
+	case *PKey:
+		key, err = aps.regenerate(kps, random)
+	default:
+		err = errors.New("Invalid Parameters")
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.parameters = aps
+	key.random = random
+	return key, nil
+}
+
+func newPKeyFromDER(der []byte, aps algorithmParameters) (*PKey, error) {
+	if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return aps.accept(private, nil)
+	}
+	if private, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return aps.accept(private, nil)
+	}
+	if private, err := x509.ParseECPrivateKey(der); err == nil {
+		return aps.accept(private, nil)
+	}
+	if public, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return aps.accept(nil, public)
+	}
+	return nil, errors.New("Invalid DER input")
+}
@@ -0,0 +1,205 @@
+package gocrypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+)
+
+func TestRSA_OAEP(t *testing.T) {
+	pri, err := NewPKey(1024, RSA_OAEP)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if pri.KeySize() != 1024 {
+		t.Fatal("Invalid key size!")
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	plain := []byte("Message in a bottle!")
+	encrypted, err := pub.Encrypt(plain)
+	if err != nil {
+		t.Fatalf("Encryption failed: %s", err)
+	}
+	decrypted, err := pri.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decryption failed: %s", err)
+	}
+	if !bytes.Equal(plain, decrypted) {
+		t.Fatalf("Result mismatch\nPlain    : %x\nDecrypted: %x\n", plain, decrypted)
+	}
+	if _, err = pri.Sign(plain); err == nil {
+		t.Fatal("Encryption key should not sign")
+	}
+}
+
+func TestRSA_PSS_SHA256(t *testing.T) {
+	pri, _ := NewPKey(1024, RSA_PSS_SHA256)
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	digest := sha256.Sum256([]byte("Message in a bottle!"))
+	signature, err := pri.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, digest[:])
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	digest[0] ^= 1
+	if valid, _ = pub.Verify(signature, digest[:]); valid {
+		t.Fatal("Verification of wrong digest succeeded")
+	}
+}
+
+func TestECDH(t *testing.T) {
+	pri1, err := NewPKey(256, ECDH)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri1.Close()
+	pub1 := pri1.PublicKey()
+	defer pub1.Close()
+	pri2, err := NewPKey(pub1, ECDH)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri2.Close()
+	if pri2.KeySize() != 256 {
+		t.Fatal("Invalid key size!")
+	}
+	pub2 := pri2.PublicKey()
+	defer pub2.Close()
+	secret1, err := pri1.Derive(pub2)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	secret2, err := pri2.Derive(pub1)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	if !bytes.Equal(secret1, secret2) {
+		t.Fatalf("\nDerivation mismatch\nSecret 1: %x\nSecret 2: %x", secret1, secret2)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for _, key := range []struct {
+		aps  algorithmParameters
+		size int
+	}{{RSA_OAEP, 2048}, {ECDH, 384}} {
+		pri, err := NewPKey(key.size, key.aps)
+		if err != nil {
+			t.Fatalf("Failed generating key: %s", err)
+		}
+		defer pri.Close()
+		der, err := pri.PublicKey().(*PKey).Export()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		imported, err := NewPKey(der, key.aps)
+		if err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		defer imported.Close()
+		if imported.private != nil || imported.KeySize() != key.size {
+			t.Fatal("Invalid imported key")
+		}
+		again, _ := imported.PublicKey().(*PKey).Export()
+		if !bytes.Equal(der, again) {
+			t.Fatal("Exported keys mismatch")
+		}
+		if _, err = NewPKey(der[1:], key.aps); err == nil {
+			t.Fatal("Import of invalid DER succeeded")
+		}
+	}
+}
+
+func TestPublicKeyClose(t *testing.T) {
+	pri, _ := NewPKey(1024, RSA_OAEP)
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	pub.(*PKey).PublicKey().Close()
+	if _, err := pub.Encrypt([]byte("plain")); err != nil {
+		t.Fatalf("Closing public key of a public key disabled it: %s", err)
+	}
+}
+
+func TestECDSA_SHA384(t *testing.T) {
+	pri, err := NewPKey(384, ECDSA_SHA384)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	digest := sha512.Sum384([]byte("Message in a bottle!"))
+	signature, err := pri.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, digest[:])
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	digest[0] ^= 1
+	if valid, _ = pub.Verify(signature, digest[:]); valid {
+		t.Fatal("Verification of wrong digest succeeded")
+	}
+}
+
+func TestEd25519(t *testing.T) {
+	pri, err := NewPKey(0, Ed25519)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	message := []byte("Message in a bottle!")
+	signature, err := pri.Sign(message)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, message)
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	message[0] ^= 1
+	if valid, _ = pub.Verify(signature, message); valid {
+		t.Fatal("Verification of wrong message succeeded")
+	}
+}
+
+func TestExportImportPrivate(t *testing.T) {
+	for _, key := range []struct {
+		aps  algorithmParameters
+		size int
+	}{{RSA_OAEP, 2048}, {ECDH, 384}, {ECDSA_SHA256, 384}, {Ed25519, 256}} {
+		pri, err := NewPKey(key.size, key.aps)
+		if err != nil {
+			t.Fatalf("Failed generating key: %s", err)
+		}
+		defer pri.Close()
+		der, err := pri.Export()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		imported, err := NewPKey(der, key.aps)
+		if err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		defer imported.Close()
+		if imported.private == nil || imported.KeySize() != pri.KeySize() {
+			t.Fatal("Invalid imported key")
+		}
+		again, _ := imported.Export()
+		if !bytes.Equal(der, again) {
+			t.Fatal("Exported keys mismatch")
+		}
+	}
+}
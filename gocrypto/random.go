@@ -1,12 +1,15 @@
 package gocrypto
 
 import (
+	"crypto/fips140"
 	"crypto/rand"
+	"errors"
 	"github.com/mkobetic/okapi"
+	"io"
 )
 
 func init() {
-	okapi.DefaultRandom = DefaultRandom
+	okapi.Register(&okapi.DefaultRandom, DefaultRandom)
 }
 
 type RandomSpec struct{}
@@ -28,3 +31,42 @@ func (r *Random) Read(b []byte) (int, error) {
 
 func (r *Random) Close() {
 }
+
+// customRandom returns the Random to use instead of crypto/rand: the provided one
+// (the Random of the key), or if it's nil, one created from okapi.DefaultRandom,
+// if it was replaced with a RandomSpec other than the DefaultRandom of this package.
+// It returns nil if crypto/rand should be used. The release function must be called
+// when the returned Random is no longer needed.
+// Go crypto packages may ignore custom random sources, see randomReader.
+func customRandom(random okapi.Random) (custom okapi.Random, release func()) {
+	random = okapi.UnwrapRandom(random)
+	if _, ok := random.(*Random); ok {
+		return nil, func() {}
+	}
+	if random != nil {
+		return random, func() {}
+	}
+	spec := okapi.UnwrapRandomSpec(okapi.DefaultRandom)
+	if _, ok := spec.(RandomSpec); ok || spec == nil {
+		return nil, func() {}
+	}
+	custom = spec.New()
+	return custom, custom.Close
+}
+
+// randomReader returns the reader to pass to the Go crypto packages, the custom Random if there is one,
+// crypto/rand otherwise. The release function must be called when the reader is no longer needed.
+// Go uses the reader as is (exact) only for OAEP padding and PSS salts. RSA key generation and PKCS#1 v1.5
+// padding mix in bytes from crypto/rand, and FIPS 140 mode ignores the reader altogether,
+// so the output cannot be reproduced with a SeededRandom, randomReader returns an error for it then.
+func randomReader(random okapi.Random, exact bool) (reader io.Reader, release func(), err error) {
+	custom, release := customRandom(random)
+	if custom == nil {
+		return rand.Reader, release, nil
+	}
+	if okapi.IsSeededRandom(custom) && (!exact || fips140.Enabled()) {
+		release()
+		return nil, nil, errors.New("gocrypto cannot reproduce this operation with SeededRandom")
+	}
+	return custom, release, nil
+}
@@ -1,6 +1,8 @@
 package gocrypto
 
 import (
+	"bytes"
+	"github.com/mkobetic/okapi"
 	"testing"
 )
 
@@ -16,3 +18,112 @@ func TestRandom(t *testing.T) {
 		t.Fatalf("Wrong result size %d, expected 10", size)
 	}
 }
+
+// seededKeys generates keys with DefaultRandom seeded with the seed,
+// RSA keys cannot be generated with it (see TestSeededRSA)
+func seededKeys(t *testing.T, seed string) (keys [][]byte) {
+	defer func(random okapi.RandomSpec) { okapi.DefaultRandom = random }(okapi.DefaultRandom)
+	okapi.DefaultRandom = okapi.SeededRandom([]byte(seed))
+	for _, k := range []struct {
+		parameters algorithmParameters
+		size       int
+	}{{ECDSA_SHA256, 256}, {ECDH, 256}, {ECDH, 521}, {Ed25519, 0}} {
+		pri, err := NewPKey(k.size, k.parameters)
+		if err != nil {
+			t.Fatalf("Failed generating key: %s", err)
+		}
+		der, err := pri.Export()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		keys = append(keys, der)
+		pri.Close()
+	}
+	return keys
+}
+
+func TestSeededRandom(t *testing.T) {
+	keys := seededKeys(t, "seed")
+	again := seededKeys(t, "seed")
+	other := seededKeys(t, "other seed")
+	if bytes.Equal(keys[0], keys[1]) {
+		t.Fatal("Successive keys are equal")
+	}
+	for i := range keys {
+		if !bytes.Equal(keys[i], again[i]) {
+			t.Fatalf("Output %d is not reproducible", i)
+		}
+		if bytes.Equal(keys[i], other[i]) {
+			t.Fatalf("Output %d doesn't depend on the seed", i)
+		}
+	}
+	if _, ok := okapi.UnwrapRandomSpec(okapi.DefaultRandom).(RandomSpec); !ok {
+		t.Fatal("DefaultRandom was not restored")
+	}
+}
+
+func TestSeededRSA(t *testing.T) {
+	random := okapi.SeededRandom([]byte("seed")).New()
+	defer random.Close()
+	if _, err := NewPKey(okapi.KeyParameters{Parameters: 2048, Random: random}, RSA_OAEP); err == nil {
+		t.Fatal("RSA key generated with SeededRandom")
+	}
+	pri, err := NewPKey(2048, RSA)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if _, err = RSA.encrypt(pri.public, []byte("plain"), random); err == nil {
+		t.Fatal("PKCS#1 v1.5 padding generated with SeededRandom")
+	}
+	if _, err = RSA_OAEP.encrypt(pri.public, []byte("plain"), random); err != nil {
+		t.Fatalf("OAEP padding failed with SeededRandom: %s", err)
+	}
+}
+
+// keyOutputs generates keys and signatures with the Random seeded with the seed
+func keyOutputs(t *testing.T, seed string) (outputs [][]byte) {
+	random := okapi.SeededRandom([]byte(seed)).New()
+	defer random.Close()
+	digest := make([]byte, 32)
+	for _, k := range []struct {
+		parameters algorithmParameters
+		size       int
+	}{{ECDSA_SHA256, 256}, {ECDSA_SHA512, 521}} {
+		pri, err := NewPKey(okapi.KeyParameters{Parameters: k.size, Random: random}, k.parameters)
+		if err != nil {
+			t.Fatalf("Failed generating key: %s", err)
+		}
+		der, err := pri.Export()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		outputs = append(outputs, der)
+		signature, err := pri.Sign(digest)
+		if err != nil {
+			t.Fatalf("Signing failed: %s", err)
+		}
+		pub := pri.PublicKey()
+		if valid, err := pub.Verify(signature, digest); !valid || err != nil {
+			t.Fatalf("Verification failed: %v", err)
+		}
+		outputs = append(outputs, signature)
+		pub.Close()
+		pri.Close()
+	}
+	return outputs
+}
+
+func TestKeyParameters(t *testing.T) {
+	outputs := keyOutputs(t, "seed")
+	again := keyOutputs(t, "seed")
+	other := keyOutputs(t, "other seed")
+	for i := range outputs {
+		if !bytes.Equal(outputs[i], again[i]) {
+			t.Fatalf("Output %d is not reproducible", i)
+		}
+		if bytes.Equal(outputs[i], other[i]) {
+			t.Fatalf("Output %d doesn't depend on the Random", i)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gocrypto
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.RSA, RSA.constructor())
+	okapi.Register(&okapi.RSA_OAEP, RSA_OAEP.constructor())
+	okapi.Register(&okapi.RSA_MD5, RSA_MD5.constructor())
+	okapi.Register(&okapi.RSA_SHA1, RSA_SHA1.constructor())
+	okapi.Register(&okapi.RSA_SHA224, RSA_SHA224.constructor())
+	okapi.Register(&okapi.RSA_SHA256, RSA_SHA256.constructor())
+	okapi.Register(&okapi.RSA_SHA384, RSA_SHA384.constructor())
+	okapi.Register(&okapi.RSA_SHA512, RSA_SHA512.constructor())
+	okapi.Register(&okapi.RSA_PSS_MD5, RSA_PSS_MD5.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA1, RSA_PSS_SHA1.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA224, RSA_PSS_SHA224.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA256, RSA_PSS_SHA256.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA384, RSA_PSS_SHA384.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA512, RSA_PSS_SHA512.constructor())
+}
+
+const (
+	rsaPKCS1 = iota
+	rsaOAEP
+	rsaPSS
+)
+
+type rsaParameters struct {
+	padding int
+	hash    crypto.Hash
+}
+
+var (
+	RSA            = rsaParameters{rsaPKCS1, 0}
+	RSA_OAEP       = rsaParameters{rsaOAEP, 0}
+	RSA_MD5        = rsaParameters{rsaPKCS1, crypto.MD5}
+	RSA_SHA1       = rsaParameters{rsaPKCS1, crypto.SHA1}
+	RSA_SHA224     = rsaParameters{rsaPKCS1, crypto.SHA224}
+	RSA_SHA256     = rsaParameters{rsaPKCS1, crypto.SHA256}
+	RSA_SHA384     = rsaParameters{rsaPKCS1, crypto.SHA384}
+	RSA_SHA512     = rsaParameters{rsaPKCS1, crypto.SHA512}
+	RSA_PSS_MD5    = rsaParameters{rsaPSS, crypto.MD5}
+	RSA_PSS_SHA1   = rsaParameters{rsaPSS, crypto.SHA1}
+	RSA_PSS_SHA224 = rsaParameters{rsaPSS, crypto.SHA224}
+	RSA_PSS_SHA256 = rsaParameters{rsaPSS, crypto.SHA256}
+	RSA_PSS_SHA384 = rsaParameters{rsaPSS, crypto.SHA384}
+	RSA_PSS_SHA512 = rsaParameters{rsaPSS, crypto.SHA512}
+)
+
+func (p rsaParameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+func (p rsaParameters) isForEncryption() bool   { return p.hash == 0 }
+func (p rsaParameters) isForSigning() bool      { return p.hash != 0 }
+func (p rsaParameters) isForKeyAgreement() bool { return false }
+
+// generate returns an error with a seeded Random, see randomReader.
+func (p rsaParameters) generate(size int, random okapi.Random) (*PKey, error) {
+	reader, release, err := randomReader(random, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	pri, err := rsa.GenerateKey(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	return &PKey{private: pri, public: &pri.PublicKey}, nil
+}
+
+func (p rsaParameters) regenerate(key *PKey, random okapi.Random) (*PKey, error) {
+	return p.generate(key.KeySize(), random)
+}
+
+func (p rsaParameters) accept(private, public interface{}) (*PKey, error) {
+	if pri, ok := private.(*rsa.PrivateKey); ok {
+		return &PKey{private: pri, public: &pri.PublicKey}, nil
+	}
+	if pub, ok := public.(*rsa.PublicKey); ok {
+		return &PKey{public: pub}, nil
+	}
+	return nil, errors.New("Not an RSA key")
+}
+
+// OAEP uses SHA1 for both the label hash and MGF1 to match the OpenSSL defaults.
+func (p rsaParameters) encrypt(public interface{}, plain []byte, random okapi.Random) ([]byte, error) {
+	reader, release, err := randomReader(random, p.padding == rsaOAEP)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if p.padding == rsaOAEP {
+		return rsa.EncryptOAEP(sha1.New(), reader, public.(*rsa.PublicKey), plain, nil)
+	}
+	return rsa.EncryptPKCS1v15(reader, public.(*rsa.PublicKey), plain)
+}
+
+func (p rsaParameters) decrypt(private interface{}, encrypted []byte) ([]byte, error) {
+	if p.padding == rsaOAEP {
+		return rsa.DecryptOAEP(sha1.New(), nil, private.(*rsa.PrivateKey), encrypted, nil)
+	}
+	return rsa.DecryptPKCS1v15(nil, private.(*rsa.PrivateKey), encrypted)
+}
+
+func (p rsaParameters) sign(private interface{}, digest []byte, random okapi.Random) ([]byte, error) {
+	if p.padding == rsaPSS {
+		options := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: p.hash}
+		reader, release, err := randomReader(random, true)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return rsa.SignPSS(reader, private.(*rsa.PrivateKey), p.hash, digest, options)
+	}
+	return rsa.SignPKCS1v15(nil, private.(*rsa.PrivateKey), p.hash, digest)
+}
+
+func (p rsaParameters) verify(public interface{}, signature, digest []byte) (bool, error) {
+	var err error
+	if p.padding == rsaPSS {
+		options := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: p.hash}
+		err = rsa.VerifyPSS(public.(*rsa.PublicKey), p.hash, digest, signature, options)
+	} else {
+		err = rsa.VerifyPKCS1v15(public.(*rsa.PublicKey), p.hash, digest, signature)
+	}
+	if err == rsa.ErrVerification {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,146 @@
+package gocrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+	"github.com/mkobetic/okapi"
+)
+
+// siv implements AES-SIV as specified in RFC 5297.
+type siv struct {
+	mac     cipher.Block // CMAC key (K1)
+	ctr     cipher.Block // CTR key (K2)
+	keySize int
+}
+
+func newSIV(key []byte) (aead okapi.AEAD, err error) {
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("invalid AES_SIV key size: %d", len(key))
+	}
+	half := len(key) / 2
+	s := &siv{keySize: len(key)}
+	if s.mac, err = aes.NewCipher(key[:half]); err != nil {
+		return nil, err
+	}
+	if s.ctr, err = aes.NewCipher(key[half:]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *siv) NonceSize() int {
+	return 0
+}
+
+func (s *siv) Overhead() int {
+	return aes.BlockSize
+}
+
+func (s *siv) KeySize() int {
+	return s.keySize
+}
+
+func (s *siv) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	v := s.s2v(nonce, plain, data)
+	out, tail := grow(dst, len(v)+len(plain))
+	copy(tail, v)
+	s.crypt(tail[len(v):], plain, v)
+	return out
+}
+
+func (s *siv) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	if len(encrypted) < aes.BlockSize {
+		return nil, errOpen
+	}
+	v := encrypted[:aes.BlockSize]
+	encrypted = encrypted[aes.BlockSize:]
+	out, plain := grow(dst, len(encrypted))
+	s.crypt(plain, encrypted, v)
+	if subtle.ConstantTimeCompare(v, s.s2v(nonce, plain, data)) != 1 {
+		for i := range plain {
+			plain[i] = 0
+		}
+		return nil, errOpen
+	}
+	return out, nil
+}
+
+func (s *siv) Close() {
+	s.mac = nil
+	s.ctr = nil
+}
+
+// crypt runs CTR mode keyed with K2 and initial counter derived from the synthetic IV v.
+func (s *siv) crypt(out, in, v []byte) {
+	var q [aes.BlockSize]byte
+	copy(q[:], v)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	cipher.NewCTR(s.ctr, q[:]).XORKeyStream(out, in)
+}
+
+// s2v computes the synthetic IV from the associated data components,
+// the nonce (treated as the last associated data component) and the plain input.
+func (s *siv) s2v(nonce, plain []byte, data [][]byte) []byte {
+	var d, t [aes.BlockSize]byte
+	s.cmac(d[:], d[:])
+	for _, component := range data {
+		dbl(d[:])
+		s.cmac(t[:], component)
+		xor(d[:], d[:], t[:])
+	}
+	if len(nonce) > 0 {
+		dbl(d[:])
+		s.cmac(t[:], nonce)
+		xor(d[:], d[:], t[:])
+	}
+	var last []byte
+	if len(plain) >= aes.BlockSize {
+		last = make([]byte, len(plain))
+		copy(last, plain)
+		tail := last[len(last)-aes.BlockSize:]
+		xor(tail, tail, d[:])
+	} else {
+		dbl(d[:])
+		last = d[:]
+		for i := range plain {
+			last[i] ^= plain[i]
+		}
+		last[len(plain)] ^= 0x80
+	}
+	v := make([]byte, aes.BlockSize)
+	s.cmac(v, last)
+	return v
+}
+
+// cmac computes CMAC (RFC 4493) of the input with the K1 key and writes it to out.
+func (s *siv) cmac(out, in []byte) {
+	var k, x [aes.BlockSize]byte
+	s.mac.Encrypt(k[:], k[:])
+	dbl(k[:])
+	for len(in) > aes.BlockSize {
+		xor(x[:], x[:], in[:aes.BlockSize])
+		s.mac.Encrypt(x[:], x[:])
+		in = in[aes.BlockSize:]
+	}
+	if len(in) < aes.BlockSize {
+		dbl(k[:])
+		k[len(in)] ^= 0x80
+	}
+	xor(x[:len(in)], x[:len(in)], in)
+	xor(x[:], x[:], k[:])
+	s.mac.Encrypt(out, x[:])
+}
+
+// dbl multiplies the block by x in GF(2^128) (RFC 5297, section 2.3).
+func dbl(b []byte) {
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] = b[len(b)-1]<<1 ^ 0x87*carry
+}
@@ -0,0 +1,650 @@
+package okapi
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The implementations registered with Register are assigned to the predefined variables wrapped in guards.
+// The guards check the algorithms and keys against FIPS mode and the current policy
+// before delegating to the implementations, and notify the observer and track the instances if needed.
+// The variables keep their guards, the refused specs panic with a *FIPSError or *PolicyViolation.
+
+// algorithm identifies a predefined variable and its status in FIPS mode
+type algorithm struct {
+	name     string
+	approval fipsApproval
+}
+
+// check returns the error refusing the algorithm in FIPS mode or by the policy
+func (a algorithm) check(p *Policy) error {
+	if err := a.fipsCheck(); err != nil {
+		return err
+	}
+	return p.checkAlgorithm(a.name)
+}
+
+// mustCheck panics with the error refusing the algorithm
+func (a algorithm) mustCheck() {
+	if err := a.check(currentPolicy()); err != nil {
+		panic(err)
+	}
+}
+
+// variable is a predefined variable, or a generic algorithm (e.g. a DRBG) that is only self-tested
+type variable struct {
+	algorithm
+	// pointer is the address of the predefined variable, nil for the generic algorithms
+	pointer interface{}
+	// assigned returns the implementation assigned to the variable without its guard, nil if there is none
+	assigned func() interface{}
+	// test is the FIPS known-answer test of an implementation, nil if there is none
+	test func(implementation interface{}) error
+	// guard replaces the assigned implementation with its guard
+	guard func()
+}
+
+var registry struct {
+	sync.Mutex
+	// implementations of the predefined variables by provider
+	implementations map[interface{}]map[string]interface{}
+}
+
+// Register assigns the implementation of a provider to a predefined variable, e.g.
+//
+//	okapi.Register(&okapi.SHA256, SHA256)
+//
+// Unlike a plain assignment it wraps the implementation in a guard enforcing FIPS mode and the policy,
+// notifying the observer and tracking the leaks, and it records the implementation, so that EnableFIPS self-tests
+// the implementations of all registered providers, including those that were replaced in the variable
+// by another provider and can still be used directly (e.g. libcrypto.AES_CBC).
+// Register is called by the init functions of the implementation packages, it must not be called
+// while other goroutines use the predefined variables.
+func Register(variable interface{}, implementation interface{}) {
+	switch v := variable.(type) {
+	case *HashSpec:
+		*v = implementation.(HashSpec)
+	case *MACSpec:
+		*v = implementation.(MACSpec)
+	case *CipherSpec:
+		*v = implementation.(CipherSpec)
+	case *AEADSpec:
+		*v = implementation.(AEADSpec)
+	case *KeyWrapSpec:
+		*v = implementation.(KeyWrapSpec)
+	case *KeyConstructor:
+		*v = implementation.(KeyConstructor)
+	case *RandomSpec:
+		*v = implementation.(RandomSpec)
+	default:
+		panic(fmt.Sprintf("%T is not a predefined variable", variable))
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.implementations == nil {
+		registry.implementations = make(map[interface{}]map[string]interface{})
+	}
+	providers := registry.implementations[variable]
+	if providers == nil {
+		providers = make(map[string]interface{})
+		registry.implementations[variable] = providers
+	}
+	providers[providerOf(implementation)] = implementation
+	for _, v := range variables {
+		if v.pointer == variable {
+			v.guard()
+		}
+	}
+}
+
+// implementations returns the registered implementations of the variable and the assigned one by provider
+func (v variable) implementations() map[string]interface{} {
+	registry.Lock()
+	defer registry.Unlock()
+	implementations := make(map[string]interface{})
+	for provider, implementation := range registry.implementations[v.pointer] {
+		implementations[provider] = implementation
+	}
+	if assigned := v.assigned(); assigned != nil {
+		implementations[providerOf(assigned)] = assigned
+	}
+	return implementations
+}
+
+// hashOf returns the implementation of the hash by the provider, or nil,
+// e.g. the hash used in the HMAC self-test, as the implementations accept only their own HashSpecs
+func hashOf(spec *HashSpec, provider string) HashSpec {
+	if *spec != nil && providerOf(unguardedHash(*spec)) == provider {
+		return unguardedHash(*spec)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	hash, _ := registry.implementations[spec][provider].(HashSpec)
+	return hash
+}
+
+func hashVariable(name string, spec *HashSpec, digest string) variable {
+	a := algorithm{name, notApproved}
+	if digest != "" {
+		a.approval = approved
+	}
+	v := variable{
+		algorithm: a,
+		pointer:   spec,
+		assigned: func() interface{} {
+			if *spec == nil {
+				return nil
+			}
+			return unguardedHash(*spec)
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedHash{a, *spec, providerOf(*spec)}
+			}
+		},
+	}
+	if a.approval != notApproved {
+		v.test = func(implementation interface{}) error {
+			return katHash(implementation.(HashSpec), digest)
+		}
+	}
+	return v
+}
+
+type guardedHash struct {
+	algorithm
+	spec     HashSpec
+	provider string
+}
+
+func (h guardedHash) New() Hash {
+	o := observe(OpNewHash, h.name, h.provider, 0, 0)
+	defer o.finish()
+	h.mustCheck()
+	return trackHash(observeHash(h.spec.New(), OpHash, h.name, h.provider, 0), h.name)
+}
+
+func unguardedHash(spec HashSpec) HashSpec {
+	if h, ok := spec.(guardedHash); ok {
+		return h.spec
+	}
+	return spec
+}
+
+func macVariable(name string, spec *MACSpec, approval fipsApproval, kat func(MACSpec) error) variable {
+	a := algorithm{name, approval}
+	v := variable{
+		algorithm: a,
+		pointer:   spec,
+		assigned: func() interface{} {
+			if m, ok := (*spec).(guardedMAC); ok {
+				return m.spec
+			}
+			if *spec == nil {
+				return nil
+			}
+			return *spec
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedMAC{a, *spec, providerOf(*spec)}
+			}
+		},
+	}
+	if approval != notApproved {
+		v.test = func(implementation interface{}) error {
+			return kat(implementation.(MACSpec))
+		}
+	}
+	return v
+}
+
+// guardedMAC checks the hash as well, and unwraps it
+// because the implementations accept only their own HashSpecs.
+type guardedMAC struct {
+	algorithm
+	spec     MACSpec
+	provider string
+}
+
+func (m guardedMAC) New(hash HashSpec, key []byte) Hash {
+	o := observe(OpNewMAC, m.name, m.provider, len(key)*8, 0)
+	defer o.finish()
+	m.mustCheck()
+	if h, ok := hash.(guardedHash); ok {
+		h.mustCheck()
+		hash = h.spec
+	}
+	return trackHash(observeHash(m.spec.New(hash, key), OpMAC, m.name, m.provider, len(key)*8), m.name)
+}
+
+func (m guardedMAC) NewWithKey(hash HashSpec, key *SecretKey) (Hash, error) {
+	return key.NewMAC(m, hash)
+}
+
+func cipherVariable(name string, spec *CipherSpec, approval fipsApproval, kat *cipherKAT) variable {
+	a := algorithm{name, approval}
+	v := variable{
+		algorithm: a,
+		pointer:   spec,
+		assigned: func() interface{} {
+			if c, ok := (*spec).(guardedCipher); ok {
+				return c.spec
+			}
+			if *spec == nil {
+				return nil
+			}
+			return *spec
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedCipher{a, *spec, providerOf(*spec)}
+			}
+		},
+	}
+	if approval != notApproved {
+		v.test = func(implementation interface{}) error {
+			return kat.run(implementation.(CipherSpec), approval == approved)
+		}
+	}
+	return v
+}
+
+type guardedCipher struct {
+	algorithm
+	spec     CipherSpec
+	provider string
+}
+
+func (c guardedCipher) New(key, iv []byte, encrypt bool) Cipher {
+	o := observe(OpNewCipher, c.name, c.provider, len(key)*8, 0)
+	defer o.finish()
+	c.mustCheck()
+	if encrypt && c.approval == decryptionOnly && fipsEnabled.Load() {
+		panic(&FIPSError{c.name, "is approved only for decryption in FIPS mode"})
+	}
+	operation := OpDecrypt
+	if encrypt {
+		operation = OpEncrypt
+	}
+	return trackCipher(observeCipher(c.spec.New(key, iv, encrypt), operation, c.name, c.provider, len(key)*8), c.name)
+}
+
+func (c guardedCipher) NewReader(in io.Reader, key, iv, buffer []byte) *CipherReader {
+	return NewCipherReader(in, c, key, iv, buffer)
+}
+
+func (c guardedCipher) NewWriter(out io.Writer, key, iv, buffer []byte) *CipherWriter {
+	return NewCipherWriter(out, c, key, iv, buffer)
+}
+
+func (c guardedCipher) NewWithKey(key *SecretKey, iv []byte, encrypt bool) (Cipher, error) {
+	return key.NewCipher(c, iv, encrypt)
+}
+
+func aeadVariable(name string, spec *AEADSpec, approval fipsApproval, kat *aeadKAT) variable {
+	a := algorithm{name, approval}
+	v := variable{
+		algorithm: a,
+		pointer:   spec,
+		assigned: func() interface{} {
+			if g, ok := (*spec).(guardedAEAD); ok {
+				return g.spec
+			}
+			if *spec == nil {
+				return nil
+			}
+			return *spec
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedAEAD{a, *spec, providerOf(*spec)}
+			}
+		},
+	}
+	if approval != notApproved {
+		v.test = func(implementation interface{}) error {
+			return kat.run(implementation.(AEADSpec))
+		}
+	}
+	return v
+}
+
+type guardedAEAD struct {
+	algorithm
+	spec     AEADSpec
+	provider string
+}
+
+func (g guardedAEAD) New(key []byte) AEAD {
+	o := observe(OpNewAEAD, g.name, g.provider, len(key)*8, 0)
+	defer o.finish()
+	g.mustCheck()
+	aead := g.spec.New(key)
+	if o != nil {
+		aead = &observedAEAD{aead, g.name, g.provider, len(key) * 8}
+	}
+	return trackAEAD(aead, g.name)
+}
+
+// keyWrapVariable guards a KeyWrapSpec, all key wrapping algorithms are approved
+func keyWrapVariable(name string, spec *KeyWrapSpec, kat *keyWrapKAT) variable {
+	a := algorithm{name, approved}
+	return variable{
+		algorithm: a,
+		pointer:   spec,
+		assigned: func() interface{} {
+			if g, ok := (*spec).(guardedKeyWrap); ok {
+				return g.spec
+			}
+			if *spec == nil {
+				return nil
+			}
+			return *spec
+		},
+		test: func(implementation interface{}) error {
+			return kat.run(implementation.(KeyWrapSpec))
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedKeyWrap{a, *spec, providerOf(*spec)}
+			}
+		},
+	}
+}
+
+type guardedKeyWrap struct {
+	algorithm
+	spec     KeyWrapSpec
+	provider string
+}
+
+func (g guardedKeyWrap) New(kek []byte) KeyWrap {
+	o := observe(OpNewKeyWrap, g.name, g.provider, len(kek)*8, 0)
+	defer o.finish()
+	g.mustCheck()
+	kw := g.spec.New(kek)
+	if o != nil {
+		kw = &observedKeyWrap{kw, g.name, g.provider, len(kek) * 8}
+	}
+	return trackKeyWrap(kw, g.name)
+}
+
+// randomVariable tracks the Randoms of the RandomSpec, it is neither checked nor tested
+func randomVariable(name string, spec *RandomSpec) variable {
+	return variable{
+		algorithm: algorithm{name, approved},
+		pointer:   spec,
+		assigned: func() interface{} {
+			if *spec == nil {
+				return nil
+			}
+			return UnwrapRandomSpec(*spec)
+		},
+		guard: func() {
+			if *spec != nil {
+				*spec = guardedRandom{name, UnwrapRandomSpec(*spec)}
+			}
+		},
+	}
+}
+
+type guardedRandom struct {
+	name string
+	spec RandomSpec
+}
+
+func (g guardedRandom) New() Random {
+	return trackRandom(g.spec.New(), g.name)
+}
+
+// keyFamily groups the key constructors with the same kind of keys
+type keyFamily int
+
+const (
+	rsaKey keyFamily = iota
+	dsaKey
+	dhKey
+	// ecKey includes the keys on Edwards and Montgomery curves (Ed25519, X25519)
+	ecKey
+)
+
+// keyVariable guards a KeyConstructor, signatureHash is the hash used by the signing constructors
+func keyVariable(name string, constructor *KeyConstructor, family keyFamily, signatureHash string, approval fipsApproval, kat func(KeyConstructor) error) variable {
+	k := &guardedKey{algorithm: algorithm{name, approval}, family: family, signatureHash: signatureHash}
+	v := variable{
+		algorithm: k.algorithm,
+		pointer:   constructor,
+		assigned: func() interface{} {
+			if k.constructor != nil { // already guarded
+				return k.constructor
+			}
+			if *constructor == nil {
+				return nil
+			}
+			return *constructor
+		},
+		guard: func() {
+			if *constructor != nil {
+				k.constructor, k.provider = *constructor, providerOf(*constructor)
+				*constructor = k.construct
+			}
+		},
+	}
+	if approval != notApproved {
+		v.test = func(implementation interface{}) error {
+			return kat(implementation.(KeyConstructor))
+		}
+	}
+	return v
+}
+
+// guardedKey checks the key size before generating a key of given size,
+// otherwise it checks the size (if the key reports it) of the constructed key, and its curve.
+// The constructed keys are wrapped to check their age and to notify the observer if needed.
+type guardedKey struct {
+	algorithm
+	constructor   KeyConstructor
+	provider      string
+	family        keyFamily
+	signatureHash string
+}
+
+func (k *guardedKey) construct(parameters interface{}) (PrivateKey, error) {
+	o := observe(OpNewKey, k.name, k.provider, 0, 0)
+	key, bits, err := k.newKey(parameters)
+	if o != nil {
+		o.event.KeySize = bits
+		o.done(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		key = &observedKey{key, k.name, k.provider, bits}
+	}
+	return trackPrivateKey(key, k.name), nil
+}
+
+// newKey returns the checked key and its size in bits, if known
+func (k *guardedKey) newKey(parameters interface{}) (PrivateKey, int, error) {
+	p := currentPolicy()
+	if err := k.check(p); err != nil {
+		return nil, 0, err
+	}
+	if err := p.checkSignatureHash(k.name, k.signatureHash); err != nil {
+		return nil, 0, err
+	}
+	kps, created, bits, checked := parameters, time.Time{}, 0, false
+	kp, wrapped := parameters.(KeyParameters)
+	if wrapped {
+		kps, created = kp.Parameters, kp.Created
+	}
+	if k.approval == verificationOnly && fipsEnabled.Load() {
+		switch kps.(type) {
+		case int, PublicKey: // key generation
+			return nil, 0, &FIPSError{k.name, "is approved only for signature verification in FIPS mode"}
+		}
+	}
+	switch kps := kps.(type) {
+	case int:
+		if err := k.checkSize(p, kps); err != nil {
+			return nil, kps, err
+		}
+		created, bits, checked = time.Now(), kps, true
+	case PublicKey:
+		created = time.Now()
+		if wrapped {
+			kp.Parameters = unwrapPublicKey(kps)
+			parameters = kp
+		} else {
+			parameters = unwrapPublicKey(kps)
+		}
+	}
+	if err := p.checkAge(k.name, created); err != nil {
+		return nil, bits, err
+	}
+	key, err := k.constructor(parameters)
+	if err != nil {
+		return nil, bits, err
+	}
+	if size := keySize(key); size > 0 && size != bits {
+		bits, checked = size, false
+	}
+	if err := k.checkKey(p, key, bits, checked); err != nil {
+		key.Close()
+		return nil, bits, err
+	}
+	if p != nil && p.MaxKeyAge > 0 && !created.IsZero() {
+		key = &agedKey{PrivateKey: key, name: k.name, created: created}
+	}
+	if k.approval == verificationOnly && fipsEnabled.Load() {
+		key = &verificationOnlyKey{PrivateKey: key, name: k.name}
+	}
+	return key, bits, nil
+}
+
+// unwrapPublicKey returns the public key of the implementation,
+// the implementations accept only their own keys as the peer or as the key parameters
+func unwrapPublicKey(key PublicKey) PublicKey {
+	for {
+		switch k := key.(type) {
+		case *observedPublicKey:
+			key = k.PublicKey
+		case *trackedPublicKey:
+			key = k.PublicKey
+		default:
+			return key
+		}
+	}
+}
+
+func (k *guardedKey) checkSize(p *Policy, bits int) error {
+	if fipsEnabled.Load() && k.family != ecKey && bits < fipsMinKeySize {
+		return &FIPSError{k.name, fmt.Sprintf("key size %d is smaller than %d bits required in FIPS mode", bits, fipsMinKeySize)}
+	}
+	return p.checkKeySize(k.name, k.family, bits)
+}
+
+// checkKey checks the size of the constructed key unless it was checked already or is unknown (0), and the curve
+func (k *guardedKey) checkKey(p *Policy, key PrivateKey, bits int, checked bool) error {
+	if bits > 0 && !checked {
+		if err := k.checkSize(p, bits); err != nil {
+			return err
+		}
+	}
+	if k.family == ecKey {
+		return p.checkCurve(k.name, key)
+	}
+	return nil
+}
+
+// variables lists the predefined variables and their status in FIPS mode (FIPS 140-3, SP 800-140C, SP 800-131A),
+// DSA signing was withdrawn by FIPS 186-5, SHA1 remains approved only for the verification of legacy signatures,
+// followed by the generic DRBGs.
+var variables = []variable{
+	hashVariable("MD4", &MD4, ""),
+	hashVariable("MD5", &MD5, ""),
+	hashVariable("SHA1", &SHA1, katSHA1),
+	hashVariable("SHA224", &SHA224, katSHA224),
+	hashVariable("SHA256", &SHA256, katSHA256),
+	hashVariable("SHA384", &SHA384, katSHA384),
+	hashVariable("SHA512", &SHA512, katSHA512),
+	hashVariable("RIPEMD160", &RIPEMD160, ""),
+	hashVariable("BLAKE2b_256", &BLAKE2b_256, ""),
+	hashVariable("BLAKE2b_512", &BLAKE2b_512, ""),
+
+	macVariable("HMAC", &HMAC, approved, katHMAC),
+	macVariable("Poly1305", &Poly1305, notApproved, nil),
+
+	cipherVariable("AES_ECB", &AES_ECB, approved, katAES_ECB),
+	cipherVariable("AES_CBC", &AES_CBC, approved, katAES_CBC),
+	cipherVariable("AES_OFB", &AES_OFB, approved, katAES_OFB),
+	cipherVariable("AES_CFB", &AES_CFB, approved, katAES_CFB),
+	cipherVariable("AES_CTR", &AES_CTR, approved, katAES_CTR),
+	cipherVariable("AES_GCM", &AES_GCM, approved, katAES_GCM),
+	cipherVariable("BF_ECB", &BF_ECB, notApproved, nil),
+	cipherVariable("BF_CBC", &BF_CBC, notApproved, nil),
+	cipherVariable("BF_OFB", &BF_OFB, notApproved, nil),
+	cipherVariable("BF_CFB", &BF_CFB, notApproved, nil),
+	cipherVariable("DES3_ECB", &DES3_ECB, decryptionOnly, katDES3_ECB),
+	cipherVariable("DES3_CBC", &DES3_CBC, decryptionOnly, katDES3_CBC),
+	cipherVariable("DES3_OFB", &DES3_OFB, decryptionOnly, katDES3_OFB),
+	cipherVariable("DES3_CFB", &DES3_CFB, decryptionOnly, katDES3_CFB),
+	cipherVariable("RC2_CBC", &RC2_CBC, notApproved, nil),
+	cipherVariable("RC4", &RC4, notApproved, nil),
+	cipherVariable("XSalsa20", &XSalsa20, notApproved, nil),
+
+	aeadVariable("AES_GCM_AEAD", &AES_GCM_AEAD, approved, katAES_GCM_AEAD),
+	aeadVariable("AES_SIV", &AES_SIV, notApproved, nil),
+	aeadVariable("AES_GCM_SIV", &AES_GCM_SIV, notApproved, nil),
+	aeadVariable("XChaCha20_Poly1305", &XChaCha20_Poly1305, notApproved, nil),
+
+	keyWrapVariable("AES_KW", &AES_KW, katAES_KW),
+	keyWrapVariable("AES_KWP", &AES_KWP, katAES_KWP),
+
+	keyVariable("RSA", &RSA, rsaKey, "", notApproved, nil),
+	keyVariable("RSA_OAEP", &RSA_OAEP, rsaKey, "", approved, katEncryption(katRSAKey)),
+	keyVariable("RSA_MD5", &RSA_MD5, rsaKey, "MD5", notApproved, nil),
+	keyVariable("RSA_SHA1", &RSA_SHA1, rsaKey, "SHA1", verificationOnly, katVerification(katRSAKey, katSHA1, katRSASHA1Signature)),
+	keyVariable("RSA_SHA224", &RSA_SHA224, rsaKey, "SHA224", approved, katSignature(katRSAKey, katSHA224, "", "")),
+	keyVariable("RSA_SHA256", &RSA_SHA256, rsaKey, "SHA256", approved, katSignature(katRSAKey, katSHA256, katRSASignature, "")),
+	keyVariable("RSA_SHA384", &RSA_SHA384, rsaKey, "SHA384", approved, katSignature(katRSAKey, katSHA384, "", "")),
+	keyVariable("RSA_SHA512", &RSA_SHA512, rsaKey, "SHA512", approved, katSignature(katRSAKey, katSHA512, "", "")),
+	keyVariable("RSA_PSS_MD5", &RSA_PSS_MD5, rsaKey, "MD5", notApproved, nil),
+	keyVariable("RSA_PSS_SHA1", &RSA_PSS_SHA1, rsaKey, "SHA1", verificationOnly, katVerification(katRSAKey, katSHA1, katRSAPSSSHA1Signature)),
+	keyVariable("RSA_PSS_SHA224", &RSA_PSS_SHA224, rsaKey, "SHA224", approved, katSignature(katRSAKey, katSHA224, "", "")),
+	keyVariable("RSA_PSS_SHA256", &RSA_PSS_SHA256, rsaKey, "SHA256", approved, katSignature(katRSAKey, katSHA256, "", katRSAPSSSignature)),
+	keyVariable("RSA_PSS_SHA384", &RSA_PSS_SHA384, rsaKey, "SHA384", approved, katSignature(katRSAKey, katSHA384, "", "")),
+	keyVariable("RSA_PSS_SHA512", &RSA_PSS_SHA512, rsaKey, "SHA512", approved, katSignature(katRSAKey, katSHA512, "", "")),
+	keyVariable("DSA_SHA1", &DSA_SHA1, dsaKey, "SHA1", verificationOnly, katVerification(katDSAKey, katSHA1, katDSASHA1Signature)),
+	keyVariable("DSA_SHA224", &DSA_SHA224, dsaKey, "SHA224", verificationOnly, katVerification(katDSAKey, katSHA224, katDSASHA224Signature)),
+	keyVariable("DSA_SHA256", &DSA_SHA256, dsaKey, "SHA256", verificationOnly, katVerification(katDSAKey, katSHA256, katDSASignature)),
+	keyVariable("DSA_SHA384", &DSA_SHA384, dsaKey, "SHA384", verificationOnly, katVerification(katDSAKey, katSHA384, katDSASHA384Signature)),
+	keyVariable("DSA_SHA512", &DSA_SHA512, dsaKey, "SHA512", verificationOnly, katVerification(katDSAKey, katSHA512, katDSASHA512Signature)),
+	keyVariable("ECDSA_SHA1", &ECDSA_SHA1, ecKey, "SHA1", verificationOnly, katVerification(katECKey, katSHA1, katECDSASHA1Signature)),
+	keyVariable("ECDSA_224", &ECDSA_224, ecKey, "SHA224", approved, katSignature(katECKey, katSHA224, "", "")),
+	keyVariable("ECDSA_SHA256", &ECDSA_SHA256, ecKey, "SHA256", approved, katSignature(katECKey, katSHA256, "", katECDSASignature)),
+	keyVariable("ECDSA_384", &ECDSA_384, ecKey, "SHA384", approved, katSignature(katECKey, katSHA384, "", "")),
+	keyVariable("ECDSA_SHA512", &ECDSA_SHA512, ecKey, "SHA512", approved, katSignature(katECKey, katSHA512, "", "")),
+	keyVariable("Ed25519", &Ed25519, ecKey, "", approved, katSignature(katEd25519Key, "", katEd25519Signature, "")),
+	keyVariable("DH", &DH, dhKey, "", approved, katKeyAgreement(katDHKey)),
+	keyVariable("ECDH", &ECDH, ecKey, "", approved, katKeyAgreement(katECKey)),
+	keyVariable("X25519", &X25519, ecKey, "", notApproved, nil),
+
+	randomVariable("DefaultRandom", &DefaultRandom),
+
+	drbgVariable("HMAC_DRBG", katHMAC_DRBG),
+	drbgVariable("Hash_DRBG", katHash_DRBG),
+	drbgVariable("CTR_DRBG", katCTR_DRBG),
+}
+
+// drbgVariable is a generic DRBG, it is tested with the implementations assigned to the variables it uses
+func drbgVariable(name string, kat func() error) variable {
+	return variable{
+		algorithm: algorithm{name, approved},
+		test:      func(interface{}) error { return kat() },
+	}
+}
@@ -42,7 +42,9 @@ type HashSpec interface {
 var (
 	MD4, MD5, SHA1,
 	SHA224, SHA256, SHA384, SHA512,
-	RIPEMD160 HashSpec
+	RIPEMD160,
+	// BLAKE2b with 256 and 512 bit digests (RFC 7693)
+	BLAKE2b_256, BLAKE2b_512 HashSpec
 )
 
 // MAC is a keyed Hash. MACs support the Hash interface, the only difference is
@@ -50,10 +52,15 @@ var (
 // MACSpec is used to create instances of MACs.
 type MACSpec interface {
 	New(hash HashSpec, key []byte) Hash
+	// NewWithKey creates a MAC with the SecretKey, which must allow signing (see SecretKey.NewMAC).
+	NewWithKey(hash HashSpec, key *SecretKey) (Hash, error)
 }
 
 // Predefined MACSpecs for know MAC algorithms.
 // Implementations are provided by sub-packages.
 var (
 	HMAC MACSpec
+	// Poly1305 is the one-time authenticator (RFC 8439), it ignores the HashSpec and requires 32 byte key,
+	// which MUST NOT be used to authenticate more than one message.
+	Poly1305 MACSpec
 )
@@ -0,0 +1,185 @@
+package okapi
+
+import (
+	"io"
+	"math"
+)
+
+// HealthTested is a RandomSpec wrapping another RandomSpec with the continuous health tests
+// of NIST SP 800-90B (section 4.4), applied to the output bytes as samples:
+// * repetition count test: detects a sample repeating too many times in a row
+// * adaptive proportion test: detects a sample occurring too often within a window of 1024 samples
+// * stuck output test: detects a 16 byte block of output repeating the previous block (FIPS 140-2, 4.9.2)
+// The first 1024 samples are tested and discarded when the Random is created (start-up tests).
+// The cutoffs are derived from the assessed MinEntropy with the false positive probability of 2^-40 per test.
+// Once a test fails, the Random discards the failed output and all Reads return a HealthTestError.
+// It can wrap any provider, e.g. to test the entropy source of a DRBG:
+//
+//	HMAC_DRBG{Hash: SHA256, Entropy: HealthTested{Source: libcrypto.DefaultRandom}}
+type HealthTested struct {
+	// Source is the tested RandomSpec, defaults to DefaultRandom.
+	Source RandomSpec
+	// MinEntropy is the assessed min-entropy per output byte in bits (greater than 0, at most 8), defaults to 8.
+	MinEntropy float64
+}
+
+// HealthTestError is returned by Read of a HealthTested Random after a health test failed.
+type HealthTestError struct {
+	// Test is the name of the failed test: "repetition count", "adaptive proportion" or "stuck output".
+	Test string
+}
+
+func (e *HealthTestError) Error() string {
+	return "random " + e.Test + " health test failed"
+}
+
+const (
+	// healthAlphaExponent is e of the false positive probability 2^-e of the health tests
+	healthAlphaExponent = 40
+	// healthWindow is the adaptive proportion test window for non-binary samples
+	healthWindow = 1024
+	// healthBlockSize is the size of the blocks compared by the stuck output test
+	healthBlockSize = 16
+	// healthChunkSize is the maximum size of the output read and tested at once
+	healthChunkSize = 64 * healthBlockSize
+)
+
+func (spec HealthTested) New() Random {
+	source := spec.Source
+	if source == nil {
+		source = DefaultRandom
+	}
+	entropy := spec.MinEntropy
+	if entropy == 0 {
+		entropy = 8
+	}
+	if entropy < 0 || entropy > 8 {
+		panic("HealthTested min-entropy must be greater than 0 and at most 8 bits")
+	}
+	r := &healthTested{
+		source:    source.New(),
+		rctCutoff: 1 + int(math.Ceil(healthAlphaExponent/entropy)),
+		aptCutoff: 1 + critBinom(healthWindow, math.Pow(2, -entropy), healthAlphaExponent),
+		chunk:     make([]byte, healthChunkSize),
+	}
+	// start-up tests
+	r.fill(healthWindow)
+	r.buffered = nil
+	return trackRandom(r, "HealthTested")
+}
+
+// critBinom returns the smallest k such that the probability of more than k successes
+// in n trials with success probability p is at most 2^-e, i.e. CRITBINOM(n, p, 1 - 2^-e).
+func critBinom(n int, p float64, e float64) int {
+	alpha := math.Pow(2, -e)
+	lp, lq := math.Log(p), math.Log1p(-p)
+	ln, _ := math.Lgamma(float64(n + 1))
+	tail := 0.0
+	for k := n; k > 0; k-- {
+		lk, _ := math.Lgamma(float64(k + 1))
+		lnk, _ := math.Lgamma(float64(n - k + 1))
+		tail += math.Exp(ln - lk - lnk + float64(k)*lp + float64(n-k)*lq)
+		if tail > alpha {
+			return k
+		}
+	}
+	return 0
+}
+
+type healthTested struct {
+	source Random
+	// repetition count test
+	rctCutoff int
+	rctSample byte
+	rctCount  int
+	// adaptive proportion test
+	aptCutoff  int
+	aptSample  byte
+	aptCount   int
+	aptSamples int
+	// stuck output test
+	previous []byte
+	// chunk holds the tested output, buffered is its part that wasn't read yet
+	chunk    []byte
+	buffered []byte
+	err      error
+}
+
+func (r *healthTested) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if r.err != nil {
+			return n, r.err
+		}
+		if len(r.buffered) == 0 {
+			r.fill(len(b) - n)
+			continue
+		}
+		copied := copy(b[n:], r.buffered)
+		Zero(r.buffered[:copied])
+		r.buffered = r.buffered[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+// fill reads at least size bytes (up to the chunk size) rounded up to whole blocks from the source
+// and tests them. If a test fails, the output is discarded and the error is recorded.
+func (r *healthTested) fill(size int) {
+	if size > len(r.chunk) {
+		size = len(r.chunk)
+	}
+	chunk := r.chunk[:(size+healthBlockSize-1)/healthBlockSize*healthBlockSize]
+	if _, err := io.ReadFull(r.source, chunk); err != nil {
+		r.err = err
+		return
+	}
+	for i := 0; i < len(chunk); i += healthBlockSize {
+		block := chunk[i : i+healthBlockSize]
+		if r.err = r.test(block); r.err != nil {
+			Zero(chunk)
+			return
+		}
+	}
+	r.buffered = chunk
+}
+
+// test runs the health tests on the block
+func (r *healthTested) test(block []byte) error {
+	if r.previous == nil {
+		r.previous = make([]byte, healthBlockSize)
+	} else if string(block) == string(r.previous) {
+		return &HealthTestError{"stuck output"}
+	}
+	copy(r.previous, block)
+	for _, sample := range block {
+		if r.rctCount > 0 && sample == r.rctSample {
+			r.rctCount++
+			if r.rctCount >= r.rctCutoff {
+				return &HealthTestError{"repetition count"}
+			}
+		} else {
+			r.rctSample, r.rctCount = sample, 1
+		}
+		if r.aptSamples == healthWindow {
+			r.aptSamples = 0
+		}
+		if r.aptSamples == 0 {
+			r.aptSample, r.aptCount = sample, 1
+		} else if sample == r.aptSample {
+			r.aptCount++
+			if r.aptCount >= r.aptCutoff {
+				return &HealthTestError{"adaptive proportion"}
+			}
+		}
+		r.aptSamples++
+	}
+	return nil
+}
+
+func (r *healthTested) Close() {
+	Zero(r.chunk)
+	Zero(r.previous)
+	r.buffered = nil
+	r.source.Close()
+}
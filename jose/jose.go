@@ -0,0 +1,212 @@
+// Package jose implements JSON Web Signature (RFC 7515), JSON Web Encryption (RFC 7516)
+// and JSON Web Key (RFC 7517) with the algorithms of RFC 7518 and EdDSA (RFC 8037)
+// using okapi keys, hashes and ciphers, so that it works with any imported implementation.
+// Only the compact serialization is supported.
+package jose
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"strings"
+)
+
+// Header is the JOSE header of a JWS or JWE. Binary header parameters
+// (e.g. "apu" or "x5t") are base64url encoded strings as in the JSON form.
+type Header map[string]interface{}
+
+// String returns the value of a string header parameter or an empty string.
+func (h Header) String(name string) string {
+	s, _ := h[name].(string)
+	return s
+}
+
+func (h Header) copy() Header {
+	c := Header{}
+	for k, v := range h {
+		c[k] = v
+	}
+	return c
+}
+
+var encoding = base64.RawURLEncoding
+
+func encodeHeader(h Header) (string, error) {
+	js, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(js), nil
+}
+
+func decodeHeader(s string) (Header, error) {
+	js, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid JOSE header encoding")
+	}
+	var h Header
+	if err = json.Unmarshal(js, &h); err != nil {
+		return nil, fmt.Errorf("invalid JOSE header: %v", err)
+	}
+	if _, ok := h["crit"]; ok {
+		return nil, errors.New("unsupported critical JOSE header parameters")
+	}
+	return h, nil
+}
+
+// split splits the compact serialization into n parts
+func split(s string, n int) ([]string, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != n {
+		return nil, fmt.Errorf("compact serialization must have %d parts", n)
+	}
+	return parts, nil
+}
+
+// decode decodes base64url encoded parts
+func decode(parts ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		b, err := encoding.DecodeString(part)
+		if err != nil {
+			return nil, errors.New("invalid base64url encoding")
+		}
+		decoded[i] = b
+	}
+	return decoded, nil
+}
+
+// signatureAlgorithm maps a JWS "alg" value to the okapi key constructor and hash.
+type signatureAlgorithm struct {
+	name string
+	// key is nil for HMAC algorithms
+	key  *okapi.KeyConstructor
+	hash *okapi.HashSpec
+	kty  string
+	crv  string
+	// size of the ECDSA signature components in bytes
+	size int
+}
+
+var signatureAlgorithms = []signatureAlgorithm{
+	{"HS256", nil, &okapi.SHA256, "oct", "", 0},
+	{"HS384", nil, &okapi.SHA384, "oct", "", 0},
+	{"HS512", nil, &okapi.SHA512, "oct", "", 0},
+	{"RS256", &okapi.RSA_SHA256, &okapi.SHA256, "RSA", "", 0},
+	{"RS384", &okapi.RSA_SHA384, &okapi.SHA384, "RSA", "", 0},
+	{"RS512", &okapi.RSA_SHA512, &okapi.SHA512, "RSA", "", 0},
+	{"PS256", &okapi.RSA_PSS_SHA256, &okapi.SHA256, "RSA", "", 0},
+	{"PS384", &okapi.RSA_PSS_SHA384, &okapi.SHA384, "RSA", "", 0},
+	{"PS512", &okapi.RSA_PSS_SHA512, &okapi.SHA512, "RSA", "", 0},
+	{"ES256", &okapi.ECDSA_SHA256, &okapi.SHA256, "EC", "P-256", 32},
+	{"ES384", &okapi.ECDSA_384, &okapi.SHA384, "EC", "P-384", 48},
+	{"ES512", &okapi.ECDSA_SHA512, &okapi.SHA512, "EC", "P-521", 66},
+	{"EdDSA", &okapi.Ed25519, nil, "OKP", "Ed25519", 0},
+}
+
+func signatureAlgorithmByName(name string) (*signatureAlgorithm, error) {
+	for i := range signatureAlgorithms {
+		if a := &signatureAlgorithms[i]; a.name == name {
+			if (a.key != nil && *a.key == nil) || (a.hash != nil && *a.hash == nil) || (a.key == nil && okapi.HMAC == nil) {
+				return nil, fmt.Errorf("JWS algorithm %s is not available", name)
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported JWS algorithm %q", name)
+}
+
+// keyAlgorithm maps a JWE "alg" value to the key management mode.
+type keyAlgorithm struct {
+	name string
+	key  *okapi.KeyConstructor
+	kty  string
+	// size of the AES key wrapping key in bytes, 0 if the key is not wrapped
+	wrap int
+}
+
+var keyAlgorithms = []keyAlgorithm{
+	{"RSA-OAEP", &okapi.RSA_OAEP, "RSA", 0},
+	{"ECDH-ES", &okapi.ECDH, "EC", 0},
+	{"ECDH-ES+A128KW", &okapi.ECDH, "EC", 16},
+	{"ECDH-ES+A192KW", &okapi.ECDH, "EC", 24},
+	{"ECDH-ES+A256KW", &okapi.ECDH, "EC", 32},
+	{"A128KW", nil, "oct", 16},
+	{"A192KW", nil, "oct", 24},
+	{"A256KW", nil, "oct", 32},
+	{"dir", nil, "oct", 0},
+}
+
+func keyAlgorithmByName(name string) (*keyAlgorithm, error) {
+	for i := range keyAlgorithms {
+		if a := &keyAlgorithms[i]; a.name == name {
+			if (a.key != nil && *a.key == nil) || (a.wrap > 0 && okapi.AES_KW == nil) {
+				return nil, fmt.Errorf("JWE algorithm %s is not available", name)
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported JWE algorithm %q", name)
+}
+
+// contentAlgorithm maps a JWE "enc" value to the content encryption algorithm.
+// The CBC algorithms use AES_CBC with HMAC (RFC 7518, section 5.2),
+// the content key is the HMAC key followed by the encryption key.
+type contentAlgorithm struct {
+	name    string
+	keySize int
+	// hash is nil for GCM algorithms
+	hash *okapi.HashSpec
+}
+
+var contentAlgorithms = []contentAlgorithm{
+	{"A128CBC-HS256", 32, &okapi.SHA256},
+	{"A192CBC-HS384", 48, &okapi.SHA384},
+	{"A256CBC-HS512", 64, &okapi.SHA512},
+	{"A128GCM", 16, nil},
+	{"A192GCM", 24, nil},
+	{"A256GCM", 32, nil},
+}
+
+func contentAlgorithmByName(name string) (*contentAlgorithm, error) {
+	for i := range contentAlgorithms {
+		if a := &contentAlgorithms[i]; a.name == name {
+			if (a.hash == nil && okapi.AES_GCM_AEAD == nil) ||
+				(a.hash != nil && (*a.hash == nil || okapi.HMAC == nil || okapi.AES_CBC == nil)) {
+				return nil, fmt.Errorf("JWE encryption %s is not available", name)
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported JWE encryption %q", name)
+}
+
+// constructor returns the key constructor for a JWS or JWE algorithm
+// along with the key type and curve the algorithm requires.
+func constructor(alg string) (key okapi.KeyConstructor, kty, crv string, err error) {
+	if a, err := signatureAlgorithmByName(alg); err == nil && a.key != nil {
+		return *a.key, a.kty, a.crv, nil
+	}
+	if a, err := keyAlgorithmByName(alg); err == nil && a.key != nil {
+		return *a.key, a.kty, "", nil
+	}
+	return nil, "", "", fmt.Errorf("algorithm %q doesn't use asymmetric keys", alg)
+}
+
+func digest(spec okapi.HashSpec, data []byte) []byte {
+	hash := spec.New()
+	defer hash.Close()
+	hash.Write(data)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+func mac(spec okapi.HashSpec, key []byte, data ...[]byte) []byte {
+	hmac := okapi.HMAC.New(spec, key)
+	defer hmac.Close()
+	for _, d := range data {
+		hmac.Write(d)
+	}
+	return append([]byte(nil), hmac.Digest()...)
+}
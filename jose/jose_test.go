@@ -0,0 +1,230 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/gocrypto"
+	"strings"
+	"testing"
+)
+
+func TestVerifyHS256(t *testing.T) {
+	// RFC 7515, Appendix A.1
+	jws := "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ" +
+		".dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	jwk, err := ParseJWK([]byte(`{"kty":"oct",
+		"k":"AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := jwk.SecretKey()
+	payload, header, err := Verify(jws, key)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if header.String("typ") != "JWT" || !bytes.HasPrefix(payload, []byte(`{"iss":"joe"`)) {
+		t.Fatalf("Wrong header %v or payload %q", header, payload)
+	}
+	if _, _, err = Verify(jws[:len(jws)-1]+"Y", key); err == nil {
+		t.Fatal("Verify of modified signature succeeded")
+	}
+}
+
+func TestDecryptA128KW(t *testing.T) {
+	// RFC 7516, Appendix A.3
+	jwe := "eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0" +
+		".6KB707dM9YTIgHtLvtgWQ8mKwboJW3of9locizkDTHzBC2IlrT1oOQ" +
+		".AxY8DCtDaGlsbGljb3RoZQ" +
+		".KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY" +
+		".U0m_YmjN04DJvceFICbCVQ"
+	jwk := &JWK{KeyType: "oct", K: "GawgguFyGrWKav7AX4VKUg"}
+	key, _ := jwk.SecretKey()
+	plaintext, _, err := Decrypt(jwe, key)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %s", err)
+	}
+	if string(plaintext) != "Live long and prosper." {
+		t.Fatalf("Wrong plaintext: %q", plaintext)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638, section 3.1
+	jwk := &JWK{KeyType: "RSA", E: "AQAB", KeyID: "2011-04-29", Algorithm: "RS256",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}
+	thumbprint, err := jwk.Thumbprint(okapi.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoding.EncodeToString(thumbprint) != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("Wrong thumbprint: %x", thumbprint)
+	}
+}
+
+func generate(t *testing.T, constructor okapi.KeyConstructor, size int) okapi.PrivateKey {
+	key, err := constructor(size)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	return key
+}
+
+func TestSignVerify(t *testing.T) {
+	payload := []byte("Message in a bottle!")
+	for _, a := range signatureAlgorithms {
+		var private, public interface{}
+		switch {
+		case a.key == nil:
+			private = bytes.Repeat([]byte{7}, 64)
+			public = private
+		case a.kty == "RSA":
+			key := generate(t, *a.key, 2048)
+			defer key.Close()
+			private, public = key, key.PublicKey()
+		default:
+			key := generate(t, *a.key, map[string]int{"P-256": 256, "P-384": 384, "P-521": 521}[a.crv])
+			defer key.Close()
+			private, public = key, key.PublicKey()
+		}
+		jws, err := Sign(payload, a.name, private, Header{"kid": "test"})
+		if err != nil {
+			t.Fatalf("%s Sign failed: %s", a.name, err)
+		}
+		verified, header, err := Verify(jws, public)
+		if err != nil {
+			t.Fatalf("%s Verify failed: %s", a.name, err)
+		}
+		if !bytes.Equal(verified, payload) || header.String("alg") != a.name || header.String("kid") != "test" {
+			t.Fatalf("%s Wrong payload %q or header %v", a.name, verified, header)
+		}
+		parts := strings.Split(jws, ".")
+		parts[1] = encoding.EncodeToString([]byte("Message in a bottle?"))
+		if _, _, err = Verify(strings.Join(parts, "."), public); err == nil {
+			t.Fatalf("%s Verify of modified payload succeeded", a.name)
+		}
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	rsa := generate(t, okapi.RSA_SHA256, 1024)
+	defer rsa.Close()
+	ec := generate(t, okapi.ECDSA_SHA256, 256)
+	defer ec.Close()
+	jws, err := Sign([]byte("payload"), "RS256", rsa, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify(jws, ec.PublicKey()); err == nil {
+		t.Fatal("Verify with EC key succeeded")
+	}
+	if _, _, err = Verify(jws, []byte("secret")); err == nil {
+		t.Fatal("Verify with secret succeeded")
+	}
+	if _, err = Sign([]byte("payload"), "ES384", ec, nil); err == nil {
+		t.Fatal("Sign of ES384 with P-256 key succeeded")
+	}
+	none := encoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + encoding.EncodeToString([]byte("payload")) + "."
+	if _, _, err = Verify(none, rsa.PublicKey()); err == nil {
+		t.Fatal("Verify of unsecured JWS succeeded")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsa := generate(t, okapi.RSA_OAEP, 1024)
+	defer rsa.Close()
+	ec := generate(t, okapi.ECDH, 384)
+	defer ec.Close()
+	plaintext := []byte("Message in a bottle!")
+	for _, a := range keyAlgorithms {
+		for _, c := range contentAlgorithms {
+			var private, public interface{}
+			switch a.kty {
+			case "RSA":
+				private, public = rsa, rsa.PublicKey()
+			case "EC":
+				private, public = ec, ec.PublicKey()
+			default:
+				size := a.wrap
+				if size == 0 {
+					size = c.keySize
+				}
+				private = bytes.Repeat([]byte{7}, size)
+				public = private
+			}
+			jwe, err := Encrypt(plaintext, a.name, c.name, public, Header{"apu": encoding.EncodeToString([]byte("Alice"))})
+			if err != nil {
+				t.Fatalf("%s %s Encrypt failed: %s", a.name, c.name, err)
+			}
+			decrypted, header, err := Decrypt(jwe, private)
+			if err != nil {
+				t.Fatalf("%s %s Decrypt failed: %s", a.name, c.name, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) || header.String("enc") != c.name {
+				t.Fatalf("%s %s Wrong plaintext %q or header %v", a.name, c.name, decrypted, header)
+			}
+			parts := strings.Split(jwe, ".")
+			ciphertext, _ := encoding.DecodeString(parts[3])
+			ciphertext[0] ^= 1
+			parts[3] = encoding.EncodeToString(ciphertext)
+			if _, _, err = Decrypt(strings.Join(parts, "."), private); err == nil {
+				t.Fatalf("%s %s Decrypt of modified ciphertext succeeded", a.name, c.name)
+			}
+		}
+	}
+}
+
+func TestJWK(t *testing.T) {
+	for _, v := range []struct {
+		alg        string
+		key        okapi.KeyConstructor
+		size       int
+		kty, other string
+	}{
+		{"PS256", okapi.RSA_PSS_SHA256, 1024, "RSA", "RS512"},
+		{"ES384", okapi.ECDSA_384, 384, "EC", "ECDH-ES"},
+		{"EdDSA", okapi.Ed25519, 0, "OKP", "EdDSA"},
+	} {
+		key := generate(t, v.key, v.size)
+		defer key.Close()
+		jwk, err := NewJWK(key)
+		if err != nil {
+			t.Fatalf("%s NewJWK failed: %s", v.alg, err)
+		}
+		if jwk.KeyType != v.kty || !jwk.IsPrivate() || jwk.Public().IsPrivate() {
+			t.Fatalf("%s Invalid JWK %+v", v.alg, jwk)
+		}
+		js, _ := json.Marshal(jwk)
+		parsed, err := ParseJWK(js)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, err := parsed.PrivateKey(v.alg)
+		if err != nil {
+			t.Fatalf("%s PrivateKey failed: %s", v.alg, err)
+		}
+		defer private.Close()
+		jws, err := Sign([]byte("payload"), v.alg, private, nil)
+		if err != nil {
+			t.Fatalf("%s Sign failed: %s", v.alg, err)
+		}
+		public, err := jwk.Public().PublicKey(v.other)
+		if err != nil {
+			t.Fatalf("%s PublicKey failed: %s", v.alg, err)
+		}
+		defer public.Close()
+		if _, _, err = Verify(jws, public); err != nil {
+			t.Fatalf("%s Verify failed: %s", v.alg, err)
+		}
+		again, _ := NewJWK(public)
+		thumbprint1, _ := jwk.Thumbprint(okapi.SHA256)
+		thumbprint2, _ := again.Thumbprint(okapi.SHA256)
+		if !bytes.Equal(thumbprint1, thumbprint2) {
+			t.Fatalf("%s Thumbprint mismatch", v.alg)
+		}
+	}
+	if _, err := (&JWK{KeyType: "EC", Curve: "P-256", X: "AA", Y: "AA"}).PublicKey("ES256"); err == nil {
+		t.Fatal("Invalid EC point accepted")
+	}
+}
@@ -0,0 +1,373 @@
+package jose
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"strings"
+)
+
+// Encrypt creates a JWE in compact serialization of the plaintext encrypted with the content
+// encryption algorithm (enc) and a random content key, which is transferred with the key
+// management algorithm (alg). The header parameters are added to the protected header,
+// "alg" and "enc" are set to the algorithms. The "apu" and "apv" header parameters
+// are used by the ECDH-ES key derivation if present.
+// The key is an okapi.PublicKey for RSA-OAEP (RSA key) and ECDH-ES* (EC key)
+// algorithms, it can have any configuration, it is only used to obtain the key material.
+// For the A*KW algorithms it is a []byte key-encryption key and for "dir" the []byte content key.
+// The content key and iv are generated with okapi.DefaultRandom.
+func Encrypt(plaintext []byte, alg, enc string, key interface{}, header Header) (string, error) {
+	ka, err := keyAlgorithmByName(alg)
+	if err != nil {
+		return "", err
+	}
+	ca, err := contentAlgorithmByName(enc)
+	if err != nil {
+		return "", err
+	}
+	h := header.copy()
+	h["alg"], h["enc"] = alg, enc
+	cek, encryptedKey, err := ka.encrypt(key, ca, h)
+	if err != nil {
+		return "", err
+	}
+	defer okapi.Zero(cek)
+	protected, err := encodeHeader(h)
+	if err != nil {
+		return "", err
+	}
+	iv, err := random(ca.ivSize())
+	if err != nil {
+		return "", err
+	}
+	ciphertext, tag := ca.encrypt(cek, iv, plaintext, []byte(protected))
+	return strings.Join([]string{protected,
+		encoding.EncodeToString(encryptedKey),
+		encoding.EncodeToString(iv),
+		encoding.EncodeToString(ciphertext),
+		encoding.EncodeToString(tag)}, "."), nil
+}
+
+// Decrypt decrypts the JWE in compact serialization and returns the plaintext and the protected header.
+// The key is an okapi.PrivateKey configured for the key management algorithm,
+// i.e. created with okapi.RSA_OAEP for RSA-OAEP or with okapi.ECDH for ECDH-ES*
+// (see also JWK.PrivateKey). For the A*KW algorithms it is a []byte key-encryption key
+// and for "dir" the []byte content key.
+func Decrypt(jwe string, key interface{}) (plaintext []byte, header Header, err error) {
+	parts, err := split(jwe, 5)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header, err = decodeHeader(parts[0]); err != nil {
+		return nil, nil, err
+	}
+	ka, err := keyAlgorithmByName(header.String("alg"))
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := contentAlgorithmByName(header.String("enc"))
+	if err != nil {
+		return nil, nil, err
+	}
+	decoded, err := decode(parts[1:]...)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+	cek, err := ka.decrypt(key, ca, header, encryptedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer okapi.Zero(cek)
+	if plaintext, err = ca.decrypt(cek, iv, ciphertext, tag, []byte(parts[0])); err != nil {
+		return nil, nil, err
+	}
+	return plaintext, header, nil
+}
+
+// encrypt generates the content key and encrypts it for the recipient key,
+// the ECDH-ES algorithms add the ephemeral public key to the header.
+func (a *keyAlgorithm) encrypt(key interface{}, ca *contentAlgorithm, header Header) (cek, encryptedKey []byte, err error) {
+	switch {
+	case a.name == "dir":
+		secret, err := a.secret(key, ca.keySize)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append([]byte(nil), secret...), nil, nil
+	case a.kty == "oct":
+		kek, err := a.secret(key, a.wrap)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cek, err = random(ca.keySize); err != nil {
+			return nil, nil, err
+		}
+		encryptedKey, err = wrap(kek, cek, true)
+		return cek, encryptedKey, err
+	}
+	public, ok := key.(okapi.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s requires a public key", a.name)
+	}
+	jwk, err := NewJWK(public)
+	if err != nil {
+		return nil, nil, err
+	}
+	if jwk.KeyType != a.kty {
+		return nil, nil, fmt.Errorf("%s cannot be used with %s key", a.name, jwk.KeyType)
+	}
+	peer, err := jwk.Public().PublicKey(a.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer peer.Close()
+	if a.kty == "RSA" {
+		if cek, err = random(ca.keySize); err != nil {
+			return nil, nil, err
+		}
+		encryptedKey, err = peer.Encrypt(cek)
+		return cek, encryptedKey, err
+	}
+	ephemeral, err := okapi.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ephemeral.Close()
+	pub := ephemeral.PublicKey()
+	defer pub.Close()
+	epk, err := NewJWK(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	header["epk"] = epk
+	secret, err := ephemeral.Derive(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer okapi.Zero(secret)
+	derived, err := a.derive(secret, ca, header)
+	if err != nil || a.wrap == 0 {
+		return derived, nil, err
+	}
+	defer okapi.Zero(derived)
+	if cek, err = random(ca.keySize); err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, err = wrap(derived, cek, true)
+	return cek, encryptedKey, err
+}
+
+// decrypt recovers the content key using the recipient key
+func (a *keyAlgorithm) decrypt(key interface{}, ca *contentAlgorithm, header Header, encryptedKey []byte) ([]byte, error) {
+	switch {
+	case a.name == "dir":
+		if len(encryptedKey) > 0 {
+			return nil, errors.New("dir requires empty encrypted key")
+		}
+		secret, err := a.secret(key, ca.keySize)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), secret...), nil
+	case a.kty == "oct":
+		kek, err := a.secret(key, a.wrap)
+		if err != nil {
+			return nil, err
+		}
+		return a.unwrap(kek, encryptedKey, ca)
+	}
+	private, ok := key.(okapi.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a private key", a.name)
+	}
+	if a.kty == "RSA" {
+		cek, err := private.Decrypt(encryptedKey)
+		if err != nil || len(cek) != ca.keySize {
+			// continue with a random key to avoid revealing the failure (RFC 7516, section 11.5),
+			// the content decryption will fail instead
+			return random(ca.keySize)
+		}
+		return cek, nil
+	}
+	epk, err := epkJWK(header)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := epk.PublicKey(a.name)
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+	secret, err := private.Derive(peer)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(secret)
+	derived, err := a.derive(secret, ca, header)
+	if err != nil || a.wrap == 0 {
+		return derived, err
+	}
+	defer okapi.Zero(derived)
+	return a.unwrap(derived, encryptedKey, ca)
+}
+
+func (a *keyAlgorithm) unwrap(kek, encryptedKey []byte, ca *contentAlgorithm) ([]byte, error) {
+	cek, err := wrap(kek, encryptedKey, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(cek) != ca.keySize {
+		okapi.Zero(cek)
+		return nil, errors.New("invalid JWE content key size")
+	}
+	return cek, nil
+}
+
+// secret validates the size of a symmetric key
+func (a *keyAlgorithm) secret(key interface{}, size int) ([]byte, error) {
+	secret, ok := key.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a []byte key", a.name)
+	}
+	if len(secret) != size {
+		return nil, fmt.Errorf("%s requires a %d byte key", a.name, size)
+	}
+	return secret, nil
+}
+
+// derive derives the content key (ECDH-ES) or the key-encryption key (ECDH-ES+A*KW)
+// from the shared secret with the Concat KDF (RFC 7518, section 4.6.2)
+func (a *keyAlgorithm) derive(secret []byte, ca *contentAlgorithm, header Header) ([]byte, error) {
+	algorithm, size := ca.name, ca.keySize
+	if a.wrap > 0 {
+		algorithm, size = a.name, a.wrap
+	}
+	parties, err := decode(header.String("apu"), header.String("apv"))
+	if err != nil {
+		return nil, errors.New("invalid JWE apu or apv header")
+	}
+	var info []byte
+	for _, field := range [][]byte{[]byte(algorithm), parties[0], parties[1]} {
+		info = binary.BigEndian.AppendUint32(info, uint32(len(field)))
+		info = append(info, field...)
+	}
+	info = binary.BigEndian.AppendUint32(info, uint32(size*8))
+	kdf := okapi.ConcatKDF{Hash: okapi.SHA256, OtherInfo: info}
+	return kdf.Derive(secret, size)
+}
+
+// epkJWK extracts the ephemeral public key from the header
+func epkJWK(header Header) (*JWK, error) {
+	epk, ok := header["epk"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("JWE header is missing the epk")
+	}
+	js, err := json.Marshal(epk)
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := ParseJWK(js)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.IsPrivate() {
+		return nil, errors.New("invalid JWE epk")
+	}
+	return jwk, nil
+}
+
+func (c *contentAlgorithm) ivSize() int {
+	if c.hash == nil {
+		return 12
+	}
+	return 16
+}
+
+func (c *contentAlgorithm) encrypt(cek, iv, plaintext, aad []byte) (ciphertext, tag []byte) {
+	if c.hash == nil {
+		gcm := okapi.AES_GCM_AEAD.New(cek)
+		defer gcm.Close()
+		sealed := gcm.Seal(nil, iv, plaintext, aad)
+		n := len(sealed) - gcm.Overhead()
+		return sealed[:n], sealed[n:]
+	}
+	half := len(cek) / 2
+	padding := len(iv) - len(plaintext)%len(iv)
+	padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	defer okapi.Zero(padded)
+	ciphertext = crypt(okapi.AES_CBC, cek[half:], iv, padded, true)
+	return ciphertext, c.tag(cek[:half], aad, iv, ciphertext)
+}
+
+func (c *contentAlgorithm) decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if len(iv) != c.ivSize() {
+		return nil, errors.New("invalid JWE iv")
+	}
+	if c.hash == nil {
+		gcm := okapi.AES_GCM_AEAD.New(cek)
+		defer gcm.Close()
+		if len(tag) != gcm.Overhead() {
+			return nil, errors.New("invalid JWE authentication tag")
+		}
+		return gcm.Open(nil, iv, append(append([]byte(nil), ciphertext...), tag...), aad)
+	}
+	half := len(cek) / 2
+	if subtle.ConstantTimeCompare(tag, c.tag(cek[:half], aad, iv, ciphertext)) != 1 {
+		return nil, errors.New("invalid JWE authentication tag")
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%len(iv) != 0 {
+		return nil, errors.New("invalid JWE ciphertext")
+	}
+	padded := crypt(okapi.AES_CBC, cek[half:], iv, ciphertext, false)
+	padding := int(padded[len(padded)-1])
+	if padding == 0 || padding > len(iv) {
+		return nil, errors.New("invalid JWE content padding")
+	}
+	for _, b := range padded[len(padded)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("invalid JWE content padding")
+		}
+	}
+	return padded[:len(padded)-padding], nil
+}
+
+// tag computes the authentication tag of the CBC algorithms (RFC 7518, section 5.2.2.1)
+func (c *contentAlgorithm) tag(key, aad, iv, ciphertext []byte) []byte {
+	al := binary.BigEndian.AppendUint64(nil, uint64(len(aad))*8)
+	return mac(*c.hash, key, aad, iv, ciphertext, al)[:len(key)]
+}
+
+// crypt processes the input, which must be a multiple of the block size, with the cipher.
+func crypt(spec okapi.CipherSpec, key, iv, in []byte, encrypt bool) []byte {
+	c := spec.New(key, iv, encrypt)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out
+}
+
+// wrap wraps or unwraps the key with AES_KW
+func wrap(kek, key []byte, encrypt bool) ([]byte, error) {
+	kw := okapi.AES_KW.New(kek)
+	defer kw.Close()
+	if encrypt {
+		return kw.Wrap(key)
+	}
+	return kw.Unwrap(key)
+}
+
+func random(size int) ([]byte, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	b := make([]byte, size)
+	if _, err := random.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,330 @@
+package jose
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+)
+
+// JWK is a JSON Web Key (RFC 7517) holding RSA, EC (P-256, P-384 and P-521),
+// OKP (Ed25519) or symmetric (oct) key material.
+// The key parameters are base64url encoded strings as in the JSON form.
+// Private key parameters are empty for public keys.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	// EC and OKP parameters
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+	// RSA parameters
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+	// private key of all asymmetric key types
+	D string `json:"d,omitempty"`
+	// symmetric key
+	K string `json:"k,omitempty"`
+}
+
+// ParseJWK parses the JSON form of a JWK.
+func ParseJWK(js []byte) (*JWK, error) {
+	var jwk JWK
+	if err := json.Unmarshal(js, &jwk); err != nil {
+		return nil, err
+	}
+	if jwk.KeyType == "" {
+		return nil, errors.New("JWK is missing the key type")
+	}
+	return &jwk, nil
+}
+
+// NewJWK creates a JWK from an okapi.PublicKey, okapi.PrivateKey or a symmetric key ([]byte).
+// The keys must be exportable (see okapi.Exporter).
+func NewJWK(key interface{}) (*JWK, error) {
+	switch key := key.(type) {
+	case []byte:
+		return &JWK{KeyType: "oct", K: encoding.EncodeToString(key)}, nil
+	case okapi.Exporter:
+		// both PublicKey and PrivateKey
+		der, err := key.Export()
+		if err != nil {
+			return nil, err
+		}
+		if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+			return newJWK(private)
+		}
+		public, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		return newJWK(public)
+	}
+	return nil, fmt.Errorf("unsupported JWK key %T", key)
+}
+
+var curveNames = map[ecdh.Curve]string{ecdh.P256(): "P-256", ecdh.P384(): "P-384", ecdh.P521(): "P-521"}
+
+func curveByName(name string) (ecdh.Curve, error) {
+	for curve, n := range curveNames {
+		if n == name {
+			return curve, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported JWK curve %q", name)
+}
+
+func newJWK(key interface{}) (*JWK, error) {
+	b64 := encoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{KeyType: "RSA", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}, nil
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, errors.New("unsupported multi-prime RSA key")
+		}
+		key.Precompute()
+		jwk, _ := newJWK(&key.PublicKey)
+		jwk.D = b64(key.D.Bytes())
+		jwk.P, jwk.Q = b64(key.Primes[0].Bytes()), b64(key.Primes[1].Bytes())
+		jwk.DP, jwk.DQ, jwk.QI = b64(key.Precomputed.Dp.Bytes()), b64(key.Precomputed.Dq.Bytes()), b64(key.Precomputed.Qinv.Bytes())
+		return jwk, nil
+	case *ecdsa.PublicKey:
+		public, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return newJWK(public)
+	case *ecdsa.PrivateKey:
+		private, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return newJWK(private)
+	case *ecdh.PublicKey:
+		name, ok := curveNames[key.Curve()]
+		if !ok {
+			return nil, errors.New("unsupported JWK curve")
+		}
+		// uncompressed point encoding 04 || X || Y
+		point := key.Bytes()
+		size := (len(point) - 1) / 2
+		return &JWK{KeyType: "EC", Curve: name, X: b64(point[1 : 1+size]), Y: b64(point[1+size:])}, nil
+	case *ecdh.PrivateKey:
+		jwk, err := newJWK(key.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		jwk.D = b64(key.Bytes())
+		return jwk, nil
+	case ed25519.PublicKey:
+		return &JWK{KeyType: "OKP", Curve: "Ed25519", X: b64(key)}, nil
+	case ed25519.PrivateKey:
+		return &JWK{KeyType: "OKP", Curve: "Ed25519", X: b64(key.Public().(ed25519.PublicKey)), D: b64(key.Seed())}, nil
+	}
+	return nil, fmt.Errorf("unsupported JWK key %T", key)
+}
+
+// IsPrivate returns whether the JWK holds a private or symmetric key.
+func (jwk *JWK) IsPrivate() bool {
+	return jwk.D != "" || jwk.K != ""
+}
+
+// Public returns a copy of the JWK without the private key parameters.
+// It returns nil for symmetric keys.
+func (jwk *JWK) Public() *JWK {
+	if jwk.KeyType == "oct" {
+		return nil
+	}
+	public := *jwk
+	public.D, public.P, public.Q, public.DP, public.DQ, public.QI = "", "", "", "", "", ""
+	return &public
+}
+
+// SecretKey returns the symmetric key of an "oct" JWK.
+func (jwk *JWK) SecretKey() ([]byte, error) {
+	if jwk.KeyType != "oct" {
+		return nil, fmt.Errorf("JWK key type %s is not symmetric", jwk.KeyType)
+	}
+	return encoding.DecodeString(jwk.K)
+}
+
+// PublicKey creates an okapi.PublicKey configured for the JWS or JWE algorithm,
+// e.g. "RS256" creates the key with okapi.RSA_SHA256 and "ECDH-ES" with okapi.ECDH.
+func (jwk *JWK) PublicKey(alg string) (okapi.PublicKey, error) {
+	key, err := jwk.newKey(alg, false)
+	if err != nil {
+		return nil, err
+	}
+	// the key holds only the public key, so it is its own PublicKey
+	return key.PublicKey(), nil
+}
+
+// PrivateKey creates an okapi.PrivateKey configured for the JWS or JWE algorithm,
+// e.g. "PS256" creates the key with okapi.RSA_PSS_SHA256 and "RSA-OAEP" with okapi.RSA_OAEP.
+func (jwk *JWK) PrivateKey(alg string) (okapi.PrivateKey, error) {
+	if jwk.D == "" {
+		return nil, errors.New("JWK doesn't have a private key")
+	}
+	return jwk.newKey(alg, true)
+}
+
+func (jwk *JWK) newKey(alg string, private bool) (okapi.PrivateKey, error) {
+	constructor, kty, crv, err := constructor(alg)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.KeyType != kty || (crv != "" && jwk.Curve != crv) {
+		return nil, fmt.Errorf("JWK key type %s %s cannot be used with %s", jwk.KeyType, jwk.Curve, alg)
+	}
+	var der []byte
+	if private {
+		key, err := jwk.privateKey()
+		if err != nil {
+			return nil, err
+		}
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		defer okapi.Zero(der)
+	} else {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		if der, err = x509.MarshalPKIXPublicKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return constructor(der)
+}
+
+// publicKey converts the JWK to the corresponding crypto package public key type
+func (jwk *JWK) publicKey() (interface{}, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		params, err := decode(jwk.N, jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		e := new(big.Int).SetBytes(params[1])
+		if len(params[0]) == 0 || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid JWK RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(params[0]), E: int(e.Int64())}, nil
+	case "EC":
+		curve, err := curveByName(jwk.Curve)
+		if err != nil {
+			return nil, err
+		}
+		params, err := decode(jwk.X, jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		point := append(append([]byte{4}, params[0]...), params[1]...)
+		return curve.NewPublicKey(point)
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK curve %q", jwk.Curve)
+		}
+		x, err := encoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid JWK Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported JWK key type %q", jwk.KeyType)
+}
+
+// privateKey converts the JWK to the corresponding crypto package private key type
+func (jwk *JWK) privateKey() (interface{}, error) {
+	public, err := jwk.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	d, err := encoding.DecodeString(jwk.D)
+	if err != nil {
+		return nil, errors.New("invalid base64url encoding")
+	}
+	defer okapi.Zero(d)
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		params, err := decode(jwk.P, jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: *public,
+			D:         new(big.Int).SetBytes(d),
+			Primes:    []*big.Int{new(big.Int).SetBytes(params[0]), new(big.Int).SetBytes(params[1])},
+		}
+		if err = key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid JWK RSA key: %v", err)
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdh.PublicKey:
+		key, err := public.Curve().NewPrivateKey(d)
+		if err != nil {
+			return nil, err
+		}
+		if !key.PublicKey().Equal(public) {
+			return nil, errors.New("JWK EC private key doesn't match the public key")
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		if len(d) != ed25519.SeedSize {
+			return nil, errors.New("invalid JWK Ed25519 key")
+		}
+		key := ed25519.NewKeyFromSeed(d)
+		if !public.Equal(key.Public()) {
+			return nil, errors.New("JWK Ed25519 private key doesn't match the public key")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported JWK key type %q", jwk.KeyType)
+}
+
+// Thumbprint computes the JWK thumbprint (RFC 7638) with the hash,
+// i.e. the digest of the JSON object with the required key parameters only.
+func (jwk *JWK) Thumbprint(hash okapi.HashSpec) ([]byte, error) {
+	// the members must be in lexicographic order
+	var members []string
+	switch jwk.KeyType {
+	case "RSA":
+		members = []string{"e", jwk.E, "kty", jwk.KeyType, "n", jwk.N}
+	case "EC":
+		members = []string{"crv", jwk.Curve, "kty", jwk.KeyType, "x", jwk.X, "y", jwk.Y}
+	case "OKP":
+		members = []string{"crv", jwk.Curve, "kty", jwk.KeyType, "x", jwk.X}
+	case "oct":
+		members = []string{"k", jwk.K, "kty", jwk.KeyType}
+	default:
+		return nil, fmt.Errorf("unsupported JWK key type %q", jwk.KeyType)
+	}
+	js := []byte{'{'}
+	for i := 0; i < len(members); i += 2 {
+		if i > 0 {
+			js = append(js, ',')
+		}
+		name, _ := json.Marshal(members[i])
+		value, _ := json.Marshal(members[i+1])
+		js = append(append(append(js, name...), ':'), value...)
+	}
+	js = append(js, '}')
+	return digest(hash, js), nil
+}
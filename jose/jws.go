@@ -0,0 +1,174 @@
+package jose
+
+import (
+	"crypto/subtle"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+)
+
+// Sign creates a JWS in compact serialization of the payload signed with the algorithm.
+// The header parameters are added to the protected header, "alg" is set to the algorithm.
+// The key is a []byte secret for the HS* algorithms, otherwise an okapi.PrivateKey
+// configured for the algorithm, e.g. created with okapi.RSA_SHA256 for RS256,
+// okapi.RSA_PSS_SHA256 for PS256, okapi.ECDSA_SHA256 for ES256 or okapi.Ed25519 for EdDSA
+// (see also JWK.PrivateKey).
+func Sign(payload []byte, alg string, key interface{}, header Header) (string, error) {
+	a, err := signatureAlgorithmByName(alg)
+	if err != nil {
+		return "", err
+	}
+	h := header.copy()
+	h["alg"] = alg
+	protected, err := encodeHeader(h)
+	if err != nil {
+		return "", err
+	}
+	input := protected + "." + encoding.EncodeToString(payload)
+	signature, err := a.sign([]byte(input), key)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify verifies the JWS in compact serialization and returns the payload and the protected header.
+// The key is a []byte secret for the HS* algorithms, otherwise an okapi.PublicKey
+// of the type required by the algorithm, it can have any configuration,
+// it is only used to obtain the key material. The "none" algorithm is not supported.
+func Verify(jws string, key interface{}) (payload []byte, header Header, err error) {
+	parts, err := split(jws, 3)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header, err = decodeHeader(parts[0]); err != nil {
+		return nil, nil, err
+	}
+	a, err := signatureAlgorithmByName(header.String("alg"))
+	if err != nil {
+		return nil, nil, err
+	}
+	decoded, err := decode(parts[1], parts[2])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = a.verify([]byte(parts[0]+"."+parts[1]), decoded[1], key); err != nil {
+		return nil, nil, err
+	}
+	return decoded[0], header, nil
+}
+
+func (a *signatureAlgorithm) sign(input []byte, key interface{}) ([]byte, error) {
+	if a.key == nil {
+		secret, err := a.secret(key)
+		if err != nil {
+			return nil, err
+		}
+		return mac(*a.hash, secret, input), nil
+	}
+	private, ok := key.(okapi.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a private key", a.name)
+	}
+	pub := private.PublicKey()
+	defer pub.Close()
+	if err := a.check(pub); err != nil {
+		return nil, err
+	}
+	if a.hash == nil {
+		return private.Sign(input)
+	}
+	signature, err := private.Sign(digest(*a.hash, input))
+	if err != nil || a.size == 0 {
+		return signature, err
+	}
+	// ECDSA signatures are R || S with fixed size components
+	var rs struct{ R, S *big.Int }
+	if _, err = asn1.Unmarshal(signature, &rs); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 2*a.size)
+	rs.R.FillBytes(raw[:a.size])
+	rs.S.FillBytes(raw[a.size:])
+	return raw, nil
+}
+
+func (a *signatureAlgorithm) verify(input, signature []byte, key interface{}) error {
+	if a.key == nil {
+		secret, err := a.secret(key)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(signature, mac(*a.hash, secret, input)) != 1 {
+			return errors.New("invalid JWS signature")
+		}
+		return nil
+	}
+	public, ok := key.(okapi.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s requires a public key", a.name)
+	}
+	jwk, err := a.jwk(public)
+	if err != nil {
+		return err
+	}
+	pub, err := jwk.PublicKey(a.name)
+	if err != nil {
+		return err
+	}
+	defer pub.Close()
+	if a.size > 0 {
+		if len(signature) != 2*a.size {
+			return errors.New("invalid JWS signature")
+		}
+		r, s := new(big.Int).SetBytes(signature[:a.size]), new(big.Int).SetBytes(signature[a.size:])
+		if signature, err = asn1.Marshal(struct{ R, S *big.Int }{r, s}); err != nil {
+			return err
+		}
+	}
+	if a.hash != nil {
+		input = digest(*a.hash, input)
+	}
+	valid, err := pub.Verify(signature, input)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid JWS signature")
+	}
+	return nil
+}
+
+// secret validates the HMAC key, which must be at least as long as the hash output
+func (a *signatureAlgorithm) secret(key interface{}) ([]byte, error) {
+	secret, ok := key.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a []byte secret", a.name)
+	}
+	hash := (*a.hash).New()
+	defer hash.Close()
+	if len(secret) < hash.Size() {
+		return nil, fmt.Errorf("%s requires a secret of at least %d bytes", a.name, hash.Size())
+	}
+	return secret, nil
+}
+
+// jwk returns the public JWK of the key if it has the type required by the algorithm
+func (a *signatureAlgorithm) jwk(key okapi.PublicKey) (*JWK, error) {
+	jwk, err := NewJWK(key)
+	if err != nil {
+		return nil, err
+	}
+	jwk = jwk.Public()
+	if jwk.KeyType != a.kty || (a.crv != "" && jwk.Curve != a.crv) {
+		return nil, fmt.Errorf("%s cannot be used with %s %s key", a.name, jwk.KeyType, jwk.Curve)
+	}
+	return jwk, nil
+}
+
+func (a *signatureAlgorithm) check(key okapi.PublicKey) error {
+	_, err := a.jwk(key)
+	return err
+}
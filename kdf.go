@@ -0,0 +1,236 @@
+package okapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// KDF is a key derivation function. It derives key material of requested size
+// from secret input, e.g. a password or a shared secret obtained from key agreement.
+// Any additional inputs (salt, iteration count, etc) are specific to each KDF
+// and are configured as fields of the implementing type.
+type KDF interface {
+	// Derive generates size bytes of key material from the secret.
+	Derive(secret []byte, size int) (key []byte, err error)
+	// DeriveKey derives a SecretKey of given size in bytes and usages from the SecretKey,
+	// which must allow derivation (see SecretKey.Derive).
+	DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error)
+}
+
+// PBKDF2 is the password based key derivation function from PKCS#5 v2.0 (RFC 8018)
+// using HMAC with the configured Hash as the pseudo-random function.
+// It is implemented generically using the HMAC MACSpec of imported implementations.
+type PBKDF2 struct {
+	Hash       HashSpec
+	Salt       []byte
+	Iterations int
+}
+
+func (kdf PBKDF2) Derive(password []byte, size int) ([]byte, error) {
+	if kdf.Iterations < 1 {
+		return nil, errors.New("PBKDF2 iteration count must be positive")
+	}
+	prf := HMAC.New(kdf.Hash, password)
+	defer prf.Close()
+	hashSize := prf.Size()
+	key := make([]byte, 0, (size+hashSize-1)/hashSize*hashSize)
+	t := make([]byte, hashSize)
+	u := make([]byte, hashSize)
+	salt := make([]byte, len(kdf.Salt)+4)
+	copy(salt, kdf.Salt)
+	for block := uint32(1); len(key) < size; block++ {
+		binary.BigEndian.PutUint32(salt[len(kdf.Salt):], block)
+		prf.Reset()
+		prf.Write(salt)
+		copy(u, prf.Digest())
+		copy(t, u)
+		for i := 1; i < kdf.Iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			copy(u, prf.Digest())
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size], nil
+}
+
+func (kdf PBKDF2) DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	return secret.Derive(kdf, size, usages, extractable)
+}
+
+// HKDF is the HMAC based extract-and-expand key derivation function (RFC 5869)
+// using HMAC with the configured Hash. It is meant to derive keys from secrets
+// with high entropy, e.g. shared secrets obtained from key agreement.
+// If Salt is empty, a string of zeros of the hash size is used.
+type HKDF struct {
+	Hash HashSpec
+	Salt []byte
+	Info []byte
+}
+
+func (kdf HKDF) Derive(secret []byte, size int) ([]byte, error) {
+	extract := HMAC.New(kdf.Hash, kdf.Salt)
+	hashSize := extract.Size()
+	if len(kdf.Salt) == 0 {
+		extract.Close()
+		extract = HMAC.New(kdf.Hash, make([]byte, hashSize))
+	}
+	extract.Write(secret)
+	prk := extract.Digest()
+	extract.Close()
+	defer Zero(prk)
+	if size > 255*hashSize {
+		return nil, errors.New("HKDF output size too large")
+	}
+	expand := HMAC.New(kdf.Hash, prk)
+	defer expand.Close()
+	key := make([]byte, 0, (size+hashSize-1)/hashSize*hashSize)
+	var t []byte
+	for block := byte(1); len(key) < size; block++ {
+		expand.Reset()
+		expand.Write(t)
+		expand.Write(kdf.Info)
+		expand.Write([]byte{block})
+		t = expand.Digest()
+		key = append(key, t...)
+	}
+	return key[:size], nil
+}
+
+func (kdf HKDF) DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	return secret.Derive(kdf, size, usages, extractable)
+}
+
+// X963KDF is the ANSI X9.63 key derivation function as specified in SEC 1 (section 3.6.1),
+// used for example by CMS with ECDH key agreement (RFC 5753).
+// It is implemented generically using the HashSpec of imported implementations.
+type X963KDF struct {
+	Hash       HashSpec
+	SharedInfo []byte
+}
+
+func (kdf X963KDF) Derive(secret []byte, size int) ([]byte, error) {
+	hash := kdf.Hash.New()
+	defer hash.Close()
+	hashSize := hash.Size()
+	key := make([]byte, 0, (size+hashSize-1)/hashSize*hashSize)
+	counter := make([]byte, 4)
+	for block := uint32(1); len(key) < size; block++ {
+		binary.BigEndian.PutUint32(counter, block)
+		hash.Reset()
+		hash.Write(secret)
+		hash.Write(counter)
+		hash.Write(kdf.SharedInfo)
+		key = append(key, hash.Digest()...)
+	}
+	return key[:size], nil
+}
+
+func (kdf X963KDF) DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	return secret.Derive(kdf, size, usages, extractable)
+}
+
+// ConcatKDF is the single-step key derivation function from NIST SP 800-56A (section 5.8.1),
+// used for example by JOSE with ECDH-ES key agreement (RFC 7518).
+// It is implemented generically using the HashSpec of imported implementations.
+type ConcatKDF struct {
+	Hash      HashSpec
+	OtherInfo []byte
+}
+
+func (kdf ConcatKDF) Derive(secret []byte, size int) ([]byte, error) {
+	hash := kdf.Hash.New()
+	defer hash.Close()
+	hashSize := hash.Size()
+	key := make([]byte, 0, (size+hashSize-1)/hashSize*hashSize)
+	counter := make([]byte, 4)
+	for block := uint32(1); len(key) < size; block++ {
+		binary.BigEndian.PutUint32(counter, block)
+		hash.Reset()
+		hash.Write(counter)
+		hash.Write(secret)
+		hash.Write(kdf.OtherInfo)
+		key = append(key, hash.Digest()...)
+	}
+	return key[:size], nil
+}
+
+func (kdf ConcatKDF) DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	return secret.Derive(kdf, size, usages, extractable)
+}
+
+// PKCS12KDF is the password based key derivation function from PKCS#12 (RFC 7292, appendix B.2),
+// used by legacy PKCS#12 encryption and MAC algorithms.
+// It is implemented generically using the HashSpec of imported implementations.
+// The password must be encoded as BMPString including the two trailing zero bytes (appendix B.1).
+// ID selects the purpose of the derived bytes: 1 for encryption keys, 2 for IVs and 3 for MAC keys.
+type PKCS12KDF struct {
+	Hash       HashSpec
+	Salt       []byte
+	Iterations int
+	ID         byte
+}
+
+func (kdf PKCS12KDF) Derive(password []byte, size int) ([]byte, error) {
+	if kdf.Iterations < 1 {
+		return nil, errors.New("PKCS12KDF iteration count must be positive")
+	}
+	hash := kdf.Hash.New()
+	defer hash.Close()
+	u, v := hash.Size(), hash.BlockSize()
+	// fill concatenates copies of data up to a multiple of v
+	fill := func(data []byte) []byte {
+		filled := make([]byte, (len(data)+v-1)/v*v)
+		for i := range filled {
+			filled[i] = data[i%len(data)]
+		}
+		return filled
+	}
+	d := bytes.Repeat([]byte{kdf.ID}, v)
+	var i []byte
+	if len(kdf.Salt) > 0 {
+		i = fill(kdf.Salt)
+	}
+	if len(password) > 0 {
+		i = append(i, fill(password)...)
+	}
+	defer Zero(i)
+	key := make([]byte, 0, (size+u-1)/u*u)
+	b := make([]byte, v)
+	for len(key) < size {
+		hash.Reset()
+		hash.Write(d)
+		hash.Write(i)
+		a := append([]byte(nil), hash.Digest()...)
+		for j := 1; j < kdf.Iterations; j++ {
+			hash.Reset()
+			hash.Write(a)
+			a = append(a[:0], hash.Digest()...)
+		}
+		key = append(key, a...)
+		if len(key) >= size {
+			break
+		}
+		// I_j = (I_j + B + 1) mod 2^(8v) for each v byte block of I
+		for j := range b {
+			b[j] = a[j%u]
+		}
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				carry += int(i[j+k]) + int(b[k])
+				i[j+k] = byte(carry)
+				carry >>= 8
+			}
+		}
+	}
+	return key[:size], nil
+}
+
+func (kdf PKCS12KDF) DeriveKey(secret *SecretKey, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	return secret.Derive(kdf, size, usages, extractable)
+}
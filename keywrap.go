@@ -0,0 +1,35 @@
+package okapi
+
+// KeyWrap is a symmetric key encryption algorithm designed for protecting
+// other cryptographic keys with a key-encryption key (KEK).
+// The wrapped key includes an integrity check, so Unwrap with a wrong KEK
+// or of corrupted input will fail with an error.
+type KeyWrap interface {
+	// Wrap encrypts the provided key material.
+	Wrap(key []byte) (wrapped []byte, err error)
+	// Unwrap decrypts and verifies the integrity of wrapped key material.
+	Unwrap(wrapped []byte) (key []byte, err error)
+	// KeySize returns the size of the key-encryption key in bytes.
+	KeySize() int
+	// Close MUST be called to securely discard and release any associated secrets and resources.
+	Close()
+}
+
+// KeyWrapSpecs are used to create instances of KeyWraps from a key-encryption key.
+type KeyWrapSpec interface {
+	// New creates a KeyWrap from the KeyWrapSpec and the key-encryption key.
+	New(kek []byte) KeyWrap
+}
+
+// Predefined KeyWrapSpecs for known key wrapping algorithms.
+// Implementations are provided by subpackages.
+// If given algorithm is not supported by the imported implementations,
+// the value of the corresponding variable will be nil.
+var (
+	// AES_KW is the AES Key Wrap algorithm from RFC 3394.
+	// The wrapped key size must be a multiple of 8 bytes and at least 16 bytes.
+	AES_KW,
+	// AES_KWP is the AES Key Wrap with Padding algorithm from RFC 5649.
+	// It can wrap keys of any size.
+	AES_KWP KeyWrapSpec
+)
@@ -0,0 +1,327 @@
+package okapi
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Leak describes a Hash, Cipher, AEAD, KeyWrap, PrivateKey, PublicKey or Random that was not closed yet.
+type Leak struct {
+	// Kind is the name of the interface, e.g. "Cipher" or "PrivateKey".
+	Kind string
+	// Algorithm is the name of the predefined variable or of the DRBG, e.g. "AES_CBC" or "CTR_DRBG".
+	Algorithm string
+	// Created is the time the instance was created.
+	Created time.Time
+	// Stack is the stack trace of the goroutine that created the instance.
+	Stack string
+}
+
+func (l *Leak) String() string {
+	return fmt.Sprintf("%s %s created at %s:\n%s", l.Algorithm, l.Kind, l.Created.Format(time.RFC3339Nano), l.Stack)
+}
+
+var leaks struct {
+	sync.Mutex
+	live map[*tracked]bool
+}
+
+var (
+	leakDetection atomic.Bool
+	leakFinalizer atomic.Bool
+)
+
+// EnableLeakDetection starts tracking the instances created by the predefined variables (including DefaultRandom),
+// by the DRBGs, SeededRandom and HealthTested until they are closed, Leaks returns those that are still open.
+// It is meant for debugging, the tracking records the stack trace of each instance and wraps it,
+// so it adds considerable overhead. The guards of the predefined variables track the instances (see Register),
+// implementations assigned to them without Register are not tracked.
+// Only the instances created after the call are tracked, it cannot be disabled.
+// If finalizers is set, the instances that are garbage collected without being closed
+// are logged with the log package and closed, releasing their resources (e.g. C memory of libcrypto).
+// For example, to report the leaks of a test suite:
+//
+//	func TestMain(m *testing.M) {
+//		okapi.EnableLeakDetection(false)
+//		code := m.Run()
+//		if okapi.ReportLeaks(os.Stderr) > 0 && code == 0 {
+//			code = 1
+//		}
+//		os.Exit(code)
+//	}
+func EnableLeakDetection(finalizers bool) {
+	leaks.Lock()
+	if leaks.live == nil {
+		leaks.live = make(map[*tracked]bool)
+	}
+	leaks.Unlock()
+	leakFinalizer.Store(finalizers)
+	leakDetection.Store(true)
+}
+
+// Leaks returns the tracked instances that were not closed yet, in the order of their creation.
+func Leaks() []*Leak {
+	leaks.Lock()
+	live := make([]*tracked, 0, len(leaks.live))
+	for t := range leaks.live {
+		live = append(live, t)
+	}
+	leaks.Unlock()
+	sort.Slice(live, func(i, j int) bool { return live[i].created.Before(live[j].created) })
+	result := make([]*Leak, len(live))
+	for i, t := range live {
+		result[i] = t.leak()
+	}
+	return result
+}
+
+// ReportLeaks writes the Leaks to the writer and returns their number.
+func ReportLeaks(w io.Writer) int {
+	live := Leaks()
+	for _, l := range live {
+		fmt.Fprintln(w, l)
+	}
+	return len(live)
+}
+
+// tracked records the creation of a live instance, it must not reference the instance
+// so that the instance can be garbage collected and finalized
+type tracked struct {
+	kind, algorithm string
+	created         time.Time
+	stack           []uintptr
+}
+
+// track records the creation of an instance if the leak detection is enabled, otherwise it returns nil
+func track(kind, algorithm string) *tracked {
+	if !leakDetection.Load() {
+		return nil
+	}
+	t := &tracked{kind: kind, algorithm: algorithm, created: time.Now(), stack: make([]uintptr, 32)}
+	t.stack = t.stack[:runtime.Callers(2, t.stack)]
+	leaks.Lock()
+	leaks.live[t] = true
+	leaks.Unlock()
+	return t
+}
+
+// finalize installs the finalizer that reports the leak and releases the resources of the instance if it is not closed,
+// release must not reference the instance other than through its argument, otherwise it cannot be garbage collected
+func finalize[T any](t *tracked, instance *T, release func(*T)) {
+	if t == nil || !leakFinalizer.Load() {
+		return
+	}
+	runtime.SetFinalizer(instance, func(instance *T) {
+		leaks.Lock()
+		live := leaks.live[t]
+		leaks.Unlock()
+		if live {
+			log.Print("okapi: leaked ", t.leak())
+			release(instance)
+			t.untrack()
+		}
+	})
+}
+
+// untrack records that the instance was closed
+func (t *tracked) untrack() {
+	if t == nil {
+		return
+	}
+	leaks.Lock()
+	delete(leaks.live, t)
+	leaks.Unlock()
+}
+
+// okapiFrames is the prefix of the functions of this package, they are omitted from the top of the stack traces
+var okapiFrames = reflect.TypeOf(tracked{}).PkgPath() + "."
+
+func (t *tracked) leak() *Leak {
+	var stack strings.Builder
+	frames := runtime.CallersFrames(t.stack)
+	caller := false
+	for {
+		frame, more := frames.Next()
+		if caller = caller || !strings.HasPrefix(frame.Function, okapiFrames) || !more; caller {
+			fmt.Fprintf(&stack, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return &Leak{t.kind, t.algorithm, t.created, stack.String()}
+}
+
+// trackHash wraps the hash if the leak detection is enabled
+func trackHash(hash Hash, algorithm string) Hash {
+	t := track("Hash", algorithm)
+	if t == nil {
+		return hash
+	}
+	h := &trackedHash{hash, t}
+	finalize(t, h, func(h *trackedHash) { h.Hash.Close() })
+	return h
+}
+
+type trackedHash struct {
+	Hash
+	*tracked
+}
+
+func (h *trackedHash) Clone() Hash {
+	return trackHash(h.Hash.Clone(), h.algorithm)
+}
+
+func (h *trackedHash) Close() {
+	h.untrack()
+	h.Hash.Close()
+}
+
+func trackCipher(cipher Cipher, algorithm string) Cipher {
+	t := track("Cipher", algorithm)
+	if t == nil {
+		return cipher
+	}
+	c := &trackedCipher{cipher, t}
+	finalize(t, c, func(c *trackedCipher) { c.Cipher.Close() })
+	return withGCMTag(c, cipher)
+}
+
+type trackedCipher struct {
+	Cipher
+	*tracked
+}
+
+func (c *trackedCipher) Close() {
+	c.untrack()
+	c.Cipher.Close()
+}
+
+func trackAEAD(aead AEAD, algorithm string) AEAD {
+	t := track("AEAD", algorithm)
+	if t == nil {
+		return aead
+	}
+	a := &trackedAEAD{aead, t}
+	finalize(t, a, func(a *trackedAEAD) { a.AEAD.Close() })
+	return a
+}
+
+type trackedAEAD struct {
+	AEAD
+	*tracked
+}
+
+func (a *trackedAEAD) Close() {
+	a.untrack()
+	a.AEAD.Close()
+}
+
+func trackKeyWrap(kw KeyWrap, algorithm string) KeyWrap {
+	t := track("KeyWrap", algorithm)
+	if t == nil {
+		return kw
+	}
+	w := &trackedKeyWrap{kw, t}
+	finalize(t, w, func(w *trackedKeyWrap) { w.KeyWrap.Close() })
+	return w
+}
+
+type trackedKeyWrap struct {
+	KeyWrap
+	*tracked
+}
+
+func (w *trackedKeyWrap) Close() {
+	w.untrack()
+	w.KeyWrap.Close()
+}
+
+func trackRandom(random Random, algorithm string) Random {
+	t := track("Random", algorithm)
+	if t == nil {
+		return random
+	}
+	r := &trackedRandom{random, t}
+	finalize(t, r, func(r *trackedRandom) { r.Random.Close() })
+	return r
+}
+
+type trackedRandom struct {
+	Random
+	*tracked
+}
+
+func (r *trackedRandom) Close() {
+	r.untrack()
+	r.Random.Close()
+}
+
+func trackPrivateKey(key PrivateKey, algorithm string) PrivateKey {
+	t := track("PrivateKey", algorithm)
+	if t == nil {
+		return key
+	}
+	k := &trackedPrivateKey{key, t}
+	finalize(t, k, func(k *trackedPrivateKey) { k.PrivateKey.Close() })
+	return k
+}
+
+type trackedPrivateKey struct {
+	PrivateKey
+	*tracked
+}
+
+func (k *trackedPrivateKey) Derive(peer PublicKey) ([]byte, error) {
+	return k.PrivateKey.Derive(unwrapPublicKey(peer))
+}
+
+func (k *trackedPrivateKey) PublicKey() PublicKey {
+	public := k.PrivateKey.PublicKey()
+	t := track("PublicKey", k.algorithm)
+	if t == nil {
+		return public
+	}
+	p := &trackedPublicKey{public, t}
+	finalize(t, p, func(p *trackedPublicKey) { p.PublicKey.Close() })
+	return p
+}
+
+func (k *trackedPrivateKey) KeySize() int {
+	return keySize(k.PrivateKey)
+}
+
+func (k *trackedPrivateKey) Export() ([]byte, error) {
+	return ExportKey(k.PrivateKey)
+}
+
+func (k *trackedPrivateKey) Close() {
+	k.untrack()
+	k.PrivateKey.Close()
+}
+
+type trackedPublicKey struct {
+	PublicKey
+	*tracked
+}
+
+func (k *trackedPublicKey) KeySize() int {
+	return keySize(k.PublicKey)
+}
+
+func (k *trackedPublicKey) Export() ([]byte, error) {
+	return ExportKey(k.PublicKey)
+}
+
+func (k *trackedPublicKey) Close() {
+	k.untrack()
+	k.PublicKey.Close()
+}
@@ -0,0 +1,314 @@
+// +build !windows
+
+package libcrypto
+
+/*
+#include <stdlib.h>
+#include <openssl/crypto.h>
+#include <openssl/err.h>
+#include <openssl/evp.h>
+#include <openssl/opensslv.h>
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+#include <openssl/core_names.h>
+#endif
+
+// SIV and GCM-SIV are only available through the provider API (OpenSSL 3.0 and 3.2 respectively).
+static const EVP_CIPHER *okapi_cipher_fetch(const char *name) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_CIPHER_fetch(NULL, name, NULL);
+#else
+	return NULL;
+#endif
+}
+
+// okapi_aes_cmac computes AES-CMAC of the input, like SIV it is only available with OpenSSL 3.x.
+static int okapi_aes_cmac(const unsigned char *key, size_t keylen, const unsigned char *in, size_t inl, unsigned char *out) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	const char *cipher = keylen == 16 ? "AES-128-CBC" : keylen == 24 ? "AES-192-CBC" : "AES-256-CBC";
+	EVP_MAC *mac = EVP_MAC_fetch(NULL, "CMAC", NULL);
+	if (mac == NULL) {
+		return 0;
+	}
+	EVP_MAC_CTX *ctx = EVP_MAC_CTX_new(mac);
+	EVP_MAC_free(mac);
+	if (ctx == NULL) {
+		return 0;
+	}
+	OSSL_PARAM params[] = {
+		OSSL_PARAM_construct_utf8_string(OSSL_MAC_PARAM_CIPHER, (char *)cipher, 0),
+		OSSL_PARAM_construct_end()
+	};
+	size_t outl;
+	int ok = EVP_MAC_init(ctx, key, keylen, params) == 1 &&
+		EVP_MAC_update(ctx, in, inl) == 1 &&
+		EVP_MAC_final(ctx, out, &outl, 16) == 1;
+	EVP_MAC_CTX_free(ctx);
+	return ok;
+#else
+	return 0;
+#endif
+}
+*/
+import "C"
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"unsafe"
+)
+
+func init() {
+	if AES_SIV.available() {
+		okapi.Register(&okapi.AES_SIV, AES_SIV)
+	}
+	if AES_GCM_SIV.available() {
+		okapi.Register(&okapi.AES_GCM_SIV, AES_GCM_SIV)
+	}
+	okapi.Register(&okapi.AES_GCM_AEAD, AES_GCM_AEAD)
+}
+
+var (
+	AES_SIV     = newAEADSpec(true, map[int]string{32: "AES-128-SIV", 48: "AES-192-SIV", 64: "AES-256-SIV"})
+	AES_GCM_SIV = newAEADSpec(false, map[int]string{16: "AES-128-GCM-SIV", 32: "AES-256-GCM-SIV"})
+
+	AES_GCM_AEAD = AEADSpec{ciphers: map[int]*C.EVP_CIPHER{16: C.EVP_aes_128_gcm(), 24: C.EVP_aes_192_gcm(), 32: C.EVP_aes_256_gcm()}}
+)
+
+var errOpen = errors.New("message authentication failed")
+
+const aeadTagSize = 16
+
+// AEADSpec represents an authenticated encryption algorithm. Different map entries correspond
+// to implementations for different key sizes. The map is empty if the algorithm
+// is not available in the linked libcrypto.
+type AEADSpec struct {
+	ciphers map[int]*C.EVP_CIPHER
+	// siv is set for RFC 5297 style algorithms, where the tag (synthetic IV)
+	// precedes the encrypted data and the nonce is the last associated data component.
+	siv bool
+}
+
+func newAEADSpec(siv bool, names map[int]string) AEADSpec {
+	as := AEADSpec{ciphers: make(map[int]*C.EVP_CIPHER), siv: siv}
+	for size, name := range names {
+		cname := C.CString(name)
+		algorithm := C.okapi_cipher_fetch(cname)
+		C.free(unsafe.Pointer(cname))
+		if algorithm != nil {
+			as.ciphers[size] = algorithm
+		}
+	}
+	return as
+}
+
+func (as AEADSpec) available() bool {
+	return len(as.ciphers) > 0
+}
+
+func (as AEADSpec) New(key []byte) okapi.AEAD {
+	algorithm, ok := as.ciphers[len(key)]
+	if !ok {
+		panic(fmt.Sprintf("Invalid key size: %d", len(key)))
+	}
+	return &AEAD{cipher: algorithm, key: keyCopy(key), siv: as.siv}
+}
+
+type AEAD struct {
+	cipher *C.EVP_CIPHER // libcrypto constant
+	key    []byte        // in C memory
+	siv    bool
+}
+
+func (a *AEAD) NonceSize() int {
+	return int(C.EVP_CIPHER_iv_length(a.cipher))
+}
+
+func (a *AEAD) Overhead() int {
+	return aeadTagSize
+}
+
+func (a *AEAD) KeySize() int {
+	return len(a.key)
+}
+
+func (a *AEAD) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	if a.siv && len(plain) == 0 {
+		out, tag := grow(dst, aeadTagSize)
+		copy(tag, a.s2vEmpty(nonce, data))
+		return out
+	}
+	ctx := a.newCtx(nonce, data, true)
+	defer C.EVP_CIPHER_CTX_free(ctx)
+	out, tail := grow(dst, len(plain)+aeadTagSize)
+	encrypted, tag := tail[:len(plain)], tail[len(plain):]
+	if a.siv {
+		tag, encrypted = tail[:aeadTagSize], tail[aeadTagSize:]
+	}
+	var outl C.int
+	check1(C.EVP_CipherUpdate(ctx, dataPtr(encrypted), &outl, dataPtr(plain), C.int(len(plain))))
+	check1(C.EVP_CipherFinal_ex(ctx, nil, &outl))
+	check1(C.EVP_CIPHER_CTX_ctrl(ctx, C.EVP_CTRL_AEAD_GET_TAG, aeadTagSize, unsafe.Pointer(&tag[0])))
+	return out
+}
+
+func (a *AEAD) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	if len(encrypted) < aeadTagSize {
+		return nil, errOpen
+	}
+	var tag []byte
+	if a.siv {
+		tag, encrypted = encrypted[:aeadTagSize], encrypted[aeadTagSize:]
+	} else {
+		tag, encrypted = encrypted[len(encrypted)-aeadTagSize:], encrypted[:len(encrypted)-aeadTagSize]
+	}
+	if a.siv && len(encrypted) == 0 {
+		if subtle.ConstantTimeCompare(tag, a.s2vEmpty(nonce, data)) != 1 {
+			return nil, errOpen
+		}
+		return dst, nil
+	}
+	ctx := a.newCtx(nonce, data, false)
+	defer C.EVP_CIPHER_CTX_free(ctx)
+	check1(C.EVP_CIPHER_CTX_ctrl(ctx, C.EVP_CTRL_AEAD_SET_TAG, aeadTagSize, unsafe.Pointer(&tag[0])))
+	out, plain := grow(dst, len(encrypted))
+	var outl C.int
+	if C.EVP_CipherUpdate(ctx, dataPtr(plain), &outl, dataPtr(encrypted), C.int(len(encrypted))) != 1 ||
+		C.EVP_CipherFinal_ex(ctx, nil, &outl) != 1 {
+		C.ERR_clear_error()
+		for i := range plain {
+			plain[i] = 0
+		}
+		return nil, errOpen
+	}
+	return out, nil
+}
+
+func (a *AEAD) Close() {
+	freeKey(a.key)
+	a.key = nil
+}
+
+// newCtx creates a cipher context initialized with the key and nonce
+// and feeds it the associated data components.
+func (a *AEAD) newCtx(nonce []byte, data [][]byte, encrypt bool) *C.EVP_CIPHER_CTX {
+	var enc C.int = 0
+	if encrypt {
+		enc = 1
+	}
+	if a.siv {
+		if len(nonce) > 0 {
+			data = append(data, nonce)
+		}
+		nonce = nil
+	} else {
+		if len(nonce) != a.NonceSize() {
+			panic(fmt.Sprintf("Invalid nonce size: %d", len(nonce)))
+		}
+		if len(data) > 1 {
+			panic("Algorithm supports at most one associated data component")
+		}
+	}
+	ctx := C.EVP_CIPHER_CTX_new()
+	if ctx == nil {
+		panic(libcryptoError())
+	}
+	check1(C.EVP_CipherInit_ex(ctx, a.cipher, nil, bytesPtr(a.key), bytesPtr(nonce), enc))
+	var outl C.int
+	for _, component := range data {
+		check1(C.EVP_CipherUpdate(ctx, nil, &outl, dataPtr(component), C.int(len(component))))
+	}
+	return ctx
+}
+
+// s2vEmpty computes the synthetic IV of empty plain input (RFC 5297, section 2.4),
+// libcrypto SIV implementation cannot process empty plain input.
+func (a *AEAD) s2vEmpty(nonce []byte, data [][]byte) []byte {
+	if len(nonce) > 0 {
+		data = append(data[:len(data):len(data)], nonce)
+	}
+	var d, t [aeadTagSize]byte
+	a.cmac(d[:], d[:])
+	for _, component := range data {
+		dbl(d[:])
+		a.cmac(t[:], component)
+		for i := range d {
+			d[i] ^= t[i]
+		}
+	}
+	dbl(d[:])
+	d[0] ^= 0x80
+	v := make([]byte, aeadTagSize)
+	a.cmac(v, d[:])
+	return v
+}
+
+// cmac computes AES-CMAC of the input with the first half of the key (K1)
+func (a *AEAD) cmac(out, in []byte) {
+	k1 := a.key[:len(a.key)/2]
+	if C.okapi_aes_cmac(bytesPtr(k1), C.size_t(len(k1)), dataPtr(in), C.size_t(len(in)), (*C.uchar)(&out[0])) != 1 {
+		panic(libcryptoError())
+	}
+}
+
+// dbl multiplies the block by x in GF(2^128) (RFC 5297, section 2.3).
+func dbl(b []byte) {
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] = b[len(b)-1]<<1 ^ 0x87*carry
+}
+
+// helpers
+
+// bytesPtr returns the C pointer to the first element of the slice,
+// or nil if the slice is empty.
+func bytesPtr(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.uchar)(&b[0])
+}
+
+// dataPtr is like bytesPtr, but it never returns nil,
+// libcrypto rejects nil input even if the size is 0.
+func dataPtr(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return (*C.uchar)(&zero[0])
+	}
+	return (*C.uchar)(&b[0])
+}
+
+var zero = []byte{0}
+
+// keyCopy copies the key into C memory, so that it is not moved or left behind by the Go runtime,
+// it must be released with freeKey
+func keyCopy(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(C.CBytes(key)), len(key))
+}
+
+// freeKey cleanses and releases the key copied with keyCopy
+func freeKey(key []byte) {
+	if len(key) == 0 {
+		return
+	}
+	C.OPENSSL_cleanse(unsafe.Pointer(&key[0]), C.size_t(len(key)))
+	C.free(unsafe.Pointer(&key[0]))
+}
+
+// grow extends the slice by n bytes, returning the extended slice
+// and the tail slice corresponding to the extension
+func grow(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
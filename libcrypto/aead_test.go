@@ -0,0 +1,114 @@
+// +build !windows
+
+package libcrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAES_SIV(t *testing.T) {
+	if !AES_SIV.available() {
+		t.Skip("AES_SIV is not available")
+	}
+	// RFC 5297, A.1 Deterministic Authenticated Encryption Example
+	key, _ := hex.DecodeString("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	data, _ := hex.DecodeString("101112131415161718191a1b1c1d1e1f2021222324252627")
+	plain, _ := hex.DecodeString("112233445566778899aabbccddee")
+	siv := AES_SIV.New(key)
+	defer siv.Close()
+	encrypted := siv.Seal(nil, nil, plain, data)
+	if hex.EncodeToString(encrypted) != "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	decrypted, err := siv.Open(nil, nil, encrypted, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	encrypted[0] ^= 1
+	if _, err = siv.Open(nil, nil, encrypted, data); err == nil {
+		t.Fatal("Open succeeded with tampered input")
+	}
+}
+
+func TestAES_SIVEmpty(t *testing.T) {
+	if !AES_SIV.available() {
+		t.Skip("AES_SIV is not available")
+	}
+	key, _ := hex.DecodeString("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	data, _ := hex.DecodeString("101112131415161718191a1b1c1d1e1f2021222324252627")
+	siv := AES_SIV.New(key)
+	defer siv.Close()
+	for _, v := range []struct {
+		nonce     []byte
+		data      [][]byte
+		encrypted string
+	}{
+		{nil, [][]byte{data}, "b9d5cc97054dcd3f6dfda629d4f4d313"},
+		{[]byte("nonce"), [][]byte{data}, "1701ff0183b5092aede8b968cfde153b"},
+		{nil, nil, "f2007a5beb2b8900c588a7adf599f172"},
+	} {
+		encrypted := siv.Seal(nil, v.nonce, nil, v.data...)
+		if hex.EncodeToString(encrypted) != v.encrypted {
+			t.Fatalf("Wrong encryption: %x", encrypted)
+		}
+		decrypted, err := siv.Open(nil, v.nonce, encrypted, v.data...)
+		if err != nil || len(decrypted) != 0 {
+			t.Fatalf("Open failed: %x %v", decrypted, err)
+		}
+		encrypted[0] ^= 1
+		if _, err = siv.Open(nil, v.nonce, encrypted, v.data...); err == nil {
+			t.Fatal("Open succeeded with tampered input")
+		}
+	}
+}
+
+func TestAES_GCM_SIV(t *testing.T) {
+	if !AES_GCM_SIV.available() {
+		t.Skip("AES_GCM_SIV is not available")
+	}
+	// RFC 8452, Appendix C.1
+	key, _ := hex.DecodeString("01000000000000000000000000000000")
+	nonce, _ := hex.DecodeString("030000000000000000000000")
+	plain, _ := hex.DecodeString("0100000000000000")
+	gcm := AES_GCM_SIV.New(key)
+	defer gcm.Close()
+	encrypted := gcm.Seal(nil, nonce, plain)
+	if hex.EncodeToString(encrypted) != "b5d839330ac7b786578782fff6013b815b287c22493a364c" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	decrypted, err := gcm.Open(nil, nonce, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+}
+
+func TestAES_GCM_AEAD(t *testing.T) {
+	// GCM specification, Test Case 2
+	gcm := AES_GCM_AEAD.New(make([]byte, 16))
+	defer gcm.Close()
+	nonce := make([]byte, gcm.NonceSize())
+	plain := make([]byte, 16)
+	encrypted := gcm.Seal(nil, nonce, plain)
+	if hex.EncodeToString(encrypted) != "0388dace60b6a392f328c2b971b2fe78ab6e47d42cec13bdf53a67b21257bddf" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	encrypted = gcm.Seal(nil, nonce, plain, []byte("header"))
+	decrypted, err := gcm.Open(nil, nonce, encrypted, []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	if _, err = gcm.Open(nil, nonce, encrypted); err == nil {
+		t.Fatal("Open succeeded with wrong associated data")
+	}
+}
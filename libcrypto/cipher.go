@@ -12,21 +12,22 @@ import (
 )
 
 func init() {
-	okapi.RC4 = RC4
-	okapi.BF_ECB = BF_ECB
-	okapi.BF_CBC = BF_CBC
-	okapi.BF_CFB = BF_CFB
-	okapi.BF_OFB = BF_OFB
-	okapi.DES3_ECB = DES3_ECB
-	okapi.DES3_CBC = DES3_CBC
-	okapi.DES3_CFB = DES3_CFB
-	okapi.DES3_OFB = DES3_OFB
-	okapi.AES_ECB = AES_ECB
-	okapi.AES_CBC = AES_CBC
-	okapi.AES_OFB = AES_OFB
-	okapi.AES_CFB = AES_CFB
-	okapi.AES_CTR = AES_CTR
-	okapi.AES_GCM = AES_GCM
+	okapi.Register(&okapi.RC4, RC4)
+	okapi.Register(&okapi.BF_ECB, BF_ECB)
+	okapi.Register(&okapi.BF_CBC, BF_CBC)
+	okapi.Register(&okapi.BF_CFB, BF_CFB)
+	okapi.Register(&okapi.BF_OFB, BF_OFB)
+	okapi.Register(&okapi.DES3_ECB, DES3_ECB)
+	okapi.Register(&okapi.DES3_CBC, DES3_CBC)
+	okapi.Register(&okapi.DES3_CFB, DES3_CFB)
+	okapi.Register(&okapi.DES3_OFB, DES3_OFB)
+	okapi.Register(&okapi.RC2_CBC, RC2_CBC)
+	okapi.Register(&okapi.AES_ECB, AES_ECB)
+	okapi.Register(&okapi.AES_CBC, AES_CBC)
+	okapi.Register(&okapi.AES_OFB, AES_OFB)
+	okapi.Register(&okapi.AES_CFB, AES_CFB)
+	okapi.Register(&okapi.AES_CTR, AES_CTR)
+	okapi.Register(&okapi.AES_GCM, AES_GCM)
 }
 
 var (
@@ -47,6 +48,7 @@ var (
 	DES3_CBC = CipherSpec{0: C.EVP_des_ede3_cbc()}
 	DES3_CFB = CipherSpec{0: C.EVP_des_ede3_cfb()}
 	DES3_OFB = CipherSpec{0: C.EVP_des_ede3_ofb()}
+	RC2_CBC  = CipherSpec{0: C.EVP_rc2_cbc()}
 )
 
 // CipherSpec represents a cipher algorithm. Different map entries correspond
@@ -55,18 +57,13 @@ var (
 type CipherSpec map[int]*C.EVP_CIPHER
 
 func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
-	var algorithm *C.EVP_CIPHER
-	algorithm, ok := cs[0]
-	if !ok {
-		algorithm, ok = cs[len(key)]
-		if !ok {
-			panic(fmt.Sprintf("Invalid key size: %d", len(key)))
-		}
-	}
+	algorithm := cs.algorithm(len(key))
 	c := &Cipher{cipher: algorithm}
 	c.blockSize = int(C.EVP_CIPHER_block_size(algorithm))
-	c.ctx = new(C.EVP_CIPHER_CTX)
-	C.EVP_CIPHER_CTX_init(c.ctx)
+	c.ctx = C.EVP_CIPHER_CTX_new()
+	if c.ctx == nil {
+		panic(libcryptoError())
+	}
 
 	var ivp *C.uchar
 	if iv != nil {
@@ -78,11 +75,27 @@ func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
 	}
 	check1(C.EVP_CipherInit_ex(c.ctx, algorithm, nil, nil, nil, enc))
 	C.EVP_CIPHER_CTX_set_key_length(c.ctx, C.int(len(key)))
+	if C.EVP_CIPHER_nid(algorithm) == C.NID_rc2_cbc {
+		// effective key bits default to 128, match the key size instead
+		C.EVP_CIPHER_CTX_ctrl(c.ctx, C.EVP_CTRL_SET_RC2_KEY_BITS, C.int(8*len(key)), nil)
+	}
 	C.EVP_CIPHER_CTX_set_padding(c.ctx, 0) // No padding
 	check1(C.EVP_CipherInit_ex(c.ctx, nil, nil, (*C.uchar)(&key[0]), ivp, -1))
 	return c
 }
 
+// algorithm selects the implementation matching the key size.
+func (cs CipherSpec) algorithm(keySize int) *C.EVP_CIPHER {
+	algorithm, ok := cs[0]
+	if !ok {
+		algorithm, ok = cs[keySize]
+		if !ok {
+			panic(fmt.Sprintf("Invalid key size: %d", keySize))
+		}
+	}
+	return algorithm
+}
+
 func (cs CipherSpec) NewReader(in io.Reader, key, iv, buffer []byte) *okapi.CipherReader {
 	return okapi.NewCipherReader(in, cs, key, iv, buffer)
 }
@@ -91,6 +104,10 @@ func (cs CipherSpec) NewWriter(out io.Writer, key, iv, buffer []byte) *okapi.Cip
 	return okapi.NewCipherWriter(out, cs, key, iv, buffer)
 }
 
+func (cs CipherSpec) NewWithKey(key *okapi.SecretKey, iv []byte, encrypt bool) (okapi.Cipher, error) {
+	return key.NewCipher(cs, iv, encrypt)
+}
+
 type Cipher struct {
 	ctx       *C.EVP_CIPHER_CTX
 	cipher    *C.EVP_CIPHER // libcrypto constant
@@ -153,5 +170,5 @@ func (c *Cipher) Close() {
 	defer func() {
 		c.ctx = nil
 	}()
-	C.EVP_CIPHER_CTX_cleanup(c.ctx)
+	C.EVP_CIPHER_CTX_free(c.ctx)
 }
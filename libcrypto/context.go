@@ -0,0 +1,300 @@
+// +build !windows
+
+package libcrypto
+
+/*
+#include <stdlib.h>
+#include <openssl/crypto.h>
+#include <openssl/err.h>
+#include <openssl/evp.h>
+#include "fetch.h"
+
+static OSSL_LIB_CTX *okapi_library_new() {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_LIB_CTX_new();
+#else
+	return NULL;
+#endif
+}
+
+static void okapi_library_free(OSSL_LIB_CTX *library) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_LIB_CTX_free(library);
+#endif
+}
+
+static int okapi_load_config(OSSL_LIB_CTX *library, const char *file) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_LIB_CTX_load_config(library, file);
+#else
+	return 0;
+#endif
+}
+
+static OSSL_PROVIDER *okapi_provider_load(OSSL_LIB_CTX *library, const char *name) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_PROVIDER_load(library, name);
+#else
+	return NULL;
+#endif
+}
+
+static void okapi_provider_unload(OSSL_PROVIDER *provider) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PROVIDER_unload(provider);
+#endif
+}
+
+static int okapi_set_properties(OSSL_LIB_CTX *library, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_set_default_properties(library, properties);
+#else
+	return 0;
+#endif
+}
+
+// okapi_md_fetch fetches the implementation of the same digest algorithm as md
+static EVP_MD *okapi_md_fetch(OSSL_LIB_CTX *library, const EVP_MD *md, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_MD_fetch(library, EVP_MD_get0_name(md), properties);
+#else
+	return NULL;
+#endif
+}
+
+static void okapi_md_free(EVP_MD *md) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_MD_free(md);
+#endif
+}
+
+// okapi_cipher_refetch fetches the implementation of the same cipher algorithm as cipher
+static EVP_CIPHER *okapi_cipher_refetch(OSSL_LIB_CTX *library, const EVP_CIPHER *cipher, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_CIPHER_fetch(library, EVP_CIPHER_get0_name(cipher), properties);
+#else
+	return NULL;
+#endif
+}
+
+static void okapi_cipher_free(EVP_CIPHER *cipher) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_CIPHER_free(cipher);
+#endif
+}
+*/
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+	"sync"
+	"unsafe"
+)
+
+// Context is an OpenSSL library context (OSSL_LIB_CTX) with its own configuration and set of loaded providers
+// (e.g. default, legacy, fips or third-party ones). The implementations of the algorithms are fetched
+// from a context with a property query (e.g. "provider=fips" or "fips=yes") selecting among the implementations
+// of the loaded providers, an empty query selects the default properties of the context.
+// Contexts require OpenSSL 3.x, with OpenSSL 1.1.1 all methods return an error.
+//
+// The specs and keys obtained from a context must not be used after the context is closed.
+type Context struct {
+	library   *C.OSSL_LIB_CTX
+	mutex     sync.Mutex
+	providers []*C.OSSL_PROVIDER
+	// release frees the algorithms fetched from the context
+	release []func()
+}
+
+// DefaultContext is the default library context, used by the predefined specs and key constructors.
+// With OpenSSL 3.x the default and legacy (if available) providers are loaded into it.
+var DefaultContext = &Context{}
+
+var errContexts = errors.New("Library contexts require OpenSSL 3.0 or later")
+
+// NewContext creates a library context without any providers loaded.
+// Note that the default provider is loaded automatically on first fetch
+// unless some provider is loaded explicitly or by the configuration.
+func NewContext() (*Context, error) {
+	if C.okapi_contexts_available() == 0 {
+		return nil, errContexts
+	}
+	library := C.okapi_library_new()
+	if library == nil {
+		return nil, errors.New(libcryptoError())
+	}
+	return &Context{library: library}, nil
+}
+
+// LoadConfig loads an OpenSSL configuration file into the context,
+// it can load and configure providers and set the default properties.
+func (c *Context) LoadConfig(file string) error {
+	if C.okapi_contexts_available() == 0 {
+		return errContexts
+	}
+	cfile := C.CString(file)
+	defer C.free(unsafe.Pointer(cfile))
+	return error1(C.okapi_load_config(c.library, cfile))
+}
+
+// LoadProvider loads the named provider (e.g. "fips" or "legacy") into the context.
+// The providers remain loaded until the context is closed.
+func (c *Context) LoadProvider(name string) error {
+	if C.okapi_contexts_available() == 0 {
+		return errContexts
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	provider := C.okapi_provider_load(c.library, cname)
+	if provider == nil {
+		return errors.New(libcryptoError())
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.providers = append(c.providers, provider)
+	return nil
+}
+
+// SetProperties sets the default property query of the context,
+// it is combined with the queries provided when fetching.
+func (c *Context) SetProperties(query string) error {
+	if C.okapi_contexts_available() == 0 {
+		return errContexts
+	}
+	cquery := C.CString(query)
+	defer C.free(unsafe.Pointer(cquery))
+	return error1(C.okapi_set_properties(c.library, cquery))
+}
+
+// HashSpec fetches the implementation of the algorithm of the provided spec matching the property query.
+func (c *Context) HashSpec(hs HashSpec, properties string) (HashSpec, error) {
+	if C.okapi_contexts_available() == 0 {
+		return HashSpec{}, errContexts
+	}
+	f := fetch{c, properties}
+	query, release := f.query()
+	defer release()
+	md := C.okapi_md_fetch(c.library, hs.md, query)
+	if md == nil {
+		return HashSpec{}, errors.New(libcryptoError())
+	}
+	c.fetched(func() { C.okapi_md_free(md) })
+	return HashSpec{md}, nil
+}
+
+// CipherSpec fetches the implementations of the algorithm of the provided spec matching the property query,
+// for all key sizes of the spec.
+func (c *Context) CipherSpec(cs CipherSpec, properties string) (CipherSpec, error) {
+	if C.okapi_contexts_available() == 0 {
+		return nil, errContexts
+	}
+	f := fetch{c, properties}
+	query, release := f.query()
+	defer release()
+	fetched := make(CipherSpec, len(cs))
+	for size, algorithm := range cs {
+		cipher := C.okapi_cipher_refetch(c.library, algorithm, query)
+		if cipher == nil {
+			return nil, errors.New(libcryptoError())
+		}
+		c.fetched(func() { C.okapi_cipher_free(cipher) })
+		fetched[size] = cipher
+	}
+	return fetched, nil
+}
+
+// HMAC returns the HMAC MACSpec fetching its implementation and the implementation
+// of the digest matching the property query.
+func (c *Context) HMAC(properties string) (MACSpec, error) {
+	if C.okapi_contexts_available() == 0 {
+		return MACSpec{}, errContexts
+	}
+	return MACSpec{fetch{c, properties}}, nil
+}
+
+// KeyConstructor returns the constructor for the algorithm parameters (e.g. RSA_OAEP or ECDSA_SHA256)
+// fetching the implementations of the keys matching the property query.
+func (c *Context) KeyConstructor(aps algorithmParameters, properties string) (okapi.KeyConstructor, error) {
+	if C.okapi_contexts_available() == 0 {
+		return nil, errContexts
+	}
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		key, err := c.NewPKey(keyParameters, aps, properties)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}, nil
+}
+
+// NewPKey is like the NewPKey function, but it fetches the implementations of the key
+// matching the property query.
+func (c *Context) NewPKey(kps interface{}, aps algorithmParameters, properties string) (*PKey, error) {
+	if C.okapi_contexts_available() == 0 {
+		return nil, errContexts
+	}
+	return newPKey(kps, aps, fetch{c, properties})
+}
+
+// Close unloads the providers loaded by LoadProvider, frees the fetched algorithms and the context.
+// The default context is not freed.
+func (c *Context) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, release := range c.release {
+		release()
+	}
+	c.release = nil
+	for _, provider := range c.providers {
+		C.okapi_provider_unload(provider)
+	}
+	c.providers = nil
+	if c.library != nil {
+		C.okapi_library_free(c.library)
+		c.library = nil
+	}
+}
+
+// fetched registers the release function of a fetched algorithm
+func (c *Context) fetched(release func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.release = append(c.release, release)
+}
+
+// fetch selects the library context and the property query used to fetch the implementations
+// of the algorithms of a key or MAC, the zero value selects the default ones.
+type fetch struct {
+	context    *Context
+	properties string
+}
+
+func (f fetch) library() *C.OSSL_LIB_CTX {
+	if f.context == nil {
+		return nil
+	}
+	return f.context.library
+}
+
+// query returns the property query as a C string, nil if empty, and the function releasing it
+func (f fetch) query() (*C.char, func()) {
+	if f.properties == "" {
+		return nil, func() {}
+	}
+	query := C.CString(f.properties)
+	return query, func() { C.free(unsafe.Pointer(query)) }
+}
+
+// newCtxID creates a context for generating keys or parameters of the key type
+func (f fetch) newCtxID(id C.int) *C.EVP_PKEY_CTX {
+	query, release := f.query()
+	defer release()
+	return C.okapi_pkey_ctx_new_id(f.library(), id, query)
+}
+
+// newCtx creates a context for the operations with the key
+func (f fetch) newCtx(pkey *C.EVP_PKEY) *C.EVP_PKEY_CTX {
+	query, release := f.query()
+	defer release()
+	return C.okapi_pkey_ctx_new(f.library(), pkey, query)
+}
@@ -0,0 +1,162 @@
+// +build !windows
+
+package libcrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newContext(t *testing.T, providers ...string) *Context {
+	ctx, err := NewContext()
+	if err == errContexts {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, provider := range providers {
+		if err := ctx.LoadProvider(provider); err != nil {
+			ctx.Close()
+			t.Skipf("Provider %s is not available: %s", provider, err)
+		}
+	}
+	return ctx
+}
+
+func TestContextLegacy(t *testing.T) {
+	ctx := newContext(t, "default", "legacy")
+	defer ctx.Close()
+	if _, err := ctx.HashSpec(MD4, "provider=default"); err == nil {
+		t.Fatal("Default provider implements MD4")
+	}
+	md4, err := ctx.HashSpec(MD4, "provider=legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := md4.New()
+	defer h.Close()
+	h.Write([]byte("test"))
+	if digest := h.Digest(); hex.EncodeToString(digest) != "db346d691d7acc4dc2625db19f9e3f52" {
+		t.Fatalf("%x", digest)
+	}
+	bf, err := ctx.CipherSpec(BF_CBC, "provider=legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, iv := []byte("open sesame!"), []byte("12345678")
+	plain := []byte("0123456789abcdef")
+	expected := crypt(t, BF_CBC, key, iv, plain)
+	if encrypted := crypt(t, bf, key, iv, plain); !bytes.Equal(encrypted, expected) {
+		t.Fatalf("%x", encrypted)
+	}
+}
+
+func TestContextConfig(t *testing.T) {
+	ctx := newContext(t)
+	defer ctx.Close()
+	config := filepath.Join(t.TempDir(), "openssl.cnf")
+	err := os.WriteFile(config, []byte(`openssl_conf = openssl_init
+[openssl_init]
+providers = provider_sect
+[provider_sect]
+default = default_sect
+legacy = legacy_sect
+[default_sect]
+activate = 1
+[legacy_sect]
+activate = 1
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ctx.LoadConfig(config); err != nil {
+		t.Skipf("Legacy provider is not available: %s", err)
+	}
+	if _, err = ctx.HashSpec(RIPEMD160, "provider=legacy"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crypt encrypts the input in one go
+func crypt(t *testing.T, cs CipherSpec, key, iv, in []byte) []byte {
+	cipher := cs.New(key, iv, true)
+	defer cipher.Close()
+	out := make([]byte, len(in)+cipher.BlockSize())
+	ins, outs := cipher.Update(in, out)
+	if ins != len(in) {
+		t.Fatalf("Wrong input count: %d", ins)
+	}
+	outs += cipher.Finish(out[outs:])
+	return out[:outs]
+}
+
+func TestContextProperties(t *testing.T) {
+	ctx := newContext(t, "default")
+	defer ctx.Close()
+	aes, err := ctx.CipherSpec(AES_CBC, "provider=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, iv := []byte("0123456789ABCDEF0123456789ABCDEF"), []byte("0123456789ABCDEF")
+	plain := []byte("0123456789abcdef0123456789abcdef")
+	if !bytes.Equal(crypt(t, aes, key, iv, plain), crypt(t, AES_CBC, key, iv, plain)) {
+		t.Fatal("Ciphers mismatch")
+	}
+	hmac, err := ctx.HMAC("provider=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha, err := ctx.HashSpec(SHA256, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha, []byte("key"))
+	defer mac.Close()
+	mac.Write([]byte("The quick brown fox jumps over the lazy dog"))
+	if digest := mac.Digest(); hex.EncodeToString(digest) != "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Fatalf("%x", digest)
+	}
+	if _, err := ctx.HashSpec(SHA256, "provider=fips"); err == nil {
+		t.Fatal("Fetched from a provider that isn't loaded")
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	ctx := newContext(t, "default")
+	defer ctx.Close()
+	constructor, err := ctx.KeyConstructor(ECDSA_SHA256, "provider=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pri, err := constructor(256)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	der, err := pri.(*PKey).Export()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	imported, err := ctx.NewPKey(der, ECDSA_SHA256, "provider=default")
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	digest := make([]byte, 32)
+	signature, err := imported.Sign(digest)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	if valid, err := pub.Verify(signature, digest); !valid || err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if _, err := ctx.NewPKey(2048, RSA_OAEP, "provider=fips"); err == nil {
+		t.Fatal("Generated key with a provider that isn't loaded")
+	}
+}
@@ -6,15 +6,16 @@ package libcrypto
 // #include <openssl/dh.h>
 // #include <openssl/ec.h>
 // #include <openssl/obj_mac.h>
+// #include "fetch.h"
 import "C"
 import (
 	"errors"
 	"github.com/mkobetic/okapi"
-	"unsafe"
 )
 
 func init() {
-	okapi.DH = DH.constructor()
+	okapi.Register(&okapi.DH, DH.constructor())
+	okapi.Register(&okapi.ECDH, ECDH.constructor())
 }
 
 type dhParameters struct {
@@ -45,41 +46,7 @@ func (p dhParameters) isForSigning() bool      { return false }
 func (p dhParameters) isForKeyAgreement() bool { return true }
 
 func (p dhParameters) toPublic(pri *PKey) (pub *PKey, err error) {
-	if p.ecc {
-		return nil, errors.New("TODO")
-	}
-	// This is butt ugly, but it seems that the only way to create
-	// a public EVP_PKEY for DH is to create a key from the parameters
-	// and then manually copy the pub_key member of the internal DH key over.
-	dh1 := (*C.DH)(C.EVP_PKEY_get1_DH(pri.pkey))
-	if dh1 == nil {
-		return nil, errors.New(libcryptoError())
-	}
-	size := C.i2d_DHparams(dh1, nil)
-	bytes := make([]byte, int(size))
-	bytesp := (*C.uchar)(&bytes[0])
-	size = C.i2d_DHparams(dh1, &bytesp)
-	bytesp = (*C.uchar)(&bytes[0])
-	dh2 := C.d2i_DHparams(nil, &bytesp, (C.long)(size))
-	if dh2 == nil {
-		return nil, errors.New(libcryptoError())
-	}
-	dh2.pub_key = C.BN_dup(dh1.pub_key)
-	pkey := C.EVP_PKEY_new()
-	// err := error1(C.EVP_PKEY_assign_DH(pkey, dh2))
-	err = error1(C.EVP_PKEY_assign(pkey, C.EVP_PKEY_DH, unsafe.Pointer(dh2)))
-	if err != nil {
-		return nil, err
-	}
-	pub = &PKey{pkey: pkey, public: true, parameters: pri.parameters}
-	ctx := C.EVP_PKEY_CTX_new(pkey, nil)
-	if ctx == nil {
-		C.EVP_PKEY_free(pkey)
-		return nil, errors.New(libcryptoError())
-	}
-	pub.ctx = ctx
-	pri.parameters.configure(pub)
-	return pub, nil
+	return newPKeyFromPrivate(pri)
 }
 
 func (p dhParameters) keyType() C.int {
@@ -90,16 +57,17 @@ func (p dhParameters) keyType() C.int {
 	}
 }
 
-func (p dhParameters) generate(size int) (*PKey, error) {
-	pkey, err := newDHParams(size, p.keyType())
+func (p dhParameters) generate(size int, f fetch) (*PKey, error) {
+	pkey, err := newDHParams(size, p.keyType(), f)
 	if err != nil {
 		return nil, err
 	}
-	return newPKeyFromParams(pkey)
+	defer C.EVP_PKEY_free(pkey)
+	return newPKeyFromParams(pkey, f)
 }
 
-func newDHParams(size int, keyType C.int) (*C.EVP_PKEY, error) {
-	ctx := C.EVP_PKEY_CTX_new_id(keyType, nil)
+func newDHParams(size int, keyType C.int, f fetch) (*C.EVP_PKEY, error) {
+	ctx := f.newCtxID(keyType)
 	if ctx == nil {
 		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
 	}
@@ -53,3 +53,52 @@ func TestDH(t *testing.T) {
 		t.Fatalf("\nDerivation mismatch\nSecret 1: %x\nSecret 2: %x", secret1, secret2)
 	}
 }
+
+func TestECDH(t *testing.T) {
+	pri1, err := NewPKey(256, ECDH)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri1.Close()
+	pub1 := pri1.PublicKey()
+	defer pub1.Close()
+	pri2, _ := NewPKey(pub1, ECDH)
+	defer pri2.Close()
+	pub2 := pri2.PublicKey()
+	defer pub2.Close()
+	secret1, err := pri1.Derive(pub2)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	secret2, err := pri2.Derive(pub1)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	if !bytes.Equal(secret1, secret2) {
+		t.Fatalf("\nDerivation mismatch\nSecret 1: %x\nSecret 2: %x", secret1, secret2)
+	}
+}
+
+func TestExportImport_ECDH(t *testing.T) {
+	pri, _ := NewPKey(384, ECDH)
+	defer pri.Close()
+	pub := pri.PublicKey().(*PKey)
+	defer pub.Close()
+	der, err := pub.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	imported, err := NewPKey(der, ECDH)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	if !imported.public || imported.KeySize() != 384 {
+		t.Fatal("Invalid imported key")
+	}
+	secret1, _ := pri.Derive(pub)
+	secret2, err := pri.Derive(imported.PublicKey())
+	if err != nil || !bytes.Equal(secret1, secret2) {
+		t.Fatalf("Derive with imported key failed: %v", err)
+	}
+}
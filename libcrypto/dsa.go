@@ -4,6 +4,7 @@ package libcrypto
 
 // #include <openssl/evp.h>
 // #include <openssl/dsa.h>
+// #include "fetch.h"
 import "C"
 import (
 	"errors"
@@ -12,11 +13,11 @@ import (
 )
 
 func init() {
-	okapi.DSA_SHA1 = DSA_SHA1.constructor()
-	okapi.DSA_SHA224 = DSA_SHA224.constructor()
-	okapi.DSA_SHA256 = DSA_SHA256.constructor()
-	okapi.DSA_SHA384 = DSA_SHA384.constructor()
-	okapi.DSA_SHA512 = DSA_SHA512.constructor()
+	okapi.Register(&okapi.DSA_SHA1, DSA_SHA1.constructor())
+	okapi.Register(&okapi.DSA_SHA224, DSA_SHA224.constructor())
+	okapi.Register(&okapi.DSA_SHA256, DSA_SHA256.constructor())
+	okapi.Register(&okapi.DSA_SHA384, DSA_SHA384.constructor())
+	okapi.Register(&okapi.DSA_SHA512, DSA_SHA512.constructor())
 }
 
 type dsaParameters struct {
@@ -57,16 +58,17 @@ func (p dsaParameters) toPublic(pri *PKey) (pub *PKey, err error) {
 	return newPKeyFromPrivate(pri)
 }
 
-func (p dsaParameters) generate(size int) (*PKey, error) {
-	pkey, err := newDSAParams(size)
+func (p dsaParameters) generate(size int, f fetch) (*PKey, error) {
+	pkey, err := newDSAParams(size, f)
 	if err != nil {
 		return nil, err
 	}
-	return newPKeyFromParams(pkey)
+	defer C.EVP_PKEY_free(pkey)
+	return newPKeyFromParams(pkey, f)
 }
 
-func newDSAParams(size int) (*C.EVP_PKEY, error) {
-	ctx := C.EVP_PKEY_CTX_new_id(C.EVP_PKEY_DSA, nil)
+func newDSAParams(size int, f fetch) (*C.EVP_PKEY, error) {
+	ctx := f.newCtxID(C.EVP_PKEY_DSA)
 	if ctx == nil {
 		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
 	}
@@ -7,12 +7,13 @@ import (
 )
 
 func TestGenerateKey_DSA(t *testing.T) {
-	pri, err := NewPKey(512, DSA_SHA1)
+	// OpenSSL 3.x refuses to generate keys with DSA parameters smaller than 1024 bits
+	pri, err := NewPKey(1024, DSA_SHA1)
 	if err != nil {
 		t.Fatalf("Failed generating key: %s", err)
 	}
 	defer pri.Close()
-	if pri.KeySize() != 512 {
+	if pri.KeySize() != 1024 {
 		t.Fatal("Invalid key size!")
 	}
 }
@@ -4,17 +4,18 @@ package libcrypto
 
 // #include <openssl/evp.h>
 // #include <openssl/ec.h>
+// #include "fetch.h"
 import "C"
 import (
 	"errors"
 )
 
 var (
-	size2curve = map[int]C.int{224: C.NID_secp224r1, 384: C.NID_secp384r1, 521: C.NID_secp521r1}
+	size2curve = map[int]C.int{224: C.NID_secp224r1, 256: C.NID_X9_62_prime256v1, 384: C.NID_secp384r1, 521: C.NID_secp521r1}
 )
 
-func newECParams(size int) (*C.EVP_PKEY, error) {
-	ctx := C.EVP_PKEY_CTX_new_id(C.EVP_PKEY_EC, nil)
+func newECParams(size int, f fetch) (*C.EVP_PKEY, error) {
+	ctx := f.newCtxID(C.EVP_PKEY_EC)
 	if ctx == nil {
 		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
 	}
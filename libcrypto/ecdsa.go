@@ -0,0 +1,64 @@
+// +build !windows
+
+package libcrypto
+
+// #include <openssl/evp.h>
+// #include <openssl/ec.h>
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+	"unsafe"
+)
+
+func init() {
+	okapi.Register(&okapi.ECDSA_SHA1, ECDSA_SHA1.constructor())
+	okapi.Register(&okapi.ECDSA_224, ECDSA_SHA224.constructor())
+	okapi.Register(&okapi.ECDSA_SHA256, ECDSA_SHA256.constructor())
+	okapi.Register(&okapi.ECDSA_384, ECDSA_SHA384.constructor())
+	okapi.Register(&okapi.ECDSA_SHA512, ECDSA_SHA512.constructor())
+}
+
+type ecdsaParameters struct {
+	md *C.EVP_MD
+}
+
+var (
+	ECDSA_SHA1   = ecdsaParameters{C.EVP_sha1()}
+	ECDSA_SHA224 = ecdsaParameters{C.EVP_sha224()}
+	ECDSA_SHA256 = ecdsaParameters{C.EVP_sha256()}
+	ECDSA_SHA384 = ecdsaParameters{C.EVP_sha384()}
+	ECDSA_SHA512 = ecdsaParameters{C.EVP_sha512()}
+)
+
+func (p ecdsaParameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+func (p ecdsaParameters) configure(key *PKey) {
+	key.parameters = p
+	if key.public {
+		check1(C.EVP_PKEY_verify_init(key.ctx))
+	} else {
+		check1(C.EVP_PKEY_sign_init(key.ctx))
+	}
+	checkP(C.EVP_PKEY_CTX_ctrl(key.ctx, -1, C.EVP_PKEY_OP_TYPE_SIG, C.EVP_PKEY_CTRL_MD, 0, unsafe.Pointer(p.md)))
+}
+
+func (p ecdsaParameters) isForEncryption() bool   { return false }
+func (p ecdsaParameters) isForSigning() bool      { return true }
+func (p ecdsaParameters) isForKeyAgreement() bool { return false }
+
+func (p ecdsaParameters) toPublic(pri *PKey) (pub *PKey, err error) {
+	return newPKeyFromPrivate(pri)
+}
+
+func (p ecdsaParameters) generate(size int, f fetch) (*PKey, error) {
+	params, err := newECParams(size, f)
+	if err != nil {
+		return nil, err
+	}
+	defer C.EVP_PKEY_free(params)
+	return newPKeyFromParams(params, f)
+}
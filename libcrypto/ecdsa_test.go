@@ -0,0 +1,41 @@
+// +build !windows
+
+package libcrypto
+
+import (
+	"testing"
+)
+
+func TestGenerateKey_ECDSA(t *testing.T) {
+	pri, err := NewPKey(384, ECDSA_SHA384)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if pri.KeySize() != 384 {
+		t.Fatal("Invalid key size!")
+	}
+}
+
+func TestECDSA_SHA256(t *testing.T) {
+	pri, _ := NewPKey(256, ECDSA_SHA256)
+	defer pri.Close()
+	pub := pri.PublicKey().(*PKey)
+	defer pub.Close()
+	digest := []byte("0123456789ABCDEF0123456789ABCDEF")
+	signature, err := pri.Sign(digest)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, digest)
+	if err != nil {
+		t.Fatalf("Verification failed: %s", err)
+	}
+	if !valid {
+		t.Fatalf("\nSignature Invalid\nDigest   : %x\nSignature: %x", digest, signature)
+	}
+	digest[0] ^= 1
+	if valid, _ = pub.Verify(signature, digest); valid {
+		t.Fatal("Verification of wrong digest succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+// +build !windows
+
+package libcrypto
+
+/*
+#include <openssl/err.h>
+#include <openssl/evp.h>
+#include <openssl/opensslv.h>
+#include "fetch.h"
+
+// Ed25519 is available since OpenSSL 1.1.1 and only through the one-shot EVP_DigestSign API.
+static int okapi_ed25519_id() {
+#if OPENSSL_VERSION_NUMBER >= 0x10101000L
+	return EVP_PKEY_ED25519;
+#else
+	return NID_undef;
+#endif
+}
+
+static int okapi_ed25519_sign(OSSL_LIB_CTX *library, EVP_PKEY *pkey, const char *properties, unsigned char *sig, size_t *siglen, const unsigned char *msg, size_t len) {
+#if OPENSSL_VERSION_NUMBER >= 0x10101000L
+	EVP_MD_CTX *ctx = EVP_MD_CTX_new();
+	if (ctx == NULL) {
+		return 0;
+	}
+	int rc = okapi_digest_sign_init(ctx, library, pkey, properties);
+	if (rc == 1) {
+		rc = EVP_DigestSign(ctx, sig, siglen, msg, len);
+	}
+	EVP_MD_CTX_free(ctx);
+	return rc;
+#else
+	return 0;
+#endif
+}
+
+static int okapi_ed25519_verify(OSSL_LIB_CTX *library, EVP_PKEY *pkey, const char *properties, const unsigned char *sig, size_t siglen, const unsigned char *msg, size_t len) {
+#if OPENSSL_VERSION_NUMBER >= 0x10101000L
+	EVP_MD_CTX *ctx = EVP_MD_CTX_new();
+	if (ctx == NULL) {
+		return -1;
+	}
+	int rc = okapi_digest_verify_init(ctx, library, pkey, properties);
+	if (rc == 1) {
+		rc = EVP_DigestVerify(ctx, sig, siglen, msg, len);
+	} else {
+		rc = -1;
+	}
+	EVP_MD_CTX_free(ctx);
+	return rc;
+#else
+	return -1;
+#endif
+}
+*/
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	if Ed25519.available() {
+		okapi.Register(&okapi.Ed25519, Ed25519.constructor())
+	}
+}
+
+// Ed25519 signatures are computed over the message itself (pure EdDSA, RFC 8032)
+type ed25519Parameters struct{}
+
+var (
+	Ed25519 = ed25519Parameters{}
+)
+
+const ed25519SignatureSize = 64
+
+func (p ed25519Parameters) available() bool {
+	return C.okapi_ed25519_id() != C.NID_undef
+}
+
+func (p ed25519Parameters) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		return NewPKey(keyParameters, p)
+	}
+}
+
+// configure doesn't initialize the key context, Ed25519 uses the one-shot API instead
+func (p ed25519Parameters) configure(key *PKey) {
+	key.parameters = p
+}
+
+func (p ed25519Parameters) isForEncryption() bool   { return false }
+func (p ed25519Parameters) isForSigning() bool      { return true }
+func (p ed25519Parameters) isForKeyAgreement() bool { return false }
+
+func (p ed25519Parameters) toPublic(pri *PKey) (pub *PKey, err error) {
+	return newPKeyFromPrivate(pri)
+}
+
+// generate ignores the size, Ed25519 keys have fixed size
+func (p ed25519Parameters) generate(size int, f fetch) (*PKey, error) {
+	ctx := f.newCtxID(C.okapi_ed25519_id())
+	if ctx == nil {
+		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
+	}
+	defer C.EVP_PKEY_CTX_free(ctx)
+	err := error1(C.EVP_PKEY_keygen_init(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var pkey *C.EVP_PKEY
+	err = error1(C.EVP_PKEY_keygen(ctx, &pkey))
+	if err != nil {
+		return nil, err
+	}
+	return &PKey{pkey: pkey}, nil
+}
+
+func (p ed25519Parameters) sign(key *PKey, message []byte) ([]byte, error) {
+	signature := make([]byte, ed25519SignatureSize)
+	outlen := C.size_t(len(signature))
+	properties, release := key.fetch.query()
+	defer release()
+	err := error1(C.okapi_ed25519_sign(key.fetch.library(), key.pkey, properties, (*C.uchar)(&signature[0]), &outlen, dataPtr(message), C.size_t(len(message))))
+	if err != nil {
+		return nil, err
+	}
+	return signature[:int(outlen)], nil
+}
+
+func (p ed25519Parameters) verify(key *PKey, signature, message []byte) (bool, error) {
+	properties, release := key.fetch.query()
+	defer release()
+	result := C.okapi_ed25519_verify(key.fetch.library(), key.pkey, properties, dataPtr(signature), C.size_t(len(signature)), dataPtr(message), C.size_t(len(message)))
+	if int(result) < 0 {
+		return false, error1(result)
+	}
+	if result != 1 {
+		C.ERR_clear_error()
+	}
+	return result == 1, nil
+}
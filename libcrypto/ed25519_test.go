@@ -0,0 +1,47 @@
+// +build !windows
+
+package libcrypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEd25519(t *testing.T) {
+	if !Ed25519.available() {
+		t.Skip("Ed25519 is not available")
+	}
+	pri, err := NewPKey(0, Ed25519)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	message := []byte("Message in a bottle!")
+	signature, err := pri.Sign(message)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, message)
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	message[0] ^= 1
+	if valid, _ = pub.Verify(signature, message); valid {
+		t.Fatal("Verification of wrong message succeeded")
+	}
+	der, err := pri.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	imported, err := NewPKey(der, Ed25519)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	again, _ := imported.Export()
+	if !bytes.Equal(der, again) {
+		t.Fatal("Exported keys mismatch")
+	}
+}
@@ -0,0 +1,77 @@
+// Library context aware wrappers, with OpenSSL 1.1.1 the library context
+// and the property query are ignored and the default implementations are used.
+
+#include <openssl/evp.h>
+#include <openssl/objects.h>
+#include <openssl/opensslv.h>
+#include <openssl/pem.h>
+#include <openssl/x509.h>
+
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+#include <openssl/provider.h>
+#else
+typedef struct ossl_lib_ctx_st OSSL_LIB_CTX;
+typedef struct ossl_provider_st OSSL_PROVIDER;
+#endif
+
+static inline int okapi_contexts_available() {
+	return OPENSSL_VERSION_NUMBER >= 0x30000000L;
+}
+
+static inline EVP_PKEY_CTX *okapi_pkey_ctx_new_id(OSSL_LIB_CTX *library, int id, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_PKEY_CTX_new_from_name(library, OBJ_nid2sn(id), properties);
+#else
+	return EVP_PKEY_CTX_new_id(id, NULL);
+#endif
+}
+
+static inline EVP_PKEY_CTX *okapi_pkey_ctx_new(OSSL_LIB_CTX *library, EVP_PKEY *pkey, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_PKEY_CTX_new_from_pkey(library, pkey, properties);
+#else
+	return EVP_PKEY_CTX_new(pkey, NULL);
+#endif
+}
+
+// The d2i functions advance the pointer to the buffer,
+// so they need a C variable to hold it.
+static inline EVP_PKEY *okapi_d2i_PUBKEY(OSSL_LIB_CTX *library, const unsigned char *in, long len, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return d2i_PUBKEY_ex(NULL, &in, len, library, properties);
+#else
+	return d2i_PUBKEY(NULL, &in, len);
+#endif
+}
+
+static inline EVP_PKEY *okapi_d2i_AutoPrivateKey(OSSL_LIB_CTX *library, const unsigned char *in, long len, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return d2i_AutoPrivateKey_ex(NULL, &in, len, library, properties);
+#else
+	return d2i_AutoPrivateKey(NULL, &in, len);
+#endif
+}
+
+static inline EVP_PKEY *okapi_PEM_read_PrivateKey(OSSL_LIB_CTX *library, BIO *bio, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return PEM_read_bio_PrivateKey_ex(bio, NULL, NULL, NULL, library, properties);
+#else
+	return PEM_read_bio_PrivateKey(bio, NULL, NULL, NULL);
+#endif
+}
+
+static inline int okapi_digest_sign_init(EVP_MD_CTX *ctx, OSSL_LIB_CTX *library, EVP_PKEY *pkey, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_DigestSignInit_ex(ctx, NULL, NULL, library, properties, pkey, NULL);
+#else
+	return EVP_DigestSignInit(ctx, NULL, NULL, NULL, pkey);
+#endif
+}
+
+static inline int okapi_digest_verify_init(EVP_MD_CTX *ctx, OSSL_LIB_CTX *library, EVP_PKEY *pkey, const char *properties) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_DigestVerifyInit_ex(ctx, NULL, NULL, library, properties, pkey, NULL);
+#else
+	return EVP_DigestVerifyInit(ctx, NULL, NULL, NULL, pkey);
+#endif
+}
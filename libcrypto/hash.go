@@ -11,14 +11,14 @@ import (
 )
 
 func init() {
-	okapi.MD4 = MD4
-	okapi.MD5 = MD5
-	okapi.SHA1 = SHA1
-	okapi.SHA224 = SHA224
-	okapi.SHA256 = SHA256
-	okapi.SHA384 = SHA384
-	okapi.SHA512 = SHA512
-	okapi.RIPEMD160 = RIPEMD160
+	okapi.Register(&okapi.MD4, MD4)
+	okapi.Register(&okapi.MD5, MD5)
+	okapi.Register(&okapi.SHA1, SHA1)
+	okapi.Register(&okapi.SHA224, SHA224)
+	okapi.Register(&okapi.SHA256, SHA256)
+	okapi.Register(&okapi.SHA384, SHA384)
+	okapi.Register(&okapi.SHA512, SHA512)
+	okapi.Register(&okapi.RIPEMD160, RIPEMD160)
 }
 
 type HashSpec struct {
@@ -38,8 +38,10 @@ var (
 
 func (hs HashSpec) New() okapi.Hash {
 	h := &Hash{md: hs.md}
-	h.ctx = new(C.EVP_MD_CTX)
-	C.EVP_MD_CTX_init(h.ctx)
+	h.ctx = C.EVP_MD_CTX_new()
+	if h.ctx == nil {
+		panic(libcryptoError())
+	}
 	check1(C.EVP_DigestInit_ex(h.ctx, hs.md, nil))
 	return h
 }
@@ -64,9 +66,11 @@ func (h *Hash) Reset() {
 }
 
 func (h *Hash) Clone() okapi.Hash {
-	ctx2 := new(C.EVP_MD_CTX)
-	C.EVP_MD_CTX_init(ctx2)
-	C.EVP_MD_CTX_copy_ex(ctx2, h.ctx)
+	ctx2 := C.EVP_MD_CTX_new()
+	if ctx2 == nil {
+		panic(libcryptoError())
+	}
+	check1(C.EVP_MD_CTX_copy_ex(ctx2, h.ctx))
 	return &Hash{md: h.md, ctx: ctx2}
 }
 
@@ -83,6 +87,9 @@ func (h *Hash) Write(data []byte) (int, error) {
 	if h.digest != nil {
 		return 0, errors.New("Cannot write into finalized hash")
 	}
+	if len(data) == 0 {
+		return 0, nil
+	}
 	check1(C.EVP_DigestUpdate(h.ctx, unsafe.Pointer(&data[0]), C.size_t(len(data))))
 	return len(data), nil
 }
@@ -94,5 +101,5 @@ func (h *Hash) Close() {
 	defer func() {
 		h.ctx = nil
 	}()
-	C.EVP_MD_CTX_cleanup(h.ctx)
+	C.EVP_MD_CTX_free(h.ctx)
 }
@@ -2,19 +2,127 @@
 
 package libcrypto
 
-// #include <openssl/hmac.h>
+/*
+#include <openssl/evp.h>
+#include <openssl/hmac.h>
+#include <openssl/opensslv.h>
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+#include <openssl/core_names.h>
+#endif
+#include "fetch.h"
+
+// OpenSSL 3.x deprecates the HMAC_CTX API in favor of the EVP_MAC one.
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+typedef EVP_MAC_CTX okapi_hmac_ctx;
+
+// okapi_hmac_new fetches HMAC and the digest from the library context with the property query
+static okapi_hmac_ctx *okapi_hmac_new(OSSL_LIB_CTX *library, const char *properties, const EVP_MD *md, const unsigned char *key, int len) {
+	EVP_MAC *mac = EVP_MAC_fetch(library, "HMAC", properties);
+	if (mac == NULL) {
+		return NULL;
+	}
+	// the context holds its own reference to the MAC
+	EVP_MAC_CTX *ctx = EVP_MAC_CTX_new(mac);
+	EVP_MAC_free(mac);
+	if (ctx == NULL) {
+		return NULL;
+	}
+	OSSL_PARAM params[] = {
+		OSSL_PARAM_construct_utf8_string(OSSL_MAC_PARAM_DIGEST, (char *)EVP_MD_get0_name(md), 0),
+		OSSL_PARAM_construct_end(),
+		OSSL_PARAM_construct_end()
+	};
+	if (properties != NULL) {
+		params[1] = OSSL_PARAM_construct_utf8_string(OSSL_MAC_PARAM_PROPERTIES, (char *)properties, 0);
+	}
+	if (EVP_MAC_init(ctx, key, len, params) != 1) {
+		EVP_MAC_CTX_free(ctx);
+		return NULL;
+	}
+	return ctx;
+}
+
+// okapi_hmac_reset restarts the computation with the same key
+static int okapi_hmac_reset(okapi_hmac_ctx *ctx) {
+	return EVP_MAC_init(ctx, NULL, 0, NULL);
+}
+
+static int okapi_hmac_update(okapi_hmac_ctx *ctx, const unsigned char *data, size_t len) {
+	return EVP_MAC_update(ctx, data, len);
+}
+
+static int okapi_hmac_final(okapi_hmac_ctx *ctx, unsigned char *out, size_t size) {
+	size_t outl;
+	return EVP_MAC_final(ctx, out, &outl, size);
+}
+
+// okapi_hmac_dup copies the context including the key and the data written so far
+static okapi_hmac_ctx *okapi_hmac_dup(okapi_hmac_ctx *ctx) {
+	return EVP_MAC_CTX_dup(ctx);
+}
+
+static void okapi_hmac_free(okapi_hmac_ctx *ctx) {
+	EVP_MAC_CTX_free(ctx);
+}
+#else
+typedef HMAC_CTX okapi_hmac_ctx;
+
+static okapi_hmac_ctx *okapi_hmac_new(OSSL_LIB_CTX *library, const char *properties, const EVP_MD *md, const unsigned char *key, int len) {
+	HMAC_CTX *ctx = HMAC_CTX_new();
+	if (ctx == NULL) {
+		return NULL;
+	}
+	if (HMAC_Init_ex(ctx, key, len, md, NULL) != 1) {
+		HMAC_CTX_free(ctx);
+		return NULL;
+	}
+	return ctx;
+}
+
+static int okapi_hmac_reset(okapi_hmac_ctx *ctx) {
+	return HMAC_Init_ex(ctx, NULL, 0, NULL, NULL);
+}
+
+static int okapi_hmac_update(okapi_hmac_ctx *ctx, const unsigned char *data, size_t len) {
+	return HMAC_Update(ctx, data, len);
+}
+
+static int okapi_hmac_final(okapi_hmac_ctx *ctx, unsigned char *out, size_t size) {
+	return HMAC_Final(ctx, out, NULL);
+}
+
+static okapi_hmac_ctx *okapi_hmac_dup(okapi_hmac_ctx *ctx) {
+	HMAC_CTX *dup = HMAC_CTX_new();
+	if (dup == NULL) {
+		return NULL;
+	}
+	if (HMAC_CTX_copy(dup, ctx) != 1) {
+		HMAC_CTX_free(dup);
+		return NULL;
+	}
+	return dup;
+}
+
+static void okapi_hmac_free(okapi_hmac_ctx *ctx) {
+	HMAC_CTX_free(ctx);
+}
+#endif
+*/
 import "C"
 import (
 	"errors"
 	"github.com/mkobetic/okapi"
-	"unsafe"
 )
 
 func init() {
-	okapi.HMAC = HMAC
+	okapi.Register(&okapi.HMAC, HMAC)
 }
 
-type MACSpec struct{}
+// MACSpec represents HMAC, the fetch selects the library context and property query
+// of the implementation, the zero value selects the default ones.
+type MACSpec struct {
+	fetch fetch
+}
 
 var (
 	HMAC = MACSpec{}
@@ -23,16 +131,23 @@ var (
 func (ms MACSpec) New(hs okapi.HashSpec, key []byte) okapi.Hash {
 	algorithm := hs.(HashSpec).md
 	h := &hmac{md: algorithm}
-	h.ctx = new(C.HMAC_CTX)
-	C.HMAC_CTX_init(h.ctx)
-	check1(C.HMAC_Init_ex(h.ctx, unsafe.Pointer(&key[0]), C.int(len(key)), algorithm, nil))
+	properties, release := ms.fetch.query()
+	defer release()
+	h.ctx = C.okapi_hmac_new(ms.fetch.library(), properties, algorithm, dataPtr(key), C.int(len(key)))
+	if h.ctx == nil {
+		panic(libcryptoError())
+	}
 	return h
 }
 
+func (ms MACSpec) NewWithKey(hash okapi.HashSpec, key *okapi.SecretKey) (okapi.Hash, error) {
+	return key.NewMAC(ms, hash)
+}
+
 // Implements HMAC algorithm, but is private so that it doesn't conflict with the variable above
 type hmac struct {
 	digest []byte
-	ctx    *C.HMAC_CTX
+	ctx    *C.okapi_hmac_ctx
 	md     *C.EVP_MD // libcrypto constant
 }
 
@@ -45,11 +160,20 @@ func (h *hmac) BlockSize() int {
 }
 
 func (h *hmac) Reset() {
-	check1(C.HMAC_Init_ex(h.ctx, nil, 0, nil, nil))
+	h.digest = nil
+	check1(C.okapi_hmac_reset(h.ctx))
 }
 
 func (h *hmac) Clone() okapi.Hash {
-	panic("libcrypto does not support HMAC cloning!")
+	ctx2 := C.okapi_hmac_dup(h.ctx)
+	if ctx2 == nil {
+		panic(libcryptoError())
+	}
+	clone := &hmac{md: h.md, ctx: ctx2}
+	if h.digest != nil {
+		clone.digest = append([]byte(nil), h.digest...)
+	}
+	return clone
 }
 
 func (h *hmac) Digest() []byte {
@@ -57,7 +181,7 @@ func (h *hmac) Digest() []byte {
 		return h.digest
 	}
 	h.digest = make([]byte, h.Size())
-	check1(C.HMAC_Final(h.ctx, (*C.uchar)(&h.digest[0]), nil))
+	check1(C.okapi_hmac_final(h.ctx, (*C.uchar)(&h.digest[0]), C.size_t(len(h.digest))))
 	return h.digest
 }
 
@@ -65,7 +189,10 @@ func (h *hmac) Write(data []byte) (int, error) {
 	if h.digest != nil {
 		return 0, errors.New("Cannot write into finalized hash")
 	}
-	check1(C.HMAC_Update(h.ctx, (*C.uchar)(&data[0]), C.size_t(len(data))))
+	if len(data) == 0 {
+		return 0, nil
+	}
+	check1(C.okapi_hmac_update(h.ctx, (*C.uchar)(&data[0]), C.size_t(len(data))))
 	return len(data), nil
 }
 
@@ -76,5 +203,5 @@ func (h *hmac) Close() {
 	defer func() {
 		h.ctx = nil
 	}()
-	C.HMAC_CTX_cleanup(h.ctx)
+	C.okapi_hmac_free(h.ctx)
 }
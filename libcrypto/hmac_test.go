@@ -3,6 +3,7 @@
 package libcrypto
 
 import (
+	"bytes"
 	"encoding/hex"
 	"testing"
 )
@@ -27,3 +28,22 @@ func TestHMACHash(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestHMACClone(t *testing.T) {
+	mac := HMAC.New(SHA256, []byte("Open Sesame!"))
+	defer mac.Close()
+	mac.Write([]byte("test"))
+	clone := mac.Clone()
+	defer clone.Close()
+	mac.Write([]byte("test"))
+	clone.Write([]byte("test"))
+	if !bytes.Equal(clone.Digest(), mac.Digest()) {
+		t.Fatalf("Clone digest mismatch %x", clone.Digest())
+	}
+	expected := HMAC.New(SHA256, []byte("Open Sesame!"))
+	defer expected.Close()
+	expected.Write([]byte("testtest"))
+	if !bytes.Equal(expected.Digest(), mac.Digest()) {
+		t.Fatalf("Unexpected digest %x", mac.Digest())
+	}
+}
@@ -0,0 +1,91 @@
+// +build !windows
+
+package libcrypto
+
+// #include <openssl/err.h>
+// #include <openssl/evp.h>
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.AES_KW, AES_KW)
+	okapi.Register(&okapi.AES_KWP, AES_KWP)
+}
+
+var (
+	AES_KW  = KeyWrapSpec{CipherSpec{16: C.EVP_aes_128_wrap(), 24: C.EVP_aes_192_wrap(), 32: C.EVP_aes_256_wrap()}}
+	AES_KWP = KeyWrapSpec{CipherSpec{16: C.EVP_aes_128_wrap_pad(), 24: C.EVP_aes_192_wrap_pad(), 32: C.EVP_aes_256_wrap_pad()}}
+)
+
+var (
+	errWrap   = errors.New("key wrap failed")
+	errUnwrap = errors.New("key unwrap failed")
+)
+
+// KeyWrapSpec represents a key wrapping algorithm.
+// It is a CipherSpec using the libcrypto wrap mode implementations.
+type KeyWrapSpec struct {
+	cipher CipherSpec
+}
+
+func (ks KeyWrapSpec) New(kek []byte) okapi.KeyWrap {
+	return &KeyWrap{cipher: ks.cipher.algorithm(len(kek)), kek: keyCopy(kek)}
+}
+
+type KeyWrap struct {
+	cipher *C.EVP_CIPHER // libcrypto constant
+	kek    []byte        // in C memory
+}
+
+func (kw *KeyWrap) KeySize() int {
+	return len(kw.kek)
+}
+
+func (kw *KeyWrap) Wrap(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errWrap
+	}
+	return kw.crypt(key, true, errWrap)
+}
+
+func (kw *KeyWrap) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 {
+		return nil, errUnwrap
+	}
+	return kw.crypt(wrapped, false, errUnwrap)
+}
+
+func (kw *KeyWrap) Close() {
+	freeKey(kw.kek)
+	kw.kek = nil
+}
+
+// crypt runs the wrap mode cipher over the whole input in one go.
+// Any libcrypto failure (e.g. the integrity check) is reported as the provided error.
+func (kw *KeyWrap) crypt(in []byte, encrypt bool, failure error) ([]byte, error) {
+	var enc C.int = 0
+	if encrypt {
+		enc = 1
+	}
+	ctx := C.EVP_CIPHER_CTX_new()
+	if ctx == nil {
+		return nil, errors.New(libcryptoError())
+	}
+	defer C.EVP_CIPHER_CTX_free(ctx)
+	C.EVP_CIPHER_CTX_set_flags(ctx, C.EVP_CIPHER_CTX_FLAG_WRAP_ALLOW)
+	if err := error1(C.EVP_CipherInit_ex(ctx, kw.cipher, nil, (*C.uchar)(&kw.kek[0]), nil, enc)); err != nil {
+		return nil, err
+	}
+	// the output is at most the input rounded up to 8 bytes plus the 8 byte integrity check value
+	out := make([]byte, len(in)+16)
+	var outl, finl C.int
+	if C.EVP_CipherUpdate(ctx, (*C.uchar)(&out[0]), &outl, (*C.uchar)(&in[0]), C.int(len(in))) <= 0 ||
+		C.EVP_CipherFinal_ex(ctx, (*C.uchar)(&out[outl]), &finl) <= 0 {
+		C.ERR_clear_error()
+		return nil, failure
+	}
+	return out[:outl+finl], nil
+}
@@ -0,0 +1,61 @@
+// +build !windows
+
+package libcrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAES_KW(t *testing.T) {
+	// RFC 3394, 4.1 Wrap 128 bits of Key Data with a 128-bit KEK
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	kw := AES_KW.New(kek)
+	defer kw.Close()
+	wrapped, err := kw.Wrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(wrapped) != "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5" {
+		t.Fatalf("Wrong wrapped key: %x", wrapped)
+	}
+	unwrapped, err := kw.Unwrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, key) {
+		t.Fatal("Unwrapped does not match key")
+	}
+	wrapped[5] ^= 1
+	if _, err = kw.Unwrap(wrapped); err == nil {
+		t.Fatal("Unwrap of corrupted input succeeded")
+	}
+}
+
+func TestAES_KWP(t *testing.T) {
+	// RFC 5649, section 6
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	key, _ := hex.DecodeString("466f7250617369")
+	kw := AES_KWP.New(kek)
+	defer kw.Close()
+	wrapped, err := kw.Wrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(wrapped) != "afbeb0f07dfbf5419200f2ccb50bb24f" {
+		t.Fatalf("Wrong wrapped key: %x", wrapped)
+	}
+	unwrapped, err := kw.Unwrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, key) {
+		t.Fatal("Unwrapped does not match key")
+	}
+	wrapped[0] ^= 1
+	if _, err = kw.Unwrap(wrapped); err == nil {
+		t.Fatal("Unwrap of corrupted input succeeded")
+	}
+}
@@ -1,11 +1,54 @@
 // +build !windows
 
 // Package libcrypto implements okapi interfaces using OpenSSL's libcrypto library.
+// It builds against OpenSSL 1.1.1 and 3.x, the code paths that differ between the versions
+// are selected at build time based on OPENSSL_VERSION_NUMBER.
+// With OpenSSL 3.x the legacy provider is loaded, if available, along with the default one
+// so that the legacy algorithms (MD4, RIPEMD160, RC2, RC4 and Blowfish) remain available.
 package libcrypto
 
-// #cgo LDFLAGS:  -L/usr/local/opt/openssl/lib -lcrypto
-// #cgo CFLAGS: -I/usr/local/opt/openssl/include
-// #include <openssl/err.h>
+/*
+#cgo LDFLAGS:  -L/usr/local/opt/openssl/lib -lcrypto
+#cgo CFLAGS: -I/usr/local/opt/openssl/include
+#include <openssl/crypto.h>
+#include <openssl/err.h>
+#include <openssl/opensslv.h>
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+#include <openssl/provider.h>
+#endif
+
+#if OPENSSL_VERSION_NUMBER < 0x10101000L
+#error "libcrypto requires OpenSSL 1.1.1 or later"
+#endif
+
+static int okapi_init() {
+	if (OPENSSL_init_crypto(OPENSSL_INIT_LOAD_CRYPTO_STRINGS, NULL) != 1) {
+		return 0;
+	}
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	// loading a provider explicitly disables the automatic loading of the default one
+	if (OSSL_PROVIDER_load(NULL, "default") == NULL) {
+		return 0;
+	}
+	if (OSSL_PROVIDER_load(NULL, "legacy") == NULL) {
+		ERR_clear_error();
+	}
+#endif
+	return 1;
+}
+
+// okapi_get_error pops the earliest error and the name of the function that raised it,
+// OpenSSL 3.x records it with the error, older versions derive it from the error code.
+static unsigned long okapi_get_error(const char **function) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return ERR_get_error_all(NULL, NULL, function, NULL, NULL);
+#else
+	unsigned long code = ERR_get_error();
+	*function = ERR_func_error_string(code);
+	return code;
+#endif
+}
+*/
 import "C"
 import (
 	"errors"
@@ -13,7 +56,7 @@ import (
 )
 
 func init() {
-	C.ERR_load_crypto_strings()
+	check1(C.okapi_init())
 }
 
 func error1(err C.int) error {
@@ -38,8 +81,9 @@ func checkP(err C.int) {
 }
 
 func libcryptoError() string {
-	code := C.ERR_get_error()
-	function := C.GoString(C.ERR_func_error_string(code))
+	var cfunction *C.char
+	code := C.okapi_get_error(&cfunction)
+	function := C.GoString(cfunction)
 	reason := C.GoString(C.ERR_reason_error_string(code))
 	return fmt.Sprintf("libcrypto error %x:%s:%s", uint64(code), function, reason)
 }
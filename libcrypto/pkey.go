@@ -2,8 +2,26 @@
 
 package libcrypto
 
+// #include <openssl/err.h>
 // #include <openssl/evp.h>
 // #include <openssl/pem.h>
+// #include <openssl/x509.h>
+// #include "fetch.h"
+//
+// // The i2d functions advance the pointer to the buffer,
+// // so they need a C variable to hold it.
+// static int okapi_i2d_PUBKEY(EVP_PKEY *pkey, unsigned char *out) {
+// 	return i2d_PUBKEY(pkey, out == NULL ? NULL : &out);
+// }
+// static int okapi_i2d_PKCS8(EVP_PKEY *pkey, unsigned char *out) {
+// 	PKCS8_PRIV_KEY_INFO *p8 = EVP_PKEY2PKCS8(pkey);
+// 	if (p8 == NULL) {
+// 		return -1;
+// 	}
+// 	int len = i2d_PKCS8_PRIV_KEY_INFO(p8, out == NULL ? NULL : &out);
+// 	PKCS8_PRIV_KEY_INFO_free(p8);
+// 	return len;
+// }
 import "C"
 import (
 	"errors"
@@ -13,18 +31,30 @@ import (
 
 type algorithmParameters interface {
 	configure(key *PKey)
-	generate(size int) (key *PKey, err error)
+	generate(size int, f fetch) (key *PKey, err error)
 	toPublic(pri *PKey) (pub *PKey, err error)
 	isForSigning() bool
 	isForEncryption() bool
 	isForKeyAgreement() bool
 }
 
+// messageSigner is implemented by algorithms that sign the message itself rather than its digest
+// (e.g. Ed25519), these cannot use the key context initialized by configure.
+type messageSigner interface {
+	sign(key *PKey, message []byte) ([]byte, error)
+	verify(key *PKey, signature, message []byte) (bool, error)
+}
+
+// PKey holds the EVP_PKEY and a context configured for its algorithm and purpose.
+// The random is the source of randomness provided with okapi.KeyParameters, if any.
+// The fetch selects the library context and property query of the implementations used by the key.
 type PKey struct {
 	pkey       *C.EVP_PKEY
 	ctx        *C.EVP_PKEY_CTX
 	parameters algorithmParameters
 	public     bool
+	random     okapi.Random
+	fetch      fetch
 }
 
 func (key *PKey) Decrypt(encrypted []byte) (decrypted []byte, err error) {
@@ -56,6 +86,10 @@ func (key *PKey) Sign(digest []byte) (signature []byte, err error) {
 	if !key.parameters.isForSigning() {
 		return nil, errors.New("Key is not for configured signing!")
 	}
+	if signer, ok := key.parameters.(messageSigner); ok {
+		return signer.sign(key, digest)
+	}
+	defer useRandom(key.random)()
 	var outlen C.size_t
 	inlen := C.size_t(len(digest))
 	in := (*C.uchar)(&digest[0])
@@ -103,6 +137,7 @@ func (key *PKey) PublicKey() okapi.PublicKey {
 	if err != nil {
 		panic(err.Error())
 	}
+	pub.random = key.random
 	return pub
 }
 
@@ -110,6 +145,7 @@ func (key *PKey) Encrypt(plain []byte) (encrypted []byte, err error) {
 	if !key.parameters.isForEncryption() {
 		return nil, errors.New("Key is not configured for encryption!")
 	}
+	defer useRandom(key.random)()
 	var outlen C.size_t
 	inlen := C.size_t(len(plain))
 	in := (*C.uchar)(&plain[0])
@@ -129,6 +165,9 @@ func (key *PKey) Verify(signature []byte, digest []byte) (valid bool, err error)
 	if !key.parameters.isForSigning() {
 		return false, errors.New("Key is not configured for signing!")
 	}
+	if signer, ok := key.parameters.(messageSigner); ok {
+		return signer.verify(key, signature, digest)
+	}
 	result := C.EVP_PKEY_verify(key.ctx, (*C.uchar)(&signature[0]), C.size_t(len(signature)), (*C.uchar)(&digest[0]), C.size_t(len(digest)))
 	if int(result) < 0 {
 		return false, error1(result)
@@ -136,6 +175,36 @@ func (key *PKey) Verify(signature []byte, digest []byte) (valid bool, err error)
 	return result == 1, nil
 }
 
+func (key *PKey) Export() ([]byte, error) {
+	if key.public {
+		return key.exportPublic()
+	}
+	size := C.okapi_i2d_PKCS8(key.pkey, nil)
+	if size <= 0 {
+		return nil, errors.New(libcryptoError())
+	}
+	der := make([]byte, int(size))
+	size = C.okapi_i2d_PKCS8(key.pkey, (*C.uchar)(&der[0]))
+	if size <= 0 {
+		return nil, errors.New(libcryptoError())
+	}
+	return der[:int(size)], nil
+}
+
+// exportPublic encodes the public part of the key as X.509 SubjectPublicKeyInfo
+func (key *PKey) exportPublic() ([]byte, error) {
+	size := C.okapi_i2d_PUBKEY(key.pkey, nil)
+	if size <= 0 {
+		return nil, errors.New(libcryptoError())
+	}
+	der := make([]byte, int(size))
+	size = C.okapi_i2d_PUBKEY(key.pkey, (*C.uchar)(&der[0]))
+	if size <= 0 {
+		return nil, errors.New(libcryptoError())
+	}
+	return der[:int(size)], nil
+}
+
 func (key *PKey) Close() {
 	if key.pkey == nil {
 		return
@@ -146,52 +215,95 @@ func (key *PKey) Close() {
 	}
 	C.EVP_PKEY_free(key.pkey)
 	key.pkey = nil
+	key.random = nil
 }
 
 func (key *PKey) KeySize() int {
 	return int(C.EVP_PKEY_bits(key.pkey))
 }
 
+// NewPKey creates a key from the key parameters (kps) configured with the algorithm parameters (aps)
+// using the default library context and properties.
+// The key parameters can be:
+// * int: generates a new key of given size in bits
+// * string: reads the key from PEM encoding
+// * []byte: reads the key from DER encoding (PKCS#8 or traditional private key, or X.509 public key)
+// * *PKey: generates a new key with the same parameters (size, group or curve) as the provided key
+// * okapi.KeyParameters: any of the above with the Random used by the key
 func NewPKey(kps interface{}, aps algorithmParameters) (key *PKey, err error) {
+	return newPKey(kps, aps, fetch{})
+}
+
+func newPKey(kps interface{}, aps algorithmParameters, f fetch) (key *PKey, err error) {
+	var random okapi.Random
+	if p, ok := kps.(okapi.KeyParameters); ok {
+		kps, random = p.Parameters, p.Random
+	}
 	switch kps := kps.(type) {
 	case int:
-		key, err = aps.generate(kps)
+		release := useRandom(random)
+		key, err = aps.generate(kps, f)
+		release()
 	// case []*big.Int:
 	// 	key, err = newRSAKeyElements(keyType, parameters)
 	case string:
-		key, err = newPKeyFromPEM([]byte(kps))
+		key, err = newPKeyFromPEM([]byte(kps), f)
+	case []byte:
+		key, err = newPKeyFromDER(kps, f)
 	case *PKey:
-		key, err = newPKeyFromParams(kps.pkey)
+		release := useRandom(random)
+		key, err = newPKeyFromParams(kps.pkey, f)
+		release()
 	default:
 		err = errors.New("Invalid Parameters")
 	}
 	if err != nil {
 		return
 	}
-	ctx := C.EVP_PKEY_CTX_new(key.pkey, nil)
+	key.fetch = f
+	ctx := f.newCtx(key.pkey)
 	if ctx == nil {
 		C.EVP_PKEY_free(key.pkey)
 		return nil, errors.New("Failed to create EVP_PKEY_CTX")
 	}
 	key.ctx = ctx
+	key.random = random
 	aps.configure(key)
 	return
 }
 
-func newPKeyFromPEM(pem []byte) (*PKey, error) {
+func newPKeyFromPEM(pem []byte, f fetch) (*PKey, error) {
 	bio := C.BIO_new_mem_buf(unsafe.Pointer(&pem[0]), C.int(len(pem)))
 	defer C.BIO_free(bio)
-	pkey := C.PEM_read_bio_PrivateKey(bio, nil, nil, nil)
+	properties, release := f.query()
+	defer release()
+	pkey := C.okapi_PEM_read_PrivateKey(f.library(), bio, properties)
 	if pkey == nil {
 		return nil, errors.New("Invalid PEM input")
 	}
 	return &PKey{pkey: pkey}, nil
 }
 
-func newPKeyFromParams(params *C.EVP_PKEY) (*PKey, error) {
-	ctx := C.EVP_PKEY_CTX_new(params, nil)
+func newPKeyFromDER(der []byte, f fetch) (*PKey, error) {
+	if len(der) == 0 {
+		return nil, errors.New("Invalid DER input")
+	}
+	properties, release := f.query()
+	defer release()
+	if pkey := C.okapi_d2i_AutoPrivateKey(f.library(), (*C.uchar)(&der[0]), C.long(len(der)), properties); pkey != nil {
+		return &PKey{pkey: pkey}, nil
+	}
+	C.ERR_clear_error()
+	if pkey := C.okapi_d2i_PUBKEY(f.library(), (*C.uchar)(&der[0]), C.long(len(der)), properties); pkey != nil {
+		return &PKey{pkey: pkey, public: true}, nil
+	}
+	return nil, errors.New("Invalid DER input")
+}
+
+func newPKeyFromParams(params *C.EVP_PKEY, f fetch) (*PKey, error) {
+	ctx := f.newCtx(params)
 	if ctx == nil {
-		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
+		return nil, errors.New("Failed EVP_PKEY_CTX_new")
 	}
 	defer C.EVP_PKEY_CTX_free(ctx)
 	err := error1(C.EVP_PKEY_keygen_init(ctx))
@@ -207,17 +319,18 @@ func newPKeyFromParams(params *C.EVP_PKEY) (*PKey, error) {
 }
 
 func newPKeyFromPrivate(pri *PKey) (*PKey, error) {
-	var buffer *C.uchar
-	blen := int(C.i2d_PublicKey(pri.pkey, &buffer))
-	if blen < 0 {
-		return nil, errors.New("Key conversion failed (i2d)")
+	der, err := pri.exportPublic()
+	if err != nil {
+		return nil, err
 	}
-	pkey := C.d2i_PublicKey(C.EVP_PKEY_id(pri.pkey), nil, &buffer, C.long(blen))
+	properties, release := pri.fetch.query()
+	defer release()
+	pkey := C.okapi_d2i_PUBKEY(pri.fetch.library(), (*C.uchar)(&der[0]), C.long(len(der)), properties)
 	if pkey == nil {
 		return nil, errors.New("PrivateKey to PublicKey conversion failed!")
 	}
-	pub := &PKey{pkey: pkey, public: true, parameters: pri.parameters}
-	ctx := C.EVP_PKEY_CTX_new(pkey, nil)
+	pub := &PKey{pkey: pkey, public: true, parameters: pri.parameters, fetch: pri.fetch}
+	ctx := pri.fetch.newCtx(pkey)
 	if ctx == nil {
 		C.EVP_PKEY_free(pkey)
 		return nil, errors.New("Failed to create EVP_PKEY_CTX")
@@ -2,14 +2,68 @@
 
 package libcrypto
 
+// #include <stdint.h>
 // #include <openssl/rand.h>
+//
+// // RAND_METHOD is deprecated in OpenSSL 3.x, but RAND_bytes and RAND_priv_bytes,
+// // used by the default and legacy providers, still honour it.
+// #pragma GCC diagnostic ignored "-Wdeprecated-declarations"
+//
+// extern int goRandomBytes(uintptr_t random, unsigned char *buf, int num);
+//
+// // okapi_thread_random is the handle of the Random used by the operation running in the current thread, if any.
+// static __thread uintptr_t okapi_thread_random = 0;
+// static void okapi_set_thread_random(uintptr_t random) {
+// 	okapi_thread_random = random;
+// }
+//
+// // okapi_rand_method routes the bytes requests of the threads with a Random through goRandomBytes,
+// // everything else is delegated to the original method, which may leave some functions unset
+// // (e.g. cleanup of the OpenSSL 1.1.1 and 3.x default method).
+// static const RAND_METHOD *okapi_original_rand_method = NULL;
+// static int okapi_rand_bytes(unsigned char *buf, int num) {
+// 	uintptr_t random = okapi_thread_random;
+// 	if (random == 0) {
+// 		return okapi_original_rand_method->bytes(buf, num);
+// 	}
+// 	return goRandomBytes(random, buf, num);
+// }
+// static int okapi_rand_seed(const void *buf, int num) {
+// 	return okapi_original_rand_method->seed == NULL ? 1 : okapi_original_rand_method->seed(buf, num);
+// }
+// static void okapi_rand_cleanup(void) {
+// 	if (okapi_original_rand_method->cleanup != NULL) {
+// 		okapi_original_rand_method->cleanup();
+// 	}
+// }
+// static int okapi_rand_add(const void *buf, int num, double entropy) {
+// 	return okapi_original_rand_method->add == NULL ? 1 : okapi_original_rand_method->add(buf, num, entropy);
+// }
+// static int okapi_rand_status(void) {
+// 	return okapi_original_rand_method->status == NULL ? 1 : okapi_original_rand_method->status();
+// }
+// static RAND_METHOD okapi_rand_method = {
+// 	okapi_rand_seed, okapi_rand_bytes, okapi_rand_cleanup, okapi_rand_add, okapi_rand_bytes, okapi_rand_status
+// };
+// static int okapi_install_rand_method(void) {
+// 	okapi_original_rand_method = RAND_get_rand_method();
+// 	return RAND_set_rand_method(&okapi_rand_method);
+// }
+// // okapi_original_rand_bytes bypasses the Random of the current thread
+// static int okapi_original_rand_bytes(unsigned char *buf, int num) {
+// 	const RAND_METHOD *original = okapi_original_rand_method;
+// 	return original == NULL ? RAND_bytes(buf, num) : original->bytes(buf, num);
+// }
 import "C"
 import (
 	"github.com/mkobetic/okapi"
+	"runtime"
+	"runtime/cgo"
+	"sync"
 )
 
 func init() {
-	okapi.DefaultRandom = DefaultRandom
+	okapi.Register(&okapi.DefaultRandom, DefaultRandom)
 }
 
 type RandomSpec struct{}
@@ -26,7 +80,7 @@ type Random struct {
 }
 
 func (r *Random) Read(b []byte) (int, error) {
-	err := error1(C.RAND_bytes((*C.uchar)(&b[0]), C.int(len(b))))
+	err := error1(C.okapi_original_rand_bytes((*C.uchar)(&b[0]), C.int(len(b))))
 	if err != nil {
 		return 0, err
 	}
@@ -35,3 +89,39 @@ func (r *Random) Read(b []byte) (int, error) {
 
 func (r *Random) Close() {
 }
+
+// randMethod installs the RAND_METHOD serving the threads with a Random set by useRandom,
+// it is installed only once a Random other than the DefaultRandom of this package is used.
+var randMethod sync.Once
+
+// useRandom makes libcrypto read the randomness of the current thread from the provided Random
+// (the Random of the key), or if it's nil, from okapi.DefaultRandom, if it was replaced with a RandomSpec
+// other than the DefaultRandom of this package, until the returned release function is called.
+// The goroutine is locked to its thread until then, libcrypto operations of other threads are not affected.
+// It is used for key generation, encryption padding and signing.
+func useRandom(random okapi.Random) (release func()) {
+	random = okapi.UnwrapRandom(random)
+	if _, ok := random.(*Random); ok {
+		return func() {}
+	}
+	owned := random == nil
+	if owned {
+		spec := okapi.UnwrapRandomSpec(okapi.DefaultRandom)
+		if _, ok := spec.(RandomSpec); ok || spec == nil {
+			return func() {}
+		}
+		random = spec.New()
+	}
+	randMethod.Do(func() { check1(C.okapi_install_rand_method()) })
+	runtime.LockOSThread()
+	handle := cgo.NewHandle(random)
+	C.okapi_set_thread_random(C.uintptr_t(handle))
+	return func() {
+		C.okapi_set_thread_random(0)
+		runtime.UnlockOSThread()
+		handle.Delete()
+		if owned {
+			random.Close()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// +build !windows
+
+package libcrypto
+
+// #include <stdint.h>
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// goRandomBytes serves the libcrypto randomness requests of a thread from its Random (see useRandom).
+// It is in a separate file because exporting restricts the cgo preamble to declarations.
+//
+//export goRandomBytes
+func goRandomBytes(random C.uintptr_t, buf *C.uchar, num C.int) C.int {
+	r := cgo.Handle(random).Value().(okapi.Random)
+	if _, err := io.ReadFull(r, unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(num))); err != nil {
+		return 0
+	}
+	return 1
+}
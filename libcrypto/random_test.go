@@ -3,6 +3,8 @@
 package libcrypto
 
 import (
+	"bytes"
+	"github.com/mkobetic/okapi"
 	"testing"
 )
 
@@ -18,3 +20,92 @@ func TestRandom(t *testing.T) {
 		t.Fatalf("Wrong result size %d, expected 10", size)
 	}
 }
+
+func seededKey(t *testing.T, seed string) (der, encrypted []byte) {
+	defer func(random okapi.RandomSpec) { okapi.DefaultRandom = random }(okapi.DefaultRandom)
+	okapi.DefaultRandom = okapi.SeededRandom([]byte(seed))
+	pri, err := NewPKey(512, RSA)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if der, err = pri.Export(); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	if encrypted, err = pub.Encrypt([]byte("Message in a bottle!")); err != nil {
+		t.Fatalf("Encryption failed: %s", err)
+	}
+	return der, encrypted
+}
+
+func TestSeededRandom(t *testing.T) {
+	der, encrypted := seededKey(t, "seed")
+	der2, encrypted2 := seededKey(t, "seed")
+	if !bytes.Equal(der, der2) || !bytes.Equal(encrypted, encrypted2) {
+		t.Fatal("Seeded key generation is not reproducible")
+	}
+	if der3, _ := seededKey(t, "other seed"); bytes.Equal(der, der3) {
+		t.Fatal("Seeded key generation doesn't depend on the seed")
+	}
+}
+
+func seededSignature(t *testing.T, seed string) (der, signature []byte) {
+	random := okapi.SeededRandom([]byte(seed)).New()
+	defer random.Close()
+	pri, err := NewPKey(okapi.KeyParameters{Parameters: 256, Random: random}, ECDSA_SHA256)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if der, err = pri.Export(); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	digest := make([]byte, 32)
+	if signature, err = pri.Sign(digest); err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	if valid, err := pub.Verify(signature, digest); !valid || err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	return der, signature
+}
+
+func TestKeyParameters(t *testing.T) {
+	der, signature := seededSignature(t, "seed")
+	der2, signature2 := seededSignature(t, "seed")
+	if !bytes.Equal(der, der2) || !bytes.Equal(signature, signature2) {
+		t.Fatal("Key generation and signing don't use the Random of the key")
+	}
+	if der3, _ := seededSignature(t, "other seed"); bytes.Equal(der, der3) {
+		t.Fatal("Key generation doesn't depend on the Random of the key")
+	}
+}
+
+func TestRandomThread(t *testing.T) {
+	seeded, _ := seededKey(t, "seed")
+	random := okapi.SeededRandom([]byte("seed")).New()
+	defer random.Close()
+	release := useRandom(random)
+	done := make(chan []byte)
+	go func() {
+		// other threads don't read from the Random of this one
+		pri, err := NewPKey(512, RSA)
+		if err != nil {
+			t.Error(err)
+			done <- nil
+			return
+		}
+		defer pri.Close()
+		der, _ := pri.Export()
+		done <- der
+	}()
+	der := <-done
+	release()
+	if der == nil || bytes.Equal(der, seeded) {
+		t.Fatal("Key generated from the Random of another thread")
+	}
+}
@@ -4,6 +4,7 @@ package libcrypto
 
 // #include <openssl/evp.h>
 // #include <openssl/rsa.h>
+// #include "fetch.h"
 import "C"
 import (
 	"errors"
@@ -12,20 +13,20 @@ import (
 )
 
 func init() {
-	okapi.RSA = RSA.constructor()
-	okapi.RSA_OAEP = RSA_OAEP.constructor()
-	okapi.RSA_MD5 = RSA_MD5.constructor()
-	okapi.RSA_SHA1 = RSA_SHA1.constructor()
-	okapi.RSA_SHA224 = RSA_SHA224.constructor()
-	okapi.RSA_SHA256 = RSA_SHA256.constructor()
-	okapi.RSA_SHA384 = RSA_SHA384.constructor()
-	okapi.RSA_SHA512 = RSA_SHA512.constructor()
-	okapi.RSA_PSS_MD5 = RSA_PSS_MD5.constructor()
-	okapi.RSA_PSS_SHA1 = RSA_PSS_SHA1.constructor()
-	okapi.RSA_PSS_SHA224 = RSA_PSS_SHA224.constructor()
-	okapi.RSA_PSS_SHA256 = RSA_PSS_SHA256.constructor()
-	okapi.RSA_PSS_SHA384 = RSA_PSS_SHA384.constructor()
-	okapi.RSA_PSS_SHA512 = RSA_PSS_SHA512.constructor()
+	okapi.Register(&okapi.RSA, RSA.constructor())
+	okapi.Register(&okapi.RSA_OAEP, RSA_OAEP.constructor())
+	okapi.Register(&okapi.RSA_MD5, RSA_MD5.constructor())
+	okapi.Register(&okapi.RSA_SHA1, RSA_SHA1.constructor())
+	okapi.Register(&okapi.RSA_SHA224, RSA_SHA224.constructor())
+	okapi.Register(&okapi.RSA_SHA256, RSA_SHA256.constructor())
+	okapi.Register(&okapi.RSA_SHA384, RSA_SHA384.constructor())
+	okapi.Register(&okapi.RSA_SHA512, RSA_SHA512.constructor())
+	okapi.Register(&okapi.RSA_PSS_MD5, RSA_PSS_MD5.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA1, RSA_PSS_SHA1.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA224, RSA_PSS_SHA224.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA256, RSA_PSS_SHA256.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA384, RSA_PSS_SHA384.constructor())
+	okapi.Register(&okapi.RSA_PSS_SHA512, RSA_PSS_SHA512.constructor())
 }
 
 type rsaParameters struct {
@@ -79,6 +80,11 @@ func (p rsaParameters) configure(key *PKey) {
 		// checkP(C.EVP_PKEY_CTX_set_signature_md(key.ctx, p.md))
 		checkP(C.EVP_PKEY_CTX_ctrl(key.ctx, -1, C.EVP_PKEY_OP_TYPE_SIG, C.EVP_PKEY_CTRL_MD, 0, unsafe.Pointer(p.md)))
 	}
+	if p.padding == C.RSA_PKCS1_PSS_PADDING && !key.public {
+		// sign with salt length equal to the digest length (as required by e.g. JWA),
+		// verification accepts any salt length
+		checkP(C.EVP_PKEY_CTX_ctrl(key.ctx, C.EVP_PKEY_RSA, C.EVP_PKEY_OP_SIGN, C.EVP_PKEY_CTRL_RSA_PSS_SALTLEN, -1, nil))
+	}
 }
 
 func (p rsaParameters) isForEncryption() bool   { return p.md == nil }
@@ -89,8 +95,8 @@ func (p rsaParameters) toPublic(pri *PKey) (pub *PKey, err error) {
 	return newPKeyFromPrivate(pri)
 }
 
-func (p rsaParameters) generate(size int) (*PKey, error) {
-	ctx := C.EVP_PKEY_CTX_new_id(C.EVP_PKEY_RSA, nil)
+func (p rsaParameters) generate(size int, f fetch) (*PKey, error) {
+	ctx := f.newCtxID(C.EVP_PKEY_RSA)
 	if ctx == nil {
 		return nil, errors.New("Failed EVP_PKEY_CTX_new_id")
 	}
@@ -68,3 +68,59 @@ func TestRSA_MD5(t *testing.T) {
 		t.Fatalf("\nSignature Invalid\nDigest   : %x\nSignature: %x", digest, signature)
 	}
 }
+
+func TestExportImport_RSA(t *testing.T) {
+	pri, _ := NewPKey(pemRSA1024, RSA_OAEP)
+	defer pri.Close()
+	pub := pri.PublicKey().(*PKey)
+	defer pub.Close()
+	der, err := pub.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	imported, err := NewPKey(der, RSA_OAEP)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	if !imported.public || imported.KeySize() != 1024 {
+		t.Fatal("Invalid imported key")
+	}
+	plain := []byte("Message in a bottle!")
+	encrypted, err := imported.PublicKey().Encrypt(plain)
+	if err != nil {
+		t.Fatalf("Encryption failed: %s", err)
+	}
+	decrypted, err := pri.Decrypt(encrypted)
+	if err != nil || !bytes.Equal(plain, decrypted) {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+}
+
+func TestExportImportPrivate_RSA(t *testing.T) {
+	pri, _ := NewPKey(pemRSA1024, RSA_PSS_SHA256)
+	defer pri.Close()
+	der, err := pri.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	imported, err := NewPKey(der, RSA_PSS_SHA256)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	if imported.public || imported.KeySize() != 1024 {
+		t.Fatal("Invalid imported key")
+	}
+	digest := make([]byte, 32)
+	signature, err := imported.Sign(digest)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	valid, err := pub.Verify(signature, digest)
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+}
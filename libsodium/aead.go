@@ -0,0 +1,89 @@
+package libsodium
+
+// #include <sodium.h>
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.XChaCha20_Poly1305, XChaCha20_Poly1305)
+}
+
+// AEADSpec is XChaCha20-Poly1305 (crypto_aead_xchacha20poly1305_ietf).
+type AEADSpec struct{}
+
+var (
+	XChaCha20_Poly1305 = AEADSpec{}
+)
+
+var errOpen = errors.New("message authentication failed")
+
+func (as AEADSpec) New(key []byte) okapi.AEAD {
+	if len(key) != C.crypto_aead_xchacha20poly1305_ietf_KEYBYTES {
+		panic("invalid key size")
+	}
+	return &AEAD{key: secretFrom(key)}
+}
+
+type AEAD struct {
+	key *secret
+}
+
+func (a *AEAD) NonceSize() int {
+	return C.crypto_aead_xchacha20poly1305_ietf_NPUBBYTES
+}
+
+func (a *AEAD) Overhead() int {
+	return C.crypto_aead_xchacha20poly1305_ietf_ABYTES
+}
+
+func (a *AEAD) KeySize() int {
+	return C.crypto_aead_xchacha20poly1305_ietf_KEYBYTES
+}
+
+// associatedData checks the nonce and returns the associated data
+func (a *AEAD) associatedData(nonce []byte, data [][]byte) []byte {
+	if len(nonce) != a.NonceSize() {
+		panic("invalid nonce size")
+	}
+	if len(data) > 1 {
+		panic("too many associated data components")
+	}
+	if len(data) == 1 {
+		return data[0]
+	}
+	return nil
+}
+
+func (a *AEAD) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	ad := a.associatedData(nonce, data)
+	sealed := make([]byte, len(plain)+a.Overhead())
+	var length C.ulonglong
+	C.crypto_aead_xchacha20poly1305_ietf_encrypt(uchar(sealed), &length, uchar(plain), C.ulonglong(len(plain)),
+		uchar(ad), C.ulonglong(len(ad)), nil, uchar(nonce), a.key.uchar())
+	return append(dst, sealed[:length]...)
+}
+
+func (a *AEAD) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	ad := a.associatedData(nonce, data)
+	if len(encrypted) < a.Overhead() {
+		return nil, errOpen
+	}
+	opened := make([]byte, len(encrypted)-a.Overhead())
+	var length C.ulonglong
+	if C.crypto_aead_xchacha20poly1305_ietf_decrypt(uchar(opened), &length, nil, uchar(encrypted), C.ulonglong(len(encrypted)),
+		uchar(ad), C.ulonglong(len(ad)), uchar(nonce), a.key.uchar()) != 0 {
+		return nil, errOpen
+	}
+	return append(dst, opened[:length]...), nil
+}
+
+func (a *AEAD) Close() {
+	if a.key == nil {
+		return
+	}
+	a.key.free()
+	a.key = nil
+}
@@ -0,0 +1,46 @@
+package libsodium
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func h2b(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestXChaCha20_Poly1305(t *testing.T) {
+	// draft-irtf-cfrg-xchacha-03, A.3.1 Example and Test Vector for AEAD_XCHACHA20_POLY1305
+	key := h2b("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+	nonce := h2b("404142434445464748494a4b4c4d4e4f5051525354555657")
+	data := h2b("50515253c0c1c2c3c4c5c6c7")
+	plain := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	aead := XChaCha20_Poly1305.New(key)
+	defer aead.Close()
+	if aead.NonceSize() != 24 || aead.Overhead() != 16 {
+		t.Fatalf("Wrong sizes: %d, %d", aead.NonceSize(), aead.Overhead())
+	}
+	encrypted := aead.Seal(nil, nonce, plain, data)
+	if hex.EncodeToString(encrypted) != "bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52ec0875924c1c7987947deafd8780acf49" {
+		t.Fatalf("Wrong encryption: %x", encrypted)
+	}
+	decrypted, err := aead.Open(nil, nonce, encrypted, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	if _, err = aead.Open(nil, nonce, encrypted); err == nil {
+		t.Fatal("Open succeeded with wrong associated data")
+	}
+	encrypted[20] ^= 1
+	if _, err = aead.Open(nil, nonce, encrypted, data); err == nil {
+		t.Fatal("Open succeeded with tampered input")
+	}
+}
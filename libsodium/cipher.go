@@ -0,0 +1,114 @@
+package libsodium
+
+// #include <sodium.h>
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+	"io"
+)
+
+func init() {
+	okapi.Register(&okapi.XSalsa20, XSalsa20)
+}
+
+// CipherSpec is the XSalsa20 stream cipher (crypto_stream_xsalsa20), the iv is the 24 byte nonce.
+// Encryption and decryption are the same operation.
+type CipherSpec struct{}
+
+var (
+	XSalsa20 = CipherSpec{}
+)
+
+// salsaBlockSize is the size of the key stream blocks
+const salsaBlockSize = 64
+
+func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
+	if len(key) != C.crypto_stream_xsalsa20_KEYBYTES {
+		panic("invalid key size")
+	}
+	if len(iv) != C.crypto_stream_xsalsa20_NONCEBYTES {
+		panic("invalid iv size")
+	}
+	return &StreamCipher{key: secretFrom(key), nonce: append([]byte(nil), iv...), keystream: newSecret(salsaBlockSize)}
+}
+
+func (cs CipherSpec) NewReader(in io.Reader, key, iv, buffer []byte) *okapi.CipherReader {
+	return okapi.NewCipherReader(in, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWriter(out io.Writer, key, iv, buffer []byte) *okapi.CipherWriter {
+	return okapi.NewCipherWriter(out, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWithKey(key *okapi.SecretKey, iv []byte, encrypt bool) (okapi.Cipher, error) {
+	return key.NewCipher(cs, iv, encrypt)
+}
+
+// StreamCipher processes whole key stream blocks directly and keeps the rest of a partially used block.
+type StreamCipher struct {
+	key   *secret
+	nonce []byte
+	// counter is the index of the next key stream block
+	counter uint64
+	// keystream holds a key stream block, of which the last unused bytes are not used yet
+	keystream *secret
+	unused    int
+}
+
+func (c *StreamCipher) Update(in, out []byte) (int, int) {
+	n := min(len(in), len(out))
+	done := 0
+	if c.unused > 0 {
+		done = xor(out[:n], in[:n], c.keystream.bytes()[salsaBlockSize-c.unused:])
+		c.unused -= done
+	}
+	if blocks := (n - done) / salsaBlockSize * salsaBlockSize; blocks > 0 {
+		C.crypto_stream_xsalsa20_xor_ic(uchar(out[done:]), uchar(in[done:]), C.ulonglong(blocks), uchar(c.nonce), C.uint64_t(c.counter), c.key.uchar())
+		c.counter += uint64(blocks / salsaBlockSize)
+		done += blocks
+	}
+	if done < n {
+		keystream := c.keystream.bytes()
+		clear(keystream)
+		C.crypto_stream_xsalsa20_xor_ic(c.keystream.uchar(), c.keystream.uchar(), salsaBlockSize, uchar(c.nonce), C.uint64_t(c.counter), c.key.uchar())
+		c.counter++
+		used := xor(out[done:n], in[done:n], keystream)
+		c.unused = salsaBlockSize - used
+		done += used
+	}
+	return done, done
+}
+
+// xor sets out to a^b for the length of the shortest input and returns the number of bytes written
+func xor(out, a, b []byte) int {
+	n := min(len(out), len(a), len(b))
+	for i := 0; i < n; i++ {
+		out[i] = a[i] ^ b[i]
+	}
+	return n
+}
+
+func (c *StreamCipher) Finish(out []byte) int {
+	return 0
+}
+
+func (c *StreamCipher) BlockSize() int {
+	return 1
+}
+
+func (c *StreamCipher) KeySize() int {
+	return C.crypto_stream_xsalsa20_KEYBYTES
+}
+
+func (c *StreamCipher) BufferedSize() int {
+	return 0
+}
+
+func (c *StreamCipher) Close() {
+	if c.key == nil {
+		return
+	}
+	c.key.free()
+	c.keystream.free()
+	c.key, c.keystream = nil, nil
+}
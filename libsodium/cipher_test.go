@@ -0,0 +1,52 @@
+package libsodium
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestXSalsa20(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 24)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for i := range iv {
+		iv[i] = byte(100 + i)
+	}
+	plain := make([]byte, 200)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+	expected := "687cfde22eff59e87606e1125161d79de48460c50d5797f4d066a1553d1b8d332298bbea1e93e8ce98d409bf1ba98d370e9b0a94d0937d2c9e3578af36b6f7b7e82eb65b0b72dda3bd5f5d294c5e932a91c1fc4b46d36f085bb8095f87efc03b23ea2e0eac592eedd1e675992cae83fc24e6ff74d38a0d75eae2f35c049b9bb97a486bf86b5cbc408bf2f50030d11bb7e8be04d943bed69ed8159438788c48a31ea1afbb936bbbaee58a819371644efad39a44ac9992c4ab13b01dc9da85774f41bee9eb191415a0"
+	// feed the input in chunks that straddle the key stream blocks
+	for _, chunk := range []int{1, 7, 64, 100, 200} {
+		salsa := XSalsa20.New(key, iv, true)
+		defer salsa.Close()
+		if salsa.BlockSize() != 1 || salsa.KeySize() != 32 {
+			t.Fatalf("Wrong sizes: %d, %d", salsa.BlockSize(), salsa.KeySize())
+		}
+		encrypted := make([]byte, len(plain))
+		for i := 0; i < len(plain); i += chunk {
+			end := min(i+chunk, len(plain))
+			ins, outs := salsa.Update(plain[i:end], encrypted[i:])
+			if ins != end-i || outs != end-i {
+				t.Fatalf("Wrong counts: %d, %d", ins, outs)
+			}
+		}
+		if outs := salsa.Finish(nil); outs != 0 {
+			t.Fatalf("Wrong finish count: %d", outs)
+		}
+		if hex.EncodeToString(encrypted) != expected {
+			t.Fatalf("Chunk %d: %x", chunk, encrypted)
+		}
+		decrypted := make([]byte, len(plain))
+		salsa = XSalsa20.New(key, iv, false)
+		defer salsa.Close()
+		salsa.Update(encrypted, decrypted)
+		if !bytes.Equal(decrypted, plain) {
+			t.Fatal("Decrypted does not match plain")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package libsodium
+
+// #include <sodium.h>
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.BLAKE2b_256, BLAKE2b_256)
+	okapi.Register(&okapi.BLAKE2b_512, BLAKE2b_512)
+	okapi.Register(&okapi.Poly1305, Poly1305)
+}
+
+// HashSpec is BLAKE2b (crypto_generichash_blake2b) with given digest size in bytes.
+type HashSpec struct {
+	size int
+}
+
+var (
+	BLAKE2b_256 = HashSpec{32}
+	BLAKE2b_512 = HashSpec{64}
+)
+
+func (hs HashSpec) New() okapi.Hash {
+	h := &Hash{size: hs.size, blockSize: 128, state: newSecret(int(C.crypto_generichash_blake2b_statebytes()))}
+	h.Reset()
+	return h
+}
+
+// Hash is a BLAKE2b or Poly1305 computation, the state is kept in sodium_malloc memory
+// because it is keyed for Poly1305 (and derived from the input otherwise).
+type Hash struct {
+	size      int
+	blockSize int
+	state     *secret
+	// key is the Poly1305 key, nil for BLAKE2b
+	key    *secret
+	digest []byte
+}
+
+func (h *Hash) Write(data []byte) (int, error) {
+	if h.digest != nil {
+		return 0, errors.New("Cannot write into finalized hash")
+	}
+	if h.key != nil {
+		C.crypto_onetimeauth_poly1305_update(h.poly1305(), uchar(data), C.ulonglong(len(data)))
+	} else {
+		C.crypto_generichash_blake2b_update(h.blake2b(), uchar(data), C.ulonglong(len(data)))
+	}
+	return len(data), nil
+}
+
+func (h *Hash) Digest() []byte {
+	if h.digest != nil {
+		return h.digest
+	}
+	digest := make([]byte, h.size)
+	if h.key != nil {
+		C.crypto_onetimeauth_poly1305_final(h.poly1305(), uchar(digest))
+	} else if C.crypto_generichash_blake2b_final(h.blake2b(), uchar(digest), C.size_t(h.size)) != 0 {
+		panic("crypto_generichash_blake2b_final failed")
+	}
+	h.digest = digest
+	return h.digest
+}
+
+func (h *Hash) Size() int {
+	return h.size
+}
+
+func (h *Hash) BlockSize() int {
+	return h.blockSize
+}
+
+func (h *Hash) Clone() okapi.Hash {
+	clone := &Hash{size: h.size, blockSize: h.blockSize, state: h.state.clone()}
+	if h.key != nil {
+		clone.key = h.key.clone()
+	}
+	if h.digest != nil {
+		clone.digest = append([]byte(nil), h.digest...)
+	}
+	return clone
+}
+
+// Reset restarts the computation, note that a Poly1305 key MUST NOT be used for more than one message.
+func (h *Hash) Reset() {
+	h.digest = nil
+	if h.key != nil {
+		C.crypto_onetimeauth_poly1305_init(h.poly1305(), h.key.uchar())
+	} else if C.crypto_generichash_blake2b_init(h.blake2b(), nil, 0, C.size_t(h.size)) != 0 {
+		panic("crypto_generichash_blake2b_init failed")
+	}
+}
+
+func (h *Hash) Close() {
+	if h.state == nil {
+		return
+	}
+	h.state.free()
+	h.state = nil
+	if h.key != nil {
+		h.key.free()
+		h.key = nil
+	}
+}
+
+func (h *Hash) blake2b() *C.crypto_generichash_blake2b_state {
+	return (*C.crypto_generichash_blake2b_state)(h.state.p)
+}
+
+func (h *Hash) poly1305() *C.crypto_onetimeauth_poly1305_state {
+	return (*C.crypto_onetimeauth_poly1305_state)(h.state.p)
+}
+
+// MACSpec is the Poly1305 one-time authenticator (crypto_onetimeauth_poly1305).
+type MACSpec struct{}
+
+var (
+	Poly1305 = MACSpec{}
+)
+
+// New ignores the hash, the key must be 32 bytes.
+func (ms MACSpec) New(hash okapi.HashSpec, key []byte) okapi.Hash {
+	if len(key) != C.crypto_onetimeauth_poly1305_KEYBYTES {
+		panic("invalid key size")
+	}
+	h := &Hash{
+		size:      C.crypto_onetimeauth_poly1305_BYTES,
+		blockSize: 16,
+		state:     newSecret(int(C.crypto_onetimeauth_poly1305_statebytes())),
+		key:       secretFrom(key),
+	}
+	h.Reset()
+	return h
+}
+
+func (ms MACSpec) NewWithKey(hash okapi.HashSpec, key *okapi.SecretKey) (okapi.Hash, error) {
+	return key.NewMAC(ms, hash)
+}
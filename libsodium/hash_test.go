@@ -0,0 +1,57 @@
+package libsodium
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestBLAKE2b(t *testing.T) {
+	for _, v := range []struct {
+		spec   HashSpec
+		digest string
+	}{
+		{BLAKE2b_256, "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{BLAKE2b_512, "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+	} {
+		h := v.spec.New()
+		defer h.Close()
+		if h.Size() != v.spec.size || h.BlockSize() != 128 {
+			t.Fatalf("Wrong sizes: %d, %d", h.Size(), h.BlockSize())
+		}
+		h.Write([]byte("ab"))
+		clone := h.Clone()
+		defer clone.Close()
+		h.Write([]byte("c"))
+		if digest := h.Digest(); hex.EncodeToString(digest) != v.digest {
+			t.Fatalf("%x", digest)
+		}
+		count, err := h.Write([]byte("test"))
+		if err == nil || count != 0 {
+			t.Fatalf("count=%d, err=%s", count, err)
+		}
+		clone.Write([]byte("c"))
+		if digest := clone.Digest(); hex.EncodeToString(digest) != v.digest {
+			t.Fatalf("Clone %x", digest)
+		}
+		h.Reset()
+		h.Write([]byte("abc"))
+		if digest := h.Digest(); hex.EncodeToString(digest) != v.digest {
+			t.Fatalf("Reset %x", digest)
+		}
+	}
+}
+
+func TestPoly1305(t *testing.T) {
+	// RFC 8439, 2.5.2 Poly1305 Example and Test Vector
+	key, _ := hex.DecodeString("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b")
+	mac := Poly1305.New(nil, key)
+	defer mac.Close()
+	if mac.Size() != 16 {
+		t.Fatalf("Wrong size: %d", mac.Size())
+	}
+	mac.Write([]byte("Cryptographic Forum "))
+	mac.Write([]byte("Research Group"))
+	if digest := mac.Digest(); hex.EncodeToString(digest) != "a8061dc1305136c6c22b8baf0c0127a9" {
+		t.Fatalf("%x", digest)
+	}
+}
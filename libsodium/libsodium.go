@@ -0,0 +1,72 @@
+// Package libsodium implements okapi interfaces using the libsodium library:
+// XSalsa20, XChaCha20-Poly1305, BLAKE2b, Poly1305, Ed25519, X25519 and randombytes_buf.
+// The keys are held in memory allocated by sodium_malloc, which is locked,
+// guarded against overflows and zeroed when the key is closed.
+package libsodium
+
+// #cgo LDFLAGS: -lsodium
+// #include <sodium.h>
+import "C"
+import (
+	"unsafe"
+)
+
+func init() {
+	if C.sodium_init() < 0 {
+		panic("libsodium initialization failed")
+	}
+}
+
+// secret is a copy of key material or of a keyed state in memory allocated by sodium_malloc
+type secret struct {
+	p    unsafe.Pointer
+	size int
+}
+
+// newSecret allocates a zeroed secret of given size, it panics if the memory cannot be locked
+func newSecret(size int) *secret {
+	p := C.sodium_malloc(C.size_t(size))
+	if p == nil {
+		panic("sodium_malloc failed")
+	}
+	s := &secret{p: p, size: size}
+	C.sodium_memzero(p, C.size_t(size))
+	return s
+}
+
+// secretFrom allocates a secret holding a copy of b
+func secretFrom(b []byte) *secret {
+	s := newSecret(len(b))
+	copy(s.bytes(), b)
+	return s
+}
+
+func (s *secret) bytes() []byte {
+	return unsafe.Slice((*byte)(s.p), s.size)
+}
+
+func (s *secret) uchar() *C.uchar {
+	return (*C.uchar)(s.p)
+}
+
+// clone allocates a new secret with the same content
+func (s *secret) clone() *secret {
+	return secretFrom(s.bytes())
+}
+
+// free zeroes and releases the memory
+func (s *secret) free() {
+	if s.p == nil {
+		return
+	}
+	C.sodium_free(s.p)
+	s.p = nil
+}
+
+// uchar returns the C pointer to the start of b, or nil if it is empty
+func uchar(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
@@ -0,0 +1,254 @@
+package libsodium
+
+// #include <sodium.h>
+import "C"
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+func init() {
+	okapi.Register(&okapi.Ed25519, Ed25519.constructor())
+	okapi.Register(&okapi.X25519, X25519.constructor())
+}
+
+// KeyAlgorithm selects the algorithm of a PKey, Ed25519 for signing or X25519 for key agreement.
+type KeyAlgorithm struct {
+	signing bool
+}
+
+var (
+	// Ed25519 signatures are computed over the message itself (pure EdDSA, RFC 8032)
+	Ed25519 = KeyAlgorithm{signing: true}
+	// X25519 key agreement (RFC 7748), the shared secret is the raw function output
+	X25519 = KeyAlgorithm{signing: false}
+)
+
+// keySize is the key size reported for both algorithms, it matches OpenSSL
+const keySize = 253
+
+func (ka KeyAlgorithm) constructor() okapi.KeyConstructor {
+	return func(keyParameters interface{}) (okapi.PrivateKey, error) {
+		key, err := NewPKey(keyParameters, ka)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// PKey is an Ed25519 or X25519 key. The private key (the Ed25519 secret key or the X25519 scalar)
+// is held in sodium_malloc memory, it is nil for public keys.
+// The random is the source of randomness provided with okapi.KeyParameters, if any.
+type PKey struct {
+	algorithm KeyAlgorithm
+	private   *secret
+	public    []byte
+	random    okapi.Random
+}
+
+func (key *PKey) Decrypt(encrypted []byte) (decrypted []byte, err error) {
+	return nil, errors.New("Key is not configured for encryption!")
+}
+
+// Sign computes a detached signature of the message (not a digest).
+func (key *PKey) Sign(message []byte) (signature []byte, err error) {
+	if key.private == nil {
+		return nil, errors.New("Public key cannot sign!")
+	}
+	if !key.algorithm.signing {
+		return nil, errors.New("Key is not configured for signing!")
+	}
+	signature = make([]byte, C.crypto_sign_ed25519_BYTES)
+	if C.crypto_sign_ed25519_detached(uchar(signature), nil, uchar(message), C.ulonglong(len(message)), key.private.uchar()) != 0 {
+		return nil, errors.New("crypto_sign_ed25519_detached failed")
+	}
+	return signature, nil
+}
+
+// Derive accepts the public keys of other implementations as well,
+// they are converted through their X.509 SubjectPublicKeyInfo encoding.
+func (key *PKey) Derive(peer okapi.PublicKey) (secret []byte, err error) {
+	if key.private == nil {
+		return nil, errors.New("Public key cannot derive!")
+	}
+	if key.algorithm.signing {
+		return nil, errors.New("Key is not configured for key agreement!")
+	}
+	other, ok := peer.(*PKey)
+	if !ok {
+		der, err := okapi.ExportKey(peer)
+		if err != nil {
+			return nil, err
+		}
+		if other, err = newPKeyFromDER(der, X25519); err != nil {
+			return nil, err
+		}
+		defer other.Close()
+	}
+	if other.algorithm.signing {
+		return nil, errors.New("Peer key is not an X25519 key")
+	}
+	secret = make([]byte, C.crypto_scalarmult_curve25519_BYTES)
+	if C.crypto_scalarmult_curve25519(uchar(secret), key.private.uchar(), uchar(other.public)) != 0 {
+		return nil, errors.New("Invalid peer key")
+	}
+	return secret, nil
+}
+
+func (key *PKey) PublicKey() okapi.PublicKey {
+	if key.private == nil {
+		return key
+	}
+	return &PKey{algorithm: key.algorithm, public: key.public, random: key.random}
+}
+
+func (key *PKey) Encrypt(plain []byte) (encrypted []byte, err error) {
+	return nil, errors.New("Key is not configured for encryption!")
+}
+
+func (key *PKey) Verify(signature []byte, message []byte) (valid bool, err error) {
+	if !key.algorithm.signing {
+		return false, errors.New("Key is not configured for signing!")
+	}
+	if len(signature) != C.crypto_sign_ed25519_BYTES {
+		return false, nil
+	}
+	return C.crypto_sign_ed25519_verify_detached(uchar(signature), uchar(message), C.ulonglong(len(message)), uchar(key.public)) == 0, nil
+}
+
+func (key *PKey) Export() ([]byte, error) {
+	if key.private == nil {
+		if key.algorithm.signing {
+			return x509.MarshalPKIXPublicKey(ed25519.PublicKey(key.public))
+		}
+		public, err := ecdh.X25519().NewPublicKey(key.public)
+		if err != nil {
+			return nil, err
+		}
+		return x509.MarshalPKIXPublicKey(public)
+	}
+	if key.algorithm.signing {
+		private := ed25519.PrivateKey(append([]byte(nil), key.private.bytes()...))
+		defer clear(private)
+		return x509.MarshalPKCS8PrivateKey(private)
+	}
+	private, err := ecdh.X25519().NewPrivateKey(key.private.bytes())
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(private)
+}
+
+func (key *PKey) Close() {
+	if key.private != nil {
+		key.private.free()
+		key.private = nil
+	}
+	key.public = nil
+	key.random = nil
+}
+
+func (key *PKey) KeySize() int {
+	return keySize
+}
+
+// NewPKey creates a key from the key parameters (kps) for the algorithm (ka).
+// The key parameters can be:
+// * int: generates a new key, the size is ignored
+// * string: reads the key from PEM encoding
+// * []byte: reads the key from DER encoding (PKCS#8 private key or X.509 public key)
+// * okapi.PublicKey: generates a new key
+// * okapi.KeyParameters: any of the above with the Random used to generate the key
+func NewPKey(kps interface{}, ka KeyAlgorithm) (key *PKey, err error) {
+	var random okapi.Random
+	if p, ok := kps.(okapi.KeyParameters); ok {
+		kps, random = p.Parameters, p.Random
+	}
+	switch kps := kps.(type) {
+	case int, okapi.PublicKey:
+		key, err = generate(ka, random)
+	case string:
+		block, _ := pem.Decode([]byte(kps))
+		if block == nil {
+			return nil, errors.New("Invalid PEM input")
+		}
+		key, err = newPKeyFromDER(block.Bytes, ka)
+	case []byte:
+		key, err = newPKeyFromDER(kps, ka)
+	default:
+		err = errors.New("Invalid Parameters")
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.random = random
+	return key, nil
+}
+
+// generate creates the Ed25519 key from a random seed, or a random X25519 scalar
+func generate(ka KeyAlgorithm, random okapi.Random) (*PKey, error) {
+	if ka.signing {
+		seed := newSecret(C.crypto_sign_ed25519_SEEDBYTES)
+		defer seed.free()
+		if err := randomSecret(seed, random); err != nil {
+			return nil, err
+		}
+		return fromSeed(seed.bytes()), nil
+	}
+	scalar := newSecret(C.crypto_scalarmult_curve25519_SCALARBYTES)
+	if err := randomSecret(scalar, random); err != nil {
+		scalar.free()
+		return nil, err
+	}
+	return fromScalar(scalar), nil
+}
+
+// fromSeed computes the Ed25519 key pair from the seed
+func fromSeed(seed []byte) *PKey {
+	key := &PKey{algorithm: Ed25519, private: newSecret(C.crypto_sign_ed25519_SECRETKEYBYTES), public: make([]byte, C.crypto_sign_ed25519_PUBLICKEYBYTES)}
+	C.crypto_sign_ed25519_seed_keypair(uchar(key.public), key.private.uchar(), uchar(seed))
+	return key
+}
+
+// fromScalar computes the X25519 public key of the scalar, the key takes ownership of the scalar
+func fromScalar(scalar *secret) *PKey {
+	key := &PKey{algorithm: X25519, private: scalar, public: make([]byte, C.crypto_scalarmult_curve25519_BYTES)}
+	C.crypto_scalarmult_curve25519_base(uchar(key.public), scalar.uchar())
+	return key
+}
+
+func newPKeyFromDER(der []byte, ka KeyAlgorithm) (*PKey, error) {
+	if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch private := private.(type) {
+		case ed25519.PrivateKey:
+			defer clear(private)
+			if ka.signing {
+				return fromSeed(private.Seed()), nil
+			}
+		case *ecdh.PrivateKey:
+			if !ka.signing && private.Curve() == ecdh.X25519() {
+				return fromScalar(secretFrom(private.Bytes())), nil
+			}
+		}
+		return nil, errors.New("Unsupported key type")
+	}
+	if public, err := x509.ParsePKIXPublicKey(der); err == nil {
+		switch public := public.(type) {
+		case ed25519.PublicKey:
+			if ka.signing {
+				return &PKey{algorithm: Ed25519, public: public}, nil
+			}
+		case *ecdh.PublicKey:
+			if !ka.signing && public.Curve() == ecdh.X25519() {
+				return &PKey{algorithm: X25519, public: public.Bytes()}, nil
+			}
+		}
+		return nil, errors.New("Unsupported key type")
+	}
+	return nil, errors.New("Invalid DER input")
+}
@@ -0,0 +1,127 @@
+package libsodium
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"github.com/mkobetic/okapi"
+	// SeededRandom needs SHA256 and HMAC
+	_ "github.com/mkobetic/okapi/gocrypto"
+	"testing"
+)
+
+func TestEd25519(t *testing.T) {
+	pri, err := NewPKey(0, Ed25519)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	message := []byte("Message in a bottle!")
+	signature, err := pri.Sign(message)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, message)
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	// cross check with crypto/ed25519
+	der, _ := okapi.ExportKey(pub)
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	if !ed25519.Verify(public.(ed25519.PublicKey), message, signature) {
+		t.Fatal("crypto/ed25519 verification failed")
+	}
+	message[0] ^= 1
+	if valid, _ = pub.Verify(signature, message); valid {
+		t.Fatal("Verification of wrong message succeeded")
+	}
+}
+
+func TestX25519(t *testing.T) {
+	pri, err := NewPKey(0, X25519)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	// the peer is a crypto/ecdh key, imported through its encoding
+	peer, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(peer.PublicKey())
+	other, err := NewPKey(der, X25519)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer other.Close()
+	secret, err := pri.Derive(other)
+	if err != nil {
+		t.Fatalf("Derive failed: %s", err)
+	}
+	der, _ = okapi.ExportKey(pub)
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	expected, _ := peer.ECDH(public.(*ecdh.PublicKey))
+	if !bytes.Equal(secret, expected) {
+		t.Fatal("Shared secrets mismatch")
+	}
+	if _, err = pri.Derive(other.PublicKey()); err != nil {
+		t.Fatalf("Derive from public key failed: %s", err)
+	}
+	if _, err = pri.Sign(secret); err == nil {
+		t.Fatal("X25519 key signed")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for _, ka := range []KeyAlgorithm{Ed25519, X25519} {
+		pri, _ := NewPKey(0, ka)
+		defer pri.Close()
+		der, err := pri.Export()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err)
+		}
+		imported, err := NewPKey(der, ka)
+		if err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		defer imported.Close()
+		if imported.private == nil || !bytes.Equal(imported.public, pri.public) {
+			t.Fatal("Invalid imported key")
+		}
+		again, _ := imported.Export()
+		if !bytes.Equal(der, again) {
+			t.Fatal("Exported keys mismatch")
+		}
+		if _, err = NewPKey(der, KeyAlgorithm{signing: !ka.signing}); err == nil {
+			t.Fatal("Imported key of the other algorithm")
+		}
+	}
+}
+
+func TestSeededKeys(t *testing.T) {
+	generate := func(ka KeyAlgorithm) []byte {
+		random := okapi.SeededRandom([]byte("seed")).New()
+		defer random.Close()
+		pri, err := NewPKey(okapi.KeyParameters{Parameters: 0, Random: random}, ka)
+		if err != nil {
+			t.Fatalf("Failed generating key: %s", err)
+		}
+		defer pri.Close()
+		der, _ := pri.Export()
+		return der
+	}
+	for _, ka := range []KeyAlgorithm{Ed25519, X25519} {
+		if !bytes.Equal(generate(ka), generate(ka)) {
+			t.Fatal("Seeded keys mismatch")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package libsodium
+
+// #include <sodium.h>
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	okapi.Register(&okapi.DefaultRandom, DefaultRandom)
+}
+
+// RandomSpec reads random bytes with randombytes_buf.
+type RandomSpec struct{}
+
+var (
+	DefaultRandom = RandomSpec{}
+)
+
+func (rs RandomSpec) New() okapi.Random {
+	return &Random{}
+}
+
+type Random struct {
+}
+
+func (r *Random) Read(b []byte) (int, error) {
+	if len(b) > 0 {
+		C.randombytes_buf(unsafe.Pointer(&b[0]), C.size_t(len(b)))
+	}
+	return len(b), nil
+}
+
+func (r *Random) Close() {
+}
+
+// randomSecret fills the secret from the random, or if it is nil, from okapi.DefaultRandom
+// if it was replaced with a RandomSpec other than the DefaultRandom of this package,
+// otherwise from randombytes_buf.
+func randomSecret(s *secret, random okapi.Random) error {
+	if random == nil {
+		if spec := okapi.DefaultRandom; spec != nil {
+			if _, ok := okapi.UnwrapRandomSpec(spec).(RandomSpec); !ok {
+				random = spec.New()
+				defer random.Close()
+			}
+		}
+	}
+	if _, ok := okapi.UnwrapRandom(random).(*Random); ok || random == nil {
+		C.randombytes_buf(s.p, C.size_t(s.size))
+		return nil
+	}
+	_, err := io.ReadFull(random, s.bytes())
+	return err
+}
@@ -0,0 +1,359 @@
+package okapi
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Operation identifies the kind of an observed Event.
+type Operation string
+
+const (
+	OpNewHash    Operation = "new-hash"
+	OpNewMAC     Operation = "new-mac"
+	OpNewCipher  Operation = "new-cipher"
+	OpNewAEAD    Operation = "new-aead"
+	OpNewKeyWrap Operation = "new-keywrap"
+	// OpNewKey is the construction of a key, i.e. its generation or import
+	OpNewKey  Operation = "new-key"
+	OpSign    Operation = "sign"
+	OpVerify  Operation = "verify"
+	OpEncrypt Operation = "encrypt"
+	OpDecrypt Operation = "decrypt"
+	OpDerive  Operation = "derive"
+	// OpHash and OpMAC are the input of a Hash or a MAC, reported when it is closed
+	OpHash   Operation = "hash"
+	OpMAC    Operation = "mac"
+	OpWrap   Operation = "wrap"
+	OpUnwrap Operation = "unwrap"
+)
+
+// Event describes an operation of a predefined algorithm variable.
+type Event struct {
+	Operation Operation
+	// Algorithm is the name of the predefined variable, e.g. "AES_GCM" or "RSA_SHA256".
+	Algorithm string
+	// Provider is the name of the implementation package, e.g. "libcrypto" or "pkcs11".
+	Provider string
+	// KeySize is the size of the key in bits, 0 for hashes or if the key doesn't report its size.
+	KeySize int
+	// Bytes is the size of the input of the operation, i.e. the digest (or the message for Ed25519)
+	// when signing or verifying, the plaintext or the ciphertext, the key when wrapping or unwrapping,
+	// or the total input of a Hash, MAC or Cipher, 0 for the New operations and OpDerive.
+	Bytes int
+	// Latency is the duration of the operation (including the key generation for OpNewKey),
+	// the total duration of the calls of a Hash, MAC or Cipher.
+	Latency time.Duration
+	// Err is the error of the operation, for the New methods of the specs it is the panic value.
+	Err error
+}
+
+// Observer is notified of the operations of the predefined algorithm variables,
+// it is called synchronously from the goroutine performing the operation.
+type Observer interface {
+	Observe(event *Event)
+}
+
+// ObserverFunc is an Observer calling the function.
+type ObserverFunc func(event *Event)
+
+func (f ObserverFunc) Observe(event *Event) {
+	f(event)
+}
+
+// MultiObserver notifies all the observers of each event.
+func MultiObserver(observers ...Observer) Observer {
+	return ObserverFunc(func(event *Event) {
+		for _, o := range observers {
+			o.Observe(event)
+		}
+	})
+}
+
+var observer atomic.Pointer[Observer]
+
+func currentObserver() Observer {
+	if o := observer.Load(); o != nil {
+		return *o
+	}
+	return nil
+}
+
+// SetObserver makes the observer notified of the operations of the predefined variables, nil removes the current observer.
+// The guards of the predefined variables notify the observer (see Register),
+// implementations assigned to them without Register are not observed.
+// The operations of the hashes, ciphers, AEADs, key wraps and keys are observed if they were created
+// while an observer is set. The input of a Hash, MAC or Cipher is reported in a single event when it is closed
+// (OpHash, OpMAC, or OpEncrypt and OpDecrypt with the total of the Update calls).
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&o)
+}
+
+// observation measures an operation for the current observer, it is nil if there is no observer
+type observation struct {
+	Observer
+	event Event
+	start time.Time
+}
+
+func observe(operation Operation, name, provider string, keySize, bytes int) *observation {
+	o := currentObserver()
+	if o == nil {
+		return nil
+	}
+	return &observation{o, Event{Operation: operation, Algorithm: name, Provider: provider, KeySize: keySize, Bytes: bytes}, time.Now()}
+}
+
+func (o *observation) done(err error) {
+	if o == nil {
+		return
+	}
+	o.event.Latency = time.Since(o.start)
+	o.event.Err = err
+	o.Observe(&o.event)
+}
+
+// add accumulates a call of a Hash, MAC or Cipher that started at start
+func (o *observation) add(bytes int, start time.Time) {
+	if o == nil {
+		return
+	}
+	o.event.Bytes += bytes
+	o.event.Latency += time.Since(start)
+}
+
+// finish must be deferred by the New methods of the specs, it reports the panic and panics again
+func (o *observation) finish() {
+	if o == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		o.done(nil)
+		return
+	}
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+	o.done(err)
+	panic(r)
+}
+
+// providerOf returns the name of the package implementing the value
+func providerOf(v interface{}) string {
+	var path string
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Func {
+		// e.g. github.com/mkobetic/okapi/libcrypto.init.func1
+		path = runtime.FuncForPC(value.Pointer()).Name()
+		path = path[strings.LastIndex(path, "/")+1:]
+		return path[:strings.Index(path+".", ".")]
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	path = t.PkgPath()
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// observedKey notifies the current observer of the operations of the key and of its PublicKey
+type observedKey struct {
+	PrivateKey
+	name     string
+	provider string
+	keySize  int
+}
+
+func (k *observedKey) Decrypt(encrypted []byte) ([]byte, error) {
+	o := observe(OpDecrypt, k.name, k.provider, k.keySize, len(encrypted))
+	decrypted, err := k.PrivateKey.Decrypt(encrypted)
+	o.done(err)
+	return decrypted, err
+}
+
+func (k *observedKey) Sign(digest []byte) ([]byte, error) {
+	o := observe(OpSign, k.name, k.provider, k.keySize, len(digest))
+	signature, err := k.PrivateKey.Sign(digest)
+	o.done(err)
+	return signature, err
+}
+
+func (k *observedKey) Derive(peer PublicKey) ([]byte, error) {
+	o := observe(OpDerive, k.name, k.provider, k.keySize, 0)
+	secret, err := k.PrivateKey.Derive(unwrapPublicKey(peer))
+	o.done(err)
+	return secret, err
+}
+
+func (k *observedKey) PublicKey() PublicKey {
+	return &observedPublicKey{k.PrivateKey.PublicKey(), k.name, k.provider, k.keySize}
+}
+
+func (k *observedKey) KeySize() int {
+	return keySize(k.PrivateKey)
+}
+
+func (k *observedKey) Export() ([]byte, error) {
+	return ExportKey(k.PrivateKey)
+}
+
+type observedPublicKey struct {
+	PublicKey
+	name     string
+	provider string
+	keySize  int
+}
+
+func (k *observedPublicKey) Encrypt(plain []byte) ([]byte, error) {
+	o := observe(OpEncrypt, k.name, k.provider, k.keySize, len(plain))
+	encrypted, err := k.PublicKey.Encrypt(plain)
+	o.done(err)
+	return encrypted, err
+}
+
+func (k *observedPublicKey) Verify(signature []byte, digest []byte) (bool, error) {
+	o := observe(OpVerify, k.name, k.provider, k.keySize, len(digest))
+	valid, err := k.PublicKey.Verify(signature, digest)
+	o.done(err)
+	return valid, err
+}
+
+func (k *observedPublicKey) KeySize() int {
+	return keySize(k.PublicKey)
+}
+
+func (k *observedPublicKey) Export() ([]byte, error) {
+	return ExportKey(k.PublicKey)
+}
+
+// observedHash reports the input of a Hash or a MAC when it is closed
+type observedHash struct {
+	Hash
+	o *observation
+}
+
+// observeHash wraps the hash if there is an observer
+func observeHash(hash Hash, operation Operation, name, provider string, keySize int) Hash {
+	o := observe(operation, name, provider, keySize, 0)
+	if o == nil {
+		return hash
+	}
+	return &observedHash{hash, o}
+}
+
+func (h *observedHash) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := h.Hash.Write(b)
+	h.o.add(n, start)
+	return n, err
+}
+
+func (h *observedHash) Digest() []byte {
+	start := time.Now()
+	digest := h.Hash.Digest()
+	h.o.add(0, start)
+	return digest
+}
+
+func (h *observedHash) Clone() Hash {
+	e := h.o.event
+	return observeHash(h.Hash.Clone(), e.Operation, e.Algorithm, e.Provider, e.KeySize)
+}
+
+func (h *observedHash) Close() {
+	h.Hash.Close()
+	if h.o != nil {
+		h.o.Observe(&h.o.event)
+		h.o = nil
+	}
+}
+
+// observedCipher reports the input of a Cipher when it is closed
+type observedCipher struct {
+	Cipher
+	o *observation
+}
+
+// observeCipher wraps the cipher if there is an observer
+func observeCipher(cipher Cipher, operation Operation, name, provider string, keySize int) Cipher {
+	o := observe(operation, name, provider, keySize, 0)
+	if o == nil {
+		return cipher
+	}
+	return withGCMTag(&observedCipher{cipher, o}, cipher)
+}
+
+func (c *observedCipher) Update(in, out []byte) (int, int) {
+	start := time.Now()
+	ins, outs := c.Cipher.Update(in, out)
+	c.o.add(ins, start)
+	return ins, outs
+}
+
+func (c *observedCipher) Finish(out []byte) int {
+	start := time.Now()
+	outs := c.Cipher.Finish(out)
+	c.o.add(0, start)
+	return outs
+}
+
+func (c *observedCipher) Close() {
+	c.Cipher.Close()
+	if c.o != nil {
+		c.o.Observe(&c.o.event)
+		c.o = nil
+	}
+}
+
+// observedAEAD notifies the current observer of each Seal and Open
+type observedAEAD struct {
+	AEAD
+	name     string
+	provider string
+	keySize  int
+}
+
+func (a *observedAEAD) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	o := observe(OpEncrypt, a.name, a.provider, a.keySize, len(plain))
+	sealed := a.AEAD.Seal(dst, nonce, plain, data...)
+	o.done(nil)
+	return sealed
+}
+
+func (a *observedAEAD) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	o := observe(OpDecrypt, a.name, a.provider, a.keySize, len(encrypted))
+	opened, err := a.AEAD.Open(dst, nonce, encrypted, data...)
+	o.done(err)
+	return opened, err
+}
+
+// observedKeyWrap notifies the current observer of each Wrap and Unwrap
+type observedKeyWrap struct {
+	KeyWrap
+	name     string
+	provider string
+	keySize  int
+}
+
+func (w *observedKeyWrap) Wrap(key []byte) ([]byte, error) {
+	o := observe(OpWrap, w.name, w.provider, w.keySize, len(key))
+	wrapped, err := w.KeyWrap.Wrap(key)
+	o.done(err)
+	return wrapped, err
+}
+
+func (w *observedKeyWrap) Unwrap(wrapped []byte) ([]byte, error) {
+	o := observe(OpUnwrap, w.name, w.provider, w.keySize, len(wrapped))
+	key, err := w.KeyWrap.Unwrap(wrapped)
+	o.done(err)
+	return key, err
+}
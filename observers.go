@@ -0,0 +1,153 @@
+package okapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// SlogObserver writes the events as audit records to the Logger (slog.Default() if nil),
+// at the Info level, or at the Error level if the operation failed.
+type SlogObserver struct {
+	Logger *slog.Logger
+}
+
+func (o SlogObserver) Observe(event *Event) {
+	logger := o.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("operation", string(event.Operation)),
+		slog.String("algorithm", event.Algorithm),
+		slog.String("provider", event.Provider),
+	}
+	if event.KeySize > 0 {
+		attrs = append(attrs, slog.Int("key_size", event.KeySize))
+	}
+	if event.Bytes > 0 {
+		attrs = append(attrs, slog.Int("bytes", event.Bytes))
+	}
+	attrs = append(attrs, slog.Duration("latency", event.Latency))
+	if event.Err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+	logger.LogAttrs(context.Background(), level, "okapi", attrs...)
+}
+
+// Metrics is an Observer counting the operations, failures, bytes and latencies
+// per operation, algorithm and provider.
+// Metrics implements expvar.Var, e.g. expvar.Publish("okapi", metrics),
+// and WriteTo writes them in the Prometheus text exposition format.
+// The zero value is ready to use.
+type Metrics struct {
+	lock     sync.Mutex
+	counters map[metricLabels]*metricCounters
+}
+
+type metricLabels struct {
+	Operation Operation `json:"operation"`
+	Algorithm string    `json:"algorithm"`
+	Provider  string    `json:"provider"`
+}
+
+type metricCounters struct {
+	Count   uint64  `json:"count"`
+	Errors  uint64  `json:"errors"`
+	Bytes   uint64  `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+}
+
+type metric struct {
+	metricLabels
+	metricCounters
+}
+
+func (m *Metrics) Observe(event *Event) {
+	labels := metricLabels{event.Operation, event.Algorithm, event.Provider}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.counters == nil {
+		m.counters = make(map[metricLabels]*metricCounters)
+	}
+	c := m.counters[labels]
+	if c == nil {
+		c = new(metricCounters)
+		m.counters[labels] = c
+	}
+	c.Count++
+	if event.Err != nil {
+		c.Errors++
+	}
+	c.Bytes += uint64(event.Bytes)
+	c.Seconds += event.Latency.Seconds()
+}
+
+// snapshot returns a copy of the metrics sorted by their labels
+func (m *Metrics) snapshot() []metric {
+	m.lock.Lock()
+	metrics := make([]metric, 0, len(m.counters))
+	for labels, counters := range m.counters {
+		metrics = append(metrics, metric{labels, *counters})
+	}
+	m.lock.Unlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		a, b := metrics[i].metricLabels, metrics[j].metricLabels
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		if a.Algorithm != b.Algorithm {
+			return a.Algorithm < b.Algorithm
+		}
+		return a.Provider < b.Provider
+	})
+	return metrics
+}
+
+// String returns the metrics as a JSON array of objects with the labels and the counters.
+func (m *Metrics) String() string {
+	encoded, err := json.Marshal(m.snapshot())
+	if err != nil {
+		return "null"
+	}
+	return string(encoded)
+}
+
+var metricFamilies = []struct {
+	name, help string
+	value      func(*metricCounters) interface{}
+}{
+	{"okapi_operations_total", "Number of okapi operations.", func(c *metricCounters) interface{} { return c.Count }},
+	{"okapi_operation_errors_total", "Number of failed okapi operations.", func(c *metricCounters) interface{} { return c.Errors }},
+	{"okapi_operation_bytes_total", "Input bytes of okapi operations.", func(c *metricCounters) interface{} { return c.Bytes }},
+	{"okapi_operation_seconds_total", "Total duration of okapi operations in seconds.", func(c *metricCounters) interface{} { return c.Seconds }},
+}
+
+// WriteTo writes the metrics as counters in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	metrics := m.snapshot()
+	var total int64
+	for _, family := range metricFamilies {
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family.name, family.help, family.name)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		for i := range metrics {
+			m := &metrics[i]
+			n, err := fmt.Fprintf(w, "%s{operation=%q,algorithm=%q,provider=%q} %v\n",
+				family.name, m.Operation, m.Algorithm, m.Provider, family.value(&m.metricCounters))
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,239 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Armor block types
+const (
+	ArmorMessage    = "PGP MESSAGE"
+	ArmorSignature  = "PGP SIGNATURE"
+	ArmorPublicKey  = "PGP PUBLIC KEY BLOCK"
+	ArmorPrivateKey = "PGP PRIVATE KEY BLOCK"
+)
+
+// crc24 computes the armor checksum (RFC 4880, section 6.1)
+func crc24(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+const crc24Init = 0xb704ce
+
+// armorLine is the number of base64 characters per line
+const armorLine = 64
+
+// armorWriter encodes the written data with ASCII armor
+type armorWriter struct {
+	out       io.Writer
+	blockType string
+	encoder   io.WriteCloser
+	lines     *lineWriter
+	crc       uint32
+}
+
+// NewArmorWriter returns a WriteCloser that writes the ASCII armored data to out.
+// The block type is one of the Armor constants, headers are optional.
+// The armor is complete only after Close is called; Close does not close out.
+func NewArmorWriter(out io.Writer, blockType string, headers map[string]string) (io.WriteCloser, error) {
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "-----BEGIN %s-----\n", blockType)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&header, "%s: %s\n", name, headers[name])
+	}
+	header.WriteByte('\n')
+	if _, err := out.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	lines := &lineWriter{out: out}
+	return &armorWriter{
+		out:       out,
+		blockType: blockType,
+		encoder:   base64.NewEncoder(base64.StdEncoding, lines),
+		lines:     lines,
+		crc:       crc24Init,
+	}, nil
+}
+
+func (w *armorWriter) Write(in []byte) (int, error) {
+	w.crc = crc24(w.crc, in)
+	return w.encoder.Write(in)
+}
+
+func (w *armorWriter) Close() error {
+	if err := w.encoder.Close(); err != nil {
+		return err
+	}
+	var trailer bytes.Buffer
+	if w.lines.column > 0 {
+		trailer.WriteByte('\n')
+	}
+	crc := []byte{byte(w.crc >> 16), byte(w.crc >> 8), byte(w.crc)}
+	fmt.Fprintf(&trailer, "=%s\n-----END %s-----\n", base64.StdEncoding.EncodeToString(crc), w.blockType)
+	_, err := w.out.Write(trailer.Bytes())
+	return err
+}
+
+// lineWriter breaks the base64 encoding into lines
+type lineWriter struct {
+	out    io.Writer
+	column int
+}
+
+func (w *lineWriter) Write(in []byte) (int, error) {
+	written := 0
+	for len(in) > 0 {
+		n := armorLine - w.column
+		if n > len(in) {
+			n = len(in)
+		}
+		if _, err := w.out.Write(in[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		in = in[n:]
+		if w.column += n; w.column == armorLine {
+			if _, err := w.out.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			w.column = 0
+		}
+	}
+	return written, nil
+}
+
+// ArmorReader decodes ASCII armored data.
+type ArmorReader struct {
+	// BlockType is the type from the armor header line, e.g. ArmorMessage
+	BlockType string
+	Headers   map[string]string
+	in        *bufio.Reader
+	// base64 characters carried over to the next line
+	pending []byte
+	buffer  []byte
+	crc     uint32
+	// checksum is the decoded checksum line (optional)
+	checksum []byte
+	err      error
+}
+
+var errArmor = errors.New("invalid OpenPGP armor")
+
+// NewArmorReader reads the armor header from the input, any text before the header line is skipped.
+// Reading returns an error instead of io.EOF if the armor checksum doesn't match.
+// Cleartext signed messages are not supported.
+func NewArmorReader(in io.Reader) (*ArmorReader, error) {
+	r := &ArmorReader{in: bufio.NewReader(in), Headers: map[string]string{}, crc: crc24Init}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "-----BEGIN ") && strings.HasSuffix(line, "-----") {
+			r.BlockType = line[len("-----BEGIN ") : len(line)-len("-----")]
+			break
+		}
+	}
+	if r.BlockType == "PGP SIGNED MESSAGE" {
+		return nil, errors.New("cleartext signed messages are not supported")
+	}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			return r, nil
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			// the blank line is missing, the line is data
+			r.err = r.decode(line)
+			return r, nil
+		}
+		r.Headers[line[:i]] = line[i+2:]
+	}
+}
+
+func (r *ArmorReader) readLine() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", unexpected(err)
+	}
+	return strings.TrimRight(line, " \t\r\n"), nil
+}
+
+func (r *ArmorReader) Read(out []byte) (int, error) {
+	for len(r.buffer) == 0 && r.err == nil {
+		line, err := r.readLine()
+		switch {
+		case err != nil:
+			r.err = err
+		case strings.HasPrefix(line, "-----END "):
+			r.err = r.end(line)
+		case strings.HasPrefix(line, "=") && len(line) == 5:
+			if r.checksum, err = base64.StdEncoding.DecodeString(line[1:]); err != nil {
+				r.err = errArmor
+			}
+		default:
+			r.err = r.decode(line)
+		}
+	}
+	n := copy(out, r.buffer)
+	r.buffer = r.buffer[n:]
+	if len(r.buffer) > 0 {
+		return n, nil
+	}
+	return n, r.err
+}
+
+// decode decodes the complete base64 quanta of the line
+func (r *ArmorReader) decode(line string) error {
+	r.pending = append(r.pending, line...)
+	size := len(r.pending) / 4 * 4
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(size))
+	n, err := base64.StdEncoding.Decode(decoded, r.pending[:size])
+	if err != nil {
+		return errArmor
+	}
+	r.pending = r.pending[:copy(r.pending, r.pending[size:])]
+	r.buffer = decoded[:n]
+	r.crc = crc24(r.crc, r.buffer)
+	return nil
+}
+
+// end checks the armor tail line and the checksum
+func (r *ArmorReader) end(line string) error {
+	if line != "-----END "+r.BlockType+"-----" || len(r.pending) > 0 {
+		return errArmor
+	}
+	if r.checksum != nil {
+		if len(r.checksum) != 3 || uint32(r.checksum[0])<<16|uint32(r.checksum[1])<<8|uint32(r.checksum[2]) != r.crc {
+			return errors.New("OpenPGP armor checksum mismatch")
+		}
+	}
+	return io.EOF
+}
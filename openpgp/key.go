@@ -0,0 +1,554 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"io"
+	"math/big"
+	"time"
+)
+
+// Key is an OpenPGP version 4 public key or subkey. The key creation time
+// is part of the key fingerprint, so it must be preserved along with the key material.
+type Key struct {
+	Algorithm PublicKeyAlgorithm
+	Created   time.Time
+	// Subkey is set for keys read from subkey packets
+	Subkey bool
+	// der is the X.509 SubjectPublicKeyInfo encoding of the key
+	der []byte
+	// curve of EC and EdDSA keys
+	curve *curve
+	// KDF parameters of ECDH keys
+	kdfHash, kekCipher byte
+	// size of the RSA modulus in bytes
+	size int
+	// body of the public key packet
+	body []byte
+}
+
+// NewKey creates an OpenPGP key from the public key for use with the algorithm.
+// RSA keys can be used with the RSA algorithm, EC keys with ECDH or ECDSA
+// and Ed25519 keys with EdDSA. ECDH keys use the KDF hash and key wrapping cipher
+// recommended for the curve by RFC 6637. Note that the fingerprint of the key
+// depends on the creation time.
+func NewKey(key okapi.PublicKey, algorithm PublicKeyAlgorithm, created time.Time) (*Key, error) {
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var public interface{}
+	if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		// a private key can be used as its public key
+		public = private.(interface{ Public() crypto.PublicKey }).Public()
+	} else if public, err = x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, err
+	}
+	body := []byte{4, 0, 0, 0, 0, byte(algorithm)}
+	binary.BigEndian.PutUint32(body[1:], uint32(created.Unix()))
+	k := &Key{Algorithm: algorithm, Created: time.Unix(created.Unix(), 0)}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if algorithm != RSA {
+			return nil, fmt.Errorf("RSA key cannot be used with %v", algorithm)
+		}
+		body = appendMPI(body, public.N.Bytes())
+		body = appendMPI(body, big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if algorithm != ECDH && algorithm != ECDSA {
+			return nil, fmt.Errorf("EC key cannot be used with %v", algorithm)
+		}
+		if k.curve, err = curveByName(public.Curve.Params().Name); err != nil {
+			return nil, err
+		}
+		point, err := public.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		body = append(append(body, byte(len(k.curve.oid))), k.curve.oid...)
+		body = appendMPI(body, point.Bytes())
+		if algorithm == ECDH {
+			k.kdfHash, k.kekCipher = k.curve.kdfHash, k.curve.kekCipher
+			body = append(body, 3, 1, k.kdfHash, k.kekCipher)
+		}
+	case ed25519.PublicKey:
+		if algorithm != EdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %v", algorithm)
+		}
+		k.curve, _ = curveByName("Ed25519")
+		body = append(append(body, byte(len(k.curve.oid))), k.curve.oid...)
+		body = appendMPI(body, append([]byte{0x40}, public...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	parsed, _, err := parseKey(body)
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// parseKey parses the public part of a key packet body and returns the rest of the body.
+func parseKey(body []byte) (*Key, []byte, error) {
+	if len(body) < 6 {
+		return nil, nil, errTruncated
+	}
+	if body[0] != 4 {
+		return nil, nil, fmt.Errorf("unsupported key version %d", body[0])
+	}
+	k := &Key{
+		Algorithm: PublicKeyAlgorithm(body[5]),
+		Created:   time.Unix(int64(binary.BigEndian.Uint32(body[1:5])), 0),
+	}
+	rest := body[6:]
+	var public interface{}
+	var err error
+	switch k.Algorithm {
+	case RSA:
+		var n, e []byte
+		if n, rest, err = readMPI(rest); err != nil {
+			return nil, nil, err
+		}
+		if e, rest, err = readMPI(rest); err != nil {
+			return nil, nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, nil, errors.New("invalid RSA key")
+		}
+		public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		k.size = len(n)
+	case ECDH, ECDSA, EdDSA:
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return nil, nil, errTruncated
+		}
+		if k.curve, err = curveByOID(rest[1 : 1+rest[0]]); err != nil {
+			return nil, nil, err
+		}
+		if (k.Algorithm == EdDSA) != (k.curve.name == "Ed25519") {
+			return nil, nil, fmt.Errorf("curve %s cannot be used with %v", k.curve.name, k.Algorithm)
+		}
+		var point []byte
+		if point, rest, err = readMPI(rest[1+rest[0]:]); err != nil {
+			return nil, nil, err
+		}
+		if k.Algorithm == EdDSA {
+			if len(point) != 1+ed25519.PublicKeySize || point[0] != 0x40 {
+				return nil, nil, errors.New("invalid EdDSA key")
+			}
+			public = ed25519.PublicKey(point[1:])
+		} else if public, err = k.curve.ecdh().NewPublicKey(point); err != nil {
+			return nil, nil, err
+		}
+		if k.Algorithm == ECDH {
+			if len(rest) < 4 || rest[0] != 3 || rest[1] != 1 {
+				return nil, nil, errors.New("invalid ECDH KDF parameters")
+			}
+			k.kdfHash, k.kekCipher, rest = rest[2], rest[3], rest[4:]
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported public key algorithm %v", k.Algorithm)
+	}
+	if k.der, err = x509.MarshalPKIXPublicKey(public); err != nil {
+		return nil, nil, err
+	}
+	k.body = append([]byte(nil), body[:len(body)-len(rest)]...)
+	return k, rest, nil
+}
+
+func (c *curve) ecdh() ecdh.Curve {
+	switch c.name {
+	case "P-256":
+		return ecdh.P256()
+	case "P-384":
+		return ecdh.P384()
+	case "P-521":
+		return ecdh.P521()
+	}
+	return nil
+}
+
+// Fingerprint returns the version 4 fingerprint of the key (SHA1 digest of the key packet).
+func (k *Key) Fingerprint() []byte {
+	hash := okapi.SHA1.New()
+	defer hash.Close()
+	hash.Write([]byte{0x99, byte(len(k.body) >> 8), byte(len(k.body))})
+	hash.Write(k.body)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+// KeyID returns the key ID, i.e. the low 64 bits of the fingerprint.
+func (k *Key) KeyID() uint64 {
+	return binary.BigEndian.Uint64(k.Fingerprint()[12:])
+}
+
+// Export encodes the key as X.509 SubjectPublicKeyInfo in DER format,
+// it can be imported using the KeyConstructor for the intended use.
+func (k *Key) Export() ([]byte, error) {
+	return append([]byte(nil), k.der...), nil
+}
+
+// publicKey creates the public key with the constructor
+func (k *Key) publicKey(constructor okapi.KeyConstructor) (okapi.PublicKey, error) {
+	if constructor == nil {
+		return nil, fmt.Errorf("%v key algorithm is not available", k.Algorithm)
+	}
+	key, err := constructor(k.der)
+	if err != nil {
+		return nil, err
+	}
+	// the key holds only the public key, so it is its own PublicKey
+	return key.PublicKey(), nil
+}
+
+// ReadKeys reads all supported public keys and subkeys from an OpenPGP key block (binary, not armored).
+// Keys with unsupported versions or algorithms are skipped. The public parts of secret keys are read as well.
+// Note that user IDs and signatures, including subkey binding signatures, are not verified.
+func ReadKeys(in io.Reader) ([]*Key, error) {
+	var keys []*Key
+	err := readKeyPackets(in, func(tag byte, body []byte) error {
+		key, _, err := parseKey(body)
+		if err != nil {
+			return nil
+		}
+		key.Subkey = tag == tagPublicSub || tag == tagSecretSub
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no supported OpenPGP keys found")
+	}
+	return keys, nil
+}
+
+func readKeyPackets(in io.Reader, process func(tag byte, body []byte) error) error {
+	r := bufio.NewReader(in)
+	for {
+		tag, body, err := readPacket(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case tagPublicKey, tagPublicSub, tagSecretKey, tagSecretSub:
+			b, err := readBody(body)
+			if err != nil {
+				return err
+			}
+			err = process(tag, b)
+			okapi.Zero(b)
+			if err != nil {
+				return err
+			}
+		default:
+			if _, err = io.Copy(io.Discard, body); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PrivateKey is an OpenPGP key along with the corresponding okapi private key.
+type PrivateKey struct {
+	*Key
+	// Private must be configured for the intended use, e.g. created with okapi.RSA
+	// for RSA decryption, okapi.RSA_SHA256 for RSA signatures with SHA256,
+	// okapi.ECDH for ECDH decryption, okapi.ECDSA_SHA256 for ECDSA signatures
+	// with SHA256 or okapi.Ed25519 for EdDSA signatures.
+	Private okapi.PrivateKey
+}
+
+var errStub = errors.New("secret key stub")
+
+// ReadPrivateKeys reads the secret keys and subkeys from an OpenPGP key block (binary, not armored).
+// Protected keys are decrypted with the passphrase. Keys with unsupported versions or algorithms
+// and secret key stubs (e.g. of offline primary keys) are skipped.
+// The constructor function returns the KeyConstructor that configures the okapi key
+// for its intended use (see PrivateKey), the key is skipped if it returns nil.
+// If constructor is nil, RSA keys are configured with okapi.RSA, ECDH keys with okapi.ECDH,
+// ECDSA keys with okapi.ECDSA_SHA256 and EdDSA keys with okapi.Ed25519.
+func ReadPrivateKeys(in io.Reader, passphrase []byte, constructor func(key *Key) okapi.KeyConstructor) ([]*PrivateKey, error) {
+	if constructor == nil {
+		constructor = defaultConstructor
+	}
+	var keys []*PrivateKey
+	err := readKeyPackets(in, func(tag byte, body []byte) error {
+		if tag != tagSecretKey && tag != tagSecretSub {
+			return nil
+		}
+		key, rest, err := parseKey(body)
+		if err != nil {
+			return nil
+		}
+		key.Subkey = tag == tagSecretSub
+		kc := constructor(key)
+		if kc == nil {
+			return nil
+		}
+		der, err := secretKey(key, rest, passphrase)
+		if err == errStub {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer okapi.Zero(der)
+		private, err := kc(der)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, &PrivateKey{Key: key, Private: private})
+		return nil
+	})
+	if err != nil {
+		for _, key := range keys {
+			key.Private.Close()
+		}
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no supported OpenPGP secret keys found")
+	}
+	return keys, nil
+}
+
+func defaultConstructor(key *Key) okapi.KeyConstructor {
+	switch key.Algorithm {
+	case RSA:
+		return okapi.RSA
+	case ECDH:
+		return okapi.ECDH
+	case ECDSA:
+		return okapi.ECDSA_SHA256
+	case EdDSA:
+		return okapi.Ed25519
+	}
+	return nil
+}
+
+// secretKey decrypts the secret key material and returns it encoded as PKCS#8
+func secretKey(key *Key, body, passphrase []byte) ([]byte, error) {
+	if len(body) < 1 {
+		return nil, errTruncated
+	}
+	usage, body := body[0], body[1:]
+	var secret []byte
+	switch usage {
+	case 0:
+		if len(body) < 2 {
+			return nil, errTruncated
+		}
+		secret = append([]byte(nil), body[:len(body)-2]...)
+		var sum uint16
+		for _, b := range secret {
+			sum += uint16(b)
+		}
+		if sum != binary.BigEndian.Uint16(body[len(body)-2:]) {
+			okapi.Zero(secret)
+			return nil, errors.New("invalid secret key checksum")
+		}
+	case 254, 255:
+		if len(body) < 1 {
+			return nil, errTruncated
+		}
+		cipher, err := cipherByID(body[0])
+		if err != nil {
+			return nil, err
+		}
+		s2k, body, err := parseS2K(body[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < blockSize {
+			return nil, errTruncated
+		}
+		kek, err := s2k.derive(passphrase, cipher.keySize)
+		if err != nil {
+			return nil, err
+		}
+		secret = crypt(kek, body[:blockSize], body[blockSize:], false)
+		okapi.Zero(kek)
+		if secret, err = checkSecret(secret, usage == 254); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported secret key protection %d", usage)
+	}
+	defer okapi.Zero(secret)
+	private, err := key.parseSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(private)
+}
+
+// checkSecret verifies and strips the SHA1 hash or the checksum of decrypted secret key material
+func checkSecret(secret []byte, sha1 bool) ([]byte, error) {
+	if sha1 {
+		if len(secret) < 20 {
+			return nil, errTruncated
+		}
+		hash := okapi.SHA1.New()
+		defer hash.Close()
+		hash.Write(secret[:len(secret)-20])
+		if subtle.ConstantTimeCompare(hash.Digest(), secret[len(secret)-20:]) != 1 {
+			okapi.Zero(secret)
+			return nil, errors.New("wrong passphrase or corrupted secret key")
+		}
+		return secret[:len(secret)-20], nil
+	}
+	if len(secret) < 2 {
+		return nil, errTruncated
+	}
+	var sum uint16
+	for _, b := range secret[:len(secret)-2] {
+		sum += uint16(b)
+	}
+	if sum != binary.BigEndian.Uint16(secret[len(secret)-2:]) {
+		okapi.Zero(secret)
+		return nil, errors.New("wrong passphrase or corrupted secret key")
+	}
+	return secret[:len(secret)-2], nil
+}
+
+// parseSecret converts the secret key material to the corresponding crypto package private key
+func (k *Key) parseSecret(secret []byte) (interface{}, error) {
+	public, err := x509.ParsePKIXPublicKey(k.der)
+	if err != nil {
+		return nil, err
+	}
+	d, rest, err := readMPI(secret)
+	if err != nil {
+		return nil, err
+	}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		var p, q []byte
+		if p, rest, err = readMPI(rest); err != nil {
+			return nil, err
+		}
+		if q, _, err = readMPI(rest); err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: *public,
+			D:         new(big.Int).SetBytes(d),
+			Primes:    []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+		}
+		if err = key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		key, err := k.curve.ecdh().NewPrivateKey(leftPad(d, k.curve.byteSize()))
+		if err != nil {
+			return nil, err
+		}
+		if point, _ := public.ECDH(); point == nil || !bytes.Equal(point.Bytes(), key.PublicKey().Bytes()) {
+			return nil, errors.New("secret key doesn't match the public key")
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		if len(d) > ed25519.SeedSize {
+			return nil, errors.New("invalid EdDSA secret key")
+		}
+		key := ed25519.NewKeyFromSeed(leftPad(d, ed25519.SeedSize))
+		if !public.Equal(key.Public()) {
+			return nil, errors.New("secret key doesn't match the public key")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// s2k is a string-to-key specifier
+type s2k struct {
+	mode  byte
+	hash  *hashAlgorithm
+	salt  []byte
+	count int
+}
+
+func parseS2K(body []byte) (*s2k, []byte, error) {
+	if len(body) < 2 {
+		return nil, nil, errTruncated
+	}
+	if body[0] == 101 {
+		// GnuPG extension for secret key stubs
+		return nil, nil, errStub
+	}
+	hash, err := hashByID(body[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &s2k{mode: body[0], hash: hash}
+	switch s.mode {
+	case 0:
+		return s, body[2:], nil
+	case 1, 3:
+		if len(body) < 10 || (s.mode == 3 && len(body) < 11) {
+			return nil, nil, errTruncated
+		}
+		s.salt = body[2:10]
+		if s.mode == 1 {
+			return s, body[10:], nil
+		}
+		c := int(body[10])
+		s.count = (16 + c&15) << (uint(c>>4) + 6)
+		return s, body[11:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported S2K mode %d", s.mode)
+}
+
+// derive derives a key of the size from the passphrase
+func (s *s2k) derive(passphrase []byte, size int) ([]byte, error) {
+	hash := s.hash.new()
+	defer hash.Close()
+	input := append(append([]byte(nil), s.salt...), passphrase...)
+	defer okapi.Zero(input)
+	count := len(input)
+	if s.count > count {
+		count = s.count
+	}
+	var key []byte
+	for preload := 0; len(key) < size; preload++ {
+		hash.Reset()
+		hash.Write(make([]byte, preload))
+		for left := count; left > 0; left -= len(input) {
+			if left < len(input) {
+				hash.Write(input[:left])
+				break
+			}
+			hash.Write(input)
+		}
+		key = append(key, hash.Digest()...)
+	}
+	return key[:size], nil
+}
+
+// crypt processes the input with AES_CFB
+func crypt(key, iv, in []byte, encrypt bool) []byte {
+	c := okapi.AES_CFB.New(key, iv, encrypt)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out
+}
@@ -0,0 +1,261 @@
+// Package openpgp implements the OpenPGP message format (RFC 4880, RFC 9580) using okapi keys,
+// hashes and ciphers, so that it works with any imported implementation.
+//
+// Supported are version 4 keys (RSA, ECDH and ECDSA over NIST curves, EdDSA with Ed25519),
+// public key encrypted session keys (version 3), symmetrically encrypted integrity protected data
+// (version 1), literal data, compressed data (reading only), one-pass signature and signature
+// (version 4) packets, and ASCII armor. Messages are streamed through io.Reader and io.Writer.
+// Key packets are read without verifying user IDs, self-signatures or key flags.
+package openpgp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+	"time"
+)
+
+// packet tags
+const (
+	tagPKESK       = 1
+	tagSignature   = 2
+	tagSKESK       = 3
+	tagOnePass     = 4
+	tagSecretKey   = 5
+	tagPublicKey   = 6
+	tagSecretSub   = 7
+	tagCompressed  = 8
+	tagSED         = 9
+	tagMarker      = 10
+	tagLiteral     = 11
+	tagUserID      = 13
+	tagPublicSub   = 14
+	tagSEIPD       = 18
+	tagMDC         = 19
+	tagPaddingData = 21
+)
+
+// PublicKeyAlgorithm identifies the OpenPGP public key algorithm of a Key.
+type PublicKeyAlgorithm byte
+
+const (
+	RSA   PublicKeyAlgorithm = 1
+	ECDH  PublicKeyAlgorithm = 18
+	ECDSA PublicKeyAlgorithm = 19
+	EdDSA PublicKeyAlgorithm = 22
+)
+
+func (a PublicKeyAlgorithm) String() string {
+	switch a {
+	case RSA:
+		return "RSA"
+	case ECDH:
+		return "ECDH"
+	case ECDSA:
+		return "ECDSA"
+	case EdDSA:
+		return "EdDSA"
+	}
+	return fmt.Sprintf("PublicKeyAlgorithm(%d)", byte(a))
+}
+
+// Config configures message creation, zero values select the defaults.
+type Config struct {
+	// Cipher is the name of the message encryption cipher:
+	// AES128, AES192 or AES256 (default).
+	Cipher string
+	// Hash is the name of the predefined HashSpec variable used for signatures:
+	// SHA1, SHA224, SHA256 (default), SHA384 or SHA512.
+	// The signing key must be configured for signing with the Hash,
+	// e.g. created with okapi.RSA_SHA256 or okapi.ECDSA_SHA256 for SHA256.
+	Hash string
+	// FileName is recorded in the literal data packet.
+	FileName string
+	// Time is recorded in the literal data and signature packets (default is the current time).
+	Time time.Time
+}
+
+func (c *Config) cipher() (*cipherAlgorithm, error) {
+	if c == nil || c.Cipher == "" {
+		return cipherByName("AES256")
+	}
+	return cipherByName(c.Cipher)
+}
+
+func (c *Config) hash() (*hashAlgorithm, error) {
+	if c == nil || c.Hash == "" {
+		return hashByName("SHA256")
+	}
+	return hashByName(c.Hash)
+}
+
+func (c *Config) fileName() string {
+	if c == nil {
+		return ""
+	}
+	return c.FileName
+}
+
+func (c *Config) time() time.Time {
+	if c == nil || c.Time.IsZero() {
+		return time.Now()
+	}
+	return c.Time
+}
+
+// hashAlgorithm maps an OpenPGP hash algorithm to the predefined HashSpec
+// and the key constructors for signature verification.
+type hashAlgorithm struct {
+	id    byte
+	name  string
+	spec  *okapi.HashSpec
+	rsa   *okapi.KeyConstructor
+	ecdsa *okapi.KeyConstructor
+}
+
+var hashAlgorithms = []hashAlgorithm{
+	{2, "SHA1", &okapi.SHA1, &okapi.RSA_SHA1, &okapi.ECDSA_SHA1},
+	{8, "SHA256", &okapi.SHA256, &okapi.RSA_SHA256, &okapi.ECDSA_SHA256},
+	{9, "SHA384", &okapi.SHA384, &okapi.RSA_SHA384, &okapi.ECDSA_384},
+	{10, "SHA512", &okapi.SHA512, &okapi.RSA_SHA512, &okapi.ECDSA_SHA512},
+	{11, "SHA224", &okapi.SHA224, &okapi.RSA_SHA224, &okapi.ECDSA_224},
+}
+
+func hashByName(name string) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; h.name == name && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash %s", name)
+}
+
+func hashByID(id byte) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; h.id == id && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %d", id)
+}
+
+func (h *hashAlgorithm) new() okapi.Hash {
+	return (*h.spec).New()
+}
+
+// cipherAlgorithm maps an OpenPGP symmetric algorithm to the key size of AES_CFB.
+type cipherAlgorithm struct {
+	id      byte
+	name    string
+	keySize int
+}
+
+const blockSize = 16
+
+var cipherAlgorithms = []cipherAlgorithm{
+	{7, "AES128", 16},
+	{8, "AES192", 24},
+	{9, "AES256", 32},
+}
+
+func cipherByName(name string) (*cipherAlgorithm, error) {
+	for i := range cipherAlgorithms {
+		if c := &cipherAlgorithms[i]; c.name == name && okapi.AES_CFB != nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported cipher %s", name)
+}
+
+func cipherByID(id byte) (*cipherAlgorithm, error) {
+	for i := range cipherAlgorithms {
+		if c := &cipherAlgorithms[i]; c.id == id && okapi.AES_CFB != nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported cipher algorithm %d", id)
+}
+
+// curve describes the supported elliptic curves,
+// ECDH keys use the recommended KDF hash and key wrapping cipher by default (RFC 6637).
+type curve struct {
+	name      string
+	oid       []byte
+	size      int
+	kdfHash   byte
+	kekCipher byte
+}
+
+var curves = []curve{
+	{"P-256", []byte{0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}, 256, 8, 7},
+	{"P-384", []byte{0x2b, 0x81, 0x04, 0x00, 0x22}, 384, 9, 8},
+	{"P-521", []byte{0x2b, 0x81, 0x04, 0x00, 0x23}, 521, 10, 9},
+	{"Ed25519", []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}, 256, 0, 0},
+}
+
+func curveByOID(oid []byte) (*curve, error) {
+	for i := range curves {
+		if c := &curves[i]; string(c.oid) == string(oid) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported curve %x", oid)
+}
+
+func curveByName(name string) (*curve, error) {
+	for i := range curves {
+		if c := &curves[i]; c.name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported curve %s", name)
+}
+
+// byteSize is the size of the curve field elements in bytes
+func (c *curve) byteSize() int {
+	return (c.size + 7) / 8
+}
+
+// helpers
+
+// appendMPI appends the multiprecision integer encoding of the big-endian unsigned integer
+func appendMPI(out, b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	bits := new(big.Int).SetBytes(b).BitLen()
+	return append(append(out, byte(bits>>8), byte(bits)), b...)
+}
+
+var errTruncated = errors.New("truncated OpenPGP packet")
+
+// readMPI reads a multiprecision integer from the packet body and returns its value and the rest of the body
+func readMPI(body []byte) (mpi, rest []byte, err error) {
+	if len(body) < 2 {
+		return nil, nil, errTruncated
+	}
+	size := (int(body[0])<<8 | int(body[1]) + 7) / 8
+	if len(body) < 2+size {
+		return nil, nil, errTruncated
+	}
+	return body[2 : 2+size], body[2+size:], nil
+}
+
+// leftPad pads the big-endian integer with leading zeros to the size
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func random(size int) ([]byte, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	b := make([]byte, size)
+	if _, err := random.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
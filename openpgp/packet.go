@@ -0,0 +1,196 @@
+package openpgp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxPacketSize limits the size of packets that are read into memory (keys, signatures, etc.)
+const maxPacketSize = 1 << 20
+
+// partialChunk is the size of the partial body chunks written by the streaming packets
+const partialChunk = 1 << 13
+
+// readPacket reads the packet header and returns the packet tag and a reader of the packet body.
+// The body must be read completely before reading the next packet. It returns io.EOF
+// if there are no more packets.
+func readPacket(in *bufio.Reader) (tag byte, body io.Reader, err error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	if b&0x80 == 0 {
+		return 0, nil, errors.New("invalid OpenPGP packet header")
+	}
+	if b&0x40 != 0 {
+		// new format
+		tag = b & 0x3f
+		length, partial, err := readLength(in)
+		if err != nil {
+			return 0, nil, err
+		}
+		return tag, &partialReader{in: in, remaining: length, partial: partial}, nil
+	}
+	// old format
+	tag = (b >> 2) & 0x0f
+	var size int
+	switch b & 3 {
+	case 0:
+		size = 1
+	case 1:
+		size = 2
+	case 2:
+		size = 4
+	case 3:
+		// indeterminate length, the packet extends to the end of the input
+		return tag, in, nil
+	}
+	var length int64
+	for i := 0; i < size; i++ {
+		if b, err = in.ReadByte(); err != nil {
+			return 0, nil, unexpected(err)
+		}
+		length = length<<8 | int64(b)
+	}
+	return tag, io.LimitReader(in, length), nil
+}
+
+// readLength reads a new format body length
+func readLength(in *bufio.Reader) (length int64, partial bool, err error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return 0, false, unexpected(err)
+	}
+	switch {
+	case b < 192:
+		return int64(b), false, nil
+	case b < 224:
+		b2, err := in.ReadByte()
+		if err != nil {
+			return 0, false, unexpected(err)
+		}
+		return (int64(b)-192)<<8 + int64(b2) + 192, false, nil
+	case b < 255:
+		return 1 << (b & 0x1f), true, nil
+	}
+	var buf [4]byte
+	if _, err = io.ReadFull(in, buf[:]); err != nil {
+		return 0, false, unexpected(err)
+	}
+	return int64(binary.BigEndian.Uint32(buf[:])), false, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// partialReader reads a new format packet body, possibly split into partial body chunks.
+type partialReader struct {
+	in        *bufio.Reader
+	remaining int64
+	partial   bool
+}
+
+func (r *partialReader) Read(out []byte) (int, error) {
+	for r.remaining == 0 {
+		if !r.partial {
+			return 0, io.EOF
+		}
+		var err error
+		if r.remaining, r.partial, err = readLength(r.in); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(out)) > r.remaining {
+		out = out[:r.remaining]
+	}
+	n, err := r.in.Read(out)
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readBody reads the whole body of a packet that is processed in memory
+func readBody(body io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(body, maxPacketSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxPacketSize {
+		return nil, errors.New("OpenPGP packet is too large")
+	}
+	return b, nil
+}
+
+// appendLength appends a new format definite body length
+func appendLength(out []byte, length int) []byte {
+	switch {
+	case length < 192:
+		return append(out, byte(length))
+	case length < 8384:
+		length -= 192
+		return append(out, byte(length>>8)+192, byte(length))
+	}
+	return binary.BigEndian.AppendUint32(append(out, 255), uint32(length))
+}
+
+// writePacket writes a new format packet with definite length
+func writePacket(out io.Writer, tag byte, body []byte) error {
+	header := appendLength([]byte{0xc0 | tag}, len(body))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	_, err := out.Write(body)
+	return err
+}
+
+// partialWriter writes a new format packet of unknown length using partial body chunks,
+// the final chunk is written when it is closed.
+type partialWriter struct {
+	out    io.Writer
+	buffer []byte
+}
+
+func newPartialWriter(out io.Writer, tag byte) (*partialWriter, error) {
+	if _, err := out.Write([]byte{0xc0 | tag}); err != nil {
+		return nil, err
+	}
+	return &partialWriter{out: out, buffer: make([]byte, 0, partialChunk)}, nil
+}
+
+func (w *partialWriter) Write(in []byte) (int, error) {
+	written := 0
+	for len(in) > 0 {
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], in)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		in = in[n:]
+		written += n
+		if len(w.buffer) == cap(w.buffer) {
+			// 0xe0 | 13 is the partial length of 2^13 bytes
+			if _, err := w.out.Write([]byte{0xe0 | 13}); err != nil {
+				return written, err
+			}
+			if _, err := w.out.Write(w.buffer); err != nil {
+				return written, err
+			}
+			w.buffer = w.buffer[:0]
+		}
+	}
+	return written, nil
+}
+
+func (w *partialWriter) Close() error {
+	if _, err := w.out.Write(appendLength(nil, len(w.buffer))); err != nil {
+		return err
+	}
+	_, err := w.out.Write(w.buffer)
+	w.buffer = w.buffer[:0]
+	return err
+}
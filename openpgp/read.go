@@ -0,0 +1,489 @@
+package openpgp
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"io"
+	"time"
+)
+
+// Message is an OpenPGP message being read.
+type Message struct {
+	// FileName and Time are recorded in the literal data packet
+	FileName string
+	Time     time.Time
+	// Encrypted is set if the message was decrypted with one of the decryption keys
+	Encrypted bool
+	// SignedBy is the verification key that signed the message,
+	// it is set only after the Body was read until io.EOF.
+	SignedBy *Key
+	// Body reads the literal data of the message. It returns an error instead of io.EOF
+	// if the integrity protection or the signature check fails, so the data must not be trusted
+	// until io.EOF is reached. The Body must be read until io.EOF or an error
+	// to release the resources associated with the message.
+	Body io.Reader
+}
+
+// maxLayers limits the nesting of encrypted and compressed packets
+const maxLayers = 8
+
+// Read starts reading the OpenPGP message (binary, use NewArmorReader for ASCII armor).
+// An encrypted message must be encrypted to one of the decryption keys, which must be configured
+// for decryption, i.e. created with okapi.RSA or okapi.ECDH. If verificationKeys is not nil,
+// the message must be signed by one of them, otherwise signatures are ignored.
+func Read(in io.Reader, decryptionKeys []*PrivateKey, verificationKeys []*Key) (*Message, error) {
+	r := &reader{
+		layers:           []layer{{packets: bufio.NewReader(in)}},
+		decryptionKeys:   decryptionKeys,
+		verificationKeys: verificationKeys,
+	}
+	r.message.Body = r
+	if err := r.readLiteral(); err != nil {
+		r.close()
+		return nil, err
+	}
+	return &r.message, nil
+}
+
+// layer is a sequence of packets, either the message itself or the contents of an encrypted or compressed packet
+type layer struct {
+	packets *bufio.Reader
+	// body of the packet that the layer was read from
+	body io.Reader
+}
+
+type reader struct {
+	message          Message
+	layers           []layer
+	literal          io.Reader
+	decryptionKeys   []*PrivateKey
+	verificationKeys []*Key
+	sessionKey       []byte
+	// signatures in the order of the one-pass signature and prepended signature packets
+	signatures []*pendingSignature
+	writers    []io.Writer
+	closers    []io.Closer
+	err        error
+}
+
+// pendingSignature hashes the literal data for a signature,
+// the signature of a one-pass signature packet follows the literal data.
+type pendingSignature struct {
+	algorithm *hashAlgorithm
+	hash      okapi.Hash
+	sig       *signature
+}
+
+// readLiteral processes the packets preceding the literal data
+func (r *reader) readLiteral() error {
+	for {
+		top := len(r.layers) == 1
+		tag, body, err := readPacket(r.layers[len(r.layers)-1].packets)
+		if err == io.EOF {
+			return errors.New("OpenPGP message has no literal data")
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case tag == tagPKESK && top:
+			b, err := readBody(body)
+			if err != nil {
+				return err
+			}
+			if r.sessionKey == nil {
+				r.sessionKey = r.decryptSessionKey(b)
+			}
+		case tag == tagSEIPD && top:
+			if r.sessionKey == nil {
+				return errors.New("OpenPGP message is not encrypted to any of the decryption keys")
+			}
+			if err = r.decrypt(body); err != nil {
+				return err
+			}
+		case tag == tagCompressed:
+			if err = r.decompress(body); err != nil {
+				return err
+			}
+		case tag == tagOnePass:
+			b, err := readBody(body)
+			if err != nil {
+				return err
+			}
+			if len(b) != 13 || b[0] != 3 {
+				return errors.New("invalid one-pass signature packet")
+			}
+			hash, _ := hashByID(b[2])
+			r.addSignature(hash, b[1], nil)
+		case tag == tagSignature:
+			sig, err := readSignature(body)
+			if err != nil {
+				return err
+			}
+			if sig != nil {
+				r.addSignature(sig.hash, sig.sigType, sig)
+			}
+		case tag == tagLiteral:
+			return r.readLiteralHeader(body)
+		case tag == tagSKESK || tag == tagMarker || tag == tagPaddingData:
+			if _, err = io.Copy(io.Discard, body); err != nil {
+				return err
+			}
+		case tag == tagSED:
+			return errors.New("OpenPGP data without integrity protection is not supported")
+		default:
+			return fmt.Errorf("unexpected OpenPGP packet %d", tag)
+		}
+	}
+}
+
+func (r *reader) push(packets io.Reader, body io.Reader) error {
+	if len(r.layers) == maxLayers {
+		return errors.New("OpenPGP packets are nested too deep")
+	}
+	r.layers = append(r.layers, layer{packets: bufio.NewReader(packets), body: body})
+	return nil
+}
+
+// decryptSessionKey returns the session key if it was encrypted to one of the decryption keys
+func (r *reader) decryptSessionKey(body []byte) []byte {
+	if len(body) < 10 || body[0] != 3 {
+		return nil
+	}
+	id, algorithm := binary.BigEndian.Uint64(body[1:9]), PublicKeyAlgorithm(body[9])
+	for _, key := range r.decryptionKeys {
+		// key ID 0 is a wildcard for anonymous recipients
+		if key.Algorithm != algorithm || (id != 0 && id != key.KeyID()) {
+			continue
+		}
+		if sessionKey, err := key.decryptSessionKey(body[10:]); err == nil {
+			r.message.Encrypted = true
+			return sessionKey
+		}
+	}
+	return nil
+}
+
+// decryptSessionKey decrypts the algorithm specific part of the public key encrypted session key
+func (key *PrivateKey) decryptSessionKey(body []byte) ([]byte, error) {
+	encrypted, rest, err := readMPI(body)
+	if err != nil {
+		return nil, err
+	}
+	var m []byte
+	switch key.Algorithm {
+	case RSA:
+		if m, err = key.Private.Decrypt(leftPad(encrypted, key.size)); err != nil {
+			return nil, err
+		}
+	case ECDH:
+		if len(rest) < 1 || len(rest) != 1+int(rest[0]) {
+			return nil, errTruncated
+		}
+		point, err := key.curve.ecdh().NewPublicKey(encrypted)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKIXPublicKey(point)
+		if err != nil {
+			return nil, err
+		}
+		peer, err := (&Key{der: der}).publicKey(okapi.ECDH)
+		if err != nil {
+			return nil, err
+		}
+		defer peer.Close()
+		secret, err := key.Private.Derive(peer)
+		if err != nil {
+			return nil, err
+		}
+		defer okapi.Zero(secret)
+		kek, err := key.deriveKEK(secret)
+		if err != nil {
+			return nil, err
+		}
+		defer okapi.Zero(kek)
+		kw := okapi.AES_KW.New(kek)
+		defer kw.Close()
+		if m, err = kw.Unwrap(rest[1:]); err != nil {
+			return nil, err
+		}
+		// strip the PKCS#5 padding
+		if len(m) == 0 || int(m[len(m)-1]) > len(m) || m[len(m)-1] == 0 {
+			okapi.Zero(m)
+			return nil, errors.New("invalid session key padding")
+		}
+		m = m[:len(m)-int(m[len(m)-1])]
+	default:
+		return nil, fmt.Errorf("%v key cannot decrypt messages", key.Algorithm)
+	}
+	defer okapi.Zero(m)
+	if len(m) < 3 {
+		return nil, errors.New("invalid session key")
+	}
+	cipher, err := cipherByID(m[0])
+	if err != nil {
+		return nil, err
+	}
+	sessionKey := m[1 : len(m)-2]
+	var sum uint16
+	for _, b := range sessionKey {
+		sum += uint16(b)
+	}
+	if len(sessionKey) != cipher.keySize || sum != binary.BigEndian.Uint16(m[len(m)-2:]) {
+		return nil, errors.New("invalid session key")
+	}
+	return append([]byte(nil), sessionKey...), nil
+}
+
+// decrypt pushes the decrypted contents of the symmetrically encrypted integrity protected data packet
+func (r *reader) decrypt(body io.Reader) error {
+	var version [1]byte
+	if _, err := io.ReadFull(body, version[:]); err != nil {
+		return unexpected(err)
+	}
+	if version[0] != 1 {
+		return fmt.Errorf("unsupported encrypted data version %d", version[0])
+	}
+	decrypted := okapi.NewCipherReader(body, okapi.AES_CFB, r.sessionKey, make([]byte, blockSize), nil)
+	r.closers = append(r.closers, decrypted)
+	// The repeated bytes of the prefix allow a quick check of the session key,
+	// it is skipped on purpose (RFC 9580, section 5.13.2), the MDC check is authoritative.
+	prefix := make([]byte, blockSize+2)
+	if _, err := io.ReadFull(decrypted, prefix); err != nil {
+		return unexpected(err)
+	}
+	hash := okapi.SHA1.New()
+	r.closers = append(r.closers, hashCloser{hash})
+	hash.Write(prefix)
+	mdc := &mdcReader{in: decrypted, hash: hash, buffer: make([]byte, 0, okapi.DefaultBufferSize+mdcSize)}
+	return r.push(mdc, body)
+}
+
+// decompress pushes the contents of the compressed data packet
+func (r *reader) decompress(body io.Reader) error {
+	var algorithm [1]byte
+	if _, err := io.ReadFull(body, algorithm[:]); err != nil {
+		return unexpected(err)
+	}
+	var decompressed io.Reader
+	switch algorithm[0] {
+	case 0:
+		decompressed = body
+	case 1:
+		decompressed = flate.NewReader(body)
+	case 2:
+		zr, err := zlib.NewReader(body)
+		if err != nil {
+			return err
+		}
+		decompressed = zr
+	case 3:
+		decompressed = bzip2.NewReader(body)
+	default:
+		return fmt.Errorf("unsupported compression algorithm %d", algorithm[0])
+	}
+	return r.push(decompressed, body)
+}
+
+// readSignature parses a signature packet, unsupported signatures are returned as nil
+func readSignature(body io.Reader) (*signature, error) {
+	b, err := readBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if sig, err := parseSignature(b); err == nil {
+		return sig, nil
+	}
+	return nil, nil
+}
+
+// addSignature starts hashing the literal data for signature verification,
+// the hash is nil if the hash algorithm is not supported
+func (r *reader) addSignature(hash *hashAlgorithm, sigType byte, sig *signature) {
+	if r.verificationKeys == nil {
+		return
+	}
+	pending := &pendingSignature{algorithm: hash, sig: sig}
+	if hash != nil {
+		pending.hash = hash.new()
+		r.writers = append(r.writers, dataHash(pending.hash, sigType))
+	}
+	r.signatures = append(r.signatures, pending)
+}
+
+// setSignature matches a signature following the literal data with its one-pass signature packet,
+// they are nested, so the first signature matches the last one-pass signature packet.
+func (r *reader) setSignature(sig *signature) {
+	for i := len(r.signatures) - 1; i >= 0; i-- {
+		if pending := r.signatures[i]; pending.sig == nil {
+			pending.sig = sig
+			return
+		}
+	}
+}
+
+func (r *reader) readLiteralHeader(body io.Reader) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(body, header); err != nil {
+		return unexpected(err)
+	}
+	header = append(header, make([]byte, int(header[1])+4)...)
+	if _, err := io.ReadFull(body, header[2:]); err != nil {
+		return unexpected(err)
+	}
+	r.message.FileName = string(header[2 : 2+header[1]])
+	r.message.Time = time.Unix(int64(binary.BigEndian.Uint32(header[2+header[1]:])), 0)
+	r.literal = body
+	return nil
+}
+
+func (r *reader) Read(out []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.literal.Read(out)
+	for _, w := range r.writers {
+		w.Write(out[:n])
+	}
+	if err == io.EOF {
+		if err = r.finish(); err == nil {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		r.err = err
+		r.close()
+	}
+	return n, err
+}
+
+// finish processes the packets following the literal data and verifies the signatures
+func (r *reader) finish() error {
+	for i := len(r.layers) - 1; i >= 0; i-- {
+		for {
+			tag, body, err := readPacket(r.layers[i].packets)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			switch tag {
+			case tagSignature:
+				var sig *signature
+				if sig, err = readSignature(body); sig != nil {
+					r.setSignature(sig)
+				}
+			case tagMarker, tagPaddingData:
+				_, err = io.Copy(io.Discard, body)
+			default:
+				err = fmt.Errorf("unexpected OpenPGP packet %d", tag)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if r.layers[i].body != nil {
+			if _, err := io.Copy(io.Discard, r.layers[i].body); err != nil {
+				return err
+			}
+		}
+	}
+	if r.verificationKeys == nil {
+		return nil
+	}
+	var sigs []*signature
+	var hashes []okapi.Hash
+	for _, pending := range r.signatures {
+		// the signature must match the hash algorithm of its one-pass signature packet
+		if pending.sig != nil && pending.algorithm == pending.sig.hash {
+			sigs, hashes = append(sigs, pending.sig), append(hashes, pending.hash)
+		}
+	}
+	if len(sigs) == 0 {
+		return errors.New("OpenPGP message is not signed")
+	}
+	key, err := verifySignatures(sigs, hashes, r.verificationKeys)
+	if err != nil {
+		return err
+	}
+	r.message.SignedBy = key
+	return nil
+}
+
+func (r *reader) close() {
+	for _, c := range r.closers {
+		c.Close()
+	}
+	r.closers = nil
+	for _, pending := range r.signatures {
+		if pending.hash != nil {
+			pending.hash.Close()
+		}
+	}
+	r.signatures = nil
+	okapi.Zero(r.sessionKey)
+}
+
+type hashCloser struct {
+	hash okapi.Hash
+}
+
+func (c hashCloser) Close() error {
+	c.hash.Close()
+	return nil
+}
+
+var errMDC = errors.New("OpenPGP message integrity check failed")
+
+// mdcReader hashes the decrypted data and checks the modification detection code packet at the end,
+// which it holds back from the reader
+type mdcReader struct {
+	in     io.Reader
+	hash   okapi.Hash
+	buffer []byte
+	eof    bool
+	err    error
+}
+
+func (r *mdcReader) Read(out []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for !r.eof && len(r.buffer) <= mdcSize {
+		n, err := r.in.Read(r.buffer[len(r.buffer):cap(r.buffer)])
+		r.buffer = r.buffer[:len(r.buffer)+n]
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+	if len(r.buffer) > mdcSize {
+		n := copy(out, r.buffer[:len(r.buffer)-mdcSize])
+		r.hash.Write(out[:n])
+		r.buffer = r.buffer[:copy(r.buffer, r.buffer[n:])]
+		return n, nil
+	}
+	r.err = io.EOF
+	header := []byte{0xc0 | tagMDC, 20}
+	if len(r.buffer) != mdcSize || subtle.ConstantTimeCompare(r.buffer[:2], header) != 1 {
+		r.err = errMDC
+		return 0, r.err
+	}
+	r.hash.Write(header)
+	if subtle.ConstantTimeCompare(r.hash.Digest(), r.buffer[2:]) != 1 {
+		r.err = errMDC
+	}
+	return 0, r.err
+}
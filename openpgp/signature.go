@@ -0,0 +1,366 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"io"
+	"math/big"
+	"time"
+)
+
+// signature types
+const (
+	sigBinary = 0x00
+	sigText   = 0x01
+)
+
+// subpacket types
+const (
+	subCreated     = 2
+	subIssuer      = 16
+	subFingerprint = 33
+)
+
+// signature is a version 4 signature packet
+type signature struct {
+	sigType   byte
+	algorithm PublicKeyAlgorithm
+	hash      *hashAlgorithm
+	hashed    []byte
+	unhashed  []byte
+	// values are the algorithm specific signature MPIs
+	values []byte
+	// from the subpackets
+	created     time.Time
+	issuer      uint64
+	fingerprint []byte
+}
+
+func parseSignature(body []byte) (*signature, error) {
+	if len(body) < 6 {
+		return nil, errTruncated
+	}
+	if body[0] != 4 {
+		return nil, fmt.Errorf("unsupported signature version %d", body[0])
+	}
+	sig := &signature{sigType: body[1], algorithm: PublicKeyAlgorithm(body[2])}
+	if sig.sigType != sigBinary && sig.sigType != sigText {
+		return nil, fmt.Errorf("unexpected signature type %d", sig.sigType)
+	}
+	var err error
+	if sig.hash, err = hashByID(body[3]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(body[4:]))
+	if len(body) < 6+size+2 {
+		return nil, errTruncated
+	}
+	sig.hashed, body = body[6:6+size], body[6+size:]
+	size = int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+size+2 {
+		return nil, errTruncated
+	}
+	// skip the left 16 bits of the digest, the signature check is authoritative
+	sig.unhashed, sig.values = body[2:2+size], body[2+size+2:]
+	if err = sig.parseSubpackets(sig.hashed, true); err != nil {
+		return nil, err
+	}
+	if err = sig.parseSubpackets(sig.unhashed, false); err != nil {
+		return nil, err
+	}
+	if sig.created.IsZero() {
+		return nil, errors.New("signature is missing the creation time")
+	}
+	return sig, nil
+}
+
+// parseSubpackets extracts the creation time and the issuer,
+// unknown critical subpackets invalidate the signature (RFC 4880, section 5.2.3.1).
+func (sig *signature) parseSubpackets(area []byte, hashed bool) error {
+	for len(area) > 0 {
+		var length int
+		switch {
+		case area[0] < 192:
+			length, area = int(area[0]), area[1:]
+		case area[0] < 255:
+			if len(area) < 2 {
+				return errTruncated
+			}
+			length, area = (int(area[0])-192)<<8+int(area[1])+192, area[2:]
+		default:
+			if len(area) < 5 {
+				return errTruncated
+			}
+			length, area = int(binary.BigEndian.Uint32(area[1:])), area[5:]
+		}
+		if length < 1 || length > len(area) {
+			return errTruncated
+		}
+		sub, data := area[:length], area[1:length]
+		area = area[length:]
+		switch typ := sub[0] & 0x7f; {
+		case typ == subCreated && hashed && len(data) == 4:
+			sig.created = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+		case typ == subIssuer && len(data) == 8:
+			sig.issuer = binary.BigEndian.Uint64(data)
+		case typ == subFingerprint && len(data) == 21 && data[0] == 4:
+			sig.fingerprint = data[1:]
+		case sub[0]&0x80 != 0:
+			return fmt.Errorf("unsupported critical signature subpacket %d", typ)
+		}
+	}
+	return nil
+}
+
+// trailer returns the signature data hashed after the signed data
+func (sig *signature) trailer() []byte {
+	trailer := []byte{4, sig.sigType, byte(sig.algorithm), sig.hash.id}
+	trailer = binary.BigEndian.AppendUint16(trailer, uint16(len(sig.hashed)))
+	trailer = append(trailer, sig.hashed...)
+	return binary.BigEndian.AppendUint32(append(trailer, 4, 0xff), uint32(len(trailer)))
+}
+
+// matches returns whether the signature was presumably issued by the key
+func (sig *signature) matches(key *Key) bool {
+	if sig.algorithm != key.Algorithm {
+		return false
+	}
+	if sig.fingerprint != nil {
+		return bytes.Equal(sig.fingerprint, key.Fingerprint())
+	}
+	return sig.issuer == key.KeyID()
+}
+
+// verify checks the signature of the digest with the key
+func (sig *signature) verify(key *Key, digest []byte) error {
+	var constructor okapi.KeyConstructor
+	switch key.Algorithm {
+	case RSA:
+		constructor = *sig.hash.rsa
+	case ECDSA:
+		constructor = *sig.hash.ecdsa
+	case EdDSA:
+		constructor = okapi.Ed25519
+	default:
+		return fmt.Errorf("%v key cannot verify signatures", key.Algorithm)
+	}
+	public, err := key.publicKey(constructor)
+	if err != nil {
+		return err
+	}
+	defer public.Close()
+	first, rest, err := readMPI(sig.values)
+	if err != nil {
+		return err
+	}
+	var signature []byte
+	switch key.Algorithm {
+	case RSA:
+		signature = leftPad(first, key.size)
+	default:
+		second, _, err := readMPI(rest)
+		if err != nil {
+			return err
+		}
+		if key.Algorithm == EdDSA {
+			if len(first) > 32 || len(second) > 32 {
+				return errors.New("invalid EdDSA signature")
+			}
+			signature = append(leftPad(first, 32), leftPad(second, 32)...)
+		} else if signature, err = asn1.Marshal(ecdsaSignature{
+			new(big.Int).SetBytes(first), new(big.Int).SetBytes(second)}); err != nil {
+			return err
+		}
+	}
+	valid, err := public.Verify(signature, digest)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// dataHash returns the writer hashing the signed data, text signatures hash the data with CRLF line endings
+func dataHash(hash okapi.Hash, sigType byte) io.Writer {
+	if sigType == sigText {
+		return &textWriter{out: hash}
+	}
+	return hash
+}
+
+// textWriter converts line endings to CRLF
+type textWriter struct {
+	out io.Writer
+	cr  bool
+}
+
+func (w *textWriter) Write(in []byte) (int, error) {
+	var out []byte
+	for _, b := range in {
+		if b == '\n' && !w.cr {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		w.cr = b == '\r'
+	}
+	if _, err := w.out.Write(out); err != nil {
+		return 0, err
+	}
+	return len(in), nil
+}
+
+// signer hashes the signed data and creates a binary signature
+type signer struct {
+	key  *PrivateKey
+	hash okapi.Hash
+	sig  *signature
+}
+
+func newSigner(key *PrivateKey, config *Config) (*signer, error) {
+	if key.Algorithm != RSA && key.Algorithm != ECDSA && key.Algorithm != EdDSA {
+		return nil, fmt.Errorf("%v key cannot create signatures", key.Algorithm)
+	}
+	hash, err := config.hash()
+	if err != nil {
+		return nil, err
+	}
+	sig := &signature{sigType: sigBinary, algorithm: key.Algorithm, hash: hash, created: config.time()}
+	sig.hashed = binary.BigEndian.AppendUint32([]byte{5, subCreated}, uint32(sig.created.Unix()))
+	sig.hashed = append(append(sig.hashed, 22, subFingerprint, 4), key.Fingerprint()...)
+	sig.unhashed = binary.BigEndian.AppendUint64([]byte{9, subIssuer}, key.KeyID())
+	return &signer{key: key, hash: hash.new(), sig: sig}, nil
+}
+
+func (s *signer) Write(in []byte) (int, error) {
+	return s.hash.Write(in)
+}
+
+// onePass returns the body of the one-pass signature packet preceding the signed data
+func (s *signer) onePass() []byte {
+	body := []byte{3, s.sig.sigType, s.sig.hash.id, byte(s.sig.algorithm)}
+	return append(binary.BigEndian.AppendUint64(body, s.key.KeyID()), 1)
+}
+
+// finish returns the body of the signature packet
+func (s *signer) finish() ([]byte, error) {
+	defer s.hash.Close()
+	sig := s.sig
+	s.hash.Write(sig.trailer())
+	digest := s.hash.Digest()
+	signature, err := s.key.Private.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+	switch sig.algorithm {
+	case RSA:
+		sig.values = appendMPI(nil, signature)
+	case ECDSA:
+		var rs ecdsaSignature
+		if _, err = asn1.Unmarshal(signature, &rs); err != nil {
+			return nil, err
+		}
+		sig.values = appendMPI(appendMPI(nil, rs.R.Bytes()), rs.S.Bytes())
+	case EdDSA:
+		if len(signature) != 64 {
+			return nil, errors.New("invalid EdDSA signature")
+		}
+		sig.values = appendMPI(appendMPI(nil, signature[:32]), signature[32:])
+	}
+	body := []byte{4, sig.sigType, byte(sig.algorithm), sig.hash.id}
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(sig.hashed))), sig.hashed...)
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(sig.unhashed))), sig.unhashed...)
+	body = append(body, digest[:2]...)
+	return append(body, sig.values...), nil
+}
+
+// SignDetached writes a detached binary signature of the data to out (binary, not armored).
+// The signing key must be configured for signing with the Config.Hash.
+func SignDetached(out io.Writer, data io.Reader, key *PrivateKey, config *Config) error {
+	s, err := newSigner(key, config)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(s, data); err != nil {
+		s.hash.Close()
+		return err
+	}
+	body, err := s.finish()
+	if err != nil {
+		return err
+	}
+	return writePacket(out, tagSignature, body)
+}
+
+// VerifyDetached verifies the detached signature (binary, not armored) of the data
+// and returns the key that made the signature. At least one of the signatures must
+// be made by one of the keys, signatures by other keys are ignored.
+func VerifyDetached(detached, data io.Reader, keys []*Key) (*Key, error) {
+	var sigs []*signature
+	var hashes []okapi.Hash
+	var writers []io.Writer
+	defer func() {
+		for _, hash := range hashes {
+			hash.Close()
+		}
+	}()
+	in := bufio.NewReader(detached)
+	for {
+		tag, body, err := readPacket(in)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := readBody(body)
+		if err != nil {
+			return nil, err
+		}
+		if tag != tagSignature {
+			continue
+		}
+		sig, err := parseSignature(b)
+		if err != nil {
+			return nil, err
+		}
+		hash := sig.hash.new()
+		sigs, hashes = append(sigs, sig), append(hashes, hash)
+		writers = append(writers, dataHash(hash, sig.sigType))
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New("no signature found")
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), data); err != nil {
+		return nil, err
+	}
+	return verifySignatures(sigs, hashes, keys)
+}
+
+// verifySignatures returns the key of the first valid signature
+func verifySignatures(sigs []*signature, hashes []okapi.Hash, keys []*Key) (*Key, error) {
+	err := errors.New("no signature by the verification keys")
+	for i, sig := range sigs {
+		hashes[i].Write(sig.trailer())
+		digest := hashes[i].Digest()
+		for _, key := range keys {
+			if !sig.matches(key) {
+				continue
+			}
+			if err = sig.verify(key, digest); err == nil {
+				return key, nil
+			}
+		}
+	}
+	return nil, err
+}
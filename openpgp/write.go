@@ -0,0 +1,266 @@
+package openpgp
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"io"
+)
+
+// Encrypt returns a WriteCloser that encrypts the data written into it for the recipients
+// and writes the OpenPGP message to out (binary, use NewArmorWriter for ASCII armor).
+// The recipient keys must be RSA or ECDH (sub)keys. If signer is not nil, the message is also signed.
+// The message is complete only after Close is called; Close does not close out.
+func Encrypt(out io.Writer, recipients []*Key, signer *PrivateKey, config *Config) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	cipher, err := config.cipher()
+	if err != nil {
+		return nil, err
+	}
+	sessionKey, err := random(cipher.keySize)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(sessionKey)
+	for _, recipient := range recipients {
+		body, err := encryptSessionKey(recipient, cipher, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = writePacket(out, tagPKESK, body); err != nil {
+			return nil, err
+		}
+	}
+	seipd, err := newPartialWriter(out, tagSEIPD)
+	if err != nil {
+		return nil, err
+	}
+	// version 1
+	if _, err = seipd.Write([]byte{1}); err != nil {
+		return nil, err
+	}
+	// the CipherWriter closes the packet writer when closed
+	encrypted := okapi.NewCipherWriter(seipd, okapi.AES_CFB, sessionKey, make([]byte, blockSize), nil)
+	mdc := &mdcWriter{out: encrypted, hash: okapi.SHA1.New()}
+	prefix, err := random(blockSize + 2)
+	if err != nil {
+		return nil, err
+	}
+	copy(prefix[blockSize:], prefix[blockSize-2:blockSize])
+	if _, err = mdc.Write(prefix); err != nil {
+		return nil, err
+	}
+	return newMessageWriter(mdc, signer, config, mdc.Close)
+}
+
+// Sign returns a WriteCloser that signs the data written into it and writes the OpenPGP message to out
+// (binary, use NewArmorWriter for ASCII armor). The signing key must be configured for signing with the Config.Hash.
+// The message is complete only after Close is called; Close does not close out.
+func Sign(out io.Writer, signer *PrivateKey, config *Config) (io.WriteCloser, error) {
+	if signer == nil {
+		return nil, errors.New("no signer")
+	}
+	return newMessageWriter(out, signer, config, nil)
+}
+
+// encryptSessionKey returns the public key encrypted session key packet body
+func encryptSessionKey(key *Key, cipher *cipherAlgorithm, sessionKey []byte) ([]byte, error) {
+	m := append([]byte{cipher.id}, sessionKey...)
+	var sum uint16
+	for _, b := range sessionKey {
+		sum += uint16(b)
+	}
+	m = binary.BigEndian.AppendUint16(m, sum)
+	defer okapi.Zero(m)
+	body := binary.BigEndian.AppendUint64([]byte{3}, key.KeyID())
+	body = append(body, byte(key.Algorithm))
+	switch key.Algorithm {
+	case RSA:
+		public, err := key.publicKey(okapi.RSA)
+		if err != nil {
+			return nil, err
+		}
+		defer public.Close()
+		encrypted, err := public.Encrypt(m)
+		if err != nil {
+			return nil, err
+		}
+		return appendMPI(body, encrypted), nil
+	case ECDH:
+		if okapi.AES_KW == nil {
+			return nil, errors.New("ECDH requires AES_KW")
+		}
+		public, err := key.publicKey(okapi.ECDH)
+		if err != nil {
+			return nil, err
+		}
+		defer public.Close()
+		ephemeral, err := okapi.ECDH(public)
+		if err != nil {
+			return nil, err
+		}
+		defer ephemeral.Close()
+		point, err := ecPoint(ephemeral.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ephemeral.Derive(public)
+		if err != nil {
+			return nil, err
+		}
+		defer okapi.Zero(secret)
+		kek, err := key.deriveKEK(secret)
+		if err != nil {
+			return nil, err
+		}
+		defer okapi.Zero(kek)
+		// PKCS#5 padding to a multiple of 8 bytes (RFC 6637, section 8)
+		padding := 8 - len(m)%8
+		for i := 0; i < padding; i++ {
+			m = append(m, byte(padding))
+		}
+		kw := okapi.AES_KW.New(kek)
+		defer kw.Close()
+		wrapped, err := kw.Wrap(m)
+		if err != nil {
+			return nil, err
+		}
+		body = appendMPI(body, point)
+		return append(append(body, byte(len(wrapped))), wrapped...), nil
+	}
+	return nil, fmt.Errorf("%v key cannot encrypt messages", key.Algorithm)
+}
+
+// ecPoint returns the uncompressed encoding of the EC public key
+func ecPoint(key okapi.PublicKey) ([]byte, error) {
+	defer key.Close()
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := public.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("ECDH produced a non-EC key")
+	}
+	point, err := ec.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return point.Bytes(), nil
+}
+
+// deriveKEK derives the ECDH key wrapping key from the shared secret (RFC 6637, section 7)
+func (k *Key) deriveKEK(secret []byte) ([]byte, error) {
+	hash, err := hashByID(k.kdfHash)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := cipherByID(k.kekCipher)
+	if err != nil {
+		return nil, err
+	}
+	param := append([]byte{byte(len(k.curve.oid))}, k.curve.oid...)
+	param = append(param, byte(ECDH), 3, 1, k.kdfHash, k.kekCipher)
+	param = append(append(param, "Anonymous Sender    "...), k.Fingerprint()...)
+	kdf := okapi.ConcatKDF{Hash: *hash.spec, OtherInfo: param}
+	return kdf.Derive(secret, cipher.keySize)
+}
+
+const mdcSize = 22
+
+// mdcWriter writes the modification detection code packet when closed
+type mdcWriter struct {
+	out  *okapi.CipherWriter
+	hash okapi.Hash
+}
+
+func (w *mdcWriter) Write(in []byte) (int, error) {
+	w.hash.Write(in)
+	return w.out.Write(in)
+}
+
+func (w *mdcWriter) Close() error {
+	defer w.hash.Close()
+	// the MDC packet header is hashed as well
+	header := []byte{0xc0 | tagMDC, 20}
+	w.hash.Write(header)
+	if _, err := w.out.Write(append(header, w.hash.Digest()...)); err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
+
+// messageWriter writes the literal data packet and optionally the signature packets around it
+type messageWriter struct {
+	out     io.Writer
+	literal *partialWriter
+	signer  *signer
+	// close finishes the enclosing packets
+	close func() error
+}
+
+func newMessageWriter(out io.Writer, key *PrivateKey, config *Config, close func() error) (*messageWriter, error) {
+	name := config.fileName()
+	if len(name) > 255 {
+		return nil, errors.New("file name is too long")
+	}
+	w := &messageWriter{out: out, close: close}
+	if key != nil {
+		s, err := newSigner(key, config)
+		if err != nil {
+			return nil, err
+		}
+		if err = writePacket(out, tagOnePass, s.onePass()); err != nil {
+			s.hash.Close()
+			return nil, err
+		}
+		w.signer = s
+	}
+	literal, err := newPartialWriter(out, tagLiteral)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{'b', byte(len(name))}, name...)
+	header = binary.BigEndian.AppendUint32(header, uint32(config.time().Unix()))
+	if _, err = literal.Write(header); err != nil {
+		return nil, err
+	}
+	w.literal = literal
+	return w, nil
+}
+
+func (w *messageWriter) Write(in []byte) (int, error) {
+	if w.signer != nil {
+		w.signer.Write(in)
+	}
+	return w.literal.Write(in)
+}
+
+func (w *messageWriter) Close() error {
+	if err := w.literal.Close(); err != nil {
+		return err
+	}
+	if w.signer != nil {
+		body, err := w.signer.finish()
+		if err != nil {
+			return err
+		}
+		if err = writePacket(w.out, tagSignature, body); err != nil {
+			return err
+		}
+	}
+	if w.close != nil {
+		return w.close()
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package okapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+PasswordWriter and PasswordReader implement a PBES2 style password based encryption container.
+The encryption key is derived from the password with PBKDF2 using a random salt,
+the hash and the iteration count are configurable. PBKDF2 is the only supported KDF,
+the other KDFs (e.g. HKDF) are not meant for low entropy secrets like passwords,
+the KDF is recorded in the header so that other password KDFs can be added later.
+The container starts with a self-describing header, so that the decrypting side
+can reconstruct all parameters from the password alone:
+
+	magic      "OKPW"
+	version    1 byte
+	cipher     name of the predefined CipherSpec (1 byte length + bytes), e.g. "AES_CTR"
+	key size   1 byte
+	iv         1 byte length + bytes
+	kdf        name of the KDF (1 byte length + bytes), currently always "PBKDF2"
+	hash       name of the predefined HashSpec (1 byte length + bytes), e.g. "SHA256"
+	iterations 4 bytes, big endian
+	salt       1 byte length + bytes
+	check      HMAC of the preceding header bytes
+
+The header is followed by the encrypted data and the container ends with an HMAC
+of the header and the encrypted data. Both HMACs use the configured hash and
+a key derived along with the encryption key.
+The header check allows to detect wrong password before decrypting anything.
+*/
+
+// PasswordParameters configure the encryption performed by PasswordWriter.
+type PasswordParameters struct {
+	// Cipher is the name of the predefined CipherSpec variable used for encryption.
+	// Only modes that don't require padding are supported: AES_CTR, AES_OFB, AES_CFB,
+	// DES3_OFB, DES3_CFB, BF_OFB and BF_CFB.
+	Cipher string
+	// KeySize is the size of the encryption key in bytes, it must be valid for the cipher
+	// (16, 24 or 32 for AES, 24 for DES3, 4 to 56 for BF).
+	KeySize int
+	// Hash is the name of the predefined HashSpec variable used by PBKDF2 and HMAC:
+	// SHA1, SHA224, SHA256, SHA384 or SHA512.
+	Hash string
+	// Iterations is the PBKDF2 iteration count,
+	// it must be between MinPasswordIterations and MaxPasswordIterations.
+	Iterations int
+	// SaltSize is the size of the random PBKDF2 salt in bytes.
+	SaltSize int
+	// Random generates the salt and iv, if nil DefaultRandom is used.
+	// It remains owned by the caller.
+	Random Random
+}
+
+// DefaultPasswordParameters are used by NewPasswordWriter if parameters are not provided.
+var DefaultPasswordParameters = PasswordParameters{
+	Cipher:     "AES_CTR",
+	KeySize:    32,
+	Hash:       "SHA256",
+	Iterations: 600000,
+	SaltSize:   16,
+}
+
+// MinPasswordIterations and MaxPasswordIterations bound the PBKDF2 iteration count
+// accepted by PasswordWriter and PasswordReader. The count is read from the header before
+// the password can be checked, so without the maximum a crafted container could make
+// the reader spend practically unlimited time deriving the key.
+var (
+	MinPasswordIterations = 1000
+	MaxPasswordIterations = 10000000
+)
+
+const (
+	passwordMagic   = "OKPW"
+	passwordVersion = 1
+	passwordKDF     = "PBKDF2"
+)
+
+var errPassword = errors.New("invalid password or corrupted header")
+
+// PasswordWriter encrypts written bytes with a key derived from a password
+// and writes them into the underlying Writer, preceded by a header describing
+// the encryption parameters.
+// PasswordWriter MUST be closed before it's discarded.
+type PasswordWriter struct {
+	cipher *CipherWriter
+}
+
+// NewPasswordWriter writes the container header into the provided Writer and creates
+// a PasswordWriter wrapped around it. The salt and iv are generated with the Random
+// of the parameters or DefaultRandom.
+// If parameters are nil, DefaultPasswordParameters are used.
+// The optional buffer is used internally. If buffer is not provided,
+// it will be created with DefaultBufferSize.
+func NewPasswordWriter(out io.Writer, password []byte, parameters *PasswordParameters, buffer []byte) (*PasswordWriter, error) {
+	if parameters == nil {
+		parameters = &DefaultPasswordParameters
+	}
+	cipher, hash, err := containerSpecs(parameters.Cipher, parameters.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := cipher.checkKey(parameters.KeySize, cipher.ivSize); err != nil {
+		return nil, err
+	}
+	if parameters.SaltSize < 1 || parameters.SaltSize > 255 {
+		return nil, errors.New("invalid password salt size")
+	}
+	if err := checkIterations(parameters.Iterations); err != nil {
+		return nil, err
+	}
+	random := parameters.Random
+	if random == nil {
+		random = DefaultRandom.New()
+		defer random.Close()
+	}
+	salt := make([]byte, parameters.SaltSize)
+	iv := make([]byte, cipher.ivSize)
+	if _, err = random.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err = random.Read(iv); err != nil {
+		return nil, err
+	}
+	header := new(bytes.Buffer)
+	header.WriteString(passwordMagic)
+	header.WriteByte(passwordVersion)
+	writeField(header, []byte(parameters.Cipher))
+	header.WriteByte(byte(parameters.KeySize))
+	writeField(header, iv)
+	writeField(header, []byte(passwordKDF))
+	writeField(header, []byte(parameters.Hash))
+	binary.Write(header, binary.BigEndian, uint32(parameters.Iterations))
+	writeField(header, salt)
+	kdf := PBKDF2{Hash: hash, Salt: salt, Iterations: parameters.Iterations}
+	key, mac, err := passwordKeys(kdf, password, parameters.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(key)
+	w, err := newContainerWriter(out, header, mac, cipher, key, iv, buffer)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordWriter{cipher: w}, nil
+}
+
+// Write encrypts bytes from the provided slice and writes the encrypted bytes into the underlying writer.
+func (w *PasswordWriter) Write(in []byte) (int, error) {
+	return w.cipher.Write(in)
+}
+
+// Close finishes the encryption and writes the trailing HMAC into the underlying Writer.
+// Then it releases associated resources.
+// If the underlying Writer is a Closer, it will close it as well.
+func (w *PasswordWriter) Close() error {
+	return w.cipher.Close()
+}
+
+// PasswordReader decrypts bytes read from the underlying Reader with a key derived
+// from a password and the parameters read from the container header.
+// Note that the integrity of the decrypted bytes is verified by Close,
+// so the decrypted bytes must not be trusted before Close returns successfully.
+// PasswordReader MUST be closed before it's discarded.
+type PasswordReader struct {
+	cipher *CipherReader
+}
+
+// NewPasswordReader reads the container header from the provided Reader and creates
+// a PasswordReader wrapped around it. It returns an error if the header is invalid
+// (including key or iv sizes not valid for the cipher), the iteration count is out of bounds
+// or the password doesn't match.
+// The optional buffer is used internally. If buffer is not provided,
+// it will be created with DefaultBufferSize.
+func NewPasswordReader(in io.Reader, password []byte, buffer []byte) (*PasswordReader, error) {
+	header := &headerReader{input: in}
+	magic := header.read(len(passwordMagic))
+	version := header.read(1)
+	if header.err != nil {
+		return nil, header.err
+	}
+	if string(magic) != passwordMagic {
+		return nil, errors.New("invalid password container")
+	}
+	if version[0] != passwordVersion {
+		return nil, fmt.Errorf("unsupported password container version %d", version[0])
+	}
+	cipherName := string(header.field())
+	keySize := header.read(1)
+	iv := header.field()
+	kdfName := string(header.field())
+	hashName := string(header.field())
+	iterations := header.read(4)
+	salt := header.field()
+	if header.err != nil {
+		return nil, header.err
+	}
+	if kdfName != passwordKDF {
+		return nil, fmt.Errorf("unsupported password KDF %s", kdfName)
+	}
+	cipher, hash, err := containerSpecs(cipherName, hashName)
+	if err != nil {
+		return nil, err
+	}
+	if err := cipher.checkKey(int(keySize[0]), len(iv)); err != nil {
+		return nil, err
+	}
+	kdf := PBKDF2{Hash: hash, Salt: salt, Iterations: int(binary.BigEndian.Uint32(iterations))}
+	if err := checkIterations(kdf.Iterations); err != nil {
+		return nil, err
+	}
+	key, mac, err := passwordKeys(kdf, password, int(keySize[0]))
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(key)
+	r, err := newContainerReader(in, header, mac, cipher, key, iv, buffer, errPassword)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordReader{cipher: r}, nil
+}
+
+// Read reads necessary amount of input from the underlying Reader and decrypts it
+// into the provided slice. It conforms to the io.Reader interface.
+func (r *PasswordReader) Read(out []byte) (int, error) {
+	return r.cipher.Read(out)
+}
+
+// Close reads any remaining input and verifies the trailing HMAC, returning an error
+// if the verification fails. Then it releases any associated resources.
+// If the underlying Reader is a Closer, then it Closes it as well.
+func (r *PasswordReader) Close() error {
+	return r.cipher.Close()
+}
+
+func checkIterations(iterations int) error {
+	if iterations < MinPasswordIterations || iterations > MaxPasswordIterations {
+		return fmt.Errorf("password iteration count %d is not between %d and %d", iterations, MinPasswordIterations, MaxPasswordIterations)
+	}
+	return nil
+}
+
+// passwordKeys derives the encryption key and creates the HMAC with the derived MAC key.
+func passwordKeys(kdf PBKDF2, password []byte, keySize int) (key []byte, mac Hash, err error) {
+	keys, err := kdf.Derive(password, keySize+hashSize(kdf.Hash))
+	if err != nil {
+		return nil, nil, err
+	}
+	mac = HMAC.New(kdf.Hash, keys[keySize:])
+	Zero(keys[keySize:])
+	return keys[:keySize], mac, nil
+}
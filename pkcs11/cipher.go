@@ -0,0 +1,213 @@
+//go:build !windows
+
+package pkcs11
+
+// #include <stdlib.h>
+// #include "pkcs11.h"
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+	"io"
+	"sync/atomic"
+	"unsafe"
+)
+
+// CipherMechanism identifies a symmetric cipher algorithm and mode of the token.
+type CipherMechanism struct {
+	mechanism C.CK_MECHANISM_TYPE
+	keyType   C.CK_KEY_TYPE
+	blockSize int
+	ivSize    int
+}
+
+var (
+	AES_ECB  = CipherMechanism{C.CKM_AES_ECB, C.CKK_AES, 16, 0}
+	AES_CBC  = CipherMechanism{C.CKM_AES_CBC, C.CKK_AES, 16, 16}
+	AES_CTR  = CipherMechanism{C.CKM_AES_CTR, C.CKK_AES, 1, 16}
+	DES3_ECB = CipherMechanism{C.CKM_DES3_ECB, C.CKK_DES3, 8, 0}
+	DES3_CBC = CipherMechanism{C.CKM_DES3_CBC, C.CKK_DES3, 8, 8}
+)
+
+// CipherSpec encrypts and decrypts with the token, the key is imported as a session object.
+type CipherSpec struct {
+	session *Session
+	cipher  CipherMechanism
+}
+
+// CipherSpec returns the CipherSpec of the cipher mechanism.
+func (s *Session) CipherSpec(cipher CipherMechanism) CipherSpec {
+	return CipherSpec{session: s, cipher: cipher}
+}
+
+func (cs CipherSpec) New(key, iv []byte, encrypt bool) okapi.Cipher {
+	if len(iv) != cs.cipher.ivSize && cs.cipher.ivSize > 0 {
+		panic("invalid iv size")
+	}
+	var m *C.CK_MECHANISM
+	switch {
+	case cs.cipher.mechanism == C.CKM_AES_CTR:
+		var parameters C.CK_AES_CTR_PARAMS
+		parameters.ulCounterBits = 128
+		for i, b := range iv {
+			parameters.cb[i] = C.CK_BYTE(b)
+		}
+		m = newMechanism(cs.cipher.mechanism, unsafe.Pointer(&parameters), unsafe.Sizeof(parameters))
+	case cs.cipher.ivSize > 0:
+		m = newMechanism(cs.cipher.mechanism, unsafe.Pointer(&iv[0]), uintptr(len(iv)))
+	default:
+		m = newMechanism(cs.cipher.mechanism, nil, 0)
+	}
+	defer C.free(unsafe.Pointer(m))
+	c := &Cipher{session: cs.session.open(), encrypt: encrypt, keySize: len(key), blockSize: cs.cipher.blockSize,
+		buffer: make([]byte, 0, cs.cipher.blockSize)}
+	usage := C.CK_ATTRIBUTE_TYPE(C.CKA_DECRYPT)
+	if encrypt {
+		usage = C.CKA_ENCRYPT
+	}
+	c.key = newSecret(c.session, template{
+		ulongAttribute(C.CKA_KEY_TYPE, uint(cs.cipher.keyType)),
+		boolAttribute(usage, true),
+		{C.CKA_VALUE, key},
+	})
+	f, session := c.session.module.f, c.session.handle
+	if encrypt {
+		must("C_EncryptInit", C.okapi_C_EncryptInit(f, session, m, c.key.handle))
+	} else {
+		must("C_DecryptInit", C.okapi_C_DecryptInit(f, session, m, c.key.handle))
+	}
+	return c
+}
+
+func (cs CipherSpec) NewReader(in io.Reader, key, iv, buffer []byte) *okapi.CipherReader {
+	return okapi.NewCipherReader(in, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWriter(out io.Writer, key, iv, buffer []byte) *okapi.CipherWriter {
+	return okapi.NewCipherWriter(out, cs, key, iv, buffer)
+}
+
+func (cs CipherSpec) NewWithKey(key *okapi.SecretKey, iv []byte, encrypt bool) (okapi.Cipher, error) {
+	return key.NewCipher(cs, iv, encrypt)
+}
+
+// Cipher is a multi-part encryption or decryption operation in its own session with the token.
+// Only whole blocks are submitted to the token, because tokens don't have to accept partial blocks.
+type Cipher struct {
+	session   *Session
+	key       *secret
+	encrypt   bool
+	keySize   int
+	blockSize int
+	buffer    []byte
+}
+
+func (c *Cipher) Update(in, out []byte) (int, int) {
+	if len(out) < c.blockSize {
+		return 0, 0
+	}
+	outs := min(len(out), len(c.buffer)+len(in)) / c.blockSize * c.blockSize
+	ins := 0
+	if outs > 0 {
+		copy(out, c.buffer)
+		ins = outs - len(c.buffer)
+		copy(out[len(c.buffer):outs], in[:ins])
+		c.buffer = c.buffer[:0]
+		c.crypt(out[:outs])
+	}
+	// buffer the leftover if it's less than a block
+	if rest := in[ins:]; len(c.buffer)+len(rest) < c.blockSize {
+		c.buffer = append(c.buffer, rest...)
+		ins += len(rest)
+	}
+	return ins, outs
+}
+
+// crypt processes the data in place, the data must be whole blocks
+func (c *Cipher) crypt(data []byte) {
+	f, session := c.session.module.f, c.session.handle
+	length := C.CK_ULONG(len(data))
+	if c.encrypt {
+		must("C_EncryptUpdate", C.okapi_C_EncryptUpdate(f, session, buffer(data), length, buffer(data), &length))
+	} else {
+		must("C_DecryptUpdate", C.okapi_C_DecryptUpdate(f, session, buffer(data), length, buffer(data), &length))
+	}
+	if int(length) != len(data) {
+		panic("Token output doesn't match the input size")
+	}
+}
+
+func (c *Cipher) Finish(out []byte) int {
+	if len(c.buffer) > 0 {
+		panic("input is not multiple of cipher block size")
+	}
+	// a NULL output would only query the length without finishing the operation
+	var last [16]byte
+	f, session := c.session.module.f, c.session.handle
+	length := C.CK_ULONG(len(last))
+	if c.encrypt {
+		must("C_EncryptFinal", C.okapi_C_EncryptFinal(f, session, buffer(last[:]), &length))
+	} else {
+		must("C_DecryptFinal", C.okapi_C_DecryptFinal(f, session, buffer(last[:]), &length))
+	}
+	return copy(out, last[:length])
+}
+
+func (c *Cipher) BlockSize() int {
+	return c.blockSize
+}
+
+func (c *Cipher) KeySize() int {
+	return c.keySize
+}
+
+func (c *Cipher) BufferedSize() int {
+	return len(c.buffer)
+}
+
+func (c *Cipher) Close() {
+	if c.session == nil {
+		return
+	}
+	okapi.Zero(c.buffer[:cap(c.buffer)])
+	c.key.release()
+	c.session.Close()
+	c.session = nil
+}
+
+// secret is a secret key session object, it is shared by its users
+// and destroyed when the last one releases it.
+type secret struct {
+	session *Session
+	handle  C.CK_OBJECT_HANDLE
+	refs    int32
+}
+
+// newSecret creates a sensitive, non-extractable secret key session object from the template
+func newSecret(s *Session, t template) *secret {
+	t = append(template{
+		ulongAttribute(C.CKA_CLASS, C.CKO_SECRET_KEY),
+		boolAttribute(C.CKA_TOKEN, false),
+		boolAttribute(C.CKA_SENSITIVE, true),
+		boolAttribute(C.CKA_EXTRACTABLE, false),
+	}, t...)
+	s.Lock()
+	defer s.Unlock()
+	handle, err := s.create(t)
+	if err != nil {
+		panic(err)
+	}
+	return &secret{session: s, handle: handle, refs: 1}
+}
+
+func (k *secret) retain() {
+	atomic.AddInt32(&k.refs, 1)
+}
+
+func (k *secret) release() {
+	if atomic.AddInt32(&k.refs, -1) > 0 {
+		return
+	}
+	k.session.Lock()
+	defer k.session.Unlock()
+	k.session.destroy(k.handle)
+}
@@ -0,0 +1,83 @@
+//go:build !windows
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// crypt processes the input in uneven pieces through Update and Finish
+func crypt(c interface {
+	Update(in, out []byte) (int, int)
+	Finish(out []byte) int
+}, input []byte) []byte {
+	output := make([]byte, len(input)+16)
+	ins, outs := 0, 0
+	for step := 1; ins < len(input); step += 7 {
+		in := input[ins:min(ins+step, len(input))]
+		i, o := c.Update(in, output[outs:])
+		ins += i
+		outs += o
+	}
+	outs += c.Finish(output[outs:])
+	return output[:outs]
+}
+
+func TestAES_CBC(t *testing.T) {
+	s := session(t)
+	requires(t, s, AES_CBC, "AES_CBC")
+	key := []byte("0123456789ABCDEF")
+	iv := []byte("0123456789ABCDEF")
+	plain := make([]byte, 1600)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+	c := s.CipherSpec(AES_CBC).New(key, iv, true)
+	defer c.Close()
+	if c.BlockSize() != 16 || c.KeySize() != 16 {
+		t.Fatal("Wrong sizes")
+	}
+	encrypted := crypt(c, plain)
+	block, _ := aes.NewCipher(key)
+	expected := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(expected, plain)
+	if !bytes.Equal(encrypted, expected) {
+		t.Fatal("Encrypted does not match crypto/cipher")
+	}
+	d := s.CipherSpec(AES_CBC).New(key, iv, false)
+	defer d.Close()
+	if decrypted := crypt(d, encrypted); !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+}
+
+func TestAES_CTR(t *testing.T) {
+	s := session(t)
+	requires(t, s, AES_CTR, "AES_CTR")
+	key := []byte("0123456789ABCDEF0123456789ABCDEF")
+	iv := []byte("0123456789ABCDEF")
+	plain := make([]byte, 10000)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+	c := s.CipherSpec(AES_CTR).New(key, iv, true)
+	defer c.Close()
+	if c.BlockSize() != 1 || c.KeySize() != 32 {
+		t.Fatal("Wrong sizes")
+	}
+	encrypted := crypt(c, plain)
+	block, _ := aes.NewCipher(key)
+	expected := make([]byte, len(plain))
+	cipher.NewCTR(block, iv).XORKeyStream(expected, plain)
+	if !bytes.Equal(encrypted, expected) {
+		t.Fatal("Encrypted does not match crypto/cipher")
+	}
+	d := s.CipherSpec(AES_CTR).New(key, iv, false)
+	defer d.Close()
+	if decrypted := crypt(d, encrypted); !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+}
@@ -0,0 +1,197 @@
+//go:build !windows
+
+package pkcs11
+
+// #include <stdlib.h>
+// #include "pkcs11.h"
+import "C"
+import (
+	"errors"
+	"github.com/mkobetic/okapi"
+	"unsafe"
+)
+
+// DigestMechanism identifies a digest algorithm of the token, with the corresponding HMAC mechanism.
+type DigestMechanism struct {
+	mechanism, hmac C.CK_MECHANISM_TYPE
+	// mgf is the MGF1 generator of the RSA OAEP and PSS parameters, 0 if not defined
+	mgf C.CK_ULONG
+	// digestInfo is the DER DigestInfo prefix of the digest in PKCS#1 v1.5 signatures
+	digestInfo      []byte
+	size, blockSize int
+}
+
+var (
+	MD5 = DigestMechanism{C.CKM_MD5, C.CKM_MD5_HMAC, 0,
+		[]byte{0x30, 0x20, 0x30, 0x0c, 0x06, 0x08, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x02, 0x05, 0x05, 0x00, 0x04, 0x10}, 16, 64}
+	SHA1 = DigestMechanism{C.CKM_SHA_1, C.CKM_SHA_1_HMAC, C.CKG_MGF1_SHA1,
+		[]byte{0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14}, 20, 64}
+	SHA224 = DigestMechanism{C.CKM_SHA224, C.CKM_SHA224_HMAC, C.CKG_MGF1_SHA224,
+		[]byte{0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c}, 28, 64}
+	SHA256 = DigestMechanism{C.CKM_SHA256, C.CKM_SHA256_HMAC, C.CKG_MGF1_SHA256,
+		[]byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}, 32, 64}
+	SHA384 = DigestMechanism{C.CKM_SHA384, C.CKM_SHA384_HMAC, C.CKG_MGF1_SHA384,
+		[]byte{0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30}, 48, 128}
+	SHA512 = DigestMechanism{C.CKM_SHA512, C.CKM_SHA512_HMAC, C.CKG_MGF1_SHA512,
+		[]byte{0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40}, 64, 128}
+)
+
+// HashSpec computes digests with the token.
+type HashSpec struct {
+	session *Session
+	digest  DigestMechanism
+}
+
+// HashSpec returns the HashSpec of the digest mechanism.
+func (s *Session) HashSpec(digest DigestMechanism) HashSpec {
+	return HashSpec{session: s, digest: digest}
+}
+
+func (hs HashSpec) New() okapi.Hash {
+	h := &Hash{session: hs.session.open(), digest: hs.digest}
+	h.init()
+	return h
+}
+
+// Hash is a multi-part digest operation in its own session with the token.
+// Clone requires the token to support saving the operation state (C_GetOperationState).
+// For HMACs the key is a session object of the Session that created the HMAC, shared by the clones.
+type Hash struct {
+	session *Session
+	digest  DigestMechanism
+	key     *secret
+	result  []byte
+}
+
+func (h *Hash) init() {
+	f, session := h.session.module.f, h.session.handle
+	if h.key == nil {
+		m := newMechanism(h.digest.mechanism, nil, 0)
+		defer C.free(unsafe.Pointer(m))
+		must("C_DigestInit", C.okapi_C_DigestInit(f, session, m))
+		return
+	}
+	m := newMechanism(h.digest.hmac, nil, 0)
+	defer C.free(unsafe.Pointer(m))
+	must("C_SignInit", C.okapi_C_SignInit(f, session, m, h.key.handle))
+}
+
+func (h *Hash) Write(data []byte) (int, error) {
+	if h.result != nil {
+		return 0, errors.New("Cannot write into finalized hash")
+	}
+	f, session := h.session.module.f, h.session.handle
+	var err error
+	if h.key == nil {
+		err = check("C_DigestUpdate", C.okapi_C_DigestUpdate(f, session, buffer(data), C.CK_ULONG(len(data))))
+	} else {
+		err = check("C_SignUpdate", C.okapi_C_SignUpdate(f, session, buffer(data), C.CK_ULONG(len(data))))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (h *Hash) Digest() []byte {
+	if h.result != nil {
+		return h.result
+	}
+	f, session := h.session.module.f, h.session.handle
+	result := make([]byte, h.digest.size)
+	length := C.CK_ULONG(len(result))
+	if h.key == nil {
+		must("C_DigestFinal", C.okapi_C_DigestFinal(f, session, buffer(result), &length))
+	} else {
+		must("C_SignFinal", C.okapi_C_SignFinal(f, session, buffer(result), &length))
+	}
+	h.result = result[:length]
+	return h.result
+}
+
+func (h *Hash) Size() int {
+	return h.digest.size
+}
+
+func (h *Hash) BlockSize() int {
+	return h.digest.blockSize
+}
+
+func (h *Hash) Clone() okapi.Hash {
+	if h.result != nil {
+		clone := &Hash{session: h.session.open(), digest: h.digest, key: h.key, result: append([]byte(nil), h.result...)}
+		if h.key != nil {
+			h.key.retain()
+		}
+		return clone
+	}
+	f := h.session.module.f
+	var length C.CK_ULONG
+	must("C_GetOperationState", C.okapi_C_GetOperationState(f, h.session.handle, nil, &length))
+	state := make([]byte, length)
+	must("C_GetOperationState", C.okapi_C_GetOperationState(f, h.session.handle, buffer(state), &length))
+	clone := &Hash{session: h.session.open(), digest: h.digest}
+	var key C.CK_OBJECT_HANDLE
+	if h.key != nil {
+		key = h.key.handle
+	}
+	if err := check("C_SetOperationState", C.okapi_C_SetOperationState(f, clone.session.handle, buffer(state), length, key)); err != nil {
+		clone.Close()
+		panic(err)
+	}
+	if h.key != nil {
+		h.key.retain()
+		clone.key = h.key
+	}
+	return clone
+}
+
+func (h *Hash) Reset() {
+	if h.result == nil {
+		// finish the active operation
+		h.Digest()
+	}
+	h.result = nil
+	h.init()
+}
+
+func (h *Hash) Close() {
+	if h.session == nil {
+		return
+	}
+	if h.key != nil {
+		h.key.release()
+		h.key = nil
+	}
+	h.session.Close()
+	h.session = nil
+}
+
+// HMAC returns the MACSpec computing HMACs with the token. The key is imported as a session object.
+// The hash must be a HashSpec of the same session (e.g. okapi.SHA256 after Session.Register).
+func (s *Session) HMAC() okapi.MACSpec {
+	return hmacSpec{s}
+}
+
+type hmacSpec struct {
+	session *Session
+}
+
+func (ms hmacSpec) New(hash okapi.HashSpec, key []byte) okapi.Hash {
+	hs, ok := hash.(HashSpec)
+	if !ok || hs.session != ms.session {
+		panic("pkcs11 HMAC requires a HashSpec of the same session")
+	}
+	h := &Hash{session: ms.session.open(), digest: hs.digest}
+	h.key = newSecret(ms.session, template{
+		ulongAttribute(C.CKA_KEY_TYPE, C.CKK_GENERIC_SECRET),
+		boolAttribute(C.CKA_SIGN, true),
+		{C.CKA_VALUE, key},
+	})
+	h.init()
+	return h
+}
+
+func (ms hmacSpec) NewWithKey(hash okapi.HashSpec, key *okapi.SecretKey) (okapi.Hash, error) {
+	return key.NewMAC(ms, hash)
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package pkcs11
+
+import (
+	"encoding/hex"
+	"github.com/mkobetic/okapi"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	s := session(t)
+	requires(t, s, SHA256, "SHA256")
+	sha := s.HashSpec(SHA256).New()
+	defer sha.Close()
+	if sha.Size() != 32 || sha.BlockSize() != 64 {
+		t.Fatal("Wrong size")
+	}
+	sha.Write([]byte("test"))
+	if digest := sha.Digest(); hex.EncodeToString(digest) != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Fatalf("%x", digest)
+	}
+	if count, err := sha.Write([]byte("test")); err == nil || count != 0 {
+		t.Fatalf("count=%d, err=%s", count, err)
+	}
+	sha.Reset()
+	if digest := sha.Digest(); hex.EncodeToString(digest) != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("Empty: %x", digest)
+	}
+}
+
+func TestHashClone(t *testing.T) {
+	s := session(t)
+	requires(t, s, SHA1, "SHA1")
+	sha := s.HashSpec(SHA1).New()
+	defer sha.Close()
+	sha.Write([]byte("te"))
+	var clone okapi.Hash
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Skipf("The token cannot save the operation state: %v", r)
+			}
+		}()
+		clone = sha.Clone()
+	}()
+	defer clone.Close()
+	sha.Write([]byte("st"))
+	clone.Write([]byte("st"))
+	for _, h := range []okapi.Hash{sha, clone} {
+		if digest := h.Digest(); hex.EncodeToString(digest) != "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3" {
+			t.Fatalf("%x", digest)
+		}
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	s := session(t)
+	requires(t, s, SHA256, "SHA256")
+	// RFC 4231 test case 2
+	hmac := s.HMAC().New(s.HashSpec(SHA256), []byte("Jefe"))
+	defer hmac.Close()
+	hmac.Write([]byte("what do ya want "))
+	hmac.Write([]byte("for nothing?"))
+	if digest := hmac.Digest(); hex.EncodeToString(digest) != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Fatalf("%x", digest)
+	}
+}
@@ -0,0 +1,211 @@
+//go:build !windows
+
+// Package pkcs11 implements okapi interfaces using PKCS#11 (Cryptoki) modules
+// of hardware tokens, smart cards and HSMs (or software tokens like SoftHSMv2).
+// The module is loaded dynamically from its path, sessions are opened on the token slots
+// and the keys held by the token are exposed as okapi.PrivateKey and PublicKey.
+// The private key operations (Sign, Decrypt, Derive) are performed by the token,
+// keys generated by the package are sensitive and non-extractable.
+// The token digests and ciphers are available as okapi HashSpecs and CipherSpecs too.
+//
+// Unlike the other implementations, the package doesn't register anything with okapi on import,
+// because it needs the module path and token credentials. Use Session.Register to do so.
+//
+//	module, err := pkcs11.Load("/usr/lib/softhsm/libsofthsm2.so")
+//	slot, err := module.FindSlot("okapi")
+//	session, err := module.OpenSession(slot, "1234")
+//	key, err := session.KeyConstructor(pkcs11.ECDSA_SHA256)(pkcs11.KeyFilter{Label: "signing"})
+package pkcs11
+
+// #cgo LDFLAGS: -ldl
+// #include <stdlib.h>
+// #include <dlfcn.h>
+// #include "pkcs11.h"
+//
+// static CK_RV okapi_get_function_list(void *f, CK_FUNCTION_LIST **list) {
+// 	return ((CK_C_GetFunctionList)f)(list);
+// }
+import "C"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Error is a failure reported by a PKCS#11 function.
+type Error struct {
+	// Function is the name of the failed function
+	Function string
+	// Code is the PKCS#11 return value (CKR_*)
+	Code uint
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pkcs11 %s failed: CKR 0x%x", e.Function, e.Code)
+}
+
+// check converts the return value of a PKCS#11 function to an error
+func check(function string, rv C.CK_RV) error {
+	if rv == C.CKR_OK {
+		return nil
+	}
+	return &Error{Function: function, Code: uint(rv)}
+}
+
+// must panics if the PKCS#11 function failed, it is used where okapi interfaces don't return errors
+func must(function string, rv C.CK_RV) {
+	if err := check(function, rv); err != nil {
+		panic(err)
+	}
+}
+
+// Module is a loaded PKCS#11 module.
+// A module should be loaded only once per process, the module instances share its initialization.
+type Module struct {
+	handle unsafe.Pointer
+	f      *C.CK_FUNCTION_LIST
+	// finalize is false if the module was already initialized by another user in the process
+	finalize bool
+}
+
+// Load loads and initializes the PKCS#11 module from the shared library path.
+func Load(path string) (*Module, error) {
+	return LoadWithParameters(path, "")
+}
+
+// LoadWithParameters loads the module passing the parameters to its initialization (in the pReserved field).
+// Some modules require these, e.g. the NSS softoken expects its database configuration:
+//
+//	configdir='sql:/etc/pki/nssdb' certPrefix='' keyPrefix='' secmod='secmod.db' flags=
+func LoadWithParameters(path, parameters string) (*Module, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	handle := C.dlopen(cpath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, errors.New("pkcs11 module load failed: " + C.GoString(C.dlerror()))
+	}
+	m := &Module{handle: handle}
+	name := C.CString("C_GetFunctionList")
+	defer C.free(unsafe.Pointer(name))
+	getFunctionList := C.dlsym(handle, name)
+	if getFunctionList == nil {
+		C.dlclose(handle)
+		return nil, errors.New("pkcs11 module load failed: C_GetFunctionList not found in " + path)
+	}
+	if err := check("C_GetFunctionList", C.okapi_get_function_list(getFunctionList, &m.f)); err != nil {
+		C.dlclose(handle)
+		return nil, err
+	}
+	args := (*C.CK_C_INITIALIZE_ARGS)(C.calloc(1, C.sizeof_CK_C_INITIALIZE_ARGS))
+	defer C.free(unsafe.Pointer(args))
+	args.flags = C.CKF_OS_LOCKING_OK
+	if parameters != "" {
+		cparameters := C.CString(parameters)
+		defer C.free(unsafe.Pointer(cparameters))
+		args.pReserved = unsafe.Pointer(cparameters)
+	}
+	switch rv := C.okapi_C_Initialize(m.f, args); rv {
+	case C.CKR_OK:
+		m.finalize = true
+	case C.CKR_CRYPTOKI_ALREADY_INITIALIZED:
+	default:
+		C.dlclose(handle)
+		return nil, check("C_Initialize", rv)
+	}
+	return m, nil
+}
+
+// Close finalizes and unloads the module, all its sessions, keys, hashes and ciphers become invalid.
+func (m *Module) Close() {
+	if m.f == nil {
+		return
+	}
+	if m.finalize {
+		C.okapi_C_Finalize(m.f)
+	}
+	C.dlclose(m.handle)
+	m.f = nil
+}
+
+// Slot is a module slot with a token present.
+type Slot struct {
+	ID                                 uint
+	Label, Manufacturer, Model, Serial string
+}
+
+// Slots returns the slots with a token present.
+func (m *Module) Slots() ([]Slot, error) {
+	var count C.CK_ULONG
+	if err := check("C_GetSlotList", C.okapi_C_GetSlotList(m.f, nil, &count)); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	ids := make([]C.CK_SLOT_ID, count)
+	if err := check("C_GetSlotList", C.okapi_C_GetSlotList(m.f, &ids[0], &count)); err != nil {
+		return nil, err
+	}
+	slots := make([]Slot, 0, count)
+	for _, id := range ids[:count] {
+		var info C.CK_TOKEN_INFO
+		if err := check("C_GetTokenInfo", C.okapi_C_GetTokenInfo(m.f, id, &info)); err != nil {
+			return nil, err
+		}
+		slots = append(slots, Slot{
+			ID:           uint(id),
+			Label:        padded(info.label[:]),
+			Manufacturer: padded(info.manufacturerID[:]),
+			Model:        padded(info.model[:]),
+			Serial:       padded(info.serialNumber[:]),
+		})
+	}
+	return slots, nil
+}
+
+// padded converts a blank padded token info field to a string
+func padded(field []C.CK_UTF8CHAR) string {
+	return strings.TrimRight(string(C.GoBytes(unsafe.Pointer(&field[0]), C.int(len(field)))), " \x00")
+}
+
+// FindSlot returns the slot holding the token with the label.
+func (m *Module) FindSlot(label string) (Slot, error) {
+	slots, err := m.Slots()
+	if err != nil {
+		return Slot{}, err
+	}
+	for _, slot := range slots {
+		if slot.Label == label {
+			return slot, nil
+		}
+	}
+	return Slot{}, errors.New("pkcs11 token not found: " + label)
+}
+
+// OpenSession opens a read/write session with the token in the slot.
+// If the pin is not empty, the user is logged in, which applies to all sessions with the token.
+func (m *Module) OpenSession(slot Slot, pin string) (*Session, error) {
+	s, err := m.openSession(slot)
+	if err != nil {
+		return nil, err
+	}
+	if pin != "" {
+		cpin := C.CString(pin)
+		defer C.free(unsafe.Pointer(cpin))
+		rv := C.okapi_C_Login(m.f, s.handle, (*C.CK_UTF8CHAR)(unsafe.Pointer(cpin)), C.CK_ULONG(len(pin)))
+		if rv != C.CKR_OK && rv != C.CKR_USER_ALREADY_LOGGED_IN {
+			s.Close()
+			return nil, check("C_Login", rv)
+		}
+	}
+	return s, nil
+}
+
+func (m *Module) openSession(slot Slot) (*Session, error) {
+	s := &Session{module: m, slot: slot}
+	if err := check("C_OpenSession", C.okapi_C_OpenSession(m.f, C.CK_SLOT_ID(slot.ID), &s.handle)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,366 @@
+/*
+ * The subset of the PKCS#11 v2.40 (Cryptoki) API used by okapi,
+ * with wrappers calling the functions of the module function list, which cgo cannot call directly.
+ */
+#ifndef OKAPI_PKCS11_H
+#define OKAPI_PKCS11_H
+
+typedef unsigned char CK_BYTE;
+typedef unsigned char CK_BBOOL;
+typedef unsigned char CK_UTF8CHAR;
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_FLAGS;
+typedef CK_ULONG CK_RV;
+typedef CK_ULONG CK_SLOT_ID;
+typedef CK_ULONG CK_SESSION_HANDLE;
+typedef CK_ULONG CK_OBJECT_HANDLE;
+typedef CK_ULONG CK_OBJECT_CLASS;
+typedef CK_ULONG CK_KEY_TYPE;
+typedef CK_ULONG CK_ATTRIBUTE_TYPE;
+typedef CK_ULONG CK_MECHANISM_TYPE;
+typedef CK_ULONG CK_USER_TYPE;
+
+#define CK_TRUE 1
+#define CK_FALSE 0
+
+typedef struct CK_VERSION {
+	CK_BYTE major;
+	CK_BYTE minor;
+} CK_VERSION;
+
+typedef struct CK_TOKEN_INFO {
+	CK_UTF8CHAR label[32];
+	CK_UTF8CHAR manufacturerID[32];
+	CK_UTF8CHAR model[16];
+	CK_BYTE serialNumber[16];
+	CK_FLAGS flags;
+	CK_ULONG ulMaxSessionCount;
+	CK_ULONG ulSessionCount;
+	CK_ULONG ulMaxRwSessionCount;
+	CK_ULONG ulRwSessionCount;
+	CK_ULONG ulMaxPinLen;
+	CK_ULONG ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory;
+	CK_ULONG ulFreePublicMemory;
+	CK_ULONG ulTotalPrivateMemory;
+	CK_ULONG ulFreePrivateMemory;
+	CK_VERSION hardwareVersion;
+	CK_VERSION firmwareVersion;
+	CK_UTF8CHAR utcTime[16];
+} CK_TOKEN_INFO;
+
+typedef struct CK_ATTRIBUTE {
+	CK_ATTRIBUTE_TYPE type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct CK_MECHANISM {
+	CK_MECHANISM_TYPE mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+typedef struct CK_C_INITIALIZE_ARGS {
+	void *CreateMutex;
+	void *DestroyMutex;
+	void *LockMutex;
+	void *UnlockMutex;
+	CK_FLAGS flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+typedef struct CK_RSA_PKCS_OAEP_PARAMS {
+	CK_MECHANISM_TYPE hashAlg;
+	CK_ULONG mgf;
+	CK_ULONG source;
+	void *pSourceData;
+	CK_ULONG ulSourceDataLen;
+} CK_RSA_PKCS_OAEP_PARAMS;
+
+typedef struct CK_RSA_PKCS_PSS_PARAMS {
+	CK_MECHANISM_TYPE hashAlg;
+	CK_ULONG mgf;
+	CK_ULONG sLen;
+} CK_RSA_PKCS_PSS_PARAMS;
+
+typedef struct CK_ECDH1_DERIVE_PARAMS {
+	CK_ULONG kdf;
+	CK_ULONG ulSharedDataLen;
+	CK_BYTE *pSharedData;
+	CK_ULONG ulPublicDataLen;
+	CK_BYTE *pPublicData;
+} CK_ECDH1_DERIVE_PARAMS;
+
+typedef struct CK_AES_CTR_PARAMS {
+	CK_ULONG ulCounterBits;
+	CK_BYTE cb[16];
+} CK_AES_CTR_PARAMS;
+
+/* Only the used functions have prototypes, the order of the list is defined by the standard. */
+typedef struct CK_FUNCTION_LIST {
+	CK_VERSION version;
+	CK_RV (*C_Initialize)(void *pInitArgs);
+	CK_RV (*C_Finalize)(void *pReserved);
+	void *C_GetInfo;
+	void *C_GetFunctionList;
+	CK_RV (*C_GetSlotList)(CK_BBOOL tokenPresent, CK_SLOT_ID *pSlotList, CK_ULONG *pulCount);
+	void *C_GetSlotInfo;
+	CK_RV (*C_GetTokenInfo)(CK_SLOT_ID slotID, CK_TOKEN_INFO *pInfo);
+	CK_RV (*C_GetMechanismList)(CK_SLOT_ID slotID, CK_MECHANISM_TYPE *pMechanismList, CK_ULONG *pulCount);
+	void *C_GetMechanismInfo;
+	void *C_InitToken;
+	void *C_InitPIN;
+	void *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_SLOT_ID slotID, CK_FLAGS flags, void *pApplication, void *Notify, CK_SESSION_HANDLE *phSession);
+	CK_RV (*C_CloseSession)(CK_SESSION_HANDLE hSession);
+	void *C_CloseAllSessions;
+	void *C_GetSessionInfo;
+	CK_RV (*C_GetOperationState)(CK_SESSION_HANDLE hSession, CK_BYTE *pOperationState, CK_ULONG *pulOperationStateLen);
+	CK_RV (*C_SetOperationState)(CK_SESSION_HANDLE hSession, CK_BYTE *pOperationState, CK_ULONG ulOperationStateLen, CK_OBJECT_HANDLE hEncryptionKey, CK_OBJECT_HANDLE hAuthenticationKey);
+	CK_RV (*C_Login)(CK_SESSION_HANDLE hSession, CK_USER_TYPE userType, CK_UTF8CHAR *pPin, CK_ULONG ulPinLen);
+	CK_RV (*C_Logout)(CK_SESSION_HANDLE hSession);
+	CK_RV (*C_CreateObject)(CK_SESSION_HANDLE hSession, CK_ATTRIBUTE *pTemplate, CK_ULONG ulCount, CK_OBJECT_HANDLE *phObject);
+	void *C_CopyObject;
+	CK_RV (*C_DestroyObject)(CK_SESSION_HANDLE hSession, CK_OBJECT_HANDLE hObject);
+	void *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_SESSION_HANDLE hSession, CK_OBJECT_HANDLE hObject, CK_ATTRIBUTE *pTemplate, CK_ULONG ulCount);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_SESSION_HANDLE hSession, CK_ATTRIBUTE *pTemplate, CK_ULONG ulCount);
+	CK_RV (*C_FindObjects)(CK_SESSION_HANDLE hSession, CK_OBJECT_HANDLE *phObject, CK_ULONG ulMaxObjectCount, CK_ULONG *pulObjectCount);
+	CK_RV (*C_FindObjectsFinal)(CK_SESSION_HANDLE hSession);
+	CK_RV (*C_EncryptInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hKey);
+	CK_RV (*C_Encrypt)(CK_SESSION_HANDLE hSession, CK_BYTE *pData, CK_ULONG ulDataLen, CK_BYTE *pEncryptedData, CK_ULONG *pulEncryptedDataLen);
+	CK_RV (*C_EncryptUpdate)(CK_SESSION_HANDLE hSession, CK_BYTE *pPart, CK_ULONG ulPartLen, CK_BYTE *pEncryptedPart, CK_ULONG *pulEncryptedPartLen);
+	CK_RV (*C_EncryptFinal)(CK_SESSION_HANDLE hSession, CK_BYTE *pLastEncryptedPart, CK_ULONG *pulLastEncryptedPartLen);
+	CK_RV (*C_DecryptInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hKey);
+	CK_RV (*C_Decrypt)(CK_SESSION_HANDLE hSession, CK_BYTE *pEncryptedData, CK_ULONG ulEncryptedDataLen, CK_BYTE *pData, CK_ULONG *pulDataLen);
+	CK_RV (*C_DecryptUpdate)(CK_SESSION_HANDLE hSession, CK_BYTE *pEncryptedPart, CK_ULONG ulEncryptedPartLen, CK_BYTE *pPart, CK_ULONG *pulPartLen);
+	CK_RV (*C_DecryptFinal)(CK_SESSION_HANDLE hSession, CK_BYTE *pLastPart, CK_ULONG *pulLastPartLen);
+	CK_RV (*C_DigestInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism);
+	void *C_Digest;
+	CK_RV (*C_DigestUpdate)(CK_SESSION_HANDLE hSession, CK_BYTE *pPart, CK_ULONG ulPartLen);
+	void *C_DigestKey;
+	CK_RV (*C_DigestFinal)(CK_SESSION_HANDLE hSession, CK_BYTE *pDigest, CK_ULONG *pulDigestLen);
+	CK_RV (*C_SignInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hKey);
+	CK_RV (*C_Sign)(CK_SESSION_HANDLE hSession, CK_BYTE *pData, CK_ULONG ulDataLen, CK_BYTE *pSignature, CK_ULONG *pulSignatureLen);
+	CK_RV (*C_SignUpdate)(CK_SESSION_HANDLE hSession, CK_BYTE *pPart, CK_ULONG ulPartLen);
+	CK_RV (*C_SignFinal)(CK_SESSION_HANDLE hSession, CK_BYTE *pSignature, CK_ULONG *pulSignatureLen);
+	void *C_SignRecoverInit;
+	void *C_SignRecover;
+	CK_RV (*C_VerifyInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hKey);
+	CK_RV (*C_Verify)(CK_SESSION_HANDLE hSession, CK_BYTE *pData, CK_ULONG ulDataLen, CK_BYTE *pSignature, CK_ULONG ulSignatureLen);
+	void *C_VerifyUpdate;
+	void *C_VerifyFinal;
+	void *C_VerifyRecoverInit;
+	void *C_VerifyRecover;
+	void *C_DigestEncryptUpdate;
+	void *C_DecryptDigestUpdate;
+	void *C_SignEncryptUpdate;
+	void *C_DecryptVerifyUpdate;
+	void *C_GenerateKey;
+	CK_RV (*C_GenerateKeyPair)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_ATTRIBUTE *pPublicKeyTemplate, CK_ULONG ulPublicKeyAttributeCount, CK_ATTRIBUTE *pPrivateKeyTemplate, CK_ULONG ulPrivateKeyAttributeCount, CK_OBJECT_HANDLE *phPublicKey, CK_OBJECT_HANDLE *phPrivateKey);
+	void *C_WrapKey;
+	void *C_UnwrapKey;
+	CK_RV (*C_DeriveKey)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hBaseKey, CK_ATTRIBUTE *pTemplate, CK_ULONG ulAttributeCount, CK_OBJECT_HANDLE *phKey);
+	void *C_SeedRandom;
+	CK_RV (*C_GenerateRandom)(CK_SESSION_HANDLE hSession, CK_BYTE *RandomData, CK_ULONG ulRandomLen);
+	void *C_GetFunctionStatus;
+	void *C_CancelFunction;
+	void *C_WaitForSlotEvent;
+} CK_FUNCTION_LIST;
+
+typedef CK_RV (*CK_C_GetFunctionList)(CK_FUNCTION_LIST **ppFunctionList);
+
+#define CKF_RW_SESSION 0x00000002UL
+#define CKF_SERIAL_SESSION 0x00000004UL
+#define CKF_OS_LOCKING_OK 0x00000002UL
+
+#define CKU_USER 1UL
+
+#define CKO_PUBLIC_KEY 2UL
+#define CKO_PRIVATE_KEY 3UL
+#define CKO_SECRET_KEY 4UL
+
+#define CKK_RSA 0x00UL
+#define CKK_EC 0x03UL
+#define CKK_GENERIC_SECRET 0x10UL
+#define CKK_DES3 0x15UL
+#define CKK_AES 0x1FUL
+#define CKK_EC_EDWARDS 0x40UL
+
+#define CKA_CLASS 0x000UL
+#define CKA_TOKEN 0x001UL
+#define CKA_PRIVATE 0x002UL
+#define CKA_LABEL 0x003UL
+#define CKA_VALUE 0x011UL
+#define CKA_KEY_TYPE 0x100UL
+#define CKA_ID 0x102UL
+#define CKA_SENSITIVE 0x103UL
+#define CKA_ENCRYPT 0x104UL
+#define CKA_DECRYPT 0x105UL
+#define CKA_SIGN 0x108UL
+#define CKA_VERIFY 0x10AUL
+#define CKA_DERIVE 0x10CUL
+#define CKA_MODULUS 0x120UL
+#define CKA_MODULUS_BITS 0x121UL
+#define CKA_PUBLIC_EXPONENT 0x122UL
+#define CKA_VALUE_LEN 0x161UL
+#define CKA_EXTRACTABLE 0x162UL
+#define CKA_EC_PARAMS 0x180UL
+#define CKA_EC_POINT 0x181UL
+
+#define CKM_RSA_PKCS_KEY_PAIR_GEN 0x0000UL
+#define CKM_RSA_PKCS 0x0001UL
+#define CKM_RSA_PKCS_OAEP 0x0009UL
+#define CKM_RSA_PKCS_PSS 0x000DUL
+#define CKM_DES3_ECB 0x0132UL
+#define CKM_DES3_CBC 0x0133UL
+#define CKM_MD5 0x0210UL
+#define CKM_MD5_HMAC 0x0211UL
+#define CKM_SHA_1 0x0220UL
+#define CKM_SHA_1_HMAC 0x0221UL
+#define CKM_SHA256 0x0250UL
+#define CKM_SHA256_HMAC 0x0251UL
+#define CKM_SHA224 0x0255UL
+#define CKM_SHA224_HMAC 0x0256UL
+#define CKM_SHA384 0x0260UL
+#define CKM_SHA384_HMAC 0x0261UL
+#define CKM_SHA512 0x0270UL
+#define CKM_SHA512_HMAC 0x0271UL
+#define CKM_EC_KEY_PAIR_GEN 0x1040UL
+#define CKM_ECDSA 0x1041UL
+#define CKM_ECDH1_DERIVE 0x1050UL
+#define CKM_EC_EDWARDS_KEY_PAIR_GEN 0x1055UL
+#define CKM_EDDSA 0x1057UL
+#define CKM_AES_ECB 0x1081UL
+#define CKM_AES_CBC 0x1082UL
+#define CKM_AES_CTR 0x1086UL
+
+#define CKG_MGF1_SHA1 0x1UL
+#define CKG_MGF1_SHA256 0x2UL
+#define CKG_MGF1_SHA384 0x3UL
+#define CKG_MGF1_SHA512 0x4UL
+#define CKG_MGF1_SHA224 0x5UL
+#define CKZ_DATA_SPECIFIED 0x1UL
+#define CKD_NULL 0x1UL
+
+#define CKR_OK 0x000UL
+#define CKR_SIGNATURE_INVALID 0x0C0UL
+#define CKR_SIGNATURE_LEN_RANGE 0x0C1UL
+#define CKR_USER_ALREADY_LOGGED_IN 0x100UL
+#define CKR_CRYPTOKI_ALREADY_INITIALIZED 0x191UL
+
+static inline CK_RV okapi_C_Initialize(CK_FUNCTION_LIST *f, CK_C_INITIALIZE_ARGS *args) {
+	return f->C_Initialize(args);
+}
+static inline CK_RV okapi_C_Finalize(CK_FUNCTION_LIST *f) {
+	return f->C_Finalize(NULL);
+}
+static inline CK_RV okapi_C_GetSlotList(CK_FUNCTION_LIST *f, CK_SLOT_ID *list, CK_ULONG *count) {
+	return f->C_GetSlotList(CK_TRUE, list, count);
+}
+static inline CK_RV okapi_C_GetTokenInfo(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	return f->C_GetTokenInfo(slot, info);
+}
+static inline CK_RV okapi_C_GetMechanismList(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_MECHANISM_TYPE *list, CK_ULONG *count) {
+	return f->C_GetMechanismList(slot, list, count);
+}
+static inline CK_RV okapi_C_OpenSession(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_SESSION_HANDLE *session) {
+	return f->C_OpenSession(slot, CKF_SERIAL_SESSION | CKF_RW_SESSION, NULL, NULL, session);
+}
+static inline CK_RV okapi_C_CloseSession(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session) {
+	return f->C_CloseSession(session);
+}
+static inline CK_RV okapi_C_GetOperationState(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *state, CK_ULONG *len) {
+	return f->C_GetOperationState(session, state, len);
+}
+static inline CK_RV okapi_C_SetOperationState(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *state, CK_ULONG len, CK_OBJECT_HANDLE key) {
+	return f->C_SetOperationState(session, state, len, 0, key);
+}
+static inline CK_RV okapi_C_Login(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_UTF8CHAR *pin, CK_ULONG len) {
+	return f->C_Login(session, CKU_USER, pin, len);
+}
+static inline CK_RV okapi_C_Logout(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session) {
+	return f->C_Logout(session);
+}
+static inline CK_RV okapi_C_CreateObject(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ATTRIBUTE *template, CK_ULONG count, CK_OBJECT_HANDLE *object) {
+	return f->C_CreateObject(session, template, count, object);
+}
+static inline CK_RV okapi_C_DestroyObject(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE object) {
+	return f->C_DestroyObject(session, object);
+}
+static inline CK_RV okapi_C_GetAttributeValue(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE object, CK_ATTRIBUTE *template, CK_ULONG count) {
+	return f->C_GetAttributeValue(session, object, template, count);
+}
+static inline CK_RV okapi_C_FindObjectsInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ATTRIBUTE *template, CK_ULONG count) {
+	return f->C_FindObjectsInit(session, template, count);
+}
+static inline CK_RV okapi_C_FindObjects(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE *objects, CK_ULONG max, CK_ULONG *count) {
+	return f->C_FindObjects(session, objects, max, count);
+}
+static inline CK_RV okapi_C_FindObjectsFinal(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session) {
+	return f->C_FindObjectsFinal(session);
+}
+static inline CK_RV okapi_C_EncryptInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE key) {
+	return f->C_EncryptInit(session, mechanism, key);
+}
+static inline CK_RV okapi_C_Encrypt(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_Encrypt(session, in, inlen, out, outlen);
+}
+static inline CK_RV okapi_C_EncryptUpdate(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_EncryptUpdate(session, in, inlen, out, outlen);
+}
+static inline CK_RV okapi_C_EncryptFinal(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_EncryptFinal(session, out, outlen);
+}
+static inline CK_RV okapi_C_DecryptInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE key) {
+	return f->C_DecryptInit(session, mechanism, key);
+}
+static inline CK_RV okapi_C_Decrypt(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_Decrypt(session, in, inlen, out, outlen);
+}
+static inline CK_RV okapi_C_DecryptUpdate(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_DecryptUpdate(session, in, inlen, out, outlen);
+}
+static inline CK_RV okapi_C_DecryptFinal(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_DecryptFinal(session, out, outlen);
+}
+static inline CK_RV okapi_C_DigestInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism) {
+	return f->C_DigestInit(session, mechanism);
+}
+static inline CK_RV okapi_C_DigestUpdate(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen) {
+	return f->C_DigestUpdate(session, in, inlen);
+}
+static inline CK_RV okapi_C_DigestFinal(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_DigestFinal(session, out, outlen);
+}
+static inline CK_RV okapi_C_SignInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE key) {
+	return f->C_SignInit(session, mechanism, key);
+}
+static inline CK_RV okapi_C_Sign(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_Sign(session, in, inlen, out, outlen);
+}
+static inline CK_RV okapi_C_SignUpdate(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen) {
+	return f->C_SignUpdate(session, in, inlen);
+}
+static inline CK_RV okapi_C_SignFinal(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *out, CK_ULONG *outlen) {
+	return f->C_SignFinal(session, out, outlen);
+}
+static inline CK_RV okapi_C_VerifyInit(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE key) {
+	return f->C_VerifyInit(session, mechanism, key);
+}
+static inline CK_RV okapi_C_Verify(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *in, CK_ULONG inlen, CK_BYTE *signature, CK_ULONG siglen) {
+	return f->C_Verify(session, in, inlen, signature, siglen);
+}
+static inline CK_RV okapi_C_GenerateKeyPair(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_ATTRIBUTE *public, CK_ULONG npublic, CK_ATTRIBUTE *private, CK_ULONG nprivate, CK_OBJECT_HANDLE *hpublic, CK_OBJECT_HANDLE *hprivate) {
+	return f->C_GenerateKeyPair(session, mechanism, public, npublic, private, nprivate, hpublic, hprivate);
+}
+static inline CK_RV okapi_C_DeriveKey(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE base, CK_ATTRIBUTE *template, CK_ULONG count, CK_OBJECT_HANDLE *key) {
+	return f->C_DeriveKey(session, mechanism, base, template, count, key);
+}
+static inline CK_RV okapi_C_GenerateRandom(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_BYTE *out, CK_ULONG len) {
+	return f->C_GenerateRandom(session, out, len);
+}
+
+#endif
@@ -0,0 +1,84 @@
+//go:build !windows
+
+package pkcs11
+
+import (
+	"github.com/mkobetic/okapi"
+	"os"
+	"sync"
+	"testing"
+)
+
+// The tests run against the token configured by the environment and are skipped without it,
+// e.g. with a SoftHSMv2 token initialized by
+//
+//	softhsm2-util --init-token --free --label okapi --pin 1234 --so-pin 1234
+//	PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=okapi PKCS11_PIN=1234 go test
+//
+// PKCS11_PARAMETERS are passed to the module initialization if set.
+var (
+	testOnce    sync.Once
+	testSession *Session
+	testErr     error
+)
+
+// session returns the session with the test token, shared by all tests
+func session(t *testing.T) *Session {
+	t.Helper()
+	path := os.Getenv("PKCS11_MODULE")
+	if path == "" {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+	testOnce.Do(func() {
+		var module *Module
+		if module, testErr = LoadWithParameters(path, os.Getenv("PKCS11_PARAMETERS")); testErr != nil {
+			return
+		}
+		var slot Slot
+		if slot, testErr = module.FindSlot(os.Getenv("PKCS11_TOKEN")); testErr != nil {
+			return
+		}
+		testSession, testErr = module.OpenSession(slot, os.Getenv("PKCS11_PIN"))
+	})
+	if testErr != nil {
+		t.Fatal(testErr)
+	}
+	return testSession
+}
+
+// requires skips the test if the token doesn't support the mechanism
+func requires(t *testing.T, s *Session, mechanism interface{}, name string) {
+	t.Helper()
+	if !s.Supports(mechanism) {
+		t.Skipf("%s is not supported by the token", name)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	s := session(t)
+	random := s.RandomSpec().New()
+	defer random.Close()
+	b1, b2 := make([]byte, 32), make([]byte, 32)
+	if n, err := random.Read(b1); n != 32 || err != nil {
+		t.Fatalf("n=%d, err=%s", n, err)
+	}
+	random.Read(b2)
+	if string(b1) == string(b2) {
+		t.Fatal("Repeated output")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := session(t)
+	requires(t, s, SHA256, "SHA256")
+	saved := okapi.SHA256
+	defer func() { okapi.SHA256 = saved }()
+	if err := s.Register(); err != nil {
+		t.Fatal(err)
+	}
+	hash := okapi.SHA256.New()
+	defer hash.Close()
+	if h, ok := hash.(*Hash); !ok || h.session != s {
+		t.Fatal("SHA256 is not registered")
+	}
+}
@@ -0,0 +1,743 @@
+//go:build !windows
+
+package pkcs11
+
+// #include <stdlib.h>
+// #include "pkcs11.h"
+import "C"
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"github.com/mkobetic/okapi"
+	"math/big"
+	"sync/atomic"
+	"unsafe"
+)
+
+type purpose int
+
+const (
+	encryption purpose = iota
+	signing
+	keyAgreement
+)
+
+// KeyMechanism identifies a public key algorithm and purpose of the token keys.
+type KeyMechanism struct {
+	keyType   C.CK_KEY_TYPE
+	generate  C.CK_MECHANISM_TYPE
+	mechanism C.CK_MECHANISM_TYPE
+	purpose   purpose
+	// digest is the digest of the signatures or of the OAEP padding, if any
+	digest DigestMechanism
+}
+
+// Key mechanisms corresponding to the okapi key constructors.
+// RSA_OAEP uses SHA1 for both the label hash and MGF1 to match the other implementations,
+// PSS salts are as long as the digest. ECDSA signatures are DER encoded (r, s) pairs.
+var (
+	RSA            = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, encryption, DigestMechanism{}}
+	RSA_OAEP       = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_OAEP, encryption, SHA1}
+	RSA_MD5        = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, MD5}
+	RSA_SHA1       = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, SHA1}
+	RSA_SHA224     = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, SHA224}
+	RSA_SHA256     = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, SHA256}
+	RSA_SHA384     = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, SHA384}
+	RSA_SHA512     = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS, signing, SHA512}
+	RSA_PSS_SHA1   = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_PSS, signing, SHA1}
+	RSA_PSS_SHA224 = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_PSS, signing, SHA224}
+	RSA_PSS_SHA256 = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_PSS, signing, SHA256}
+	RSA_PSS_SHA384 = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_PSS, signing, SHA384}
+	RSA_PSS_SHA512 = KeyMechanism{C.CKK_RSA, C.CKM_RSA_PKCS_KEY_PAIR_GEN, C.CKM_RSA_PKCS_PSS, signing, SHA512}
+	ECDSA_SHA1     = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDSA, signing, SHA1}
+	ECDSA_SHA224   = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDSA, signing, SHA224}
+	ECDSA_SHA256   = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDSA, signing, SHA256}
+	ECDSA_SHA384   = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDSA, signing, SHA384}
+	ECDSA_SHA512   = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDSA, signing, SHA512}
+	// Ed25519 signs the message itself (pure EdDSA)
+	Ed25519 = KeyMechanism{C.CKK_EC_EDWARDS, C.CKM_EC_EDWARDS_KEY_PAIR_GEN, C.CKM_EDDSA, signing, DigestMechanism{}}
+	// ECDH derives the raw shared secret (x-coordinate) without a KDF
+	ECDH = KeyMechanism{C.CKK_EC, C.CKM_EC_KEY_PAIR_GEN, C.CKM_ECDH1_DERIVE, keyAgreement, DigestMechanism{}}
+)
+
+// c returns the mechanism of the key operations in C memory, which must be released with C.free
+func (km KeyMechanism) c() *C.CK_MECHANISM {
+	switch km.mechanism {
+	case C.CKM_RSA_PKCS_OAEP:
+		parameters := C.CK_RSA_PKCS_OAEP_PARAMS{hashAlg: km.digest.mechanism, mgf: km.digest.mgf, source: C.CKZ_DATA_SPECIFIED}
+		return newMechanism(km.mechanism, unsafe.Pointer(&parameters), unsafe.Sizeof(parameters))
+	case C.CKM_RSA_PKCS_PSS:
+		parameters := C.CK_RSA_PKCS_PSS_PARAMS{hashAlg: km.digest.mechanism, mgf: km.digest.mgf, sLen: C.CK_ULONG(km.digest.size)}
+		return newMechanism(km.mechanism, unsafe.Pointer(&parameters), unsafe.Sizeof(parameters))
+	}
+	return newMechanism(km.mechanism, nil, 0)
+}
+
+// usage returns the attribute allowing the private and the public key operations of the purpose
+func (km KeyMechanism) usage() (private, public C.CK_ATTRIBUTE_TYPE) {
+	switch km.purpose {
+	case encryption:
+		return C.CKA_DECRYPT, C.CKA_ENCRYPT
+	case signing:
+		return C.CKA_SIGN, C.CKA_VERIFY
+	}
+	return C.CKA_DERIVE, C.CKA_DERIVE
+}
+
+// KeyFilter finds an existing key pair on the token by its label (CKA_LABEL) and/or ID (CKA_ID).
+// The public key is found by the ID of the private key if it has one, otherwise by the label.
+// If only a public key matches, the constructor returns a partially initialized key.
+type KeyFilter struct {
+	Label string
+	ID    []byte
+}
+
+// KeyTemplate generates a new key pair on the token. The private key is sensitive, non-extractable
+// and private (CKA_PRIVATE), so most tokens require the session to be logged in.
+type KeyTemplate struct {
+	// Size is the RSA modulus size or the EC curve size (224, 256, 384 or 521) in bits, ignored for Ed25519
+	Size  int
+	Label string
+	ID    []byte
+	// Persistent keys are stored on the token (CKA_TOKEN), otherwise they are session objects
+	// destroyed when the key and its PublicKeys are closed (or with the session).
+	Persistent bool
+}
+
+// KeyConstructor returns the okapi.KeyConstructor creating keys of the mechanism held by the token.
+// It accepts the following parameters:
+// * KeyFilter: finds an existing key pair on the token
+// * KeyTemplate: generates a new key pair on the token
+// * int: generates a new session key pair of given size in bits
+// * okapi.PublicKey: generates a new session key pair with the same size or curve as the provided key
+// * []byte: imports a public key (X.509 SubjectPublicKeyInfo) from DER encoding as a session object
+// * okapi.KeyParameters: any of the above, the Random is ignored because the token uses its own
+// Private keys cannot be imported into the token.
+func (s *Session) KeyConstructor(mechanism KeyMechanism) okapi.KeyConstructor {
+	return func(parameters interface{}) (okapi.PrivateKey, error) {
+		key, err := s.NewPKey(parameters, mechanism)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// NewPKey creates a key of the mechanism from the parameters accepted by Session.KeyConstructor.
+func (s *Session) NewPKey(parameters interface{}, mechanism KeyMechanism) (*PKey, error) {
+	switch p := parameters.(type) {
+	case okapi.KeyParameters:
+		return s.NewPKey(p.Parameters, mechanism)
+	case KeyFilter:
+		return s.findKey(p, mechanism)
+	case KeyTemplate:
+		return s.generateKey(p, mechanism)
+	case int:
+		return s.generateKey(KeyTemplate{Size: p}, mechanism)
+	case okapi.PublicKey:
+		der, err := okapi.ExportKey(p)
+		if err != nil {
+			return nil, err
+		}
+		public, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		switch public := public.(type) {
+		case *rsa.PublicKey:
+			return s.generateKey(KeyTemplate{Size: public.N.BitLen()}, mechanism)
+		case *ecdsa.PublicKey:
+			return s.generateKey(KeyTemplate{Size: public.Curve.Params().BitSize}, mechanism)
+		case ed25519.PublicKey:
+			return s.generateKey(KeyTemplate{}, mechanism)
+		}
+		return nil, errors.New("Unsupported public key")
+	case []byte:
+		return s.importKey(p, mechanism)
+	}
+	return nil, errors.New("Unsupported key parameters")
+}
+
+// PKey is a key pair held by the token, identified by the handles of its objects.
+// The private key operations are performed by the token with the private key object,
+// the public key operations with the public key object.
+// The objects are shared by the PKey and its PublicKeys and the objects created by the package
+// are destroyed when the last of them is closed.
+type PKey struct {
+	session   *Session
+	mechanism KeyMechanism
+	objects   *keyObjects
+	// public is true for the PublicKey of a PKey
+	public bool
+	// size is the RSA modulus size or the EC curve size in bits
+	size int
+}
+
+type keyObjects struct {
+	// private is 0 (CK_INVALID_HANDLE) for partially initialized keys,
+	// public is 0 if the token doesn't hold the public key
+	private, public C.CK_OBJECT_HANDLE
+	// destroyPrivate and destroyPublic are set for the objects created by the package with session lifetime
+	destroyPrivate, destroyPublic bool
+	refs                          int32
+}
+
+func (key *PKey) Decrypt(encrypted []byte) ([]byte, error) {
+	if key.public || key.objects.private == 0 {
+		return nil, errors.New("Public key cannot decrypt!")
+	}
+	if key.mechanism.purpose != encryption {
+		return nil, errors.New("Key is not configured for encryption!")
+	}
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	m := key.mechanism.c()
+	defer C.free(unsafe.Pointer(m))
+	if err := check("C_DecryptInit", C.okapi_C_DecryptInit(s.module.f, s.handle, m, key.objects.private)); err != nil {
+		return nil, err
+	}
+	return output("C_Decrypt", func(out *C.CK_BYTE, length *C.CK_ULONG) C.CK_RV {
+		return C.okapi_C_Decrypt(s.module.f, s.handle, buffer(encrypted), C.CK_ULONG(len(encrypted)), out, length)
+	})
+}
+
+func (key *PKey) Sign(digest []byte) ([]byte, error) {
+	if key.public || key.objects.private == 0 {
+		return nil, errors.New("Public key cannot sign!")
+	}
+	if key.mechanism.purpose != signing {
+		return nil, errors.New("Key is not configured for signing!")
+	}
+	input, err := key.signatureInput(digest)
+	if err != nil {
+		return nil, err
+	}
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	m := key.mechanism.c()
+	defer C.free(unsafe.Pointer(m))
+	if err := check("C_SignInit", C.okapi_C_SignInit(s.module.f, s.handle, m, key.objects.private)); err != nil {
+		return nil, err
+	}
+	signature, err := output("C_Sign", func(out *C.CK_BYTE, length *C.CK_ULONG) C.CK_RV {
+		return C.okapi_C_Sign(s.module.f, s.handle, buffer(input), C.CK_ULONG(len(input)), out, length)
+	})
+	if err != nil || key.mechanism.mechanism != C.CKM_ECDSA {
+		return signature, err
+	}
+	// the token signature is the concatenation of r and s
+	half := len(signature) / 2
+	return asn1.Marshal(ecdsaSignature{new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])})
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// signatureInput returns the input of the token signature mechanism for the digest
+func (key *PKey) signatureInput(digest []byte) ([]byte, error) {
+	d := key.mechanism.digest
+	switch key.mechanism.mechanism {
+	case C.CKM_RSA_PKCS, C.CKM_RSA_PKCS_PSS:
+		if len(digest) != d.size {
+			return nil, errors.New("Invalid digest size")
+		}
+		if key.mechanism.mechanism == C.CKM_RSA_PKCS {
+			return append(append([]byte(nil), d.digestInfo...), digest...), nil
+		}
+	case C.CKM_ECDSA:
+		// the leftmost bits of the digest, the supported curve sizes are byte aligned or larger than the digests
+		if size := (key.size + 7) / 8; len(digest) > size {
+			return digest[:size], nil
+		}
+	}
+	return digest, nil
+}
+
+func (key *PKey) Derive(peer okapi.PublicKey) ([]byte, error) {
+	if key.public || key.objects.private == 0 {
+		return nil, errors.New("Public key cannot derive!")
+	}
+	if key.mechanism.purpose != keyAgreement {
+		return nil, errors.New("Key is not configured for key agreement!")
+	}
+	der, err := okapi.ExportKey(peer)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := public.(*ecdsa.PublicKey)
+	if !ok || ec.Curve.Params().BitSize != key.size {
+		return nil, errors.New("Peer key doesn't match the key curve")
+	}
+	point := C.CBytes(elliptic.Marshal(ec.Curve, ec.X, ec.Y))
+	defer C.free(point)
+	parameters := C.CK_ECDH1_DERIVE_PARAMS{
+		kdf:             C.CKD_NULL,
+		ulPublicDataLen: C.CK_ULONG(1 + 2*((key.size+7)/8)),
+		pPublicData:     (*C.CK_BYTE)(point),
+	}
+	m := newMechanism(C.CKM_ECDH1_DERIVE, unsafe.Pointer(&parameters), unsafe.Sizeof(parameters))
+	defer C.free(unsafe.Pointer(m))
+	attributes, count, free := template{
+		ulongAttribute(C.CKA_CLASS, C.CKO_SECRET_KEY),
+		ulongAttribute(C.CKA_KEY_TYPE, C.CKK_GENERIC_SECRET),
+		ulongAttribute(C.CKA_VALUE_LEN, uint((key.size+7)/8)),
+		boolAttribute(C.CKA_TOKEN, false),
+		boolAttribute(C.CKA_SENSITIVE, false),
+		boolAttribute(C.CKA_EXTRACTABLE, true),
+	}.c()
+	defer free()
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	var secret C.CK_OBJECT_HANDLE
+	if err := check("C_DeriveKey", C.okapi_C_DeriveKey(s.module.f, s.handle, m, key.objects.private, attributes, count, &secret)); err != nil {
+		return nil, err
+	}
+	defer s.destroy(secret)
+	return s.getAttribute(secret, C.CKA_VALUE)
+}
+
+func (key *PKey) Encrypt(plain []byte) ([]byte, error) {
+	if key.mechanism.purpose != encryption {
+		return nil, errors.New("Key is not configured for encryption!")
+	}
+	if key.objects.public == 0 {
+		return nil, errors.New("The token doesn't hold the public key")
+	}
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	m := key.mechanism.c()
+	defer C.free(unsafe.Pointer(m))
+	if err := check("C_EncryptInit", C.okapi_C_EncryptInit(s.module.f, s.handle, m, key.objects.public)); err != nil {
+		return nil, err
+	}
+	return output("C_Encrypt", func(out *C.CK_BYTE, length *C.CK_ULONG) C.CK_RV {
+		return C.okapi_C_Encrypt(s.module.f, s.handle, buffer(plain), C.CK_ULONG(len(plain)), out, length)
+	})
+}
+
+func (key *PKey) Verify(signature []byte, digest []byte) (bool, error) {
+	if key.mechanism.purpose != signing {
+		return false, errors.New("Key is not configured for signing!")
+	}
+	if key.objects.public == 0 {
+		return false, errors.New("The token doesn't hold the public key")
+	}
+	input, err := key.signatureInput(digest)
+	if err != nil {
+		return false, err
+	}
+	if key.mechanism.mechanism == C.CKM_ECDSA {
+		var rs ecdsaSignature
+		if rest, err := asn1.Unmarshal(signature, &rs); err != nil || len(rest) > 0 || rs.R.Sign() < 0 || rs.S.Sign() < 0 {
+			return false, nil
+		}
+		size := (key.size + 7) / 8
+		if rs.R.BitLen() > 8*size || rs.S.BitLen() > 8*size {
+			return false, nil
+		}
+		signature = make([]byte, 2*size)
+		rs.R.FillBytes(signature[:size])
+		rs.S.FillBytes(signature[size:])
+	}
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return false, errClosed
+	}
+	m := key.mechanism.c()
+	defer C.free(unsafe.Pointer(m))
+	if err := check("C_VerifyInit", C.okapi_C_VerifyInit(s.module.f, s.handle, m, key.objects.public)); err != nil {
+		return false, err
+	}
+	rv := C.okapi_C_Verify(s.module.f, s.handle, buffer(input), C.CK_ULONG(len(input)), buffer(signature), C.CK_ULONG(len(signature)))
+	switch rv {
+	case C.CKR_OK:
+		return true, nil
+	case C.CKR_SIGNATURE_INVALID, C.CKR_SIGNATURE_LEN_RANGE:
+		return false, nil
+	}
+	return false, check("C_Verify", rv)
+}
+
+func (key *PKey) PublicKey() okapi.PublicKey {
+	atomic.AddInt32(&key.objects.refs, 1)
+	return &PKey{session: key.session, mechanism: key.mechanism, objects: key.objects, public: true, size: key.size}
+}
+
+// Export encodes public keys and partially initialized keys as X.509 SubjectPublicKeyInfo,
+// private keys held by the token cannot be exported.
+func (key *PKey) Export() ([]byte, error) {
+	if !key.public && key.objects.private != 0 {
+		return nil, errors.New("Private keys held by the token cannot be exported")
+	}
+	s := key.session
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	public, err := s.publicKey(key.objects.public, key.mechanism.keyType)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKIXPublicKey(public)
+}
+
+// KeySize returns the RSA modulus size or the EC curve size in bits (253 for Ed25519).
+func (key *PKey) KeySize() int {
+	return key.size
+}
+
+func (key *PKey) Close() {
+	if key.objects == nil {
+		return
+	}
+	objects := key.objects
+	key.objects = nil
+	if atomic.AddInt32(&objects.refs, -1) > 0 {
+		return
+	}
+	key.session.Lock()
+	defer key.session.Unlock()
+	if objects.destroyPrivate {
+		key.session.destroy(objects.private)
+	}
+	if objects.destroyPublic {
+		key.session.destroy(objects.public)
+	}
+}
+
+// output calls a single-part operation twice, to get the output length and then the output
+func output(function string, call func(out *C.CK_BYTE, length *C.CK_ULONG) C.CK_RV) ([]byte, error) {
+	var length C.CK_ULONG
+	if err := check(function, call(nil, &length)); err != nil {
+		return nil, err
+	}
+	out := make([]byte, length+1)
+	if err := check(function, call(buffer(out), &length)); err != nil {
+		return nil, err
+	}
+	return out[:length], nil
+}
+
+// findKey finds the key pair matching the filter
+func (s *Session) findKey(filter KeyFilter, mechanism KeyMechanism) (*PKey, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	match := func(class uint, label string, id []byte) (C.CK_OBJECT_HANDLE, error) {
+		t := template{ulongAttribute(C.CKA_CLASS, class), ulongAttribute(C.CKA_KEY_TYPE, uint(mechanism.keyType))}
+		if label != "" {
+			t = append(t, attribute{C.CKA_LABEL, []byte(label)})
+		}
+		if len(id) > 0 {
+			t = append(t, attribute{C.CKA_ID, id})
+		}
+		objects, err := s.find(t)
+		if err != nil {
+			return 0, err
+		}
+		if len(objects) > 1 {
+			return 0, errors.New("Multiple keys match the filter")
+		}
+		if len(objects) == 0 {
+			return 0, nil
+		}
+		return objects[0], nil
+	}
+	objects := &keyObjects{refs: 1}
+	var err error
+	if objects.private, err = match(C.CKO_PRIVATE_KEY, filter.Label, filter.ID); err != nil {
+		return nil, err
+	}
+	label, id := filter.Label, filter.ID
+	if objects.private != 0 {
+		if id, err = s.getAttribute(objects.private, C.CKA_ID); err != nil {
+			return nil, err
+		}
+		if len(id) > 0 {
+			label = ""
+		} else if l, err := s.getAttribute(objects.private, C.CKA_LABEL); err == nil {
+			label = string(l)
+		}
+	}
+	if objects.public, err = match(C.CKO_PUBLIC_KEY, label, id); err != nil {
+		return nil, err
+	}
+	if objects.private == 0 && objects.public == 0 {
+		return nil, errors.New("No key matches the filter")
+	}
+	if objects.public == 0 && mechanism.keyType == C.CKK_RSA {
+		// the public components of RSA private keys are readable, provide the public key as a session object
+		if public, err := s.publicKey(objects.private, mechanism.keyType); err == nil {
+			if objects.public, err = s.createPublic(public, mechanism); err != nil {
+				return nil, err
+			}
+			objects.destroyPublic = true
+		}
+	}
+	return s.newKey(objects, mechanism)
+}
+
+// generateKey generates a new key pair from the template
+func (s *Session) generateKey(kt KeyTemplate, mechanism KeyMechanism) (*PKey, error) {
+	privateUsage, publicUsage := mechanism.usage()
+	private := template{
+		boolAttribute(C.CKA_TOKEN, kt.Persistent),
+		boolAttribute(C.CKA_PRIVATE, true),
+		boolAttribute(C.CKA_SENSITIVE, true),
+		boolAttribute(C.CKA_EXTRACTABLE, false),
+		boolAttribute(privateUsage, true),
+	}
+	public := template{
+		boolAttribute(C.CKA_TOKEN, kt.Persistent),
+		boolAttribute(publicUsage, true),
+	}
+	if kt.Label != "" {
+		private = append(private, attribute{C.CKA_LABEL, []byte(kt.Label)})
+		public = append(public, attribute{C.CKA_LABEL, []byte(kt.Label)})
+	}
+	if len(kt.ID) > 0 {
+		private = append(private, attribute{C.CKA_ID, kt.ID})
+		public = append(public, attribute{C.CKA_ID, kt.ID})
+	}
+	switch mechanism.keyType {
+	case C.CKK_RSA:
+		if kt.Size < 512 {
+			return nil, errors.New("Invalid RSA key size")
+		}
+		public = append(public,
+			ulongAttribute(C.CKA_MODULUS_BITS, uint(kt.Size)),
+			attribute{C.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}})
+	case C.CKK_EC:
+		curve, ok := size2curve[kt.Size]
+		if !ok {
+			return nil, errors.New("Unsupported curve size")
+		}
+		parameters, _ := asn1.Marshal(curve.oid)
+		public = append(public, attribute{C.CKA_EC_PARAMS, parameters})
+	case C.CKK_EC_EDWARDS:
+		parameters, _ := asn1.Marshal(oidEd25519)
+		public = append(public, attribute{C.CKA_EC_PARAMS, parameters})
+	}
+	m := newMechanism(mechanism.generate, nil, 0)
+	defer C.free(unsafe.Pointer(m))
+	publicAttributes, publicCount, freePublic := public.c()
+	defer freePublic()
+	privateAttributes, privateCount, freePrivate := private.c()
+	defer freePrivate()
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	objects := &keyObjects{refs: 1, destroyPrivate: !kt.Persistent, destroyPublic: !kt.Persistent}
+	if err := check("C_GenerateKeyPair", C.okapi_C_GenerateKeyPair(s.module.f, s.handle, m,
+		publicAttributes, publicCount, privateAttributes, privateCount, &objects.public, &objects.private)); err != nil {
+		return nil, err
+	}
+	return s.newKey(objects, mechanism)
+}
+
+// importKey imports the DER encoded public key as a session object
+func (s *Session) importKey(der []byte, mechanism KeyMechanism) (*PKey, error) {
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("Private keys cannot be imported into the token")
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return nil, errClosed
+	}
+	objects := &keyObjects{refs: 1, destroyPublic: true}
+	if objects.public, err = s.createPublic(public, mechanism); err != nil {
+		return nil, err
+	}
+	return s.newKey(objects, mechanism)
+}
+
+// createPublic creates a public key session object, the caller must hold the session lock
+func (s *Session) createPublic(public interface{}, mechanism KeyMechanism) (C.CK_OBJECT_HANDLE, error) {
+	_, usage := mechanism.usage()
+	t := template{
+		ulongAttribute(C.CKA_CLASS, C.CKO_PUBLIC_KEY),
+		ulongAttribute(C.CKA_KEY_TYPE, uint(mechanism.keyType)),
+		boolAttribute(C.CKA_TOKEN, false),
+		boolAttribute(usage, true),
+	}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if mechanism.keyType != C.CKK_RSA {
+			return 0, errors.New("Key type doesn't match the mechanism")
+		}
+		t = append(t,
+			attribute{C.CKA_MODULUS, public.N.Bytes()},
+			attribute{C.CKA_PUBLIC_EXPONENT, big.NewInt(int64(public.E)).Bytes()})
+	case *ecdsa.PublicKey:
+		curve, ok := size2curve[public.Curve.Params().BitSize]
+		if !ok || mechanism.keyType != C.CKK_EC {
+			return 0, errors.New("Key type doesn't match the mechanism")
+		}
+		parameters, _ := asn1.Marshal(curve.oid)
+		point, _ := asn1.Marshal(elliptic.Marshal(public.Curve, public.X, public.Y))
+		t = append(t, attribute{C.CKA_EC_PARAMS, parameters}, attribute{C.CKA_EC_POINT, point})
+	case ed25519.PublicKey:
+		if mechanism.keyType != C.CKK_EC_EDWARDS {
+			return 0, errors.New("Key type doesn't match the mechanism")
+		}
+		parameters, _ := asn1.Marshal(oidEd25519)
+		point, _ := asn1.Marshal([]byte(public))
+		t = append(t, attribute{C.CKA_EC_PARAMS, parameters}, attribute{C.CKA_EC_POINT, point})
+	default:
+		return 0, errors.New("Unsupported public key")
+	}
+	return s.create(t)
+}
+
+// newKey creates the PKey for the objects, reading the key size from the token.
+// The caller must hold the session lock.
+func (s *Session) newKey(objects *keyObjects, mechanism KeyMechanism) (*PKey, error) {
+	key := &PKey{session: s, mechanism: mechanism, objects: objects}
+	object := objects.private
+	if object == 0 {
+		object = objects.public
+	}
+	switch mechanism.keyType {
+	case C.CKK_RSA:
+		modulus, err := s.getAttribute(object, C.CKA_MODULUS)
+		if err != nil {
+			return nil, err
+		}
+		key.size = new(big.Int).SetBytes(modulus).BitLen()
+	case C.CKK_EC:
+		curve, err := s.curve(object)
+		if err != nil {
+			return nil, err
+		}
+		key.size = curve.Params().BitSize
+	case C.CKK_EC_EDWARDS:
+		key.size = 253
+	}
+	return key, nil
+}
+
+// Supported curves with their OIDs (RFC 5480)
+type namedCurve struct {
+	oid   asn1.ObjectIdentifier
+	curve elliptic.Curve
+}
+
+var (
+	size2curve = map[int]namedCurve{
+		224: {asn1.ObjectIdentifier{1, 3, 132, 0, 33}, elliptic.P224()},
+		256: {asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, elliptic.P256()},
+		384: {asn1.ObjectIdentifier{1, 3, 132, 0, 34}, elliptic.P384()},
+		521: {asn1.ObjectIdentifier{1, 3, 132, 0, 35}, elliptic.P521()},
+	}
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// curve returns the curve of the EC key object, the caller must hold the session lock
+func (s *Session) curve(object C.CK_OBJECT_HANDLE) (elliptic.Curve, error) {
+	parameters, err := s.getAttribute(object, C.CKA_EC_PARAMS)
+	if err != nil {
+		return nil, err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(parameters, &oid); err == nil {
+		for _, c := range size2curve {
+			if c.oid.Equal(oid) {
+				return c.curve, nil
+			}
+		}
+	}
+	return nil, errors.New("Unsupported curve")
+}
+
+// publicKey reads the public key from the key object, the caller must hold the session lock.
+// The object can be an RSA private key too.
+func (s *Session) publicKey(object C.CK_OBJECT_HANDLE, keyType C.CK_KEY_TYPE) (interface{}, error) {
+	if object == 0 {
+		return nil, errors.New("The token doesn't hold the public key")
+	}
+	switch keyType {
+	case C.CKK_RSA:
+		modulus, err := s.getAttribute(object, C.CKA_MODULUS)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := s.getAttribute(object, C.CKA_PUBLIC_EXPONENT)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}, nil
+	case C.CKK_EC:
+		curve, err := s.curve(object)
+		if err != nil {
+			return nil, err
+		}
+		point, err := s.point(object, 1+2*((curve.Params().BitSize+7)/8))
+		if err != nil {
+			return nil, err
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errors.New("Invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case C.CKK_EC_EDWARDS:
+		point, err := s.point(object, ed25519.PublicKeySize)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(point), nil
+	}
+	return nil, errors.New("Unsupported key type")
+}
+
+// point reads the CKA_EC_POINT, which is DER encoded as an OCTET STRING,
+// although some tokens provide the raw point
+func (s *Session) point(object C.CK_OBJECT_HANDLE, size int) ([]byte, error) {
+	point, err := s.getAttribute(object, C.CKA_EC_POINT)
+	if err != nil {
+		return nil, err
+	}
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 && len(raw) == size {
+		return raw, nil
+	}
+	if len(point) != size {
+		return nil, errors.New("Invalid EC point")
+	}
+	return point, nil
+}
@@ -0,0 +1,187 @@
+//go:build !windows
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"github.com/mkobetic/okapi"
+	"testing"
+)
+
+func TestRSA_OAEP(t *testing.T) {
+	s := session(t)
+	requires(t, s, RSA_OAEP, "RSA_OAEP")
+	pri, err := s.NewPKey(2048, RSA_OAEP)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	if pri.KeySize() != 2048 {
+		t.Fatal("Invalid key size!")
+	}
+	if _, err := pri.Export(); err == nil {
+		t.Fatal("Private key should not be exported")
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	plain := []byte("Message in a bottle!")
+	encrypted, err := pub.Encrypt(plain)
+	if err != nil {
+		t.Fatalf("Encryption failed: %s", err)
+	}
+	decrypted, err := pri.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decryption failed: %s", err)
+	}
+	if !bytes.Equal(plain, decrypted) {
+		t.Fatalf("Result mismatch\nPlain    : %x\nDecrypted: %x\n", plain, decrypted)
+	}
+	// interoperability with crypto/rsa
+	der, err := okapi.ExportKey(pub)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	public, _ := x509.ParsePKIXPublicKey(der)
+	encrypted, _ = rsa.EncryptOAEP(crypto.SHA1.New(), rand.Reader, public.(*rsa.PublicKey), plain, nil)
+	if decrypted, err = pri.Decrypt(encrypted); err != nil || !bytes.Equal(plain, decrypted) {
+		t.Fatalf("Decryption of crypto/rsa output failed: %v", err)
+	}
+	if _, err = pri.Sign(plain); err == nil {
+		t.Fatal("Encryption key should not sign")
+	}
+}
+
+func TestRSA_PSS_SHA256(t *testing.T) {
+	s := session(t)
+	requires(t, s, RSA_PSS_SHA256, "RSA_PSS_SHA256")
+	pri, err := s.NewPKey(2048, RSA_PSS_SHA256)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	pub := pri.PublicKey()
+	defer pub.Close()
+	digest := sha256.Sum256([]byte("Message in a bottle!"))
+	signature, err := pri.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	valid, err := pub.Verify(signature, digest[:])
+	if err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	der, _ := okapi.ExportKey(pub)
+	public, _ := x509.ParsePKIXPublicKey(der)
+	if err = rsa.VerifyPSS(public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature, nil); err != nil {
+		t.Fatalf("crypto/rsa verification failed: %s", err)
+	}
+	digest[0] ^= 1
+	if valid, _ = pub.Verify(signature, digest[:]); valid {
+		t.Fatal("Verification of wrong digest succeeded")
+	}
+}
+
+func TestECDSA(t *testing.T) {
+	s := session(t)
+	requires(t, s, ECDSA_SHA256, "ECDSA_SHA256")
+	pri, err := s.NewPKey(KeyTemplate{Size: 256, Label: "okapi test", ID: []byte{0x42}}, ECDSA_SHA256)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	digest := sha256.Sum256([]byte("Message in a bottle!"))
+	signature, err := pri.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	der, err := okapi.ExportKey(pub)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	public, _ := x509.ParsePKIXPublicKey(der)
+	if !ecdsa.VerifyASN1(public.(*ecdsa.PublicKey), digest[:], signature) {
+		t.Fatal("crypto/ecdsa verification failed")
+	}
+	// the imported public key verifies on the token
+	imported, err := s.NewPKey(der, ECDSA_SHA256)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	defer imported.Close()
+	if valid, err := imported.PublicKey().Verify(signature, digest[:]); err != nil || !valid {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	// the session key is found by its label and ID
+	found, err := s.NewPKey(KeyFilter{Label: "okapi test", ID: []byte{0x42}}, ECDSA_SHA256)
+	if err != nil {
+		t.Fatalf("Find failed: %s", err)
+	}
+	defer found.Close()
+	if valid, err := found.PublicKey().Verify(signature, digest[:]); err != nil || !valid {
+		t.Fatalf("Verification with the found key failed: %v", err)
+	}
+}
+
+func TestECDH(t *testing.T) {
+	s := session(t)
+	requires(t, s, ECDH, "ECDH")
+	pri1, err := s.NewPKey(384, ECDH)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri1.Close()
+	pub1 := pri1.PublicKey()
+	defer pub1.Close()
+	pri2, err := s.KeyConstructor(ECDH)(okapi.KeyParameters{Parameters: pub1})
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri2.Close()
+	pub2 := pri2.PublicKey()
+	defer pub2.Close()
+	secret1, err := pri1.Derive(pub2)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	secret2, err := pri2.Derive(pub1)
+	if err != nil {
+		t.Fatalf("Derive error: %s", err)
+	}
+	if len(secret1) != 48 || !bytes.Equal(secret1, secret2) {
+		t.Fatalf("Secrets don't match\n%x\n%x", secret1, secret2)
+	}
+}
+
+func TestEd25519(t *testing.T) {
+	s := session(t)
+	requires(t, s, Ed25519, "Ed25519")
+	pri, err := s.NewPKey(0, Ed25519)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	defer pri.Close()
+	message := []byte("Message in a bottle!")
+	signature, err := pri.Sign(message)
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err)
+	}
+	pub := pri.PublicKey()
+	defer pub.Close()
+	der, err := okapi.ExportKey(pub)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	public, _ := x509.ParsePKIXPublicKey(der)
+	if !ed25519.Verify(public.(ed25519.PublicKey), message, signature) {
+		t.Fatal("crypto/ed25519 verification failed")
+	}
+}
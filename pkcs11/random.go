@@ -0,0 +1,43 @@
+//go:build !windows
+
+package pkcs11
+
+// #include "pkcs11.h"
+import "C"
+import (
+	"github.com/mkobetic/okapi"
+)
+
+// RandomSpec returns the RandomSpec generating random bytes with the token (C_GenerateRandom).
+// It can be used as okapi.DefaultRandom or passed to other implementations with okapi.KeyParameters.
+func (s *Session) RandomSpec() okapi.RandomSpec {
+	return randomSpec{s}
+}
+
+type randomSpec struct {
+	session *Session
+}
+
+func (rs randomSpec) New() okapi.Random {
+	return &Random{session: rs.session}
+}
+
+// Random reads from the token random generator using the session of its RandomSpec.
+type Random struct {
+	session *Session
+}
+
+func (r *Random) Read(b []byte) (int, error) {
+	r.session.Lock()
+	defer r.session.Unlock()
+	if r.session.module == nil {
+		return 0, errClosed
+	}
+	if err := check("C_GenerateRandom", C.okapi_C_GenerateRandom(r.session.module.f, r.session.handle, buffer(b), C.CK_ULONG(len(b)))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (r *Random) Close() {
+}
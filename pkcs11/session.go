@@ -0,0 +1,264 @@
+//go:build !windows
+
+package pkcs11
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "pkcs11.h"
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/mkobetic/okapi"
+	"sync"
+	"unsafe"
+)
+
+// Session is a session with a token. PKCS#11 sessions don't allow concurrent use,
+// so the operations of the keys created from a session are serialized by its mutex.
+// Hashes, HMACs and ciphers open their own sessions with the token to keep their multi-part operations.
+type Session struct {
+	sync.Mutex
+	module *Module
+	slot   Slot
+	handle C.CK_SESSION_HANDLE
+}
+
+// Close closes the session, the keys created from it become invalid
+// and the keys generated with session lifetime are destroyed by the token.
+func (s *Session) Close() {
+	s.Lock()
+	defer s.Unlock()
+	if s.module == nil {
+		return
+	}
+	C.okapi_C_CloseSession(s.module.f, s.handle)
+	s.module = nil
+}
+
+// Slot returns the slot of the token.
+func (s *Session) Slot() Slot {
+	return s.slot
+}
+
+// Register sets the okapi hashes, HMAC and ciphers to the ones provided by the token,
+// if the token supports the corresponding mechanisms. Neither the key constructors
+// nor DefaultRandom are replaced, use Session.KeyConstructor and Session.RandomSpec for those.
+func (s *Session) Register() error {
+	supported, err := s.mechanisms()
+	if err != nil {
+		return err
+	}
+	for _, h := range []struct {
+		spec   *okapi.HashSpec
+		digest DigestMechanism
+	}{
+		{&okapi.MD5, MD5}, {&okapi.SHA1, SHA1}, {&okapi.SHA224, SHA224},
+		{&okapi.SHA256, SHA256}, {&okapi.SHA384, SHA384}, {&okapi.SHA512, SHA512},
+	} {
+		if supported[h.digest.mechanism] {
+			okapi.Register(h.spec, s.HashSpec(h.digest))
+		}
+	}
+	if supported[SHA256.hmac] {
+		okapi.Register(&okapi.HMAC, s.HMAC())
+	}
+	for _, c := range []struct {
+		spec   *okapi.CipherSpec
+		cipher CipherMechanism
+	}{
+		{&okapi.AES_ECB, AES_ECB}, {&okapi.AES_CBC, AES_CBC}, {&okapi.AES_CTR, AES_CTR},
+		{&okapi.DES3_ECB, DES3_ECB}, {&okapi.DES3_CBC, DES3_CBC},
+	} {
+		if supported[c.cipher.mechanism] {
+			okapi.Register(c.spec, s.CipherSpec(c.cipher))
+		}
+	}
+	return nil
+}
+
+// Supports checks whether the token supports the mechanism of a DigestMechanism,
+// CipherMechanism or KeyMechanism.
+func (s *Session) Supports(mechanism interface{}) bool {
+	supported, err := s.mechanisms()
+	if err != nil {
+		return false
+	}
+	switch m := mechanism.(type) {
+	case DigestMechanism:
+		return supported[m.mechanism]
+	case CipherMechanism:
+		return supported[m.mechanism]
+	case KeyMechanism:
+		return supported[m.mechanism] && supported[m.generate]
+	}
+	return false
+}
+
+// mechanisms returns the set of mechanisms supported by the token
+func (s *Session) mechanisms() (map[C.CK_MECHANISM_TYPE]bool, error) {
+	f, slot := s.module.f, C.CK_SLOT_ID(s.slot.ID)
+	var count C.CK_ULONG
+	if err := check("C_GetMechanismList", C.okapi_C_GetMechanismList(f, slot, nil, &count)); err != nil {
+		return nil, err
+	}
+	supported := make(map[C.CK_MECHANISM_TYPE]bool)
+	if count == 0 {
+		return supported, nil
+	}
+	list := make([]C.CK_MECHANISM_TYPE, count)
+	if err := check("C_GetMechanismList", C.okapi_C_GetMechanismList(f, slot, &list[0], &count)); err != nil {
+		return nil, err
+	}
+	for _, m := range list[:count] {
+		supported[m] = true
+	}
+	return supported, nil
+}
+
+// open opens another session with the same token, for the operations that need their own
+func (s *Session) open() *Session {
+	session, err := s.module.openSession(s.slot)
+	if err != nil {
+		panic(err)
+	}
+	return session
+}
+
+// attribute is an object attribute with its value encoded as expected by the token
+type attribute struct {
+	typ   C.CK_ATTRIBUTE_TYPE
+	value []byte
+}
+
+func boolAttribute(typ C.CK_ATTRIBUTE_TYPE, value bool) attribute {
+	if value {
+		return attribute{typ, []byte{C.CK_TRUE}}
+	}
+	return attribute{typ, []byte{C.CK_FALSE}}
+}
+
+func ulongAttribute(typ C.CK_ATTRIBUTE_TYPE, value uint) attribute {
+	b := make([]byte, unsafe.Sizeof(C.CK_ULONG(0)))
+	if len(b) == 8 {
+		binary.NativeEndian.PutUint64(b, uint64(value))
+	} else {
+		binary.NativeEndian.PutUint32(b, uint32(value))
+	}
+	return attribute{typ, b}
+}
+
+// template is a list of attributes used to create, generate or find objects
+type template []attribute
+
+// c copies the template into C memory, free zeroes and releases it
+func (t template) c() (attributes *C.CK_ATTRIBUTE, count C.CK_ULONG, free func()) {
+	size := C.sizeof_CK_ATTRIBUTE * len(t)
+	for _, a := range t {
+		size += len(a.value)
+	}
+	if size == 0 {
+		return nil, 0, func() {}
+	}
+	p := C.malloc(C.size_t(size))
+	list := unsafe.Slice((*C.CK_ATTRIBUTE)(p), len(t))
+	value := unsafe.Add(p, C.sizeof_CK_ATTRIBUTE*len(t))
+	for i, a := range t {
+		list[i]._type = a.typ
+		list[i].pValue = nil
+		list[i].ulValueLen = C.CK_ULONG(len(a.value))
+		if len(a.value) > 0 {
+			C.memcpy(value, unsafe.Pointer(&a.value[0]), C.size_t(len(a.value)))
+			list[i].pValue = value
+			value = unsafe.Add(value, len(a.value))
+		}
+	}
+	return (*C.CK_ATTRIBUTE)(p), C.CK_ULONG(len(t)), func() {
+		// the template can contain secret key values
+		C.memset(p, 0, C.size_t(size))
+		C.free(p)
+	}
+}
+
+// newMechanism copies the mechanism with its parameter (a C struct value or nil) into C memory,
+// which must be released with C.free
+func newMechanism(typ C.CK_MECHANISM_TYPE, parameter unsafe.Pointer, size uintptr) *C.CK_MECHANISM {
+	m := (*C.CK_MECHANISM)(C.calloc(1, C.size_t(C.sizeof_CK_MECHANISM+size)))
+	m.mechanism = typ
+	if parameter != nil {
+		p := unsafe.Add(unsafe.Pointer(m), C.sizeof_CK_MECHANISM)
+		C.memcpy(p, parameter, C.size_t(size))
+		m.pParameter = p
+		m.ulParameterLen = C.CK_ULONG(size)
+	}
+	return m
+}
+
+// buffer returns the C pointer to the start of b, or nil if it is empty
+func buffer(b []byte) *C.CK_BYTE {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.CK_BYTE)(unsafe.Pointer(&b[0]))
+}
+
+// find returns the objects matching the template, the caller must hold the session lock
+func (s *Session) find(t template) ([]C.CK_OBJECT_HANDLE, error) {
+	f := s.module.f
+	attributes, count, free := t.c()
+	defer free()
+	if err := check("C_FindObjectsInit", C.okapi_C_FindObjectsInit(f, s.handle, attributes, count)); err != nil {
+		return nil, err
+	}
+	defer C.okapi_C_FindObjectsFinal(f, s.handle)
+	var objects []C.CK_OBJECT_HANDLE
+	batch := make([]C.CK_OBJECT_HANDLE, 16)
+	for {
+		var found C.CK_ULONG
+		if err := check("C_FindObjects", C.okapi_C_FindObjects(f, s.handle, &batch[0], C.CK_ULONG(len(batch)), &found)); err != nil {
+			return nil, err
+		}
+		if found == 0 {
+			return objects, nil
+		}
+		objects = append(objects, batch[:found]...)
+	}
+}
+
+// getAttribute reads the value of the object attribute, the caller must hold the session lock
+func (s *Session) getAttribute(object C.CK_OBJECT_HANDLE, typ C.CK_ATTRIBUTE_TYPE) ([]byte, error) {
+	a := (*C.CK_ATTRIBUTE)(C.calloc(1, C.sizeof_CK_ATTRIBUTE))
+	defer C.free(unsafe.Pointer(a))
+	a._type = typ
+	if err := check("C_GetAttributeValue", C.okapi_C_GetAttributeValue(s.module.f, s.handle, object, a, 1)); err != nil {
+		return nil, err
+	}
+	if a.ulValueLen == 0 {
+		return []byte{}, nil
+	}
+	a.pValue = C.malloc(C.size_t(a.ulValueLen))
+	defer C.free(a.pValue)
+	if err := check("C_GetAttributeValue", C.okapi_C_GetAttributeValue(s.module.f, s.handle, object, a, 1)); err != nil {
+		return nil, err
+	}
+	return C.GoBytes(a.pValue, C.int(a.ulValueLen)), nil
+}
+
+// create creates an object from the template, the caller must hold the session lock
+func (s *Session) create(t template) (C.CK_OBJECT_HANDLE, error) {
+	attributes, count, free := t.c()
+	defer free()
+	var object C.CK_OBJECT_HANDLE
+	err := check("C_CreateObject", C.okapi_C_CreateObject(s.module.f, s.handle, attributes, count, &object))
+	return object, err
+}
+
+// destroy destroys the object, the caller must hold the session lock
+func (s *Session) destroy(object C.CK_OBJECT_HANDLE) {
+	if s.module != nil {
+		C.okapi_C_DestroyObject(s.module.f, s.handle, object)
+	}
+}
+
+// errClosed is returned by the operations of keys whose session was closed
+var errClosed = errors.New("pkcs11 session is closed")
@@ -0,0 +1,524 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+)
+
+// PrivateKey is a private key with its certificate chain.
+type PrivateKey struct {
+	Key okapi.PrivateKey
+	// Algorithm is the public key algorithm of the key
+	Algorithm x509.PublicKeyAlgorithm
+	// Certificates is the certificate chain of the key, starting with the certificate of the key
+	Certificates []*x509.Certificate
+	FriendlyName string
+}
+
+// Certificate is a certificate that doesn't belong to any of the private keys, e.g. a trusted root.
+type Certificate struct {
+	Certificate  *x509.Certificate
+	FriendlyName string
+}
+
+// Store is the content of a PKCS#12 file.
+type Store struct {
+	PrivateKeys  []*PrivateKey
+	Certificates []*Certificate
+}
+
+// Close closes all the private keys of the store.
+func (s *Store) Close() {
+	for _, key := range s.PrivateKeys {
+		if key.Key != nil {
+			key.Key.Close()
+		}
+	}
+}
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is explicitly tagged which is handled manually
+	Content asn1.RawValue
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"optional,tag:0"`
+}
+
+type safeBag struct {
+	ID asn1.ObjectIdentifier
+	// Value is explicitly tagged which is handled manually
+	Value      asn1.RawValue
+	Attributes []attribute `asn1:"optional,set"`
+}
+
+type attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID    asn1.ObjectIdentifier
+	Value []byte `asn1:"explicit,tag:0"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// bag is a decoded key or certificate bag
+type bag struct {
+	key          []byte
+	certificate  *x509.Certificate
+	friendlyName string
+	localKeyID   []byte
+}
+
+// Decode decodes the DER encoded PKCS#12 file, decrypting it and verifying its integrity with the password.
+// Files without the password integrity MAC are refused (see DecodeUnauthenticated).
+// The constructor returns the KeyConstructor used to import each private key based on its algorithm
+// and certificate, the key must be configured for its intended use. If constructor is nil or returns nil,
+// RSA keys are imported with okapi.RSA_SHA256, EC keys with okapi.ECDSA_SHA256, okapi.ECDSA_384
+// or okapi.ECDSA_SHA512 depending on the curve, and Ed25519 keys with okapi.Ed25519.
+// The Store must be closed when no longer needed.
+func Decode(data []byte, password string, constructor func(key *PrivateKey) okapi.KeyConstructor) (*Store, error) {
+	return decode(data, password, constructor, true)
+}
+
+// DecodeUnauthenticated is like Decode, but it accepts files without the password integrity MAC
+// (the MAC is still verified if present). The content of such files is not authenticated,
+// e.g. the certificates can be replaced, so it should be used only for files from a trusted source.
+func DecodeUnauthenticated(data []byte, password string, constructor func(key *PrivateKey) okapi.KeyConstructor) (*Store, error) {
+	return decode(data, password, constructor, false)
+}
+
+func decode(data []byte, password string, constructor func(key *PrivateKey) okapi.KeyConstructor, requireMAC bool) (*Store, error) {
+	var p pfx
+	if rest, err := asn1.Unmarshal(data, &p); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after PKCS#12")
+	}
+	if p.Version != 3 {
+		return nil, fmt.Errorf("unsupported PKCS#12 version %d", p.Version)
+	}
+	if !p.AuthSafe.ContentType.Equal(oidData) {
+		return nil, errors.New("public key integrity mode is not supported")
+	}
+	var content []byte
+	if err := unmarshalExplicit(p.AuthSafe.Content, &content); err != nil {
+		return nil, err
+	}
+	if p.MacData.Mac.Algorithm.Algorithm == nil && requireMAC {
+		return nil, errors.New("PKCS#12 integrity MAC is missing")
+	}
+	if p.MacData.Mac.Algorithm.Algorithm != nil {
+		hash, err := hashByOID(p.MacData.Mac.Algorithm.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkIterations(p.MacData.Iterations); err != nil {
+			return nil, err
+		}
+		digest, err := mac(hash, password, p.MacData.MacSalt, p.MacData.Iterations, content)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(digest, p.MacData.Mac.Digest) != 1 {
+			return nil, errIncorrectPassword
+		}
+	}
+	var authenticatedSafe []contentInfo
+	if _, err := asn1.Unmarshal(content, &authenticatedSafe); err != nil {
+		return nil, err
+	}
+	var bags []*bag
+	defer func() {
+		for _, b := range bags {
+			okapi.Zero(b.key)
+		}
+	}()
+	for _, info := range authenticatedSafe {
+		var safeContents []byte
+		switch {
+		case info.ContentType.Equal(oidData):
+			if err := unmarshalExplicit(info.Content, &safeContents); err != nil {
+				return nil, err
+			}
+		case info.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			if err := unmarshalExplicit(info.Content, &ed); err != nil {
+				return nil, err
+			}
+			var err error
+			eci := ed.EncryptedContentInfo
+			if safeContents, err = decrypt(eci.ContentEncryptionAlgorithm, password, eci.EncryptedContent); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PKCS#12 content type %v", info.ContentType)
+		}
+		decoded, err := decodeBags(safeContents, password)
+		bags = append(bags, decoded...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	store := new(Store)
+	if err := store.assemble(bags, constructor); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// decodeBags decodes the key and certificate bags of the SafeContents, other bags are ignored.
+func decodeBags(safeContents []byte, password string) (bags []*bag, err error) {
+	var safeBags []safeBag
+	if _, err = asn1.Unmarshal(safeContents, &safeBags); err != nil {
+		return nil, err
+	}
+	for _, sb := range safeBags {
+		b := new(bag)
+		switch {
+		case sb.ID.Equal(oidKeyBag):
+			var raw asn1.RawValue
+			if err = unmarshalExplicit(sb.Value, &raw); err != nil {
+				return bags, err
+			}
+			b.key = append([]byte(nil), raw.FullBytes...)
+		case sb.ID.Equal(oidShroudedKeyBag):
+			var info encryptedPrivateKeyInfo
+			if err = unmarshalExplicit(sb.Value, &info); err != nil {
+				return bags, err
+			}
+			if b.key, err = decrypt(info.Algorithm, password, info.EncryptedData); err != nil {
+				return bags, err
+			}
+		case sb.ID.Equal(oidCertBag):
+			var cb certBag
+			if err = unmarshalExplicit(sb.Value, &cb); err != nil {
+				return bags, err
+			}
+			if !cb.ID.Equal(oidX509Certificate) {
+				continue
+			}
+			if b.certificate, err = x509.ParseCertificate(cb.Value); err != nil {
+				return bags, err
+			}
+		default:
+			continue
+		}
+		bags = append(bags, b)
+		for _, a := range sb.Attributes {
+			if len(a.Values) != 1 {
+				continue
+			}
+			switch {
+			case a.ID.Equal(oidFriendlyName):
+				if a.Values[0].Tag != asn1.TagBMPString {
+					return bags, errors.New("invalid friendly name")
+				}
+				if b.friendlyName, err = decodeBMPString(a.Values[0].Bytes); err != nil {
+					return bags, err
+				}
+			case a.ID.Equal(oidLocalKeyID):
+				if _, err = asn1.Unmarshal(a.Values[0].FullBytes, &b.localKeyID); err != nil {
+					return bags, err
+				}
+			}
+		}
+	}
+	return bags, nil
+}
+
+// assemble imports the keys and matches them with their certificate chains
+func (s *Store) assemble(bags []*bag, constructor func(key *PrivateKey) okapi.KeyConstructor) error {
+	var certificates []*bag
+	for _, b := range bags {
+		if b.certificate != nil {
+			certificates = append(certificates, b)
+		}
+	}
+	used := make(map[*bag]bool)
+	for _, b := range bags {
+		if b.key == nil {
+			continue
+		}
+		algorithm, defaultConstructor, err := keyAlgorithm(b.key)
+		if err != nil {
+			return err
+		}
+		key := &PrivateKey{Algorithm: algorithm, FriendlyName: b.friendlyName}
+		var leaf *bag
+		for _, c := range certificates {
+			if len(b.localKeyID) > 0 && bytes.Equal(b.localKeyID, c.localKeyID) {
+				leaf = c
+				break
+			}
+		}
+		if leaf != nil {
+			key.Certificates = chain(leaf, certificates, used)
+		}
+		var kc okapi.KeyConstructor
+		if constructor != nil {
+			kc = constructor(key)
+		}
+		if kc == nil {
+			kc = defaultConstructor
+		}
+		if kc == nil {
+			return fmt.Errorf("%s keys are not available", algorithm)
+		}
+		if key.Key, err = kc(b.key); err != nil {
+			return err
+		}
+		s.PrivateKeys = append(s.PrivateKeys, key)
+		if leaf == nil {
+			// without the local key ID the certificate is matched by the public key
+			if leaf, err = certificateOf(key.Key, certificates); err != nil {
+				return err
+			}
+			if leaf != nil {
+				key.Certificates = chain(leaf, certificates, used)
+			}
+		}
+		if key.FriendlyName == "" && leaf != nil {
+			key.FriendlyName = leaf.friendlyName
+		}
+	}
+	for _, c := range certificates {
+		if !used[c] {
+			s.Certificates = append(s.Certificates, &Certificate{Certificate: c.certificate, FriendlyName: c.friendlyName})
+		}
+	}
+	return nil
+}
+
+func certificateOf(key okapi.PrivateKey, certificates []*bag) (*bag, error) {
+	pub := key.PublicKey()
+	defer pub.Close()
+	der, err := okapi.ExportKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range certificates {
+		if bytes.Equal(der, c.certificate.RawSubjectPublicKeyInfo) {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// chain builds the certificate chain from the leaf following the issuer names, and marks the certificates used
+func chain(leaf *bag, certificates []*bag, used map[*bag]bool) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf.certificate}
+	used[leaf] = true
+	for last := leaf.certificate; !bytes.Equal(last.RawIssuer, last.RawSubject); {
+		var issuer *bag
+		for _, c := range certificates {
+			if bytes.Equal(c.certificate.RawSubject, last.RawIssuer) && !contains(chain, c.certificate) {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer.certificate)
+		used[issuer] = true
+		last = issuer.certificate
+	}
+	return chain
+}
+
+func contains(certificates []*x509.Certificate, certificate *x509.Certificate) bool {
+	for _, c := range certificates {
+		if bytes.Equal(c.Raw, certificate.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode creates a DER encoded PKCS#12 file with the content of the store protected with the password.
+// The private keys must be exportable. If protection is nil, ModernProtection is used.
+// Each key is linked to the first of its certificates with a local key ID.
+func Encode(store *Store, password string, protection *Protection) ([]byte, error) {
+	if protection == nil {
+		protection = &ModernProtection
+	}
+	if err := checkIterations(protection.Iterations); err != nil {
+		return nil, err
+	}
+	hash, err := hashByName(protection.Hash)
+	if err != nil {
+		return nil, err
+	}
+	var keyBags, certificateBags []safeBag
+	addCertificate := func(certificate *x509.Certificate, attributes []attribute) error {
+		der, err := asn1.Marshal(certBag{ID: oidX509Certificate, Value: certificate.Raw})
+		if err != nil {
+			return err
+		}
+		certificateBags = append(certificateBags, safeBag{ID: oidCertBag, Value: explicit(der), Attributes: attributes})
+		return nil
+	}
+	for i, key := range store.PrivateKeys {
+		localKeyID := []byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)}
+		if len(key.Certificates) > 0 {
+			localKeyID = hash.digest(key.Certificates[0].Raw)
+		}
+		attributes, err := bagAttributes(key.FriendlyName, localKeyID)
+		if err != nil {
+			return nil, err
+		}
+		for j, certificate := range key.Certificates {
+			if j == 0 {
+				err = addCertificate(certificate, attributes)
+			} else {
+				err = addCertificate(certificate, nil)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		der, err := okapi.ExportKey(key.Key)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, encrypted, err := encrypt(protection.KeyEncryption, protection, password, der)
+		okapi.Zero(der)
+		if err != nil {
+			return nil, err
+		}
+		if der, err = asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted}); err != nil {
+			return nil, err
+		}
+		keyBags = append(keyBags, safeBag{ID: oidShroudedKeyBag, Value: explicit(der), Attributes: attributes})
+	}
+	for _, certificate := range store.Certificates {
+		attributes, err := bagAttributes(certificate.FriendlyName, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = addCertificate(certificate.Certificate, attributes); err != nil {
+			return nil, err
+		}
+	}
+	var authenticatedSafe []contentInfo
+	if len(certificateBags) > 0 {
+		info, err := safeContents(certificateBags, protection.CertificateEncryption, protection, password)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, info)
+	}
+	if len(keyBags) > 0 {
+		info, err := safeContents(keyBags, "", protection, password)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, info)
+	}
+	content, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+	p := pfx{Version: 3, MacData: macData{Iterations: protection.Iterations}}
+	if p.AuthSafe, err = dataContentInfo(content); err != nil {
+		return nil, err
+	}
+	if p.MacData.MacSalt, err = random(protection.SaltSize); err != nil {
+		return nil, err
+	}
+	p.MacData.Mac.Algorithm = pkix.AlgorithmIdentifier{Algorithm: hash.oid, Parameters: asn1.NullRawValue}
+	if p.MacData.Mac.Digest, err = mac(hash, password, p.MacData.MacSalt, protection.Iterations, content); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(p)
+}
+
+func bagAttributes(friendlyName string, localKeyID []byte) ([]attribute, error) {
+	var attributes []attribute
+	if friendlyName != "" {
+		der, err := asn1.Marshal(bmpString(friendlyName))
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attribute{ID: oidFriendlyName, Values: []asn1.RawValue{{FullBytes: der}}})
+	}
+	if localKeyID != nil {
+		der, err := asn1.Marshal(localKeyID)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attribute{ID: oidLocalKeyID, Values: []asn1.RawValue{{FullBytes: der}}})
+	}
+	return attributes, nil
+}
+
+func dataContentInfo(data []byte) (contentInfo, error) {
+	der, err := asn1.Marshal(data)
+	return contentInfo{ContentType: oidData, Content: explicit(der)}, err
+}
+
+// safeContents encodes the bags as SafeContents, encrypted with the encryption scheme if provided
+func safeContents(bags []safeBag, encryption string, protection *Protection, password string) (contentInfo, error) {
+	der, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	if encryption == "" {
+		return dataContentInfo(der)
+	}
+	algorithm, encrypted, err := encrypt(encryption, protection, password, der)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	if der, err = asn1.Marshal(encryptedData{EncryptedContentInfo: encryptedContentInfo{
+		ContentType:                oidData,
+		ContentEncryptionAlgorithm: algorithm,
+		EncryptedContent:           encrypted,
+	}}); err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidEncryptedData, Content: explicit(der)}, nil
+}
+
+// explicit wraps the DER encoding in the [0] explicit tag
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func unmarshalExplicit(raw asn1.RawValue, value interface{}) error {
+	if raw.Class != asn1.ClassContextSpecific || raw.Tag != 0 || !raw.IsCompound {
+		return errors.New("invalid PKCS#12 content")
+	}
+	rest, err := asn1.Unmarshal(raw.Bytes, value)
+	if err == nil && len(rest) > 0 {
+		err = errors.New("trailing data in PKCS#12 content")
+	}
+	return err
+}
@@ -0,0 +1,465 @@
+// Package pkcs12 reads and writes PKCS#12 files (RFC 7292), also known as PFX or .p12 files,
+// with private keys, certificates and certificate chains, using okapi ciphers, HMAC and KDFs,
+// so that it works with any imported implementation.
+//
+// Supported are password integrity (HMAC) and password privacy modes, with the legacy
+// PKCS#12 encryption schemes (RC2 or 3DES with SHA1) and PBES2 (RFC 8018) with PBKDF2 and AES or 3DES.
+// Public key integrity and privacy modes, and bag types other than keys and X.509 certificates are not supported.
+// Only DER encoded input is supported (BER indefinite length encodings are not).
+package pkcs12
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"unicode/utf16"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidHMACWithSHA1    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidSHA1            = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidNamedCurveP384  = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521  = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// PKCS12KDF purpose IDs (RFC 7292, appendix B.3)
+const (
+	idKey byte = 1
+	idIV  byte = 2
+	idMAC byte = 3
+)
+
+// hashAlgorithm maps a predefined HashSpec to the related algorithm identifiers.
+type hashAlgorithm struct {
+	name string
+	spec *okapi.HashSpec
+	oid  asn1.ObjectIdentifier
+	// hmacOID identifies the PBKDF2 pseudo-random function
+	hmacOID asn1.ObjectIdentifier
+}
+
+var hashAlgorithms = []hashAlgorithm{
+	{"SHA1", &okapi.SHA1, oidSHA1, oidHMACWithSHA1},
+	{"SHA224", &okapi.SHA224, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}, asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}},
+	{"SHA256", &okapi.SHA256, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}},
+	{"SHA384", &okapi.SHA384, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}},
+	{"SHA512", &okapi.SHA512, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}},
+}
+
+func hashByName(name string) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; h.name == name && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash %s", name)
+}
+
+func (h *hashAlgorithm) digest(data []byte) []byte {
+	hash := (*h.spec).New()
+	defer hash.Close()
+	hash.Write(data)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+func hashByOID(oid asn1.ObjectIdentifier) (*hashAlgorithm, error) {
+	for i := range hashAlgorithms {
+		if h := &hashAlgorithms[i]; (h.oid.Equal(oid) || h.hmacOID.Equal(oid)) && *h.spec != nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %v", oid)
+}
+
+// encryptionScheme describes the supported password based encryption schemes.
+type encryptionScheme struct {
+	name string
+	// oid is the PKCS#12 PBE algorithm, or the PBES2 encryption scheme
+	oid       asn1.ObjectIdentifier
+	pbes2     bool
+	spec      *okapi.CipherSpec
+	keySize   int
+	blockSize int
+}
+
+var encryptionSchemes = []encryptionScheme{
+	{"AES-256-CBC", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, true, &okapi.AES_CBC, 32, 16},
+	{"AES-192-CBC", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}, true, &okapi.AES_CBC, 24, 16},
+	{"AES-128-CBC", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}, true, &okapi.AES_CBC, 16, 16},
+	{"DES-EDE3-CBC", asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}, true, &okapi.DES3_CBC, 24, 8},
+	{"PBE-SHA1-3DES", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}, false, &okapi.DES3_CBC, 24, 8},
+	{"PBE-SHA1-RC2-128", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}, false, &okapi.RC2_CBC, 16, 8},
+	{"PBE-SHA1-RC2-40", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}, false, &okapi.RC2_CBC, 5, 8},
+}
+
+func encryptionSchemeByName(name string) (*encryptionScheme, error) {
+	for i := range encryptionSchemes {
+		if s := &encryptionSchemes[i]; s.name == name && *s.spec != nil {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported encryption %s", name)
+}
+
+func encryptionSchemeByOID(oid asn1.ObjectIdentifier, pbes2 bool) (*encryptionScheme, error) {
+	for i := range encryptionSchemes {
+		if s := &encryptionSchemes[i]; s.oid.Equal(oid) && s.pbes2 == pbes2 && *s.spec != nil {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm %v", oid)
+}
+
+// pbeParams are the parameters of the PKCS#12 PBE algorithms (RFC 7292, appendix C)
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pbes2Params are the parameters of PBES2 (RFC 8018, appendix A.4)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of PBKDF2 (RFC 8018, appendix A.2)
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Protection configures the encryption and integrity protection of written PKCS#12 files.
+type Protection struct {
+	// KeyEncryption and CertificateEncryption name the encryption schemes of private keys
+	// and certificates: PBES2 with AES-256-CBC, AES-192-CBC, AES-128-CBC or DES-EDE3-CBC,
+	// or legacy PBE-SHA1-3DES, PBE-SHA1-RC2-128 or PBE-SHA1-RC2-40.
+	// Certificates are not encrypted if CertificateEncryption is empty.
+	KeyEncryption, CertificateEncryption string
+	// Hash is the name of the predefined HashSpec variable used by PBKDF2 and the MAC:
+	// SHA1, SHA224, SHA256, SHA384 or SHA512. Legacy PBE schemes always use SHA1.
+	Hash string
+	// Iterations is the iteration count of the key derivations, at most MaxIterations.
+	Iterations int
+	// SaltSize is the size of the random salts in bytes.
+	SaltSize int
+}
+
+var (
+	// ModernProtection matches the defaults of OpenSSL 3.
+	ModernProtection = Protection{
+		KeyEncryption:         "AES-256-CBC",
+		CertificateEncryption: "AES-256-CBC",
+		Hash:                  "SHA256",
+		Iterations:            2048,
+		SaltSize:              16,
+	}
+	// LegacyProtection is readable by older software, e.g. Windows before Server 2019 or Java before 8u301.
+	LegacyProtection = Protection{
+		KeyEncryption:         "PBE-SHA1-3DES",
+		CertificateEncryption: "PBE-SHA1-RC2-40",
+		Hash:                  "SHA1",
+		Iterations:            2048,
+		SaltSize:              8,
+	}
+)
+
+// MaxIterations bounds the iteration counts of the key derivations read from PKCS#12 files,
+// they are used before the password can be verified, so without a bound a crafted file
+// could make Decode spend practically unlimited time deriving the keys.
+var MaxIterations = 10000000
+
+func checkIterations(iterations int) error {
+	if iterations < 1 || iterations > MaxIterations {
+		return fmt.Errorf("PKCS#12 iteration count %d is not between 1 and %d", iterations, MaxIterations)
+	}
+	return nil
+}
+
+// bmpPassword encodes the password as BMPString with the trailing zeros (RFC 7292, appendix B.1)
+func bmpPassword(password string) ([]byte, error) {
+	var b []byte
+	for _, r := range password {
+		if r > 0xffff {
+			return nil, errors.New("password characters must be in the Basic Multilingual Plane")
+		}
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return append(b, 0, 0), nil
+}
+
+// decodeBMPString decodes the contents of a BMPString
+func decodeBMPString(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("invalid BMPString")
+	}
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(s)), nil
+}
+
+func bmpString(s string) asn1.RawValue {
+	b, _ := bmpPassword(s)
+	return asn1.RawValue{Tag: asn1.TagBMPString, Bytes: b[:len(b)-2]}
+}
+
+// deriveKey derives the key and IV of the encryption scheme from the password
+func deriveKey(scheme *encryptionScheme, password string, hash *hashAlgorithm, salt []byte, iterations int) (key, iv []byte, err error) {
+	if scheme.pbes2 {
+		key, err = okapi.PBKDF2{Hash: *hash.spec, Salt: salt, Iterations: iterations}.Derive([]byte(password), scheme.keySize)
+		return key, nil, err
+	}
+	if okapi.SHA1 == nil {
+		return nil, nil, errors.New("PKCS#12 encryption requires SHA1")
+	}
+	bmp, err := bmpPassword(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer okapi.Zero(bmp)
+	kdf := okapi.PKCS12KDF{Hash: okapi.SHA1, Salt: salt, Iterations: iterations, ID: idKey}
+	if key, err = kdf.Derive(bmp, scheme.keySize); err != nil {
+		return nil, nil, err
+	}
+	kdf.ID = idIV
+	iv, err = kdf.Derive(bmp, scheme.blockSize)
+	return key, iv, err
+}
+
+// decrypt decrypts the data encrypted with the password based encryption algorithm
+func decrypt(algorithm pkix.AlgorithmIdentifier, password string, encrypted []byte) ([]byte, error) {
+	var scheme *encryptionScheme
+	var hash *hashAlgorithm
+	var salt, iv []byte
+	var iterations int
+	var err error
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		var params pbes2Params
+		if _, err = asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+			return nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+		}
+		var kdf pbkdf2Params
+		if _, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, err
+		}
+		prf := kdf.PRF.Algorithm
+		if prf == nil {
+			prf = oidHMACWithSHA1
+		}
+		if hash, err = hashByOID(prf); err != nil {
+			return nil, err
+		}
+		if scheme, err = encryptionSchemeByOID(params.EncryptionScheme.Algorithm, true); err != nil {
+			return nil, err
+		}
+		if kdf.KeyLength != 0 && kdf.KeyLength != scheme.keySize {
+			return nil, errors.New("invalid PBKDF2 key length")
+		}
+		if _, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+		salt, iterations = kdf.Salt, kdf.Iterations
+	} else {
+		if scheme, err = encryptionSchemeByOID(algorithm.Algorithm, false); err != nil {
+			return nil, err
+		}
+		var params pbeParams
+		if _, err = asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		salt, iterations = params.Salt, params.Iterations
+	}
+	if err = checkIterations(iterations); err != nil {
+		return nil, err
+	}
+	key, derivedIV, err := deriveKey(scheme, password, hash, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(key)
+	if derivedIV != nil {
+		iv = derivedIV
+	}
+	if len(iv) != scheme.blockSize || len(encrypted) == 0 || len(encrypted)%scheme.blockSize != 0 {
+		return nil, errors.New("invalid encrypted data")
+	}
+	padded := crypt(*scheme.spec, key, iv, encrypted, false)
+	padding := int(padded[len(padded)-1])
+	if padding == 0 || padding > scheme.blockSize {
+		return nil, errIncorrectPassword
+	}
+	for _, b := range padded[len(padded)-padding:] {
+		if int(b) != padding {
+			return nil, errIncorrectPassword
+		}
+	}
+	return padded[:len(padded)-padding], nil
+}
+
+// encrypt encrypts the data with the password and returns the encryption algorithm identifier
+func encrypt(name string, protection *Protection, password string, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	var algorithm pkix.AlgorithmIdentifier
+	scheme, err := encryptionSchemeByName(name)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	hash, err := hashByName(protection.Hash)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	salt, err := random(protection.SaltSize)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	key, iv, err := deriveKey(scheme, password, hash, salt, protection.Iterations)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	defer okapi.Zero(key)
+	var params interface{} = pbeParams{Salt: salt, Iterations: protection.Iterations}
+	if scheme.pbes2 {
+		if iv, err = random(scheme.blockSize); err != nil {
+			return algorithm, nil, err
+		}
+		kdf, err := asn1.Marshal(pbkdf2Params{
+			Salt:       salt,
+			Iterations: protection.Iterations,
+			PRF:        pkix.AlgorithmIdentifier{Algorithm: hash.hmacOID, Parameters: asn1.NullRawValue},
+		})
+		if err != nil {
+			return algorithm, nil, err
+		}
+		ivParameter, err := asn1.Marshal(iv)
+		if err != nil {
+			return algorithm, nil, err
+		}
+		params = pbes2Params{
+			KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+			EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: scheme.oid, Parameters: asn1.RawValue{FullBytes: ivParameter}},
+		}
+	}
+	der, err := asn1.Marshal(params)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	algorithm.Algorithm, algorithm.Parameters = scheme.oid, asn1.RawValue{FullBytes: der}
+	if scheme.pbes2 {
+		algorithm.Algorithm = oidPBES2
+	}
+	padding := scheme.blockSize - len(data)%scheme.blockSize
+	padded := append(append([]byte{}, data...), make([]byte, padding)...)
+	defer okapi.Zero(padded)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+	return algorithm, crypt(*scheme.spec, key, iv, padded, true), nil
+}
+
+var errIncorrectPassword = errors.New("incorrect password or corrupted data")
+
+// macData is the password integrity protection (RFC 7292, section 4)
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// mac computes the HMAC of the data with the key derived from the password (RFC 7292, appendix B.4)
+func mac(hash *hashAlgorithm, password string, salt []byte, iterations int, data []byte) ([]byte, error) {
+	bmp, err := bmpPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(bmp)
+	h := (*hash.spec).New()
+	size := h.Size()
+	h.Close()
+	key, err := okapi.PKCS12KDF{Hash: *hash.spec, Salt: salt, Iterations: iterations, ID: idMAC}.Derive(bmp, size)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(key)
+	hmac := okapi.HMAC.New(*hash.spec, key)
+	defer hmac.Close()
+	hmac.Write(data)
+	return append([]byte(nil), hmac.Digest()...), nil
+}
+
+// crypt processes the input, which must be a multiple of the block size, with the cipher.
+func crypt(spec okapi.CipherSpec, key, iv, in []byte, encrypt bool) []byte {
+	c := spec.New(key, iv, encrypt)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out
+}
+
+// keyAlgorithm returns the public key algorithm of the PKCS#8 encoded private key
+// and the default constructor for it.
+func keyAlgorithm(der []byte) (x509.PublicKeyAlgorithm, okapi.KeyConstructor, error) {
+	var info struct {
+		Version    int
+		Algorithm  pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return x509.UnknownPublicKeyAlgorithm, nil, err
+	}
+	switch oid := info.Algorithm.Algorithm; {
+	case oid.Equal(oidRSAEncryption):
+		return x509.RSA, okapi.RSA_SHA256, nil
+	case oid.Equal(oidEd25519):
+		return x509.Ed25519, okapi.Ed25519, nil
+	case oid.Equal(oidECPublicKey):
+		var curve asn1.ObjectIdentifier
+		asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curve)
+		switch {
+		case curve.Equal(oidNamedCurveP384):
+			return x509.ECDSA, okapi.ECDSA_384, nil
+		case curve.Equal(oidNamedCurveP521):
+			return x509.ECDSA, okapi.ECDSA_SHA512, nil
+		}
+		return x509.ECDSA, okapi.ECDSA_SHA256, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, nil, fmt.Errorf("unsupported private key algorithm %v", oid)
+	}
+}
+
+func random(size int) ([]byte, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	b := make([]byte, size)
+	if _, err := random.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,178 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/gocrypto"
+	"github.com/mkobetic/okapi/pki"
+	"testing"
+	"time"
+)
+
+// P-256 key with self-signed certificate (CN=test) exported by openssl pkcs12 -legacy, password "secret"
+const opensslPKCS12 = `
+MIIDrwIBAzCCA3UGCSqGSIb3DQEHAaCCA2YEggNiMIIDXjCCAjcGCSqGSIb3DQEHBqCCAi
+gwggIkAgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQYwDgQI7DdbAMV0I1kCAggA
+gIIB8C5bSAijWaeWumdHDNoXzkiRNOzar2wFL6ZgCXJo9aCSRm1zzAJdziuuhWjja0lDEk
+eQYD2LDpRdJGGXZJyBYFnyO8wrzcLncPNRf6F+9Cpa134RYjof9KOFkmArHJRqPGB35xHL
+RI5Sk9ilrjDs4j0C9nYirkThXwMfMuxeJong5QF57oCU2bUrydlwVfEv7PMK9R7yuHD0xN
+/ZJTKlqqeDBgDdNTs3zcoZTGiLZCJEr/Jmkr4BDmIA3bqWpDU4n9Q690MmBBioscBg7zBM
+2lq5uUDogBM4nDwl0MoVI929XQiuhfTxNI6lcaP2W6fcTzgcAc78DlVMLk71N4RpVHUUae
+/HRmKIDz06yB9bx3CsBM0KgfqDRm4+NzbkX0yXH5joPj3RxG1peF1/jr9qen6uL5apZzlV
+R+wVZqKeBO4TZqpWx6K49vL3xfGu/l2qCG/RmgSArRU/i5pdobmMbNhrLrPHIm2n+3ohPe
+Pai7FipEf9GAvf5jW2LMbNChwihFp2qayRbuw2xmyfQ+ONsel9VZmcrGOt2OiZ+M92UZ5J
+DZ0DAM5QLs/+JV+svOdL522Ti37H0XjLr4vaGvi/Cdq362fI7MMoM0r/P/GaEop65e+r0j
+Df2YvLNtAlyDbQjApKigoYeLTpOsuHlC55lmYwggEfBgkqhkiG9w0BBwGgggEQBIIBDDCC
+AQgwggEEBgsqhkiG9w0BDAoBAqCBtDCBsTAcBgoqhkiG9w0BDAEDMA4ECLDI9WTjd0bGAg
+IIAASBkFFE+3Ja5aASGqf2V8wHJmrab7d2erFIU8OZ+XwbnPxlkpP1Q4U42OmgWkqNeTNj
+Nk5K/kVDiJ4RszVj1L6L4ZGAPNK5jzKcn7G6G9KzJMI0cDemhYd+jrtc759o5azdhrC31E
+PEYWEoDtEWsMLqIXn66oA6IBl1LYGaOYxqqATpuwIwxvVwWGvvLIhW9NUQwzE+MBcGCSqG
+SIb3DQEJFDEKHggAdABlAHMAdDAjBgkqhkiG9w0BCRUxFgQUiUpDXByVbMts3f+mWtrm0k
+9OHqcwMTAhMAkGBSsOAwIaBQAEFBiXtOjJuXopqa96HtM9cpvkuJlwBAiRKWK7hJ7daAIC
+CAA=`
+
+func TestOpenSSL(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(opensslPKCS12)
+	if _, err := Decode(data, "wrong", nil); err != errIncorrectPassword {
+		t.Fatalf("Decode with wrong password: %v", err)
+	}
+	store, err := Decode(data, "secret", nil)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	defer store.Close()
+	if len(store.PrivateKeys) != 1 || len(store.Certificates) != 0 {
+		t.Fatalf("Wrong store content %+v", store)
+	}
+	key := store.PrivateKeys[0]
+	if key.Algorithm != x509.ECDSA || key.FriendlyName != "test" || len(key.Certificates) != 1 ||
+		key.Certificates[0].Subject.CommonName != "test" {
+		t.Fatalf("Wrong key %+v", key)
+	}
+	pub := key.Key.PublicKey()
+	defer pub.Close()
+	der, err := okapi.ExportKey(pub)
+	if err != nil || !bytes.Equal(der, key.Certificates[0].RawSubjectPublicKeyInfo) {
+		t.Fatalf("Key doesn't match the certificate: %v", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	now := time.Now()
+	caKey, err := okapi.ECDSA_SHA256(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caKey.Close()
+	caPub := caKey.PublicKey()
+	defer caPub.Close()
+	der, err := pki.CreateCertificate(&pki.Template{
+		Subject:   pkix.Name{CommonName: "CA"},
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+		IsCA:      true,
+	}, caPub, pki.Signer{Key: caKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	key, err := okapi.RSA_SHA256(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	pub := key.PublicKey()
+	defer pub.Close()
+	if der, err = pki.CreateCertificate(&pki.Template{
+		Subject:   pkix.Name{CommonName: "Key"},
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+	}, pub, pki.Signer{Key: caKey, Certificate: ca}); err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	other, err := okapi.Ed25519(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	store := &Store{
+		PrivateKeys: []*PrivateKey{
+			{Key: key, Certificates: []*x509.Certificate{leaf, ca}, FriendlyName: "Schlüssel"},
+			{Key: other},
+		},
+		Certificates: []*Certificate{{Certificate: ca, FriendlyName: "root"}},
+	}
+	noCertificateEncryption := ModernProtection
+	noCertificateEncryption.CertificateEncryption = ""
+	for _, protection := range []*Protection{nil, &LegacyProtection, &noCertificateEncryption} {
+		data, err := Encode(store, "pass word", protection)
+		if err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+		if _, err = Decode(data, "password", nil); err == nil {
+			t.Fatal("Decode with wrong password succeeded")
+		}
+		decoded, err := Decode(data, "pass word", func(key *PrivateKey) okapi.KeyConstructor {
+			if key.Algorithm == x509.RSA {
+				return okapi.RSA_SHA512
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Decode failed: %s", err)
+		}
+		defer decoded.Close()
+		if len(decoded.PrivateKeys) != 2 || len(decoded.Certificates) != 1 || decoded.Certificates[0].FriendlyName != "root" {
+			t.Fatalf("Wrong store content %+v", decoded)
+		}
+		rsa, ed := decoded.PrivateKeys[0], decoded.PrivateKeys[1]
+		if rsa.Algorithm != x509.RSA || rsa.FriendlyName != "Schlüssel" || len(rsa.Certificates) != 2 ||
+			!rsa.Certificates[0].Equal(leaf) || !rsa.Certificates[1].Equal(ca) {
+			t.Fatalf("Wrong RSA key %+v", rsa)
+		}
+		if ed.Algorithm != x509.Ed25519 || len(ed.Certificates) != 0 {
+			t.Fatalf("Wrong Ed25519 key %+v", ed)
+		}
+		digest := make([]byte, 64)
+		signature, err := rsa.Key.Sign(digest)
+		if err != nil {
+			t.Fatalf("Sign with decoded key failed: %s", err)
+		}
+		verifier, err := okapi.RSA_SHA512(leaf.RawSubjectPublicKeyInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer verifier.Close()
+		if valid, err := verifier.PublicKey().Verify(signature, digest); !valid || err != nil {
+			t.Fatalf("Decoded key doesn't match: %v", err)
+		}
+	}
+}
+
+func TestDecodeIntegrity(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(opensslPKCS12)
+	var p pfx
+	if _, err := asn1.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	p.MacData.Iterations = 1 << 30
+	excessive, _ := asn1.Marshal(p)
+	if _, err := Decode(excessive, "secret", nil); err == nil {
+		t.Fatal("Excessive iteration count accepted")
+	}
+	p.MacData = macData{}
+	unauthenticated, _ := asn1.Marshal(p)
+	if _, err := Decode(unauthenticated, "secret", nil); err == nil {
+		t.Fatal("Decode without MAC succeeded")
+	}
+	store, err := DecodeUnauthenticated(unauthenticated, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+}
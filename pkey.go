@@ -1,14 +1,41 @@
 package okapi
 
+import (
+	"fmt"
+	"time"
+)
+
 // KeyConstructor creates a PrivateKey for given algorithm and purpose.
 // The parameters contain the required constituents of the key
 // which are algorithm and key type specific.
 // If parameters contain only public key constituents the constructor returns
 // a partially initialized PrivateKey that can only be used to obtain a PublicKey from it.
 // The parameters may also contain key generation parameters
-// in which case a full PrivateKey will be generated
+// in which case a full PrivateKey will be generated.
+// Implementations generally accept the following parameters:
+// * int: generates a new key of given size in bits
+// * string: reads a private key from PEM encoding
+// * []byte: reads a private key (PKCS#8) or a public key (X.509 SubjectPublicKeyInfo) from DER encoding
+// * PublicKey: generates a new key with the same parameters (size, group or curve) as the provided key
+// * KeyParameters: any of the above with the source of randomness to be used by the key
 type KeyConstructor func(parameters interface{}) (PrivateKey, error)
 
+// KeyParameters wrap the parameters of a KeyConstructor with a Random
+// that is used instead of DefaultRandom to generate the key and by the randomized operations
+// of the key and of the PublicKey obtained from it: encryption padding (RSA, RSA_OAEP),
+// PSS salts and DSA/ECDSA per-message secrets.
+// This allows to route the entropy through an HSM or an audited DRBG.
+// The Random remains owned by the caller and must not be closed while the key is in use.
+type KeyParameters struct {
+	// Parameters are any of the parameters accepted by the KeyConstructor
+	Parameters interface{}
+	// Random is the source of randomness, if nil DefaultRandom is used
+	Random Random
+	// Created is the creation time of an imported key, the implementations ignore it,
+	// it is used to check the MaxKeyAge of the Policy
+	Created time.Time
+}
+
 // Predefined key constructors for known algorithms and purposes, implementations are provided by subpackages. Note that different implementations can support different set of algorithms/purposes. If given algorithm/purpose combination is not supported by the imported implementations, the value of the corresponding variable will be nil.
 var (
 	// encryption PKCS1 v1.5 & v2.0
@@ -20,8 +47,12 @@ var (
 	// signing DSS
 	DSA_SHA1, DSA_SHA224, DSA_SHA256, DSA_SHA384, DSA_SHA512,
 	ECDSA_SHA1, ECDSA_224, ECDSA_SHA256, ECDSA_384, ECDSA_SHA512,
+	// signing EdDSA, note that the Sign and Verify input is the message itself, not a digest
+	Ed25519,
 	// key agreement
-	DH, ECDH KeyConstructor
+	DH, ECDH,
+	// key agreement X25519 (RFC 7748), the shared secret is the raw function output
+	X25519 KeyConstructor
 )
 
 // PrivateKey provides private key operations for given public key algorithm and purpose.
@@ -29,6 +60,11 @@ var (
 // * encryption: Decrypt
 // * signing: Sign
 // * key agreement: Derive
+//
+// The keys created with the predefined KeyConstructors may be wrapped
+// (see SetObserver, SetPolicy, EnableFIPS and EnableLeakDetection), the wrappers provide KeySize() int
+// (the size of the key in bits) and Export (see Exporter) if the implementation does, the other methods
+// of the implementations are not available through them.
 type PrivateKey interface {
 	// Decrypt decrypts provided input.
 	Decrypt(encrypted []byte) (decrypted []byte, err error)
@@ -49,6 +85,7 @@ type PrivateKey interface {
 // The purpose determines which operations are available:
 // * encryption: Encrypt
 // * signing: Verify
+// The public keys of the wrapped private keys may be wrapped as well (see PrivateKey).
 type PublicKey interface {
 	// Encrypt encrypts provided input.
 	// Note that the size of input is constrained by the size of the PrivateKey
@@ -59,3 +96,29 @@ type PublicKey interface {
 	// Close MUST be called before discarding a key instance to securely discard and release any associated resources.
 	Close()
 }
+
+// Exporter is implemented by the PrivateKeys and PublicKeys that can be encoded, see ExportKey.
+type Exporter interface {
+	// Export encodes a PrivateKey as PKCS#8 PrivateKeyInfo in DER format (RFC 5208),
+	// partially initialized keys are encoded as X.509 SubjectPublicKeyInfo instead,
+	// and a PublicKey as X.509 SubjectPublicKeyInfo in DER format (RFC 5280).
+	// Keys that cannot be extracted (e.g. held by a hardware token) return an error.
+	// The encoding can be imported back using the corresponding KeyConstructor.
+	Export() (der []byte, err error)
+}
+
+// ExportKey encodes the PrivateKey or PublicKey if it implements Exporter, otherwise it returns an error.
+func ExportKey(key interface{}) ([]byte, error) {
+	if exporter, ok := key.(Exporter); ok {
+		return exporter.Export()
+	}
+	return nil, fmt.Errorf("%T cannot be exported", key)
+}
+
+// keySize returns the size of the key in bits if the implementation provides it, 0 otherwise
+func keySize(key interface{}) int {
+	if sized, ok := key.(interface{ KeySize() int }); ok {
+		return sized.KeySize()
+	}
+	return 0
+}
@@ -0,0 +1,264 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+var (
+	oidSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidAuthorityKeyID   = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+var extKeyUsages = []struct {
+	usage x509.ExtKeyUsage
+	oid   asn1.ObjectIdentifier
+}{
+	{x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}},
+	{x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}},
+	{x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}},
+	{x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}},
+	{x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}},
+	{x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}},
+	{x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}},
+}
+
+// Template describes the content of a certificate or a certificate request.
+type Template struct {
+	// SerialNumber of the certificate, a random one is generated if nil
+	SerialNumber *big.Int
+	Subject      pkix.Name
+	// NotBefore and NotAfter is the validity period of the certificate
+	NotBefore, NotAfter time.Time
+	// subject alternative names
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	// KeyUsage is omitted if zero
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// IsCA marks a CA certificate in the basic constraints
+	IsCA bool
+	// MaxPathLen is the maximum number of intermediate CA certificates that may follow
+	// a CA certificate in a chain, negative means unlimited.
+	MaxPathLen int
+	// ExtraExtensions are added as they are
+	ExtraExtensions []pkix.Extension
+}
+
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           validity
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	Extensions         []pkix.Extension `asn1:"omitempty,optional,explicit,tag:3"`
+}
+
+type validity struct {
+	NotBefore, NotAfter time.Time
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// CreateCertificate creates a DER encoded X.509 v3 certificate of the subject key signed by the signer.
+// The certificate has the subject and authority key identifiers, the basic constraints,
+// and the subject alternative names, key usage and extended key usage if present in the template.
+// If the signer has no certificate, the certificate is self-signed and the subject must be the signer's key.
+func CreateCertificate(template *Template, subject okapi.PublicKey, signer Signer) ([]byte, error) {
+	if template.NotBefore.IsZero() || !template.NotAfter.After(template.NotBefore) {
+		return nil, errors.New("invalid certificate validity period")
+	}
+	spki, err := okapi.ExportKey(subject)
+	if err != nil {
+		return nil, err
+	}
+	signerKey, err := signer.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := signer.algorithm(signerKey)
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(spki)
+	if err != nil {
+		return nil, err
+	}
+	name, err := asn1.Marshal(template.Subject.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	issuer, aki := name, ski
+	if signer.Certificate == nil && !bytes.Equal(spki, signerKey) {
+		return nil, errors.New("self-signed certificate subject must be the signer key")
+	}
+	if signer.Certificate != nil {
+		if !signer.Certificate.BasicConstraintsValid || !signer.Certificate.IsCA {
+			return nil, errors.New("issuer certificate is not a CA certificate")
+		}
+		if usage := signer.Certificate.KeyUsage; usage != 0 && usage&x509.KeyUsageCertSign == 0 {
+			return nil, errors.New("issuer certificate is not allowed to sign certificates")
+		}
+		issuer, aki = signer.Certificate.RawSubject, signer.Certificate.SubjectKeyId
+		if len(aki) == 0 {
+			if aki, err = subjectKeyID(signer.Certificate.RawSubjectPublicKeyInfo); err != nil {
+				return nil, err
+			}
+		}
+	}
+	serial := template.SerialNumber
+	if serial == nil {
+		if serial, err = serialNumber(); err != nil {
+			return nil, err
+		}
+	} else if serial.Sign() <= 0 {
+		return nil, errors.New("certificate serial number must be positive")
+	}
+	extensions, err := template.extensions(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidSubjectKeyID, ski},
+		{oidAuthorityKeyID, authorityKeyID{ID: aki}},
+	} {
+		extension, err := newExtension(e.oid, false, e.value)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	tbs := tbsCertificate{
+		Version:            2,
+		SerialNumber:       serial,
+		SignatureAlgorithm: algorithm.identifier(),
+		Issuer:             asn1.RawValue{FullBytes: issuer},
+		Validity:           validity{template.NotBefore.UTC(), template.NotAfter.UTC()},
+		Subject:            asn1.RawValue{FullBytes: name},
+		PublicKey:          asn1.RawValue{FullBytes: spki},
+		Extensions:         extensions,
+	}
+	return sign(tbs, algorithm, signer.Key)
+}
+
+func newExtension(oid asn1.ObjectIdentifier, critical bool, value interface{}) (pkix.Extension, error) {
+	der, err := asn1.Marshal(value)
+	return pkix.Extension{Id: oid, Critical: critical, Value: der}, err
+}
+
+// extensions returns the extensions described by the template,
+// the basic constraints are omitted from requests for end entity certificates.
+func (t *Template) extensions(request bool) (extensions []pkix.Extension, err error) {
+	add := func(oid asn1.ObjectIdentifier, critical bool, value interface{}) {
+		if err != nil {
+			return
+		}
+		var extension pkix.Extension
+		if extension, err = newExtension(oid, critical, value); err == nil {
+			extensions = append(extensions, extension)
+		}
+	}
+	if !request || t.IsCA {
+		constraints := basicConstraints{IsCA: t.IsCA, MaxPathLen: -1}
+		if t.IsCA && t.MaxPathLen >= 0 {
+			constraints.MaxPathLen = t.MaxPathLen
+		}
+		add(oidBasicConstraints, true, constraints)
+	}
+	if t.KeyUsage != 0 {
+		add(oidKeyUsage, true, keyUsageBits(t.KeyUsage))
+	}
+	if len(t.ExtKeyUsage) > 0 {
+		var oids []asn1.ObjectIdentifier
+		for _, usage := range t.ExtKeyUsage {
+			oid := extKeyUsageOID(usage)
+			if oid == nil {
+				return nil, fmt.Errorf("unsupported extended key usage %d", usage)
+			}
+			oids = append(oids, oid)
+		}
+		add(oidExtKeyUsage, false, oids)
+	}
+	if names := t.alternativeNames(); len(names) > 0 {
+		// critical if the subject is empty (RFC 5280, section 4.2.1.6)
+		add(oidSubjectAltName, len(t.Subject.ToRDNSequence()) == 0, names)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(extensions, t.ExtraExtensions...), nil
+}
+
+// alternativeNames returns the subject alternative names as GeneralNames
+func (t *Template) alternativeNames() (names []asn1.RawValue) {
+	add := func(tag int, value []byte) {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, Bytes: value})
+	}
+	for _, email := range t.EmailAddresses {
+		add(1, []byte(email))
+	}
+	for _, name := range t.DNSNames {
+		add(2, []byte(name))
+	}
+	for _, uri := range t.URIs {
+		add(6, []byte(uri.String()))
+	}
+	for _, ip := range t.IPAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		add(7, ip)
+	}
+	return names
+}
+
+// keyUsageBits encodes the key usage as a named bit list with trailing zero bits removed
+func keyUsageBits(usage x509.KeyUsage) asn1.BitString {
+	var bits asn1.BitString
+	for i := 0; i < 9; i++ {
+		if usage&(1<<uint(i)) != 0 {
+			if len(bits.Bytes) <= i/8 {
+				bits.Bytes = append(bits.Bytes, make([]byte, i/8+1-len(bits.Bytes))...)
+			}
+			bits.Bytes[i/8] |= 0x80 >> uint(i%8)
+			bits.BitLength = i + 1
+		}
+	}
+	return bits
+}
+
+func extKeyUsageOID(usage x509.ExtKeyUsage) asn1.ObjectIdentifier {
+	for _, u := range extKeyUsages {
+		if u.usage == usage {
+			return u.oid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	oidCRLNumber  = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// RevocationList describes the content of a CRL.
+type RevocationList struct {
+	// Number is the CRL number, it must increase with every CRL issued
+	Number *big.Int
+	// ThisUpdate is the issue date and NextUpdate the date by which the next CRL is issued
+	ThisUpdate, NextUpdate time.Time
+	Revoked                []Revoked
+}
+
+// Revoked describes a revoked certificate.
+type Revoked struct {
+	SerialNumber   *big.Int
+	RevocationTime time.Time
+	// ReasonCode is the CRLReason (RFC 5280, section 5.3.1), omitted if zero (unspecified)
+	ReasonCode int
+}
+
+type tbsCertList struct {
+	Version             int
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time
+	RevokedCertificates []revokedCertificate `asn1:"omitempty,optional"`
+	Extensions          []pkix.Extension     `asn1:"optional,explicit,tag:0"`
+}
+
+type revokedCertificate struct {
+	SerialNumber   *big.Int
+	RevocationDate time.Time
+	Extensions     []pkix.Extension `asn1:"omitempty,optional"`
+}
+
+// CreateRevocationList creates a DER encoded X.509 v2 CRL signed by the signer.
+// The signer must have a CA certificate. The CRL has the authority key identifier
+// and the CRL number extensions.
+func CreateRevocationList(list *RevocationList, signer Signer) ([]byte, error) {
+	issuer := signer.Certificate
+	if issuer == nil {
+		return nil, errors.New("CRL requires the issuer certificate")
+	}
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.New("issuer certificate is not allowed to sign CRLs")
+	}
+	if list.Number == nil || list.Number.Sign() < 0 {
+		return nil, errors.New("CRL number is required")
+	}
+	if list.ThisUpdate.IsZero() || !list.NextUpdate.After(list.ThisUpdate) {
+		return nil, errors.New("invalid CRL update times")
+	}
+	spki, err := signer.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(spki, issuer.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("signer key doesn't match the issuer certificate")
+	}
+	algorithm, err := signer.algorithm(spki)
+	if err != nil {
+		return nil, err
+	}
+	aki := issuer.SubjectKeyId
+	if len(aki) == 0 {
+		if aki, err = subjectKeyID(spki); err != nil {
+			return nil, err
+		}
+	}
+	tbs := tbsCertList{
+		Version:    1,
+		Signature:  algorithm.identifier(),
+		Issuer:     asn1.RawValue{FullBytes: issuer.RawSubject},
+		ThisUpdate: list.ThisUpdate.UTC(),
+		NextUpdate: list.NextUpdate.UTC(),
+	}
+	for _, r := range list.Revoked {
+		revoked := revokedCertificate{SerialNumber: r.SerialNumber, RevocationDate: r.RevocationTime.UTC()}
+		if r.ReasonCode != 0 {
+			extension, err := newExtension(oidReasonCode, false, asn1.Enumerated(r.ReasonCode))
+			if err != nil {
+				return nil, err
+			}
+			revoked.Extensions = append(revoked.Extensions, extension)
+		}
+		tbs.RevokedCertificates = append(tbs.RevokedCertificates, revoked)
+	}
+	for _, e := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAuthorityKeyID, authorityKeyID{ID: aki}},
+		{oidCRLNumber, list.Number},
+	} {
+		extension, err := newExtension(e.oid, false, e.value)
+		if err != nil {
+			return nil, err
+		}
+		tbs.Extensions = append(tbs.Extensions, extension)
+	}
+	return sign(tbs, algorithm, signer.Key)
+}
+
+// VerifyRevocationList parses the DER encoded CRL and verifies that it is issued by the issuer.
+// The caller is responsible for checking that the CRL is current (NextUpdate).
+func VerifyRevocationList(der []byte, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	list, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(list.RawIssuer, issuer.RawSubject) {
+		return nil, errors.New("CRL issuer doesn't match the certificate subject")
+	}
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.New("issuer certificate is not allowed to sign CRLs")
+	}
+	if err = verify(list.RawTBSRevocationList, list.Signature, list.SignatureAlgorithm, issuer.RawSubjectPublicKeyInfo); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,285 @@
+// Package pki creates X.509 certificates, certificate signing requests (PKCS#10) and CRLs
+// signed with okapi keys, and verifies them and certificate chains using okapi Verify,
+// so that it works with any imported implementation, including keys that cannot be exported.
+//
+// Parsing is left to crypto/x509, the parsed certificates, requests and CRLs are used
+// for verification, but their own signature checking methods should not be used,
+// see Verify, VerifyRequest and VerifyRevocationList instead.
+// Supported signatures are RSA PKCS#1 v1.5 and ECDSA with SHA1, SHA256, SHA384 or SHA512, and Ed25519.
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+)
+
+var (
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECPublicKey   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// signatureAlgorithm maps a signature algorithm to the predefined HashSpec
+// and the key constructor for signing and verification.
+type signatureAlgorithm struct {
+	algorithm x509.SignatureAlgorithm
+	oid       asn1.ObjectIdentifier
+	// keyOID is the algorithm of the SubjectPublicKeyInfo
+	keyOID asn1.ObjectIdentifier
+	// hash is the name of the predefined HashSpec variable, empty if the message is signed itself
+	hash        string
+	spec        *okapi.HashSpec
+	constructor *okapi.KeyConstructor
+}
+
+var signatureAlgorithms = []signatureAlgorithm{
+	{x509.SHA1WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, oidRSAEncryption, "SHA1", &okapi.SHA1, &okapi.RSA_SHA1},
+	{x509.SHA256WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, oidRSAEncryption, "SHA256", &okapi.SHA256, &okapi.RSA_SHA256},
+	{x509.SHA384WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, oidRSAEncryption, "SHA384", &okapi.SHA384, &okapi.RSA_SHA384},
+	{x509.SHA512WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, oidRSAEncryption, "SHA512", &okapi.SHA512, &okapi.RSA_SHA512},
+	{x509.ECDSAWithSHA1, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, oidECPublicKey, "SHA1", &okapi.SHA1, &okapi.ECDSA_SHA1},
+	{x509.ECDSAWithSHA256, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, oidECPublicKey, "SHA256", &okapi.SHA256, &okapi.ECDSA_SHA256},
+	{x509.ECDSAWithSHA384, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, oidECPublicKey, "SHA384", &okapi.SHA384, &okapi.ECDSA_384},
+	{x509.ECDSAWithSHA512, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, oidECPublicKey, "SHA512", &okapi.SHA512, &okapi.ECDSA_SHA512},
+	{x509.PureEd25519, oidEd25519, oidEd25519, "", nil, &okapi.Ed25519},
+}
+
+func (a *signatureAlgorithm) available() bool {
+	return *a.constructor != nil && (a.spec == nil || *a.spec != nil)
+}
+
+// signatureAlgorithmFor returns the signature algorithm for the key algorithm and hash name,
+// the hash is ignored for Ed25519 keys.
+func signatureAlgorithmFor(keyOID asn1.ObjectIdentifier, hash string) (*signatureAlgorithm, error) {
+	for i := range signatureAlgorithms {
+		a := &signatureAlgorithms[i]
+		if a.keyOID.Equal(keyOID) && (a.hash == hash || a.spec == nil) && a.available() {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported signature with %v key and hash %s", keyOID, hash)
+}
+
+func signatureAlgorithmByID(algorithm x509.SignatureAlgorithm) (*signatureAlgorithm, error) {
+	for i := range signatureAlgorithms {
+		if a := &signatureAlgorithms[i]; a.algorithm == algorithm && a.available() {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported signature algorithm %s", algorithm)
+}
+
+// identifier returns the AlgorithmIdentifier, RSA requires NULL parameters (RFC 4055, section 5)
+func (a *signatureAlgorithm) identifier() pkix.AlgorithmIdentifier {
+	id := pkix.AlgorithmIdentifier{Algorithm: a.oid}
+	if a.keyOID.Equal(oidRSAEncryption) {
+		id.Parameters = asn1.NullRawValue
+	}
+	return id
+}
+
+// input returns the signature input for the signed data, i.e. its digest unless the message is signed itself
+func (a *signatureAlgorithm) input(data []byte) []byte {
+	if a.spec == nil {
+		return data
+	}
+	hash := (*a.spec).New()
+	defer hash.Close()
+	hash.Write(data)
+	return append([]byte(nil), hash.Digest()...)
+}
+
+// Signer is the key signing certificates, requests or CRLs.
+type Signer struct {
+	// Key is the signing key, it must be configured for signing with the Hash,
+	// e.g. created with okapi.RSA_SHA256 or okapi.ECDSA_SHA256 for SHA256.
+	// RSA keys produce PKCS#1 v1.5 signatures, EC keys produce ECDSA signatures
+	// and Ed25519 keys ignore the Hash.
+	Key okapi.PrivateKey
+	// Hash is the name of the predefined HashSpec variable used for the signatures:
+	// SHA1, SHA256, SHA384 or SHA512. Defaults to SHA256.
+	Hash string
+	// Certificate is the certificate of the issuer, nil for self-signed certificates.
+	Certificate *x509.Certificate
+}
+
+// publicKey returns the SubjectPublicKeyInfo of the signing key
+func (s *Signer) publicKey() ([]byte, error) {
+	pub := s.Key.PublicKey()
+	defer pub.Close()
+	return okapi.ExportKey(pub)
+}
+
+// algorithm returns the signature algorithm matching the signing key
+func (s *Signer) algorithm(spki []byte) (*signatureAlgorithm, error) {
+	info, err := parsePublicKeyInfo(spki)
+	if err != nil {
+		return nil, err
+	}
+	hash := s.Hash
+	if hash == "" {
+		hash = "SHA256"
+	}
+	return signatureAlgorithmFor(info.Algorithm.Algorithm, hash)
+}
+
+// signed is the common structure of certificates, requests and CRLs
+type signed struct {
+	Data               asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+// sign signs the DER encoding of the data and returns the DER encoded signed structure
+func sign(data interface{}, algorithm *signatureAlgorithm, key okapi.PrivateKey) ([]byte, error) {
+	der, err := asn1.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := key.Sign(algorithm.input(der))
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(signed{
+		Data:               asn1.RawValue{FullBytes: der},
+		SignatureAlgorithm: algorithm.identifier(),
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+// verify checks the signature of the signed data with the SubjectPublicKeyInfo
+func verify(data, signature []byte, algorithm x509.SignatureAlgorithm, spki []byte) error {
+	a, err := signatureAlgorithmByID(algorithm)
+	if err != nil {
+		return err
+	}
+	info, err := parsePublicKeyInfo(spki)
+	if err != nil {
+		return err
+	}
+	if !info.Algorithm.Algorithm.Equal(a.keyOID) {
+		return fmt.Errorf("%s signature made by %v key", algorithm, info.Algorithm.Algorithm)
+	}
+	key, err := (*a.constructor)(spki)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	pub := key.PublicKey()
+	defer pub.Close()
+	valid, err := pub.Verify(signature, a.input(data))
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func parsePublicKeyInfo(der []byte) (info publicKeyInfo, err error) {
+	_, err = asn1.Unmarshal(der, &info)
+	return info, err
+}
+
+// subjectKeyID computes the subject key identifier as the SHA1 digest
+// of the subject public key bits (RFC 5280, section 4.2.1.2, method 1).
+func subjectKeyID(spki []byte) ([]byte, error) {
+	info, err := parsePublicKeyInfo(spki)
+	if err != nil {
+		return nil, err
+	}
+	if okapi.SHA1 == nil {
+		return nil, errors.New("subject key identifier requires SHA1")
+	}
+	hash := okapi.SHA1.New()
+	defer hash.Close()
+	hash.Write(info.PublicKey.Bytes)
+	return append([]byte(nil), hash.Digest()...), nil
+}
+
+// ImportPublicKey imports the DER encoded SubjectPublicKeyInfo, e.g. of a parsed request,
+// with a default key constructor for its algorithm (RSA_SHA256, ECDSA_SHA256 or Ed25519).
+// The key can be used as the subject of CreateCertificate.
+func ImportPublicKey(spki []byte) (okapi.PublicKey, error) {
+	info, err := parsePublicKeyInfo(spki)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := signatureAlgorithmFor(info.Algorithm.Algorithm, "SHA256")
+	if err != nil {
+		return nil, err
+	}
+	key, err := (*algorithm.constructor)(spki)
+	if err != nil {
+		return nil, err
+	}
+	// the key holds only the public key, so it is its own PublicKey
+	return key.PublicKey(), nil
+}
+
+// PEM block types
+const (
+	PEMCertificate    = "CERTIFICATE"
+	PEMRequest        = "CERTIFICATE REQUEST"
+	PEMRevocationList = "X509 CRL"
+)
+
+// EncodePEM encodes the DER encoded certificate, request or CRL as PEM block of the type.
+func EncodePEM(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+// ParseCertificates parses a sequence of PEM encoded certificates (other PEM blocks are skipped),
+// or a single DER encoded certificate.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if len(data) > 0 && data[0] == 0x30 {
+		certificate, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{certificate}, nil
+	}
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != PEMCertificate {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certificates, nil
+}
+
+// serialNumber generates a random positive serial number, its encoding fits in 16 bytes (RFC 5280, section 4.1.2.2)
+func serialNumber() (*big.Int, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	b := make([]byte, 16)
+	if _, err := random.Read(b); err != nil {
+		return nil, err
+	}
+	b[0] &= 0x7f
+	return new(big.Int).SetBytes(b), nil
+}
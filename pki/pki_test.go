@@ -0,0 +1,210 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/gocrypto"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T, constructor okapi.KeyConstructor, size int) (okapi.PrivateKey, okapi.PublicKey) {
+	key, err := constructor(size)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	return key, key.PublicKey()
+}
+
+func parse(t *testing.T, der []byte) *x509.Certificate {
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %s", err)
+	}
+	return certificate
+}
+
+func TestCertificateChain(t *testing.T) {
+	now := time.Now()
+	rootKey, rootPub := newKey(t, okapi.ECDSA_384, 384)
+	defer rootKey.Close()
+	defer rootPub.Close()
+	der, err := CreateCertificate(&Template{
+		Subject:    pkix.Name{CommonName: "Root CA"},
+		NotBefore:  now.Add(-time.Hour),
+		NotAfter:   now.Add(24 * time.Hour),
+		KeyUsage:   x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:       true,
+		MaxPathLen: 1,
+	}, rootPub, Signer{Key: rootKey, Hash: "SHA384"})
+	if err != nil {
+		t.Fatalf("CreateCertificate root failed: %s", err)
+	}
+	root := parse(t, der)
+	if !root.IsCA || root.MaxPathLen != 1 || root.SignatureAlgorithm != x509.ECDSAWithSHA384 ||
+		!bytes.Equal(root.SubjectKeyId, root.AuthorityKeyId) {
+		t.Fatalf("Wrong root certificate %+v", root)
+	}
+
+	caKey, caPub := newKey(t, okapi.RSA_SHA256, 1024)
+	defer caKey.Close()
+	defer caPub.Close()
+	if der, err = CreateCertificate(&Template{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Issuing CA", Organization: []string{"okapi"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(12 * time.Hour),
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:         true,
+	}, caPub, Signer{Key: rootKey, Hash: "SHA384", Certificate: root}); err != nil {
+		t.Fatalf("CreateCertificate CA failed: %s", err)
+	}
+	ca := parse(t, der)
+	if ca.SerialNumber.Int64() != 2 || !ca.MaxPathLenZero || !bytes.Equal(ca.AuthorityKeyId, root.SubjectKeyId) {
+		t.Fatalf("Wrong CA certificate %+v", ca)
+	}
+
+	leafKey, leafPub := newKey(t, okapi.Ed25519, 0)
+	defer leafKey.Close()
+	defer leafPub.Close()
+	der, err = CreateRequest(&Template{
+		Subject:     pkix.Name{CommonName: "server"},
+		DNSNames:    []string{"server.example"},
+		IPAddresses: []net.IP{net.IPv4(10, 0, 0, 1)},
+	}, Signer{Key: leafKey})
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %s", err)
+	}
+	request, err := VerifyRequest(der)
+	if err != nil {
+		t.Fatalf("VerifyRequest failed: %s", err)
+	}
+	der[len(der)-1] ^= 1
+	if _, err = VerifyRequest(der); err == nil {
+		t.Fatal("VerifyRequest of modified request succeeded")
+	}
+	subject, err := ImportPublicKey(request.RawSubjectPublicKeyInfo)
+	if err != nil {
+		t.Fatalf("ImportPublicKey failed: %s", err)
+	}
+	defer subject.Close()
+	template := RequestTemplate(request)
+	template.NotBefore, template.NotAfter = now.Add(-time.Hour), now.Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if der, err = CreateCertificate(template, subject, Signer{Key: caKey, Certificate: ca}); err != nil {
+		t.Fatalf("CreateCertificate leaf failed: %s", err)
+	}
+	leaf := parse(t, der)
+	if leaf.IsCA || leaf.DNSNames[0] != "server.example" || !leaf.IPAddresses[0].Equal(net.IPv4(10, 0, 0, 1)) ||
+		leaf.KeyUsage != x509.KeyUsageDigitalSignature || leaf.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth ||
+		leaf.Subject.CommonName != "server" || leaf.SignatureAlgorithm != x509.SHA256WithRSA {
+		t.Fatalf("Wrong leaf certificate %+v", leaf)
+	}
+
+	options := VerifyOptions{Roots: []*x509.Certificate{root}, Intermediates: []*x509.Certificate{ca}}
+	chain, err := Verify(leaf, options)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if len(chain) != 3 || chain[0] != leaf || chain[1] != ca || chain[2] != root {
+		t.Fatalf("Wrong chain %v", chain)
+	}
+	if _, err = Verify(leaf, VerifyOptions{Roots: options.Roots}); err == nil {
+		t.Fatal("Verify without intermediate succeeded")
+	}
+	if _, err = Verify(leaf, VerifyOptions{Roots: options.Roots, Intermediates: options.Intermediates, Time: now.Add(2 * time.Hour)}); err == nil {
+		t.Fatal("Verify of expired certificate succeeded")
+	}
+	forged := *leaf
+	forged.Signature = append([]byte(nil), leaf.Signature...)
+	forged.Signature[0] ^= 1
+	if _, err = Verify(&forged, options); err == nil {
+		t.Fatal("Verify of forged certificate succeeded")
+	}
+
+	// the issuing CA has path length 0, it can't issue CA certificates
+	subKey, subPub := newKey(t, okapi.ECDSA_SHA256, 256)
+	defer subKey.Close()
+	defer subPub.Close()
+	if der, err = CreateCertificate(&Template{
+		Subject:   pkix.Name{CommonName: "Sub CA"},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+		IsCA:      true,
+	}, subPub, Signer{Key: caKey, Certificate: ca}); err != nil {
+		t.Fatalf("CreateCertificate sub CA failed: %s", err)
+	}
+	sub := parse(t, der)
+	if der, err = CreateCertificate(&Template{
+		Subject:   pkix.Name{CommonName: "client"},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}, leafPub, Signer{Key: subKey, Certificate: sub}); err != nil {
+		t.Fatalf("CreateCertificate client failed: %s", err)
+	}
+	options.Intermediates = append(options.Intermediates, sub)
+	if _, err = Verify(parse(t, der), options); err == nil {
+		t.Fatal("Verify exceeding path length succeeded")
+	}
+	if _, err = CreateCertificate(template, subject, Signer{Key: leafKey, Certificate: leaf}); err == nil {
+		t.Fatal("CreateCertificate with end entity issuer succeeded")
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	now := time.Now()
+	key, pub := newKey(t, okapi.ECDSA_SHA256, 256)
+	defer key.Close()
+	defer pub.Close()
+	der, err := CreateCertificate(&Template{
+		Subject:   pkix.Name{CommonName: "CA"},
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+		KeyUsage:  x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:      true,
+	}, pub, Signer{Key: key})
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %s", err)
+	}
+	ca := parse(t, der)
+	der, err = CreateRevocationList(&RevocationList{
+		Number:     big.NewInt(7),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+		Revoked: []Revoked{
+			{SerialNumber: big.NewInt(42), RevocationTime: now, ReasonCode: 1},
+			{SerialNumber: big.NewInt(43), RevocationTime: now},
+		},
+	}, Signer{Key: key, Certificate: ca})
+	if err != nil {
+		t.Fatalf("CreateRevocationList failed: %s", err)
+	}
+	list, err := VerifyRevocationList(EncodePEM(PEMRevocationList, der), ca)
+	if err == nil {
+		t.Fatal("VerifyRevocationList of PEM succeeded")
+	}
+	if list, err = VerifyRevocationList(der, ca); err != nil {
+		t.Fatalf("VerifyRevocationList failed: %s", err)
+	}
+	entries := list.RevokedCertificateEntries
+	if list.Number.Int64() != 7 || len(entries) != 2 || entries[0].SerialNumber.Int64() != 42 || entries[0].ReasonCode != 1 ||
+		!bytes.Equal(list.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Fatalf("Wrong CRL %+v", list)
+	}
+	other, otherPub := newKey(t, okapi.ECDSA_SHA256, 256)
+	defer other.Close()
+	defer otherPub.Close()
+	if _, err = CreateRevocationList(&RevocationList{Number: big.NewInt(8), ThisUpdate: now, NextUpdate: now.Add(time.Hour)},
+		Signer{Key: other, Certificate: ca}); err == nil {
+		t.Fatal("CreateRevocationList with wrong key succeeded")
+	}
+	certificates, err := ParseCertificates(append(EncodePEM(PEMRevocationList, der), EncodePEM(PEMCertificate, ca.Raw)...))
+	if err != nil || len(certificates) != 1 || !bytes.Equal(certificates[0].Raw, ca.Raw) {
+		t.Fatalf("ParseCertificates failed: %v", err)
+	}
+}
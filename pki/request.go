@@ -0,0 +1,86 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+var oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+
+// certificationRequestInfo is the signed part of the PKCS#10 request (RFC 2986, section 4.1)
+type certificationRequestInfo struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []attribute `asn1:"tag:0"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// CreateRequest creates a DER encoded PKCS#10 certificate signing request for the signer key.
+// The request includes the subject of the template, and the subject alternative names, key usage,
+// extended key usage, basic constraints (if IsCA is set) and extra extensions as requested extensions.
+// The template validity and serial number, and the signer certificate are ignored.
+func CreateRequest(template *Template, signer Signer) ([]byte, error) {
+	spki, err := signer.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := signer.algorithm(spki)
+	if err != nil {
+		return nil, err
+	}
+	name, err := asn1.Marshal(template.Subject.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	info := certificationRequestInfo{
+		Subject:    asn1.RawValue{FullBytes: name},
+		PublicKey:  asn1.RawValue{FullBytes: spki},
+		Attributes: []attribute{},
+	}
+	extensions, err := template.extensions(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(extensions) > 0 {
+		der, err := asn1.Marshal(extensions)
+		if err != nil {
+			return nil, err
+		}
+		info.Attributes = append(info.Attributes, attribute{
+			Type:   oidExtensionRequest,
+			Values: []asn1.RawValue{{FullBytes: der}},
+		})
+	}
+	return sign(info, algorithm, signer.Key)
+}
+
+// VerifyRequest parses the DER encoded certificate signing request and verifies that it is signed
+// by the key it requests the certificate for.
+func VerifyRequest(der []byte) (*x509.CertificateRequest, error) {
+	request, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	err = verify(request.RawTBSCertificateRequest, request.Signature, request.SignatureAlgorithm, request.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// RequestTemplate returns a Template with the subject and the subject alternative names of the request.
+// The issuer decides the validity period, key usage and any other content of the certificate.
+func RequestTemplate(request *x509.CertificateRequest) *Template {
+	return &Template{
+		Subject:        request.Subject,
+		DNSNames:       request.DNSNames,
+		EmailAddresses: request.EmailAddresses,
+		IPAddresses:    request.IPAddresses,
+		URIs:           request.URIs,
+	}
+}
@@ -0,0 +1,136 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxChainLength limits the chains built by Verify
+const maxChainLength = 10
+
+// VerifyOptions are the trust anchors and other inputs of chain verification.
+type VerifyOptions struct {
+	// Roots are the trusted certificates, their signatures are not verified
+	Roots []*x509.Certificate
+	// Intermediates are the certificates that can be used to build a chain to one of the Roots
+	Intermediates []*x509.Certificate
+	// Time is the time of validity check, defaults to current time
+	Time time.Time
+}
+
+// Verify builds a chain from the certificate to one of the roots and verifies it,
+// checking the signatures with okapi keys, the validity periods, and that the issuers
+// are CA certificates allowed to sign certificates, within their path length constraints.
+// It returns the chain starting with the certificate and ending with the root.
+// Name constraints, policies and revocation are not checked, certificates with
+// critical extensions that crypto/x509 doesn't handle are rejected.
+func Verify(certificate *x509.Certificate, options VerifyOptions) ([]*x509.Certificate, error) {
+	if options.Time.IsZero() {
+		options.Time = time.Now()
+	}
+	if err := checkCertificate(certificate, options.Time); err != nil {
+		return nil, err
+	}
+	chain, err := buildChain([]*x509.Certificate{certificate}, &options)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return nil, errors.New("no chain to a root certificate found")
+	}
+	return chain, nil
+}
+
+// buildChain extends the chain until it reaches a root and returns it,
+// nil if no chain can be built and error if the only possible chains are invalid.
+func buildChain(chain []*x509.Certificate, options *VerifyOptions) ([]*x509.Certificate, error) {
+	last := chain[len(chain)-1]
+	if contains(options.Roots, last) {
+		return chain, nil
+	}
+	if len(chain) == maxChainLength {
+		return nil, errors.New("certificate chain is too long")
+	}
+	var lastErr error
+	for _, candidates := range [][]*x509.Certificate{options.Roots, options.Intermediates} {
+		for _, issuer := range candidates {
+			if contains(chain, issuer) || !issuedBy(last, issuer) {
+				continue
+			}
+			err := checkIssuer(chain, issuer, options.Time)
+			if err == nil {
+				var extended []*x509.Certificate
+				if extended, err = buildChain(append(chain[:len(chain):len(chain)], issuer), options); extended != nil {
+					return extended, nil
+				}
+			}
+			if err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+func contains(certificates []*x509.Certificate, certificate *x509.Certificate) bool {
+	for _, c := range certificates {
+		if bytes.Equal(c.Raw, certificate.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// issuedBy returns whether the issuer names and key identifiers (if present) match
+func issuedBy(certificate, issuer *x509.Certificate) bool {
+	if !bytes.Equal(certificate.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	return len(certificate.AuthorityKeyId) == 0 || len(issuer.SubjectKeyId) == 0 ||
+		bytes.Equal(certificate.AuthorityKeyId, issuer.SubjectKeyId)
+}
+
+// checkCertificate checks the validity period and critical extensions
+func checkCertificate(certificate *x509.Certificate, now time.Time) error {
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return fmt.Errorf("certificate %q is not valid at %s", certificate.Subject, now.UTC().Format(time.RFC3339))
+	}
+	if len(certificate.UnhandledCriticalExtensions) > 0 {
+		return fmt.Errorf("certificate %q has unhandled critical extension %v", certificate.Subject, certificate.UnhandledCriticalExtensions[0])
+	}
+	return nil
+}
+
+// checkIssuer checks that the issuer can issue the last certificate of the chain and verifies its signature
+func checkIssuer(chain []*x509.Certificate, issuer *x509.Certificate, now time.Time) error {
+	if err := checkCertificate(issuer, now); err != nil {
+		return err
+	}
+	if !issuer.BasicConstraintsValid || !issuer.IsCA {
+		return fmt.Errorf("issuer %q is not a CA certificate", issuer.Subject)
+	}
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("issuer %q is not allowed to sign certificates", issuer.Subject)
+	}
+	if issuer.MaxPathLen > 0 || issuer.MaxPathLenZero {
+		// intermediate CA certificates between the issuer and the end entity (RFC 5280, section 4.2.1.9)
+		// (self-issued certificates are not counted)
+		intermediates := 0
+		for _, c := range chain[1:] {
+			if !bytes.Equal(c.RawIssuer, c.RawSubject) {
+				intermediates++
+			}
+		}
+		if intermediates > issuer.MaxPathLen {
+			return fmt.Errorf("issuer %q path length constraint exceeded", issuer.Subject)
+		}
+	}
+	last := chain[len(chain)-1]
+	if err := verify(last.RawTBSCertificate, last.Signature, last.SignatureAlgorithm, issuer.RawSubjectPublicKeyInfo); err != nil {
+		return fmt.Errorf("certificate %q: %s", last.Subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package okapi
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Policy is an organisational crypto policy enforced by the predefined algorithm variables,
+// in addition to FIPS mode. The zero values of the fields don't restrict anything.
+// The specs and key constructors check the policy when they are used, so SetPolicy affects
+// the subsequent uses of the predefined variables, not the hashes, ciphers or keys created earlier
+// (except for MaxKeyAge, which is checked when the keys are used).
+type Policy struct {
+	// MinRSASize is the minimum size of RSA keys in bits.
+	MinRSASize int
+	// MinDHSize is the minimum size of DH keys (of the group modulus) in bits.
+	MinDHSize int
+	// AllowedCurves are the names of the curves allowed for ECDSA, ECDH, Ed25519 and X25519 keys,
+	// "P-224", "P-256", "P-384", "P-521", "secp256k1", "Ed25519", "Ed448", "X25519" or "X448",
+	// other curves are named by their object identifier, e.g. "1.3.36.3.3.2.8.1.1.7".
+	// All curves are allowed if empty.
+	AllowedCurves []string
+	// BannedSignatureHashes are the names of the hashes that the signing keys must not use, e.g. "MD5" or "SHA1".
+	BannedSignatureHashes []string
+	// BannedAlgorithms are the names of the predefined variables that must not be used, e.g. "RC4" or "DES3_CBC".
+	BannedAlgorithms []string
+	// MaxKeyAge is the maximum age (cryptoperiod) of private keys, after that they cannot sign, decrypt or derive.
+	// The age of generated keys is measured from their construction, the age of imported keys
+	// from KeyParameters.Created, imported keys without it are not checked.
+	MaxKeyAge time.Duration
+	// ReportOnly makes the violations reported instead of refused.
+	ReportOnly bool
+	// Report is called with the violations in report only mode, by default they are logged with the log package.
+	Report func(*PolicyViolation) `json:"-"`
+}
+
+// PolicyViolation is returned by the key constructors and the private key operations when the policy refuses them.
+// The specs of the banned algorithms panic with it in their New methods.
+type PolicyViolation struct {
+	// Algorithm is the name of the predefined variable, e.g. "RSA_SHA1".
+	Algorithm string
+	// Rule describes the violated rule.
+	Rule string
+}
+
+func (v *PolicyViolation) Error() string {
+	return v.Algorithm + " violates the policy: " + v.Rule
+}
+
+var policy atomic.Pointer[Policy]
+
+func currentPolicy() *Policy {
+	return policy.Load()
+}
+
+// SetPolicy makes the policy enforced by the guards of the predefined variables (see Register),
+// nil removes the current policy. The specs of the banned algorithms panic with a *PolicyViolation
+// in their New methods (unless the policy is report only), the key constructors and the private key operations return it.
+// Implementations assigned to the predefined variables without Register are not checked.
+func SetPolicy(p *Policy) {
+	if p == nil {
+		policy.Store(nil)
+		return
+	}
+	current := *p
+	policy.Store(&current)
+}
+
+// LoadPolicy reads a policy from a JSON file with the fields of Policy (except Report),
+// MaxKeyAge is a duration string, e.g. "8760h". For example:
+//
+//	{
+//		"MinRSASize": 3072,
+//		"AllowedCurves": ["P-256", "P-384", "Ed25519"],
+//		"BannedSignatureHashes": ["MD5", "SHA1"],
+//		"MaxKeyAge": "17520h"
+//	}
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		Policy
+		MaxKeyAge string
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %s", file, err)
+	}
+	if p.MaxKeyAge != "" {
+		if p.Policy.MaxKeyAge, err = time.ParseDuration(p.MaxKeyAge); err != nil {
+			return nil, fmt.Errorf("invalid policy %s: %s", file, err)
+		}
+	}
+	return &p.Policy, nil
+}
+
+// violation returns the violation, or reports it and returns nil in report only mode
+func (p *Policy) violation(name, rule string) error {
+	v := &PolicyViolation{name, rule}
+	if !p.ReportOnly {
+		return v
+	}
+	if p.Report != nil {
+		p.Report(v)
+	} else {
+		log.Print("okapi: ", v)
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) checkAlgorithm(name string) error {
+	if p == nil || !contains(p.BannedAlgorithms, name) {
+		return nil
+	}
+	return p.violation(name, "the algorithm is banned")
+}
+
+func (p *Policy) checkSignatureHash(name, hash string) error {
+	if p == nil || hash == "" || !contains(p.BannedSignatureHashes, hash) {
+		return nil
+	}
+	return p.violation(name, fmt.Sprintf("signature hash %s is banned", hash))
+}
+
+func (p *Policy) checkKeySize(name string, family keyFamily, bits int) error {
+	if p == nil {
+		return nil
+	}
+	min := 0
+	switch family {
+	case rsaKey:
+		min = p.MinRSASize
+	case dhKey:
+		min = p.MinDHSize
+	}
+	if bits >= min {
+		return nil
+	}
+	return p.violation(name, fmt.Sprintf("key size %d is smaller than %d bits", bits, min))
+}
+
+// checkCurve checks the curve of the key, identified by the algorithm parameters of its public key
+func (p *Policy) checkCurve(name string, key PrivateKey) error {
+	if p == nil || len(p.AllowedCurves) == 0 {
+		return nil
+	}
+	public := key.PublicKey()
+	defer public.Close()
+	der, err := ExportKey(public)
+	if err != nil {
+		return err
+	}
+	curve, err := curveName(der)
+	if err != nil {
+		return err
+	}
+	if contains(p.AllowedCurves, curve) {
+		return nil
+	}
+	return p.violation(name, fmt.Sprintf("curve %s is not allowed", curve))
+}
+
+func (p *Policy) checkAge(name string, created time.Time) error {
+	if p == nil || p.MaxKeyAge == 0 || created.IsZero() {
+		return nil
+	}
+	if age := time.Since(created); age > p.MaxKeyAge {
+		return p.violation(name, fmt.Sprintf("key age %s exceeds %s", age.Round(time.Second), p.MaxKeyAge))
+	}
+	return nil
+}
+
+var (
+	oidECPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	curveNames     = map[string]string{
+		"1.3.132.0.33":        "P-224",
+		"1.2.840.10045.3.1.7": "P-256",
+		"1.3.132.0.34":        "P-384",
+		"1.3.132.0.35":        "P-521",
+		"1.3.132.0.10":        "secp256k1",
+		"1.3.101.110":         "X25519",
+		"1.3.101.111":         "X448",
+		"1.3.101.112":         "Ed25519",
+		"1.3.101.113":         "Ed448",
+	}
+)
+
+// curveName returns the name of the curve of the X.509 SubjectPublicKeyInfo
+func curveName(der []byte) (string, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return "", err
+	}
+	oid := spki.Algorithm.Algorithm
+	if oid.Equal(oidECPublicKey) {
+		if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &oid); err != nil {
+			return "", errors.New("EC key without a named curve")
+		}
+	}
+	if name, ok := curveNames[oid.String()]; ok {
+		return name, nil
+	}
+	return oid.String(), nil
+}
+
+// agedKey refuses the private key operations once the key is older than the MaxKeyAge of the current policy
+type agedKey struct {
+	PrivateKey
+	name    string
+	created time.Time
+}
+
+func (k *agedKey) Decrypt(encrypted []byte) ([]byte, error) {
+	if err := currentPolicy().checkAge(k.name, k.created); err != nil {
+		return nil, err
+	}
+	return k.PrivateKey.Decrypt(encrypted)
+}
+
+func (k *agedKey) Sign(digest []byte) ([]byte, error) {
+	if err := currentPolicy().checkAge(k.name, k.created); err != nil {
+		return nil, err
+	}
+	return k.PrivateKey.Sign(digest)
+}
+
+func (k *agedKey) Derive(peer PublicKey) ([]byte, error) {
+	if err := currentPolicy().checkAge(k.name, k.created); err != nil {
+		return nil, err
+	}
+	return k.PrivateKey.Derive(unwrapPublicKey(peer))
+}
+
+func (k *agedKey) KeySize() int {
+	return keySize(k.PrivateKey)
+}
+
+func (k *agedKey) Export() ([]byte, error) {
+	return ExportKey(k.PrivateKey)
+}
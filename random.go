@@ -1,5 +1,9 @@
 package okapi
 
+import (
+	"sync"
+)
+
 // Random is a cryptographicly secure pseudo-random byte generator.
 // The interface complies with io.Reader interface (similarly to crypto/rand package).
 // The interface also include a Close method to allow resource release in specific implementations.
@@ -15,8 +19,89 @@ type RandomSpec interface {
 	New() Random
 }
 
+// UnwrapRandomSpec returns the implementation of the spec registered with Register (e.g. DefaultRandom),
+// or the spec itself, so that the implementations recognize their own RandomSpecs.
+func UnwrapRandomSpec(spec RandomSpec) RandomSpec {
+	if g, ok := spec.(guardedRandom); ok {
+		return g.spec
+	}
+	return spec
+}
+
+// UnwrapRandom returns the Random wrapped by the leak detection, or the random itself,
+// so that the implementations recognize their own Randoms.
+func UnwrapRandom(random Random) Random {
+	if t, ok := random.(*trackedRandom); ok {
+		return t.Random
+	}
+	return random
+}
+
+// IsSeededRandom reports whether the Random was created from a SeededRandom,
+// so that the implementations that cannot honour it can refuse it.
+func IsSeededRandom(random Random) bool {
+	_, ok := UnwrapRandom(random).(*seededReader)
+	return ok
+}
+
 // Set of predefined (well known) RandomSpecs.
 var (
 	// Default represents the default (unspecified) PRNG of imported implementation.
 	DefaultRandom RandomSpec
 )
+
+// SeededRandom returns a RandomSpec generating a deterministic byte stream from the seed,
+// using HMAC_DRBG (SHA256) with the seed as the personalization string and no real entropy.
+// It is meant for reproducible tests only and MUST NOT be used for anything else.
+// All Randoms created from the returned RandomSpec read from a single shared stream,
+// so a sequence of operations is reproducible, but it doesn't repeat the same output.
+// Implementations use DefaultRandom for key generation and encryption padding,
+// if it is replaced with a RandomSpec that they don't provide themselves, e.g.
+//
+//	okapi.DefaultRandom = okapi.SeededRandom([]byte("test"))
+//
+// The implementations that cannot reproduce their output with it return an error instead (see IsSeededRandom),
+// e.g. gocrypto RSA key generation, Go mixes its own randomness into it.
+func SeededRandom(seed []byte) RandomSpec {
+	return &seededRandom{seed: append([]byte(nil), seed...)}
+}
+
+type seededRandom struct {
+	sync.Mutex
+	seed []byte
+	drbg Random
+}
+
+func (s *seededRandom) New() Random {
+	return trackRandom(&seededReader{s}, "SeededRandom")
+}
+
+type seededReader struct {
+	spec *seededRandom
+}
+
+func (r *seededReader) Read(b []byte) (int, error) {
+	s := r.spec
+	s.Lock()
+	defer s.Unlock()
+	if s.drbg == nil {
+		s.drbg = HMAC_DRBG{Hash: SHA256, Entropy: zeroEntropy{}, Personalization: s.seed}.New()
+	}
+	return s.drbg.Read(b)
+}
+
+// Close doesn't affect the shared stream
+func (r *seededReader) Close() {
+}
+
+// zeroEntropy is the entropy source of SeededRandom
+type zeroEntropy struct{}
+
+func (zeroEntropy) New() Random { return zeroEntropy{} }
+
+func (zeroEntropy) Read(b []byte) (int, error) {
+	Zero(b)
+	return len(b), nil
+}
+
+func (zeroEntropy) Close() {}
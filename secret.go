@@ -0,0 +1,143 @@
+package okapi
+
+// Secret is a buffer for keys, digests, derived secrets or decrypted plaintext held outside of the Go heap,
+// so that the copy held by the application is not moved, left behind or swapped to disk.
+// On Linux and macOS the memory is mapped separately, locked (so that it is not swapped to disk)
+// and surrounded by inaccessible guard pages, the secret is placed right before the trailing guard page,
+// so that any overflow faults. Elsewhere the memory cannot be locked or guarded portably and it is an ordinary Go slice,
+// SecretsLocked reports which one is the case. The memory is zeroed when the Secret is closed.
+// A Secret holding a key can be passed to NewSecretCipher, NewSecretAEAD, NewSecretMAC and KDFSecret,
+// its Bytes can be passed to the other APIs accepting keys (e.g. KeyWrapSpec.New),
+// and used as the output of Cipher.Update or as the dst of AEAD.Open with a zero length, e.g.
+//
+//	plain, err := okapi.NewSecret(len(sealed) - aead.Overhead())
+//	defer plain.Close()
+//	_, err = aead.Open(plain.Bytes()[:0], nonce, sealed, data)
+//
+// Secret protects only its own memory: the implementations keep their own copies of the keys
+// until they are closed (e.g. gocrypto keeps the expanded keys on the Go heap, libcrypto in C memory),
+// and the results of the operations (e.g. Hash.Digest, PrivateKey.Derive) are ordinary slices,
+// the DeriveSecret, DecryptSecret and UnwrapSecret helpers copy them into a Secret and zero them,
+// DigestSecret copies the digest and leaves the hash alone (it may keep its own copy until it is reset or closed).
+// Secret MUST be closed before it is discarded.
+type Secret struct {
+	memory []byte // the mapped memory including the guard pages
+	data   []byte
+}
+
+// NewSecret allocates a zeroed Secret of given size,
+// it fails if the memory cannot be locked (e.g. RLIMIT_MEMLOCK is exceeded).
+func NewSecret(size int) (*Secret, error) {
+	memory, data, err := allocSecret(size)
+	if err != nil {
+		return nil, err
+	}
+	return &Secret{memory: memory, data: data}, nil
+}
+
+// SecretFrom allocates a Secret holding a copy of b, b is left intact,
+// the caller should Zero it when it is no longer needed.
+func SecretFrom(b []byte) (*Secret, error) {
+	s, err := NewSecret(len(b))
+	if err != nil {
+		return nil, err
+	}
+	copy(s.data, b)
+	return s, nil
+}
+
+// SecretsLocked reports whether the Secrets are held in locked and guarded memory on this platform,
+// if not, they are ordinary Go slices that are only zeroed when closed.
+func SecretsLocked() bool {
+	return secretsLocked
+}
+
+// Zero overwrites b with zeros, it is used to discard keys and other secrets held in ordinary slices.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Bytes returns the content of the Secret, the slice MUST NOT be used after the Secret is closed.
+func (s *Secret) Bytes() []byte {
+	return s.data
+}
+
+// Len returns the size of the Secret.
+func (s *Secret) Len() int {
+	return len(s.data)
+}
+
+// Close zeroes the Secret and releases its memory.
+func (s *Secret) Close() {
+	if s.memory == nil {
+		return
+	}
+	freeSecret(s.memory)
+	s.memory, s.data = nil, nil
+}
+
+// DigestSecret returns a copy of the digest of the hash as a Secret, the hash is left intact.
+func DigestSecret(hash Hash) (*Secret, error) {
+	return SecretFrom(hash.Digest())
+}
+
+// DeriveSecret returns the secret derived from the key and the peer as a Secret,
+// the secret returned by the key is zeroed.
+func DeriveSecret(key PrivateKey, peer PublicKey) (*Secret, error) {
+	secret, err := key.Derive(peer)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(secret)
+	return SecretFrom(secret)
+}
+
+// DecryptSecret returns the plaintext decrypted by the key as a Secret,
+// the plaintext returned by the key is zeroed.
+func DecryptSecret(key PrivateKey, encrypted []byte) (*Secret, error) {
+	decrypted, err := key.Decrypt(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(decrypted)
+	return SecretFrom(decrypted)
+}
+
+// UnwrapSecret returns the key unwrapped by the KeyWrap as a Secret,
+// the key returned by the KeyWrap is zeroed.
+func UnwrapSecret(kw KeyWrap, wrapped []byte) (*Secret, error) {
+	key, err := kw.Unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(key)
+	return SecretFrom(key)
+}
+
+// NewSecretCipher creates a Cipher from the spec with the key held in the Secret.
+func NewSecretCipher(spec CipherSpec, key *Secret, iv []byte, encrypt bool) Cipher {
+	return spec.New(key.Bytes(), iv, encrypt)
+}
+
+// NewSecretAEAD creates an AEAD from the spec with the key held in the Secret.
+func NewSecretAEAD(spec AEADSpec, key *Secret) AEAD {
+	return spec.New(key.Bytes())
+}
+
+// NewSecretMAC creates a MAC from the spec with the key held in the Secret.
+func NewSecretMAC(spec MACSpec, hash HashSpec, key *Secret) Hash {
+	return spec.New(hash, key.Bytes())
+}
+
+// KDFSecret returns the key material of given size derived by the KDF from the secret as a Secret,
+// the key material returned by the KDF is zeroed.
+func KDFSecret(kdf KDF, secret *Secret, size int) (*Secret, error) {
+	key, err := kdf.Derive(secret.Bytes(), size)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(key)
+	return SecretFrom(key)
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin
+
+package okapi
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// secretsLocked is true, the memory is mapped, locked and guarded
+const secretsLocked = true
+
+// allocSecret maps the pages for the secret with a guard page on each side and locks them,
+// the secret is placed at the end of the locked pages
+func allocSecret(size int) (memory, data []byte, err error) {
+	if size < 0 {
+		return nil, nil, fmt.Errorf("invalid secret size %d", size)
+	}
+	page := syscall.Getpagesize()
+	pages := (size + page - 1) / page
+	if pages == 0 {
+		pages = 1
+	}
+	memory, err = syscall.Mmap(-1, 0, (pages+2)*page, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("secret allocation failed: %s", err)
+	}
+	locked := memory[page : len(memory)-page]
+	if err = syscall.Mprotect(memory[:page], syscall.PROT_NONE); err == nil {
+		err = syscall.Mprotect(memory[len(memory)-page:], syscall.PROT_NONE)
+	}
+	if err == nil {
+		err = syscall.Mlock(locked)
+	}
+	if err != nil {
+		syscall.Munmap(memory)
+		return nil, nil, fmt.Errorf("secret allocation failed: %s", err)
+	}
+	return memory, locked[len(locked)-size:], nil
+}
+
+// freeSecret zeroes the locked pages, unlocks them and unmaps the memory
+func freeSecret(memory []byte) {
+	page := syscall.Getpagesize()
+	locked := memory[page : len(memory)-page]
+	Zero(locked)
+	syscall.Munlock(locked)
+	syscall.Munmap(memory)
+}
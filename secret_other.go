@@ -0,0 +1,24 @@
+//go:build !(linux || darwin)
+
+package okapi
+
+import (
+	"fmt"
+)
+
+// secretsLocked is false, the memory cannot be locked or guarded portably
+const secretsLocked = false
+
+// allocSecret allocates the secret on the Go heap, the memory cannot be locked or guarded portably
+func allocSecret(size int) (memory, data []byte, err error) {
+	if size < 0 {
+		return nil, nil, fmt.Errorf("invalid secret size %d", size)
+	}
+	memory = make([]byte, size)
+	return memory, memory, nil
+}
+
+// freeSecret zeroes the memory
+func freeSecret(memory []byte) {
+	Zero(memory)
+}
@@ -0,0 +1,271 @@
+package okapi
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// KeyUsage is a set of operations allowed with a SecretKey (similar to PKCS#11 key attributes or WebCrypto key usages).
+type KeyUsage int
+
+const (
+	UsageEncrypt KeyUsage = 1 << iota
+	UsageDecrypt
+	// UsageSign allows computing (and verifying) MACs.
+	UsageSign
+	// UsageWrap allows wrapping other (extractable) keys.
+	UsageWrap
+	// UsageUnwrap allows unwrapping keys.
+	UsageUnwrap
+	// UsageDerive allows deriving keys with a KDF.
+	UsageDerive
+)
+
+var usageNames = []string{"encrypt", "decrypt", "sign", "wrap", "unwrap", "derive"}
+
+// String returns the names of the usages separated with |, e.g. "encrypt|decrypt".
+func (u KeyUsage) String() string {
+	var names []string
+	for i, name := range usageNames {
+		if u&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// KeyUsageError is returned when a SecretKey is used for an operation it doesn't allow,
+// AEAD.Seal panics with it.
+type KeyUsageError struct {
+	// Operation is the refused operation, one of the usage names or "export".
+	Operation string
+}
+
+func (e *KeyUsageError) Error() string {
+	return "secret key doesn't allow " + e.Operation
+}
+
+// SecretKey is a handle of a symmetric key, the key material is held in a Secret
+// and is used only by the operations allowed by its usages.
+// The key material of a key that is not extractable cannot be exported, nor wrapped,
+// note that it is still in the process memory, the restriction is enforced by the API only.
+// CipherSpec, MACSpec and KDF accept the SecretKey (NewWithKey and DeriveKey), the AEADs and KeyWraps
+// are created with the SecretKey methods, which check the usages. The key material is passed to the implementations
+// as the Bytes of its Secret, they keep their own copies until they are closed (see Secret).
+// SecretKey MUST be closed before it is discarded, it zeroes the key material.
+type SecretKey struct {
+	secret      *Secret
+	usages      KeyUsage
+	extractable bool
+}
+
+// NewSecretKey generates a key of given size in bytes from DefaultRandom.
+func NewSecretKey(size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	secret, err := NewSecret(size)
+	if err != nil {
+		return nil, err
+	}
+	random := DefaultRandom.New()
+	defer random.Close()
+	if _, err := io.ReadFull(random, secret.Bytes()); err != nil {
+		secret.Close()
+		return nil, err
+	}
+	return &SecretKey{secret, usages, extractable}, nil
+}
+
+// ImportSecretKey creates a key with a copy of the key material, the provided slice is left intact,
+// the caller should Zero it when it is no longer needed (like with SecretFrom).
+func ImportSecretKey(key []byte, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	secret, err := SecretFrom(key)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{secret, usages, extractable}, nil
+}
+
+// NewSecretKeyFrom creates a key holding the key material in the Secret, the key takes over the Secret,
+// which is closed when the key is closed.
+func NewSecretKeyFrom(secret *Secret, usages KeyUsage, extractable bool) *SecretKey {
+	return &SecretKey{secret, usages, extractable}
+}
+
+// Size returns the size of the key in bytes, 0 if it is closed.
+func (k *SecretKey) Size() int {
+	if k.secret == nil {
+		return 0
+	}
+	return k.secret.Len()
+}
+
+// Usages returns the allowed usages of the key.
+func (k *SecretKey) Usages() KeyUsage {
+	return k.usages
+}
+
+// Extractable reports whether the key material can be exported or wrapped.
+func (k *SecretKey) Extractable() bool {
+	return k.extractable
+}
+
+// allow returns the key material if the key allows the usage
+func (k *SecretKey) allow(usage KeyUsage) ([]byte, error) {
+	if k.secret == nil {
+		return nil, errors.New("secret key is closed")
+	}
+	if k.usages&usage == 0 {
+		return nil, &KeyUsageError{usage.String()}
+	}
+	return k.secret.Bytes(), nil
+}
+
+// extract returns the key material if the key is extractable
+func (k *SecretKey) extract() ([]byte, error) {
+	if k.secret == nil {
+		return nil, errors.New("secret key is closed")
+	}
+	if !k.extractable {
+		return nil, &KeyUsageError{"export"}
+	}
+	return k.secret.Bytes(), nil
+}
+
+// Export returns a copy of the key material if the key is extractable.
+func (k *SecretKey) Export() ([]byte, error) {
+	key, err := k.extract()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), key...), nil
+}
+
+// cipherUsage returns the usage required by a Cipher
+func cipherUsage(encrypt bool) KeyUsage {
+	if encrypt {
+		return UsageEncrypt
+	}
+	return UsageDecrypt
+}
+
+// NewCipher creates a Cipher with the key, which must allow encryption or decryption respectively.
+func (k *SecretKey) NewCipher(spec CipherSpec, iv []byte, encrypt bool) (Cipher, error) {
+	key, err := k.allow(cipherUsage(encrypt))
+	if err != nil {
+		return nil, err
+	}
+	return spec.New(key, iv, encrypt), nil
+}
+
+// NewCipherReader creates a CipherReader decrypting with the key, which must allow decryption.
+func (k *SecretKey) NewCipherReader(in io.Reader, spec CipherSpec, iv, buffer []byte) (*CipherReader, error) {
+	key, err := k.allow(UsageDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipherReader(in, spec, key, iv, buffer), nil
+}
+
+// NewCipherWriter creates a CipherWriter encrypting with the key, which must allow encryption.
+func (k *SecretKey) NewCipherWriter(out io.Writer, spec CipherSpec, iv, buffer []byte) (*CipherWriter, error) {
+	key, err := k.allow(UsageEncrypt)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipherWriter(out, spec, key, iv, buffer), nil
+}
+
+// NewAEAD creates an AEAD with the key, which must allow encryption or decryption.
+// Seal panics with a KeyUsageError if the key doesn't allow encryption,
+// Open returns it if the key doesn't allow decryption.
+func (k *SecretKey) NewAEAD(spec AEADSpec) (AEAD, error) {
+	key, err := k.allow(UsageEncrypt | UsageDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	aead := spec.New(key)
+	if k.usages&(UsageEncrypt|UsageDecrypt) == UsageEncrypt|UsageDecrypt {
+		return aead, nil
+	}
+	return &restrictedAEAD{aead, k.usages}, nil
+}
+
+// restrictedAEAD is an AEAD that can only seal or only open
+type restrictedAEAD struct {
+	AEAD
+	usages KeyUsage
+}
+
+func (a *restrictedAEAD) Seal(dst, nonce, plain []byte, data ...[]byte) []byte {
+	if a.usages&UsageEncrypt == 0 {
+		panic(&KeyUsageError{UsageEncrypt.String()})
+	}
+	return a.AEAD.Seal(dst, nonce, plain, data...)
+}
+
+func (a *restrictedAEAD) Open(dst, nonce, encrypted []byte, data ...[]byte) ([]byte, error) {
+	if a.usages&UsageDecrypt == 0 {
+		return nil, &KeyUsageError{UsageDecrypt.String()}
+	}
+	return a.AEAD.Open(dst, nonce, encrypted, data...)
+}
+
+// NewMAC creates a MAC with the key, which must allow signing.
+func (k *SecretKey) NewMAC(spec MACSpec, hash HashSpec) (Hash, error) {
+	key, err := k.allow(UsageSign)
+	if err != nil {
+		return nil, err
+	}
+	return spec.New(hash, key), nil
+}
+
+// Wrap wraps the key material of an extractable key with the key, which must allow wrapping.
+func (k *SecretKey) Wrap(spec KeyWrapSpec, key *SecretKey) ([]byte, error) {
+	kek, err := k.allow(UsageWrap)
+	if err != nil {
+		return nil, err
+	}
+	material, err := key.extract()
+	if err != nil {
+		return nil, err
+	}
+	kw := spec.New(kek)
+	defer kw.Close()
+	return kw.Wrap(material)
+}
+
+// Unwrap unwraps a key with given usages with the key, which must allow unwrapping.
+func (k *SecretKey) Unwrap(spec KeyWrapSpec, wrapped []byte, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	kek, err := k.allow(UsageUnwrap)
+	if err != nil {
+		return nil, err
+	}
+	kw := spec.New(kek)
+	defer kw.Close()
+	secret, err := UnwrapSecret(kw, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{secret, usages, extractable}, nil
+}
+
+// Derive derives a key of given size in bytes and usages with the KDF from the key, which must allow derivation.
+func (k *SecretKey) Derive(kdf KDF, size int, usages KeyUsage, extractable bool) (*SecretKey, error) {
+	if _, err := k.allow(UsageDerive); err != nil {
+		return nil, err
+	}
+	secret, err := KDFSecret(kdf, k.secret, size)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{secret, usages, extractable}, nil
+}
+
+// Close zeroes the key material.
+func (k *SecretKey) Close() {
+	if k.secret == nil {
+		return
+	}
+	k.secret.Close()
+	k.secret = nil
+}
@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/mkobetic/okapi"
+)
+
+// blowfish is the Blowfish cipher state with the expensive key schedule of bcrypt.
+// It is used only by bcrypt-pbkdf, so it's not exposed as a CipherSpec.
+type blowfish struct {
+	p [18]uint32
+	s [4][256]uint32
+}
+
+func (b *blowfish) f(x uint32) uint32 {
+	return ((b.s[0][x>>24] + b.s[1][x>>16&0xff]) ^ b.s[2][x>>8&0xff]) + b.s[3][x&0xff]
+}
+
+func (b *blowfish) encrypt(l, r uint32) (uint32, uint32) {
+	l ^= b.p[0]
+	for i := 1; i < 17; i += 2 {
+		r ^= b.f(l) ^ b.p[i]
+		l ^= b.f(r) ^ b.p[i+1]
+	}
+	return r ^ b.p[17], l
+}
+
+// streamWord reads the next big-endian word from data cycling over it
+func streamWord(data []byte, j *int) uint32 {
+	var w uint32
+	for i := 0; i < 4; i++ {
+		w = w<<8 | uint32(data[*j])
+		*j = (*j + 1) % len(data)
+	}
+	return w
+}
+
+// expand mixes the key into the state, with data being mixed into the encrypted blocks (salt) if provided
+func (b *blowfish) expand(data, key []byte) {
+	j := 0
+	for i := range b.p {
+		b.p[i] ^= streamWord(key, &j)
+	}
+	j = 0
+	var l, r uint32
+	next := func() {
+		if data != nil {
+			l ^= streamWord(data, &j)
+			r ^= streamWord(data, &j)
+		}
+		l, r = b.encrypt(l, r)
+	}
+	for i := 0; i < len(b.p); i += 2 {
+		next()
+		b.p[i], b.p[i+1] = l, r
+	}
+	for s := range b.s {
+		for i := 0; i < len(b.s[s]); i += 2 {
+			next()
+			b.s[s][i], b.s[s][i+1] = l, r
+		}
+	}
+}
+
+// bcryptHash is the bcrypt variant used by bcrypt-pbkdf
+func bcryptHash(sha2pass, sha2salt []byte) []byte {
+	b := &blowfish{p: blowfishP, s: blowfishS}
+	b.expand(sha2salt, sha2pass)
+	for i := 0; i < 64; i++ {
+		b.expand(nil, sha2salt)
+		b.expand(nil, sha2pass)
+	}
+	magic := []byte("OxychromaticBlowfishSwatDynamite")
+	var data [8]uint32
+	for i := range data {
+		data[i] = binary.BigEndian.Uint32(magic[4*i:])
+	}
+	for i := 0; i < 64; i++ {
+		for k := 0; k < len(data); k += 2 {
+			data[k], data[k+1] = b.encrypt(data[k], data[k+1])
+		}
+	}
+	out := make([]byte, 32)
+	for i, w := range data {
+		binary.LittleEndian.PutUint32(out[4*i:], w)
+	}
+	return out
+}
+
+// bcryptPBKDF derives a key of the size from the password and salt
+// as OpenBSD bcrypt_pbkdf (used by OpenSSH to encrypt private keys).
+func bcryptPBKDF(password, salt []byte, rounds, size int) ([]byte, error) {
+	if rounds < 1 || size < 1 || size > 32*32 || len(salt) == 0 {
+		return nil, errors.New("invalid bcrypt-pbkdf parameters")
+	}
+	if okapi.SHA512 == nil {
+		return nil, errors.New("bcrypt-pbkdf requires SHA512")
+	}
+	hash := okapi.SHA512.New()
+	defer hash.Close()
+	sum := func(data ...[]byte) []byte {
+		hash.Reset()
+		for _, d := range data {
+			hash.Write(d)
+		}
+		return append([]byte(nil), hash.Digest()...)
+	}
+	stride := (size + 31) / 32
+	amount := (size + stride - 1) / stride
+	sha2pass := sum(password)
+	defer okapi.Zero(sha2pass)
+	key := make([]byte, size)
+	for count := 1; count <= stride; count++ {
+		out := bcryptHash(sha2pass, sum(salt, binary.BigEndian.AppendUint32(nil, uint32(count))))
+		previous := out
+		for i := 1; i < rounds; i++ {
+			previous = bcryptHash(sha2pass, sum(previous))
+			for j := range out {
+				out[j] ^= previous[j]
+			}
+		}
+		// the output bytes are spread across the key
+		for i := 0; i < amount; i++ {
+			if dest := i*stride + count - 1; dest < size {
+				key[dest] = out[i]
+			}
+		}
+		okapi.Zero(out)
+	}
+	return key, nil
+}
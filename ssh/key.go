@@ -0,0 +1,581 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+	"strings"
+)
+
+// Key is an SSH public key.
+type Key struct {
+	// Type is the key type, e.g. ssh-rsa
+	Type    string
+	Comment string
+	// blob is the SSH wire encoding of the key
+	blob []byte
+	// der is the X.509 SubjectPublicKeyInfo encoding of the key
+	der []byte
+}
+
+// NewKey creates an SSH key from the public key. RSA, EC (P-256, P-384, P-521) and Ed25519 keys are supported.
+func NewKey(key okapi.PublicKey, comment string) (*Key, error) {
+	der, err := okapi.ExportKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var public crypto.PublicKey
+	if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		// a private key can be used as its public key
+		public = private.(interface{ Public() crypto.PublicKey }).Public()
+	} else if public, err = x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, err
+	}
+	blob, err := marshalPublic(public)
+	if err != nil {
+		return nil, err
+	}
+	k, err := parseKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	k.Comment = comment
+	return k, nil
+}
+
+// marshalPublic returns the SSH wire encoding of the crypto package public key
+func marshalPublic(public crypto.PublicKey) ([]byte, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		blob := appendString(nil, []byte("ssh-rsa"))
+		blob = appendMPInt(blob, big.NewInt(int64(public.E)).Bytes())
+		return appendMPInt(blob, public.N.Bytes()), nil
+	case *ecdsa.PublicKey:
+		t, err := keyTypeByCurve(public.Curve.Params().Name)
+		if err != nil {
+			return nil, err
+		}
+		point, err := public.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		blob := appendString(nil, []byte(t.name))
+		blob = appendString(blob, []byte(t.curve))
+		return appendString(blob, point.Bytes()), nil
+	case *ecdh.PublicKey:
+		for i := range keyTypes {
+			if t := &keyTypes[i]; t.ecdh != nil && t.ecdh() == public.Curve() {
+				blob := appendString(nil, []byte(t.name))
+				blob = appendString(blob, []byte(t.curve))
+				return appendString(blob, public.Bytes()), nil
+			}
+		}
+	case ed25519.PublicKey:
+		blob := appendString(nil, []byte("ssh-ed25519"))
+		return appendString(blob, public), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// parseKey parses the SSH wire encoding of a public key
+func parseKey(blob []byte) (*Key, error) {
+	name, rest, err := readString(blob)
+	if err != nil {
+		return nil, err
+	}
+	t, err := keyTypeByName(string(name))
+	if err != nil {
+		return nil, err
+	}
+	var public interface{}
+	switch {
+	case t.name == "ssh-rsa":
+		var e, n *big.Int
+		if e, rest, err = readMPInt(rest); err != nil {
+			return nil, err
+		}
+		if n, rest, err = readMPInt(rest); err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || n.Sign() == 0 {
+			return nil, errors.New("invalid RSA key")
+		}
+		public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case t.ecdh != nil:
+		var s [][]byte
+		if s, rest, err = readStrings(rest, 2); err != nil {
+			return nil, err
+		}
+		if string(s[0]) != t.curve {
+			return nil, fmt.Errorf("%s key with curve %s", t.name, s[0])
+		}
+		if public, err = t.ecdh().NewPublicKey(s[1]); err != nil {
+			return nil, err
+		}
+	default:
+		var point []byte
+		if point, rest, err = readString(rest); err != nil {
+			return nil, err
+		}
+		if len(point) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		public = ed25519.PublicKey(point)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after SSH key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Type: t.name, blob: append([]byte(nil), blob...), der: der}, nil
+}
+
+// ParseAuthorizedKey parses a public key in the authorized_keys line format,
+// i.e. optional options, key type, base64 encoded key and optional comment.
+// Note that the options are skipped.
+func ParseAuthorizedKey(line []byte) (*Key, error) {
+	fields := strings.Fields(string(line))
+	for i, field := range fields {
+		if _, err := keyTypeByName(field); err != nil || i+1 == len(fields) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		k, err := parseKey(blob)
+		if err != nil {
+			return nil, err
+		}
+		if k.Type != field {
+			return nil, fmt.Errorf("%s key with type %s", k.Type, field)
+		}
+		k.Comment = strings.Join(fields[i+2:], " ")
+		return k, nil
+	}
+	return nil, errors.New("no supported SSH key found")
+}
+
+// ParseAuthorizedKeys parses all supported keys from an authorized_keys file,
+// blank lines, comments and lines with unsupported key types are skipped.
+func ParseAuthorizedKeys(data []byte) ([]*Key, error) {
+	var keys []*Key
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		k, err := ParseAuthorizedKey(line)
+		if err != nil {
+			if fields := strings.Fields(string(line)); !hasKeyType(fields) {
+				continue
+			}
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func hasKeyType(fields []string) bool {
+	for _, field := range fields {
+		if _, err := keyTypeByName(field); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizedKey returns the key in the authorized_keys line format (including the trailing newline).
+func (k *Key) AuthorizedKey() []byte {
+	line := k.Type + " " + base64.StdEncoding.EncodeToString(k.blob)
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return []byte(line + "\n")
+}
+
+// Marshal returns the SSH wire encoding of the key (RFC 4253, section 6.6).
+func (k *Key) Marshal() []byte {
+	return append([]byte(nil), k.blob...)
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key as displayed by ssh-keygen -l.
+func (k *Key) Fingerprint() string {
+	sum := sha256.Sum256(k.blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Export encodes the key as X.509 SubjectPublicKeyInfo in DER format,
+// it can be imported using the KeyConstructor for the intended use.
+func (k *Key) Export() ([]byte, error) {
+	return append([]byte(nil), k.der...), nil
+}
+
+// publicKey creates the public key with the constructor
+func (k *Key) publicKey(constructor okapi.KeyConstructor) (okapi.PublicKey, error) {
+	if constructor == nil {
+		return nil, fmt.Errorf("%s key algorithm is not available", k.Type)
+	}
+	key, err := constructor(k.der)
+	if err != nil {
+		return nil, err
+	}
+	// the key holds only the public key, so it is its own PublicKey
+	return key.PublicKey(), nil
+}
+
+// PrivateKey is an SSH key along with the corresponding okapi private key.
+type PrivateKey struct {
+	*Key
+	// Private must be configured for the intended use, e.g. for SSH signatures RSA keys
+	// must be created with okapi.RSA_SHA512, ECDSA keys with the hash matching the curve
+	// (okapi.ECDSA_SHA256, okapi.ECDSA_384 or okapi.ECDSA_SHA512) and Ed25519 keys with okapi.Ed25519.
+	Private okapi.PrivateKey
+}
+
+const (
+	privateKeyMagic = "openssh-key-v1\x00"
+	privateKeyPEM   = "OPENSSH PRIVATE KEY"
+	// defaults of ssh-keygen
+	defaultCipher = "aes256-ctr"
+	defaultRounds = 16
+	saltSize      = 16
+)
+
+// ciphers maps the supported private key ciphers to key sizes
+var ciphers = map[string]int{
+	"aes128-ctr": 16,
+	"aes192-ctr": 24,
+	"aes256-ctr": 32,
+}
+
+// ParsePrivateKey parses a PEM encoded private key in the OpenSSH format, encrypted keys
+// are decrypted with the passphrase. Unencrypted PKCS#1, SEC 1 and PKCS#8 PEM keys
+// (written by older ssh-keygen versions) are accepted as well.
+// The constructor function returns the KeyConstructor that configures the okapi key
+// for its intended use (see PrivateKey). If constructor is nil, the key is configured
+// for SSH signatures.
+func ParsePrivateKey(data, passphrase []byte, constructor func(key *Key) okapi.KeyConstructor) (*PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	defer okapi.Zero(block.Bytes)
+	var private crypto.PrivateKey
+	var comment string
+	var err error
+	switch block.Type {
+	case privateKeyPEM:
+		private, comment, err = parseOpenSSH(block.Bytes, passphrase)
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+		if block.Headers["Proc-Type"] != "" {
+			return nil, errors.New("encrypted PEM private keys are not supported")
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			private, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob, err := marshalPublic(private.(interface{ Public() crypto.PublicKey }).Public())
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	key.Comment = comment
+	if constructor == nil {
+		constructor = defaultConstructor
+	}
+	kc := constructor(key)
+	if kc == nil {
+		return nil, fmt.Errorf("%s key algorithm is not available", key.Type)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(der)
+	pk, err := kc(der)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{Key: key, Private: pk}, nil
+}
+
+func defaultConstructor(key *Key) okapi.KeyConstructor {
+	if a, err := signatureAlgorithmByKey(key.Type); err == nil {
+		return *a.constructor
+	}
+	return nil
+}
+
+// parseOpenSSH parses the openssh-key-v1 format (PROTOCOL.key in OpenSSH sources)
+func parseOpenSSH(data, passphrase []byte) (crypto.PrivateKey, string, error) {
+	if !bytes.HasPrefix(data, []byte(privateKeyMagic)) {
+		return nil, "", errors.New("invalid OpenSSH private key")
+	}
+	s, rest, err := readStrings(data[len(privateKeyMagic):], 3)
+	if err != nil {
+		return nil, "", err
+	}
+	cipher, kdf, kdfOptions := string(s[0]), string(s[1]), s[2]
+	count, rest, err := readUint32(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	if count != 1 {
+		return nil, "", errors.New("OpenSSH private key files with multiple keys are not supported")
+	}
+	if s, _, err = readStrings(rest, 2); err != nil {
+		return nil, "", err
+	}
+	public, encrypted := s[0], s[1]
+	var section []byte
+	switch {
+	case cipher == "none" && kdf == "none":
+		section = append([]byte(nil), encrypted...)
+	case kdf == "bcrypt" && ciphers[cipher] > 0:
+		if len(passphrase) == 0 {
+			return nil, "", errors.New("OpenSSH private key is encrypted, passphrase required")
+		}
+		salt, options, err := readString(kdfOptions)
+		if err != nil {
+			return nil, "", err
+		}
+		rounds, _, err := readUint32(options)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(encrypted)%16 != 0 {
+			return nil, "", errors.New("invalid OpenSSH private key encryption")
+		}
+		if section, err = crypt(cipher, passphrase, salt, int(rounds), encrypted); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported OpenSSH private key encryption %s/%s", cipher, kdf)
+	}
+	defer okapi.Zero(section)
+	private, comment, err := parsePrivateSection(section)
+	if err != nil {
+		return nil, "", err
+	}
+	if blob, err := marshalPublic(private.(interface{ Public() crypto.PublicKey }).Public()); err != nil || !bytes.Equal(blob, public) {
+		return nil, "", errors.New("OpenSSH private key doesn't match the public key")
+	}
+	return private, comment, nil
+}
+
+// crypt encrypts or decrypts the private section with AES-CTR and the key derived with bcrypt-pbkdf
+func crypt(cipher string, passphrase, salt []byte, rounds int, in []byte) ([]byte, error) {
+	if okapi.AES_CTR == nil {
+		return nil, errors.New("OpenSSH private key encryption requires AES_CTR")
+	}
+	keySize := ciphers[cipher]
+	key, err := bcryptPBKDF(passphrase, salt, rounds, keySize+16)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(key)
+	// CTR mode is the same for encryption and decryption
+	c := okapi.AES_CTR.New(key[:keySize], key[keySize:], true)
+	defer c.Close()
+	out := make([]byte, len(in))
+	_, n := c.Update(in, out)
+	c.Finish(out[n:])
+	return out, nil
+}
+
+func parsePrivateSection(section []byte) (crypto.PrivateKey, string, error) {
+	check1, rest, err := readUint32(section)
+	if err != nil {
+		return nil, "", err
+	}
+	check2, rest, err := readUint32(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	if check1 != check2 {
+		return nil, "", errors.New("wrong passphrase or corrupted OpenSSH private key")
+	}
+	name, rest, err := readString(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	t, err := keyTypeByName(string(name))
+	if err != nil {
+		return nil, "", err
+	}
+	var private crypto.PrivateKey
+	switch {
+	case t.name == "ssh-rsa":
+		var values [6]*big.Int // n, e, d, iqmp, p, q
+		for i := range values {
+			if values[i], rest, err = readMPInt(rest); err != nil {
+				return nil, "", err
+			}
+		}
+		if !values[1].IsInt64() || values[1].Int64() > 1<<31-1 {
+			return nil, "", errors.New("invalid RSA key")
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: values[0], E: int(values[1].Int64())},
+			D:         values[2],
+			Primes:    []*big.Int{values[4], values[5]},
+		}
+		if err = key.Validate(); err != nil {
+			return nil, "", err
+		}
+		key.Precompute()
+		private = key
+	case t.ecdh != nil:
+		var s [][]byte
+		if s, rest, err = readStrings(rest, 2); err != nil {
+			return nil, "", err
+		}
+		var d *big.Int
+		if d, rest, err = readMPInt(rest); err != nil {
+			return nil, "", err
+		}
+		if string(s[0]) != t.curve || len(d.Bytes()) > t.byteSize {
+			return nil, "", errors.New("invalid ECDSA key")
+		}
+		key, err := t.ecdh().NewPrivateKey(leftPad(d.Bytes(), t.byteSize))
+		if err != nil {
+			return nil, "", err
+		}
+		if !bytes.Equal(key.PublicKey().Bytes(), s[1]) {
+			return nil, "", errors.New("invalid ECDSA key")
+		}
+		private = key
+	default:
+		var s [][]byte
+		if s, rest, err = readStrings(rest, 2); err != nil {
+			return nil, "", err
+		}
+		if len(s[1]) != ed25519.PrivateKeySize || !bytes.Equal(s[1][32:], s[0]) {
+			return nil, "", errors.New("invalid Ed25519 key")
+		}
+		key := ed25519.NewKeyFromSeed(s[1][:ed25519.SeedSize])
+		if !bytes.Equal(key[32:], s[0]) {
+			return nil, "", errors.New("invalid Ed25519 key")
+		}
+		private = key
+	}
+	comment, rest, err := readString(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, b := range rest {
+		if b != byte(i+1) {
+			return nil, "", errors.New("invalid OpenSSH private key padding")
+		}
+	}
+	return private, string(comment), nil
+}
+
+// MarshalPrivateKey encodes the key in the PEM encoded OpenSSH private key format.
+// If passphrase is not empty, the key is encrypted with aes256-ctr and bcrypt-pbkdf (16 rounds),
+// the same as ssh-keygen does. The okapi key must be extractable.
+func MarshalPrivateKey(key *PrivateKey, passphrase []byte) ([]byte, error) {
+	der, err := okapi.ExportKey(key.Private)
+	if err != nil {
+		return nil, err
+	}
+	defer okapi.Zero(der)
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	public, err := marshalPublic(private.(interface{ Public() crypto.PublicKey }).Public())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(public, key.blob) {
+		return nil, errors.New("private key doesn't match the public key")
+	}
+	check, err := random(4)
+	if err != nil {
+		return nil, err
+	}
+	section := append(append([]byte(nil), check...), check...)
+	section = appendString(section, []byte(key.Type))
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if len(private.Primes) != 2 {
+			return nil, errors.New("multi-prime RSA keys are not supported")
+		}
+		private.Precompute()
+		for _, value := range []*big.Int{private.N, big.NewInt(int64(private.E)), private.D,
+			private.Precomputed.Qinv, private.Primes[0], private.Primes[1]} {
+			section = appendMPInt(section, value.Bytes())
+		}
+	case *ecdsa.PrivateKey:
+		t, _ := keyTypeByName(key.Type)
+		key, err := private.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		section = appendString(section, []byte(t.curve))
+		section = appendString(section, key.PublicKey().Bytes())
+		section = appendMPInt(section, key.Bytes())
+	case ed25519.PrivateKey:
+		section = appendString(section, private[32:])
+		section = appendString(section, private)
+	}
+	section = appendString(section, []byte(key.Comment))
+	cipher, kdf, kdfOptions, blockSize := "none", "none", []byte{}, 8
+	if len(passphrase) > 0 {
+		salt, err := random(saltSize)
+		if err != nil {
+			return nil, err
+		}
+		cipher, kdf, blockSize = defaultCipher, "bcrypt", 16
+		kdfOptions = binary.BigEndian.AppendUint32(appendString(nil, salt), defaultRounds)
+	}
+	for i := 1; len(section)%blockSize != 0; i++ {
+		section = append(section, byte(i))
+	}
+	defer okapi.Zero(section)
+	encrypted := section
+	if len(passphrase) > 0 {
+		salt, _, _ := readString(kdfOptions)
+		if encrypted, err = crypt(cipher, passphrase, salt, defaultRounds, section); err != nil {
+			return nil, err
+		}
+	}
+	data := []byte(privateKeyMagic)
+	data = appendString(data, []byte(cipher))
+	data = appendString(data, []byte(kdf))
+	data = appendString(data, kdfOptions)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = appendString(data, key.blob)
+	data = appendString(data, encrypted)
+	return pem.EncodeToMemory(&pem.Block{Type: privateKeyPEM, Bytes: data}), nil
+}
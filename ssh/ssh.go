@@ -0,0 +1,169 @@
+// Package ssh implements the OpenSSH key formats and SSH signatures using okapi keys and hashes,
+// so that it works with any imported implementation.
+//
+// Supported are public keys in the authorized_keys line format, private keys in the OpenSSH format
+// (openssh-key-v1, optionally encrypted with bcrypt-pbkdf and AES-CTR) and detached SSHSIG signatures
+// (as created and verified by ssh-keygen -Y sign/verify). Key types are ssh-rsa, ecdsa-sha2-nistp256,
+// ecdsa-sha2-nistp384, ecdsa-sha2-nistp521 and ssh-ed25519.
+package ssh
+
+import (
+	"crypto/ecdh"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"math/big"
+)
+
+// keyType describes the supported key types
+type keyType struct {
+	name string
+	// curve of ECDSA keys
+	curve    string
+	ecdh     func() ecdh.Curve
+	goCurve  string
+	byteSize int
+}
+
+var keyTypes = []keyType{
+	{name: "ssh-rsa"},
+	{"ecdsa-sha2-nistp256", "nistp256", ecdh.P256, "P-256", 32},
+	{"ecdsa-sha2-nistp384", "nistp384", ecdh.P384, "P-384", 48},
+	{"ecdsa-sha2-nistp521", "nistp521", ecdh.P521, "P-521", 66},
+	{name: "ssh-ed25519"},
+}
+
+func keyTypeByName(name string) (*keyType, error) {
+	for i := range keyTypes {
+		if t := &keyTypes[i]; t.name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key type %s", name)
+}
+
+func keyTypeByCurve(curve string) (*keyType, error) {
+	for i := range keyTypes {
+		if t := &keyTypes[i]; t.goCurve == curve && curve != "" {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported curve %s", curve)
+}
+
+// signatureAlgorithm maps an SSH signature algorithm to the predefined HashSpec
+// and the key constructor for signing and verification.
+type signatureAlgorithm struct {
+	name        string
+	keyType     string
+	hash        *okapi.HashSpec
+	constructor *okapi.KeyConstructor
+}
+
+var signatureAlgorithms = []signatureAlgorithm{
+	{"rsa-sha2-512", "ssh-rsa", &okapi.SHA512, &okapi.RSA_SHA512},
+	{"rsa-sha2-256", "ssh-rsa", &okapi.SHA256, &okapi.RSA_SHA256},
+	{"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp256", &okapi.SHA256, &okapi.ECDSA_SHA256},
+	{"ecdsa-sha2-nistp384", "ecdsa-sha2-nistp384", &okapi.SHA384, &okapi.ECDSA_384},
+	{"ecdsa-sha2-nistp521", "ecdsa-sha2-nistp521", &okapi.SHA512, &okapi.ECDSA_SHA512},
+	// Ed25519 signs the message itself
+	{"ssh-ed25519", "ssh-ed25519", nil, &okapi.Ed25519},
+}
+
+func signatureAlgorithmByName(name string) (*signatureAlgorithm, error) {
+	for i := range signatureAlgorithms {
+		if a := &signatureAlgorithms[i]; a.name == name && *a.constructor != nil {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported signature algorithm %s", name)
+}
+
+// signatureAlgorithmByKey returns the default signature algorithm for the key type
+func signatureAlgorithmByKey(keyType string) (*signatureAlgorithm, error) {
+	for i := range signatureAlgorithms {
+		if a := &signatureAlgorithms[i]; a.keyType == keyType && *a.constructor != nil {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("signatures with %s keys are not available", keyType)
+}
+
+// SSH wire encoding (RFC 4251, section 5)
+
+func appendString(out []byte, s []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(out, uint32(len(s))), s...)
+}
+
+// appendMPInt appends the big-endian unsigned integer as mpint
+func appendMPInt(out []byte, b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return appendString(out, b)
+}
+
+var errTruncated = errors.New("truncated SSH data")
+
+func readUint32(in []byte) (uint32, []byte, error) {
+	if len(in) < 4 {
+		return 0, nil, errTruncated
+	}
+	return binary.BigEndian.Uint32(in), in[4:], nil
+}
+
+func readString(in []byte) (s, rest []byte, err error) {
+	size, in, err := readUint32(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint32(len(in)) < size {
+		return nil, nil, errTruncated
+	}
+	return in[:size], in[size:], nil
+}
+
+// readStrings reads consecutive strings
+func readStrings(in []byte, count int) (strings [][]byte, rest []byte, err error) {
+	strings = make([][]byte, count)
+	for i := range strings {
+		if strings[i], in, err = readString(in); err != nil {
+			return nil, nil, err
+		}
+	}
+	return strings, in, nil
+}
+
+// readMPInt reads a non-negative mpint as a big.Int
+func readMPInt(in []byte) (*big.Int, []byte, error) {
+	b, rest, err := readString(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		return nil, nil, errors.New("negative SSH mpint")
+	}
+	return new(big.Int).SetBytes(b), rest, nil
+}
+
+// leftPad pads the big-endian integer with leading zeros to the size
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func random(size int) ([]byte, error) {
+	random := okapi.DefaultRandom.New()
+	defer random.Close()
+	b := make([]byte, size)
+	if _, err := random.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	"io"
+	"math/big"
+)
+
+// SSHSIG format (PROTOCOL.sshsig in OpenSSH sources)
+const (
+	sigMagic   = "SSHSIG"
+	sigVersion = 1
+	sigPEM     = "SSH SIGNATURE"
+	// defaultHash is the message hash used by ssh-keygen
+	defaultHash = "sha512"
+)
+
+// messageHashes are the hashes of the signed message
+var messageHashes = map[string]*okapi.HashSpec{
+	"sha256": &okapi.SHA256,
+	"sha512": &okapi.SHA512,
+}
+
+// signedData returns the data that is signed by the key
+func signedData(namespace, hash string, digest []byte) []byte {
+	data := []byte(sigMagic)
+	data = appendString(data, []byte(namespace))
+	data = appendString(data, nil)
+	data = appendString(data, []byte(hash))
+	return appendString(data, digest)
+}
+
+func digest(hash string, message io.Reader) ([]byte, error) {
+	spec, ok := messageHashes[hash]
+	if !ok || *spec == nil {
+		return nil, fmt.Errorf("unsupported SSH signature hash %s", hash)
+	}
+	h := (*spec).New()
+	defer h.Close()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), h.Digest()...), nil
+}
+
+// Sign creates a PEM encoded detached SSH signature of the message, the same as ssh-keygen -Y sign.
+// The namespace prevents signatures from being used in a different context, e.g. "file" or "git".
+// RSA keys sign with rsa-sha2-512, the key must be configured accordingly (see PrivateKey).
+func Sign(message io.Reader, key *PrivateKey, namespace string) ([]byte, error) {
+	if namespace == "" {
+		return nil, errors.New("SSH signature namespace is required")
+	}
+	algorithm, err := signatureAlgorithmByKey(key.Type)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := digest(defaultHash, message)
+	if err != nil {
+		return nil, err
+	}
+	data := signedData(namespace, defaultHash, digest)
+	if algorithm.hash != nil {
+		h := (*algorithm.hash).New()
+		h.Write(data)
+		data = append([]byte(nil), h.Digest()...)
+		h.Close()
+	}
+	signature, err := key.Private.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm.keyType != "ssh-rsa" && algorithm.hash != nil {
+		// ECDSA signature is encoded as mpint r and s
+		var rs ecdsaSignature
+		if _, err = asn1.Unmarshal(signature, &rs); err != nil {
+			return nil, err
+		}
+		signature = appendMPInt(appendMPInt(nil, rs.R.Bytes()), rs.S.Bytes())
+	}
+	blob := appendString(appendString(nil, []byte(algorithm.name)), signature)
+	out := binary.BigEndian.AppendUint32([]byte(sigMagic), sigVersion)
+	out = appendString(out, key.blob)
+	out = appendString(out, []byte(namespace))
+	out = appendString(out, nil)
+	out = appendString(out, []byte(defaultHash))
+	out = appendString(out, blob)
+	return pem.EncodeToMemory(&pem.Block{Type: sigPEM, Bytes: out}), nil
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Verify verifies the PEM encoded detached SSH signature of the message in the namespace,
+// the same as ssh-keygen -Y verify, and returns the key that made the signature.
+// The signing key must be one of the keys.
+func Verify(signature []byte, message io.Reader, keys []*Key, namespace string) (*Key, error) {
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != sigPEM {
+		return nil, errors.New("no PEM encoded SSH signature found")
+	}
+	data := block.Bytes
+	if !bytes.HasPrefix(data, []byte(sigMagic)) {
+		return nil, errors.New("invalid SSH signature")
+	}
+	version, rest, err := readUint32(data[len(sigMagic):])
+	if err != nil {
+		return nil, err
+	}
+	if version != sigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", version)
+	}
+	s, _, err := readStrings(rest, 5)
+	if err != nil {
+		return nil, err
+	}
+	public, hash, blob := s[0], string(s[3]), s[4]
+	if string(s[1]) != namespace {
+		return nil, fmt.Errorf("SSH signature namespace %q doesn't match %q", s[1], namespace)
+	}
+	var key *Key
+	for _, k := range keys {
+		if bytes.Equal(k.blob, public) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.New("SSH signature is not made by any of the keys")
+	}
+	if s, _, err = readStrings(blob, 2); err != nil {
+		return nil, err
+	}
+	algorithm, err := signatureAlgorithmByName(string(s[0]))
+	if err != nil {
+		return nil, err
+	}
+	if algorithm.keyType != key.Type {
+		return nil, fmt.Errorf("%s signature made by %s key", algorithm.name, key.Type)
+	}
+	sig := s[1]
+	digest, err := digest(hash, message)
+	if err != nil {
+		return nil, err
+	}
+	data = signedData(namespace, hash, digest)
+	if algorithm.hash != nil {
+		h := (*algorithm.hash).New()
+		h.Write(data)
+		data = append([]byte(nil), h.Digest()...)
+		h.Close()
+	}
+	if algorithm.keyType != "ssh-rsa" && algorithm.hash != nil {
+		r, rest, err := readMPInt(sig)
+		if err != nil {
+			return nil, err
+		}
+		s, _, err := readMPInt(rest)
+		if err != nil {
+			return nil, err
+		}
+		if sig, err = asn1.Marshal(ecdsaSignature{r, s}); err != nil {
+			return nil, err
+		}
+	}
+	pk, err := key.publicKey(*algorithm.constructor)
+	if err != nil {
+		return nil, err
+	}
+	defer pk.Close()
+	valid, err := pk.Verify(sig, data)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.New("invalid SSH signature")
+	}
+	return key, nil
+}
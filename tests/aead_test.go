@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	_ "testing"
+)
+
+func Example_aesSIV() {
+	key, _ := hex.DecodeString("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	siv := okapi.AES_SIV.New(key)
+	defer siv.Close()
+	header := []byte("header")
+	plain := []byte("Message in a bottle!")
+	// without a nonce the encryption is deterministic
+	encrypted := siv.Seal(nil, nil, plain, header)
+	fmt.Printf("Encrypted size %d, overhead %d\n", len(encrypted), siv.Overhead())
+	decrypted, err := siv.Open(nil, nil, encrypted, header)
+	fmt.Printf("Decrypted: %s, error %v\n", decrypted, err)
+	_, err = siv.Open(nil, nil, encrypted, []byte("forged header"))
+	fmt.Printf("Forged error: %v\n", err)
+	// Output:
+	// Encrypted size 36, overhead 16
+	// Decrypted: Message in a bottle!, error <nil>
+	// Forged error: message authentication failed
+}
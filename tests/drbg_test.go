@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	. "github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	_ "testing"
+)
+
+// entropy is a fixed entropy source for DRBG test vectors
+type entropy struct {
+	data []byte
+}
+
+func (e *entropy) New() Random { return e }
+
+func (e *entropy) Read(b []byte) (int, error) {
+	if len(b) > len(e.data) {
+		return 0, errors.New("entropy exhausted")
+	}
+	copy(b, e.data)
+	e.data = e.data[len(b):]
+	return len(b), nil
+}
+
+func (e *entropy) Close() {}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func ExampleDRBG_hmac() {
+	// NIST CAVP HMAC_DRBG SHA-256, no prediction resistance, no reseed, COUNT 0
+	spec := HMAC_DRBG{
+		Hash:    SHA256,
+		Entropy: &entropy{unhex("ca851911349384bffe89de1cbdc46e6831e44d34a4fb935ee285dd14b71a7488")},
+		Nonce:   unhex("659ba96c601dc69fc902940805ec0ca8"),
+	}
+	drbg := spec.New().(DRBG)
+	defer drbg.Close()
+	out := make([]byte, 128)
+	drbg.Generate(out, nil)
+	err := drbg.Generate(out, nil)
+	fmt.Printf("%x, error %v\n", out[:64], err)
+	fmt.Printf("%x\n", out[64:])
+	// Output:
+	// e528e9abf2dece54d47c7e75e5fe302149f817ea9fb4bee6f4199697d04d5b89d54fbb978a15b5c443c9ec21036d2460b6f73ebad0dc2aba6e624abf07745bc1, error <nil>
+	// 07694bb7547bb0995f70de25d6b29e2d3011bb19d27676c07162c8b5ccde0668961df86803482cb37ed6d5c0bb8d50cf1f50d476aa0458bdaba806f48be9dcb8
+}
+
+func ExampleDRBG_ctr() {
+	// NIST ACVP CTR_DRBG AES-256 without derivation function, with reseed and additional input
+	spec := CTR_DRBG{
+		KeySize:              32,
+		NoDerivationFunction: true,
+		Entropy: &entropy{unhex("9fcbb4ccc0135c484bded061da9fd70748682fe84166b97ff53f9aa1909b2e95d3d529c0f453b3ac575d12aa441cc5cd" +
+			"913c0da19b010eddd55a7a4f3f713eef5b1534d34360a7ec376ae71a6b340043cc7726f762cb853453f399b3a645062a")},
+		Personalization: unhex("2c9fed0b39556cdbe699ebca2a0ec7eecb287e8744475050c572fa8ae9ed0a4a7d6f1cabf1c4278532fb20af7d64bd32"),
+	}
+	drbg := spec.New().(DRBG)
+	defer drbg.Close()
+	drbg.Reseed(unhex("2d9d4ec141a22e6cd2f6ee4f6719cf6bdf95cfe50b8d5ea6c87d38b4b872706fff80b0380bb90e9c42d11d6526e56c29"))
+	out := make([]byte, 512)
+	drbg.Generate(out, unhex("a642f06d327828f3e84564a3e37d60c157073b95864ca07981b0189668a0d978cd5dc68f06801ceff0dc839a312b028e"))
+	err := drbg.Generate(out, unhex("9db14babfa9107c88ba92073c0b4a65e89147ea06d74b894142979482f452915b35b5636f9b8a951759735ade7c8d5d1"))
+	expected := unhex("f10c645683ff0131254052ed4c698122b46b563654c29d728ac191ca4aaefe649eefe4c6fc33b25bb739294dd5cf578099f856c98d98000cbf971f1e6ea900822ff8c110118f6520471744d3f8a3f5c7d568494240e57f5488af9c9f9f4e7322f56ccd843c0dbfce9170c02e205389420527f23edb3369d9fcc5e34901b5ba4eb71b973fc7982ffe0899ff7fe53ee0c4f51a3ef93ef9c6d4d279dd7536f8776be94aaa05e89ef6e6aee8832b4b42ffca5fb91ec0273f9ef945865512889b0c5ee141d1b38df827d2a694835561628c6f9b093a01a835f07adbb9e03febf93389e8f3b86e1e0abf1f9958fa286ad995289c2f606d1a9043a166c1afe8d00769c712650819c9068a4bd22717c98338395a7ba6e95b5178bfbf4efb0f05a91713ba8bf2127a6ba1edfa6d1cab05c03ee0d2afe1da4eb8f2c579ec872ff4b602027ef4bdcf2f4b01423f8e600a13d7cacb6ab83263ba58f907694af614a6724fd0e4c627a0d91ddc6716c697face6f4808a4f37b731de4e0cd4766ceadaaaf47992505299c72ac1a6e9a8335b8d7e501b3841188d0da4de5267674444dc2b0cf9f010756fa865a25ca3f1b24c34e845b2259926b6a867a7684de68a6137c4fb0f47a2e54ae9e6455beba0b0a9629644fe9e378ee95386443ba977124ffd1192e9f460684c7b09fa99f5f93f04f56fd7955e042187887ce696f1934017e458b16b5c9")
+	fmt.Printf("Matches: %v, error %v\n", bytes.Equal(out, expected), err)
+	// Output:
+	// Matches: true, error <nil>
+}
+
+func ExampleDRBG_hash() {
+	// prediction resistance reseeds before the request, cross-checked with OpenSSL
+	source := make([]byte, 64)
+	for i := range source {
+		source[i] = byte(i)
+	}
+	nonce := make([]byte, 16)
+	for i := range nonce {
+		nonce[i] = byte(0x80 + i)
+	}
+	spec := Hash_DRBG{
+		Hash:                 SHA256,
+		Entropy:              &entropy{source},
+		Nonce:                nonce,
+		Personalization:      []byte("personal"),
+		PredictionResistance: true,
+	}
+	drbg := spec.New().(DRBG)
+	defer drbg.Close()
+	out := make([]byte, 40)
+	err := drbg.Generate(out, []byte("pr"))
+	fmt.Printf("%x, error %v\n", out, err)
+	_, err = drbg.Read(out)
+	fmt.Printf("Entropy exhausted: %v\n", err != nil)
+	// Output:
+	// 11431a614935c43e5732652caa5a1fad05813cd2f6c42869b47d578502182b8e9def44ab30d47cf9, error <nil>
+	// Entropy exhausted: true
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"io/ioutil"
+	"testing"
+)
+
+func ExampleEnvelopeWriter() {
+	alice, _ := okapi.RSA_OAEP(1024)
+	defer alice.Close()
+	bob, _ := okapi.ECDH(256)
+	defer bob.Close()
+	alicePub, bobPub := alice.PublicKey(), bob.PublicKey()
+	defer alicePub.Close()
+	defer bobPub.Close()
+	encrypted := new(bytes.Buffer)
+	w, err := okapi.NewEnvelopeWriter(encrypted, []okapi.PublicKey{alicePub, bobPub}, nil, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	w.Write([]byte("Message in a bottle!"))
+	err = w.Close()
+	fmt.Printf("Encryption error %v\n", err)
+	// recipients look up their private key by the key id
+	bobID, _ := okapi.EnvelopeKeyID(bobPub)
+	keys := func(id []byte) okapi.PrivateKey {
+		if bytes.Equal(id, bobID) {
+			return bob
+		}
+		return nil
+	}
+	r, err := okapi.NewEnvelopeReader(bytes.NewReader(encrypted.Bytes()), keys, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	fmt.Printf("Decrypted: %s, error %v\n", decrypted, err)
+	err = r.Close()
+	fmt.Printf("Integrity error %v\n", err)
+	// Output:
+	// Encryption error <nil>
+	// Decrypted: Message in a bottle!, error <nil>
+	// Integrity error <nil>
+}
+
+func TestEnvelopeRecipients(t *testing.T) {
+	var pris []okapi.PrivateKey
+	var pubs []okapi.PublicKey
+	for _, new := range []func() (okapi.PrivateKey, error){
+		func() (okapi.PrivateKey, error) { return okapi.RSA_OAEP(1024) },
+		func() (okapi.PrivateKey, error) { return okapi.ECDH(384) },
+		func() (okapi.PrivateKey, error) { return okapi.ECDH(521) },
+	} {
+		pri, err := new()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pri.Close()
+		pub := pri.PublicKey()
+		defer pub.Close()
+		pris = append(pris, pri)
+		pubs = append(pubs, pub)
+	}
+	parameters := okapi.EnvelopeParameters{Cipher: "AES_OFB", KeySize: 16, Hash: "SHA1"}
+	plain := make([]byte, 100000)
+	encrypted := new(bytes.Buffer)
+	w, err := okapi.NewEnvelopeWriter(encrypted, pubs, &parameters, make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := encrypted.Bytes()
+	for i, pri := range pris {
+		id, err := okapi.EnvelopeKeyID(pubs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := pri
+		keys := func(other []byte) okapi.PrivateKey {
+			if bytes.Equal(id, other) {
+				return key
+			}
+			return nil
+		}
+		r, err := okapi.NewEnvelopeReader(bytes.NewReader(data), keys, nil)
+		if err != nil {
+			t.Fatalf("recipient %d: %s", i, err)
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Close(); err != nil {
+			t.Fatalf("recipient %d: %s", i, err)
+		}
+		if !bytes.Equal(plain, decrypted) {
+			t.Fatalf("recipient %d: decrypted data mismatch", i)
+		}
+	}
+	_, err = okapi.NewEnvelopeReader(bytes.NewReader(data), func([]byte) okapi.PrivateKey { return nil }, nil)
+	if err == nil {
+		t.Fatal("no recipient key should fail")
+	}
+	keySize := bytes.Index(data, []byte("AES_OFB")) + 7
+	data[keySize] = 20
+	_, err = okapi.NewEnvelopeReader(bytes.NewReader(data), func([]byte) okapi.PrivateKey { return pris[0] }, nil)
+	if err == nil {
+		t.Fatal("invalid key size should fail")
+	}
+	data[keySize] = 16
+	data[len(data)-1000] ^= 1
+	r, err := okapi.NewEnvelopeReader(bytes.NewReader(data), func([]byte) okapi.PrivateKey { return pris[0] }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(r)
+	if err = r.Close(); err == nil {
+		t.Fatal("tampered envelope should fail integrity check")
+	}
+}
+
+func TestEnvelopeRandom(t *testing.T) {
+	alice, _ := okapi.RSA_OAEP(1024)
+	defer alice.Close()
+	bob, _ := okapi.ECDH(256)
+	defer bob.Close()
+	alicePub, bobPub := alice.PublicKey(), bob.PublicKey()
+	defer alicePub.Close()
+	defer bobPub.Close()
+	encrypt := func(seed string) []byte {
+		parameters := okapi.DefaultEnvelopeParameters
+		parameters.Random = okapi.SeededRandom([]byte(seed)).New()
+		defer parameters.Random.Close()
+		encrypted := new(bytes.Buffer)
+		w, err := okapi.NewEnvelopeWriter(encrypted, []okapi.PublicKey{alicePub, bobPub}, &parameters, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("Message in a bottle!"))
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return encrypted.Bytes()
+	}
+	if !bytes.Equal(encrypt("seed"), encrypt("seed")) {
+		t.Fatal("Envelope doesn't use the Random of the parameters")
+	}
+	if bytes.Equal(encrypt("seed"), encrypt("other seed")) {
+		t.Fatal("Envelope doesn't depend on the Random of the parameters")
+	}
+}
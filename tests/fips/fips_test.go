@@ -0,0 +1,145 @@
+// FIPS mode cannot be switched off, so these tests run in their own process.
+package fips
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// refused returns the FIPSError the function panicked with
+func refused(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(*FIPSError)
+		}
+	}()
+	f()
+	return nil
+}
+
+func ExampleEnableFIPS() {
+	fmt.Printf("Self-tests: %v\n", EnableFIPS())
+	fmt.Println(refused(func() { MD5.New() }))
+	key := bytes.Repeat([]byte{0x5a}, 24)
+	iv := make([]byte, 8)
+	fmt.Println(refused(func() { DES3_CBC.New(key, iv, true) }))
+	fmt.Printf("Decryption: %v\n", refused(func() { DES3_CBC.New(key, iv, false).Close() }))
+	_, err := RSA_SHA256(1024)
+	fmt.Println(err)
+	_, err = RSA(2048)
+	fmt.Println(err)
+	_, err = DSA_SHA256(2048)
+	fmt.Println(err)
+	_, err = ECDSA_SHA1(256)
+	fmt.Println(err)
+	hash := SHA256.New()
+	defer hash.Close()
+	hash.Write([]byte("abc"))
+	fmt.Printf("SHA256: %x\n", hash.Digest())
+	// Output:
+	// Self-tests: <nil>
+	// MD5 is not approved in FIPS mode
+	// DES3_CBC is approved only for decryption in FIPS mode
+	// Decryption: <nil>
+	// RSA_SHA256 key size 1024 is smaller than 2048 bits required in FIPS mode
+	// RSA is not approved in FIPS mode
+	// DSA_SHA256 is approved only for signature verification in FIPS mode
+	// ECDSA_SHA1 is approved only for signature verification in FIPS mode
+	// SHA256: ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad
+}
+
+// faultyHash is a HashSpec that computes wrong digests
+type faultyHash struct {
+	HashSpec
+}
+
+func (h faultyHash) New() Hash {
+	return &faultyDigest{h.HashSpec.New()}
+}
+
+type faultyDigest struct {
+	Hash
+}
+
+func (d *faultyDigest) Digest() []byte {
+	digest := d.Hash.Digest()
+	digest[0] ^= 1
+	return digest
+}
+
+func TestFIPSSelfTestFailure(t *testing.T) {
+	if os.Getenv("OKAPI_FIPS_FAULTY") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=TestFIPSSelfTestFailure", "-test.v")
+		cmd.Env = append(os.Environ(), "OKAPI_FIPS_FAULTY=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+	SHA384 = faultyHash{SHA384}
+	// a registered implementation is tested even if it's no longer assigned
+	sha512 := SHA512
+	Register(&SHA512, faultyHash{SHA512})
+	SHA512 = sha512
+	err := EnableFIPS()
+	if err == nil || !strings.Contains(err.Error(), "SHA384 self-test of fips failed: known answer mismatch") {
+		t.Fatalf("Unexpected self-tests result: %v", err)
+	}
+	if !strings.Contains(err.Error(), "SHA512 self-test of fips failed: known answer mismatch") {
+		t.Fatalf("Registered implementation not tested: %v", err)
+	}
+	if strings.Contains(err.Error(), "SHA256") {
+		t.Fatalf("Unexpected SHA256 failure: %v", err)
+	}
+	if refused(func() { SHA256.New() }) == nil {
+		t.Fatal("SHA256 not refused")
+	}
+	if _, err = ECDSA_SHA256(256); err == nil {
+		t.Fatal("ECDSA_SHA256 not refused")
+	}
+	if EnableFIPS() == nil {
+		t.Fatal("Failure not repeated")
+	}
+}
+
+func TestFIPSVerificationOnly(t *testing.T) {
+	key, err := ECDSA_SHA1(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := ExportKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := make([]byte, 20)
+	signature, err := key.Sign(digest)
+	key.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = EnableFIPS(); err != nil {
+		t.Fatal(err)
+	}
+	if key, err = ECDSA_SHA1(der); err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	if sized, ok := key.(interface{ KeySize() int }); !ok || sized.KeySize() != 256 {
+		t.Errorf("Missing KeySize of verification only key")
+	}
+	if _, err = key.Sign(digest); err == nil || err.Error() != "ECDSA_SHA1 is approved only for signature verification in FIPS mode" {
+		t.Fatalf("Signing not refused: %v", err)
+	}
+	public := key.PublicKey()
+	defer public.Close()
+	if valid, err := public.Verify(signature, digest); !valid || err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+}
@@ -20,7 +20,7 @@ func ExampleMD5() {
 	// Digest: 098f6bcd4621d373cade4e832627b4f6
 }
 
-func ExampleHashCloning() {
+func Example_hashCloning() {
 	sha := SHA256.New()
 	defer sha.Close()
 	fmt.Printf("Block size %d, digest size %d\n", sha.BlockSize(), sha.Size())
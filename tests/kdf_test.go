@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	_ "testing"
+)
+
+func ExamplePBKDF2() {
+	// RFC 6070 test vector
+	kdf := okapi.PBKDF2{Hash: okapi.SHA1, Salt: []byte("salt"), Iterations: 4096}
+	key, err := kdf.Derive([]byte("password"), 20)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 4b007901b765489abead49d926f721d065a429c1, error <nil>
+}
+
+func ExamplePBKDF2_emptyPassword() {
+	// RFC 8018 allows empty passwords
+	kdf := okapi.PBKDF2{Hash: okapi.SHA256, Salt: []byte("salt"), Iterations: 1000}
+	key, err := kdf.Derive(nil, 32)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 94fb56af3ea22e5d3ed1b054085b136ca301b75d8b406c802c489479f27387c6, error <nil>
+}
+
+func ExampleHKDF() {
+	// RFC 5869 test case 1
+	secret := bytes.Repeat([]byte{0x0b}, 22)
+	salt := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c}
+	info := []byte{0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8, 0xf9}
+	kdf := okapi.HKDF{Hash: okapi.SHA256, Salt: salt, Info: info}
+	key, err := kdf.Derive(secret, 42)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865, error <nil>
+}
+
+func ExampleX963KDF() {
+	// NIST CAVS test vector
+	secret, _ := hex.DecodeString("96c05619d56c328ab95fe84b18264b08725b85e33fd34f08")
+	kdf := okapi.X963KDF{Hash: okapi.SHA256}
+	key, err := kdf.Derive(secret, 16)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 443024c3dae66b95e6f5670601558f71, error <nil>
+}
+
+func ExampleConcatKDF() {
+	// RFC 7518, Appendix C
+	secret := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132, 38, 156,
+		251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121, 140, 254, 144, 196}
+	info, _ := hex.DecodeString("000000074131323847434d00000005416c69636500000003426f6200000080")
+	kdf := okapi.ConcatKDF{Hash: okapi.SHA256, OtherInfo: info}
+	key, err := kdf.Derive(secret, 16)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 56aa8deaf8236d205c2228cd71a7101a, error <nil>
+}
+
+func ExamplePKCS12KDF() {
+	// password "sesame" encoded as BMPString
+	password := []byte{0, 's', 0, 'e', 0, 's', 0, 'a', 0, 'm', 0, 'e', 0, 0}
+	salt := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	kdf := okapi.PKCS12KDF{Hash: okapi.SHA1, Salt: salt, Iterations: 2048, ID: 1}
+	key, err := kdf.Derive(password, 24)
+	fmt.Printf("Key: %x, error %v\n", key, err)
+	// Output:
+	// Key: 7cd9fd3e2b3be7691a44e3bef0f9ea0fb9b897d4e325d9d1, error <nil>
+}
@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	_ "testing"
+)
+
+func Example_aesKWP() {
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	kw := okapi.AES_KWP.New(kek)
+	defer kw.Close()
+	wrapped, err := kw.Wrap([]byte("ForPasi"))
+	fmt.Printf("Wrapped: %x, error %v\n", wrapped, err)
+	key, err := kw.Unwrap(wrapped)
+	fmt.Printf("Unwrapped: %s, error %v\n", key, err)
+	wrapped[0] ^= 1
+	_, err = kw.Unwrap(wrapped)
+	fmt.Printf("Corrupted: error %v\n", err != nil)
+	// Output:
+	// Wrapped: afbeb0f07dfbf5419200f2ccb50bb24f, error <nil>
+	// Unwrapped: ForPasi, error <nil>
+	// Corrupted: error true
+}
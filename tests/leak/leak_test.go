@@ -0,0 +1,121 @@
+// Leak detection cannot be switched off, so these tests run in their own package.
+package leak
+
+import (
+	"bytes"
+	. "github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kinds returns the kinds and algorithms of the leaks
+func kinds() string {
+	var names []string
+	for _, leak := range Leaks() {
+		names = append(names, leak.Algorithm+" "+leak.Kind)
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestLeaks(t *testing.T) {
+	EnableLeakDetection(false)
+	hash := SHA256.New()
+	clone := hash.Clone()
+	cipher := AES_CBC.New(make([]byte, 16), make([]byte, 16), true)
+	cipher.Close()
+	pri, err := ECDSA_SHA256(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := pri.PublicKey()
+	// the tracked keys provide the KeySize of the implementation
+	if sized, ok := pri.(interface{ KeySize() int }); !ok || sized.KeySize() != 256 {
+		t.Errorf("Missing KeySize of tracked private key")
+	}
+	if sized, ok := pub.(interface{ KeySize() int }); !ok || sized.KeySize() != 256 {
+		t.Errorf("Missing KeySize of tracked public key")
+	}
+	if actual, expected := kinds(), "SHA256 Hash, SHA256 Hash, ECDSA_SHA256 PrivateKey, ECDSA_SHA256 PublicKey"; actual != expected {
+		t.Fatalf("Unexpected leaks: %s", actual)
+	}
+	if stack := Leaks()[0].Stack; !strings.HasPrefix(stack, "github.com/mkobetic/okapi/tests/leak.TestLeaks\n") {
+		t.Errorf("Unexpected stack:\n%s", stack)
+	}
+	var report bytes.Buffer
+	if n := ReportLeaks(&report); n != 4 || !strings.Contains(report.String(), "leak_test.go:") {
+		t.Errorf("Unexpected report %d:\n%s", n, report.String())
+	}
+	hash.Close()
+	clone.Close()
+	pub.Close()
+	pri.Close()
+	if leaks := Leaks(); len(leaks) != 0 {
+		t.Fatalf("Unexpected leaks: %v", leaks)
+	}
+}
+
+func TestDRBGLeak(t *testing.T) {
+	EnableLeakDetection(false)
+	random := CTR_DRBG{KeySize: 16}.New()
+	if actual := kinds(); !strings.Contains(actual, "CTR_DRBG Random") {
+		t.Fatalf("Unexpected leaks: %s", actual)
+	}
+	random.Close()
+	if leaks := Leaks(); len(leaks) != 0 {
+		t.Fatalf("Unexpected leaks: %v", leaks)
+	}
+}
+
+func TestRandomLeak(t *testing.T) {
+	EnableLeakDetection(false)
+	random := DefaultRandom.New()
+	seeded := SeededRandom([]byte("seed")).New()
+	if actual, expected := kinds(), "DefaultRandom Random, SeededRandom Random"; actual != expected {
+		t.Fatalf("Unexpected leaks: %s", actual)
+	}
+	random.Close()
+	seeded.Close()
+	if leaks := Leaks(); len(leaks) != 0 {
+		t.Fatalf("Unexpected leaks: %v", leaks)
+	}
+}
+
+func TestLeakGCMTag(t *testing.T) {
+	EnableLeakDetection(false)
+	aes := AES_GCM.New(make([]byte, 16), make([]byte, 12), true)
+	defer aes.Close()
+	tagged, ok := aes.(interface{ GCMGetTag(out []byte) int })
+	if !ok {
+		t.Fatal("Tracked AES_GCM doesn't provide the tag")
+	}
+	aes.Finish(nil)
+	if tagged.GCMGetTag(make([]byte, 16)) != 1 {
+		t.Fatal("GCMGetTag failed")
+	}
+}
+
+func TestLeakFinalizer(t *testing.T) {
+	EnableLeakDetection(true)
+	defer EnableLeakDetection(false)
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	func() {
+		hash := SHA512.New()
+		hash.Write([]byte("abc"))
+	}()
+	for start := time.Now(); len(Leaks()) > 0; runtime.GC() {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Leak not finalized: %s", kinds())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(logged.String(), "okapi: leaked SHA512 Hash created at") {
+		t.Fatalf("Leak not logged: %q", logged.String())
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleSlogObserver() {
+	// drop the time and latency to get reproducible output
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "latency" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	okapi.SetObserver(okapi.SlogObserver{Logger: logger})
+	defer okapi.SetObserver(nil)
+	hash := okapi.SHA256.New()
+	hash.Write([]byte("abc"))
+	digest := hash.Digest()
+	// the input of the hash is reported when it is closed
+	hash.Close()
+	pri, _ := okapi.ECDSA_SHA256(256)
+	defer pri.Close()
+	signature, _ := pri.Sign(digest)
+	pub := pri.PublicKey()
+	defer pub.Close()
+	pub.Verify(signature, digest)
+	// Output:
+	// level=INFO msg=okapi operation=new-hash algorithm=SHA256 provider=libcrypto
+	// level=INFO msg=okapi operation=hash algorithm=SHA256 provider=libcrypto bytes=3
+	// level=INFO msg=okapi operation=new-key algorithm=ECDSA_SHA256 provider=libcrypto key_size=256
+	// level=INFO msg=okapi operation=sign algorithm=ECDSA_SHA256 provider=libcrypto key_size=256 bytes=32
+	// level=INFO msg=okapi operation=verify algorithm=ECDSA_SHA256 provider=libcrypto key_size=256 bytes=32
+}
+
+func TestObserverMetrics(t *testing.T) {
+	var metrics okapi.Metrics
+	var events []*okapi.Event
+	okapi.SetObserver(okapi.MultiObserver(&metrics, okapi.ObserverFunc(func(e *okapi.Event) { events = append(events, e) })))
+	defer okapi.SetObserver(nil)
+	okapi.SetPolicy(&okapi.Policy{BannedAlgorithms: []string{"RC4"}})
+	defer okapi.SetPolicy(nil)
+
+	key := make([]byte, 16)
+	cbc := okapi.AES_CBC.New(key, make([]byte, 16), true)
+	cbc.Update(make([]byte, 32), make([]byte, 32))
+	cbc.Close()
+	func() {
+		defer func() { recover() }()
+		okapi.RC4.New(key, nil, true)
+	}()
+	pri, err := okapi.ECDH(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pri.Close()
+	peer, err := okapi.ECDH(pri.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	pub := peer.PublicKey()
+	defer pub.Close()
+	if sized, ok := pub.(interface{ KeySize() int }); !ok || sized.KeySize() != 256 {
+		t.Errorf("Missing KeySize of observed public key")
+	}
+	if _, err = pri.Derive(pub); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 6 {
+		t.Fatalf("Unexpected events %v", events)
+	}
+	if e := events[0]; e.Operation != okapi.OpNewCipher || e.Algorithm != "AES_CBC" || e.KeySize != 128 || e.Err != nil {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e := events[1]; e.Operation != okapi.OpEncrypt || e.Algorithm != "AES_CBC" || e.Bytes != 32 || e.Err != nil {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e := events[2]; e.Algorithm != "RC4" || e.Err == nil {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e := events[5]; e.Operation != okapi.OpDerive || e.KeySize != 256 || e.Err != nil {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	var text bytes.Buffer
+	if _, err := metrics.WriteTo(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`okapi_operations_total{operation="new-key",algorithm="ECDH",provider="libcrypto"} 2`,
+		`okapi_operation_errors_total{operation="new-cipher",algorithm="RC4",provider="libcrypto"} 1`,
+		`okapi_operation_errors_total{operation="derive",algorithm="ECDH",provider="libcrypto"} 0`,
+		`okapi_operation_bytes_total{operation="encrypt",algorithm="AES_CBC",provider="libcrypto"} 32`,
+	} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("Missing %s in\n%s", line, text.String())
+		}
+	}
+	if !strings.Contains(metrics.String(), `{"operation":"derive","algorithm":"ECDH","provider":"libcrypto","count":1,`) {
+		t.Errorf("Unexpected JSON %s", metrics.String())
+	}
+}
+
+// gcmCipher is the libcrypto AES_GCM Cipher providing the tag
+type gcmCipher interface {
+	okapi.Cipher
+	GCMGetTag(out []byte) int
+	GCMSetTag(in []byte) int
+}
+
+func TestObserverGCMTag(t *testing.T) {
+	okapi.SetObserver(okapi.ObserverFunc(func(*okapi.Event) {}))
+	defer okapi.SetObserver(nil)
+	key, iv := make([]byte, 16), make([]byte, 12)
+	encrypter, ok := okapi.AES_GCM.New(key, iv, true).(gcmCipher)
+	if !ok {
+		t.Fatal("Observed AES_GCM doesn't provide the tag")
+	}
+	defer encrypter.Close()
+	encrypted := make([]byte, 5)
+	encrypter.Update([]byte("plain"), encrypted)
+	encrypter.Finish(nil)
+	tag := make([]byte, 16)
+	encrypter.GCMGetTag(tag)
+	decrypter := okapi.AES_GCM.New(key, iv, false).(gcmCipher)
+	defer decrypter.Close()
+	decrypter.GCMSetTag(tag)
+	decrypted := make([]byte, 5)
+	decrypter.Update(encrypted, decrypted)
+	decrypter.Finish(nil) // panics if the tag doesn't match
+	if string(decrypted) != "plain" {
+		t.Fatalf("Unexpected decryption %q", decrypted)
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"io/ioutil"
+	"testing"
+)
+
+func ExamplePasswordWriter() {
+	encrypted := new(bytes.Buffer)
+	password := []byte("open sesame")
+	w, err := okapi.NewPasswordWriter(encrypted, password, nil, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	w.Write([]byte("Message in a bottle!"))
+	err = w.Close()
+	fmt.Printf("Encryption error %v\n", err)
+	r, err := okapi.NewPasswordReader(bytes.NewReader(encrypted.Bytes()), password, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	fmt.Printf("Decrypted: %s, error %v\n", decrypted, err)
+	err = r.Close()
+	fmt.Printf("Integrity error %v\n", err)
+	_, err = okapi.NewPasswordReader(bytes.NewReader(encrypted.Bytes()), []byte("open sesamE"), nil)
+	fmt.Printf("Wrong password error: %v\n", err)
+	// Output:
+	// Encryption error <nil>
+	// Decrypted: Message in a bottle!, error <nil>
+	// Integrity error <nil>
+	// Wrong password error: invalid password or corrupted header
+}
+
+func TestPasswordTampering(t *testing.T) {
+	parameters := okapi.PasswordParameters{Cipher: "AES_OFB", KeySize: 16, Hash: "SHA1", Iterations: 1000, SaltSize: 8}
+	plain := make([]byte, 100000)
+	encrypted := new(bytes.Buffer)
+	w, err := okapi.NewPasswordWriter(encrypted, []byte("password"), &parameters, make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := encrypted.Bytes()
+	r, err := okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("Decrypted does not match plain")
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 1
+	r, err = okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closing without reading should still verify the whole input
+	if err = r.Close(); err == nil {
+		t.Fatal("Tampered input was not detected")
+	}
+}
+
+func TestPasswordIterations(t *testing.T) {
+	parameters := okapi.PasswordParameters{Cipher: "AES_CTR", KeySize: 16, Hash: "SHA1", Iterations: 1000, SaltSize: 8}
+	encrypted := new(bytes.Buffer)
+	w, err := okapi.NewPasswordWriter(encrypted, []byte("password"), &parameters, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("plain"))
+	w.Close()
+	data := encrypted.Bytes()
+	iterations := data[bytes.Index(data, []byte("SHA1"))+4:]
+	copy(iterations, []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err = okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil); err == nil {
+		t.Fatal("Excessive iteration count accepted")
+	}
+	copy(iterations, []byte{0, 0, 0, 1})
+	if _, err = okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil); err == nil {
+		t.Fatal("Insufficient iteration count accepted")
+	}
+	parameters.Iterations = 1
+	if _, err = okapi.NewPasswordWriter(encrypted, []byte("password"), &parameters, nil); err == nil {
+		t.Fatal("Insufficient iteration count used")
+	}
+}
+
+func TestPasswordKeySize(t *testing.T) {
+	parameters := okapi.PasswordParameters{Cipher: "AES_CTR", KeySize: 16, Hash: "SHA1", Iterations: 1000, SaltSize: 8}
+	encrypted := new(bytes.Buffer)
+	w, err := okapi.NewPasswordWriter(encrypted, []byte("password"), &parameters, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("plain"))
+	w.Close()
+	data := encrypted.Bytes()
+	keySize := bytes.Index(data, []byte("AES_CTR")) + 7
+	for _, size := range []byte{0, 20, 255} {
+		data[keySize] = size
+		if _, err = okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil); err == nil {
+			t.Fatalf("Key size %d accepted", size)
+		}
+	}
+	data[keySize] = 16
+	data[keySize+1] = 15 // iv length
+	if _, err = okapi.NewPasswordReader(bytes.NewReader(data), []byte("password"), nil); err == nil {
+		t.Fatal("Invalid iv size accepted")
+	}
+	parameters.KeySize = 20
+	if _, err = okapi.NewPasswordWriter(encrypted, []byte("password"), &parameters, nil); err == nil {
+		t.Fatal("Invalid key size used")
+	}
+}
@@ -9,32 +9,40 @@ import (
 )
 
 func ExampleRSA() {
-	pri, _ := okapi.RSA(512)
+	// a seeded Random makes the key and the OAEP padding reproducible
+	random := okapi.SeededRandom([]byte("example")).New()
+	defer random.Close()
+	pri, _ := okapi.RSA_OAEP(okapi.KeyParameters{Parameters: 2048, Random: random})
 	defer pri.Close()
 	pub := pri.PublicKey()
 	defer pub.Close()
 	plain := []byte("Message in a bottle!")
 	fmt.Printf("Plain    : %x\n", plain)
 	encrypted, _ := pub.Encrypt(plain)
-	// fmt.Printf("Encrypted: %x\n", encrypted)
+	fmt.Printf("Encrypted: %x\n", encrypted[:16])
 	decrypted, _ := pri.Decrypt(encrypted)
 	fmt.Printf("Decrypted: %x\n", decrypted)
 	// Output:
 	// Plain    : 4d65737361676520696e206120626f74746c6521
+	// Encrypted: 021896c4a5cd70c450dcef6e7c0904dd
 	// Decrypted: 4d65737361676520696e206120626f74746c6521
-
 }
 
-func ExampleDSA_SHA256() {
-	pri, _ := okapi.DSA_SHA256(512)
+func Example_dsaSHA256() {
+	pri, _ := okapi.DSA_SHA256(1024)
 	defer pri.Close()
 	pub := pri.PublicKey()
 	defer pub.Close()
 	message := []byte("Message in a bottle!")
 	fmt.Printf("Message : %x\n", message)
-	signature, _ := pri.Sign(message)
+	// the key signs the SHA256 digest of the message
+	hash := okapi.SHA256.New()
+	defer hash.Close()
+	hash.Write(message)
+	digest := hash.Digest()
+	signature, _ := pri.Sign(digest)
 	// fmt.Printf("Signature: %x", signature)
-	verified, _ := pub.Verify(signature, message)
+	verified, _ := pub.Verify(signature, digest)
 	fmt.Printf("Verified: %v\n", verified)
 	// Output:
 	// Message : 4d65737361676520696e206120626f74746c6521
@@ -61,3 +69,22 @@ func ExampleDH() {
 	// Secret 2: 64 bytes
 	// Secrets equal? true
 }
+
+func ExampleKeyParameters() {
+	// keys generated with the same seeded Random are identical,
+	// as are their signatures if the Random is in the same state
+	signed := func() (der, signature []byte) {
+		random := okapi.SeededRandom([]byte("seed")).New()
+		defer random.Close()
+		pri, _ := okapi.ECDSA_SHA256(okapi.KeyParameters{Parameters: 256, Random: random})
+		defer pri.Close()
+		der, _ = okapi.ExportKey(pri)
+		signature, _ = pri.Sign(make([]byte, 32))
+		return der, signature
+	}
+	der, signature := signed()
+	der2, signature2 := signed()
+	fmt.Printf("Same keys: %v, same signatures: %v\n", bytes.Equal(der, der2), bytes.Equal(signature, signature2))
+	// Output:
+	// Same keys: true, same signatures: true
+}
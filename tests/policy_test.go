@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ExampleSetPolicy() {
+	okapi.SetPolicy(&okapi.Policy{
+		MinDHSize:             2048,
+		AllowedCurves:         []string{"P-256", "P-384", "Ed25519"},
+		BannedSignatureHashes: []string{"MD5", "SHA1"},
+	})
+	defer okapi.SetPolicy(nil)
+	_, err := okapi.RSA_SHA1(2048)
+	fmt.Println(err)
+	_, err = okapi.DH(512)
+	fmt.Println(err)
+	_, err = okapi.ECDSA_SHA512(521)
+	fmt.Println(err)
+	pri, err := okapi.ECDSA_SHA256(256)
+	fmt.Println(err)
+	pri.Close()
+	// Output:
+	// RSA_SHA1 violates the policy: signature hash SHA1 is banned
+	// DH violates the policy: key size 512 is smaller than 2048 bits
+	// ECDSA_SHA512 violates the policy: curve P-521 is not allowed
+	// <nil>
+}
+
+func TestPolicyReportOnly(t *testing.T) {
+	var violations []string
+	okapi.SetPolicy(&okapi.Policy{
+		MinRSASize:       2048,
+		BannedAlgorithms: []string{"MD5"},
+		ReportOnly:       true,
+		Report:           func(v *okapi.PolicyViolation) { violations = append(violations, v.Error()) },
+	})
+	defer okapi.SetPolicy(nil)
+	pri, err := okapi.RSA_SHA256(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pri.Close()
+	okapi.MD5.New().Close()
+	expected := []string{
+		"RSA_SHA256 violates the policy: key size 1024 is smaller than 2048 bits",
+		"MD5 violates the policy: the algorithm is banned",
+	}
+	if fmt.Sprint(violations) != fmt.Sprint(expected) {
+		t.Fatalf("Unexpected violations %q", violations)
+	}
+}
+
+func TestPolicyBannedAlgorithm(t *testing.T) {
+	okapi.SetPolicy(&okapi.Policy{BannedAlgorithms: []string{"RC4"}})
+	defer okapi.SetPolicy(nil)
+	defer func() {
+		v, ok := recover().(*okapi.PolicyViolation)
+		if !ok || v.Algorithm != "RC4" {
+			t.Fatalf("RC4 not refused: %v", v)
+		}
+	}()
+	okapi.RC4.New(make([]byte, 16), nil, true)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(file, []byte(`{"MinRSASize": 3072, "BannedSignatureHashes": ["SHA1"], "MaxKeyAge": "8760h"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := okapi.LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MinRSASize != 3072 || len(p.BannedSignatureHashes) != 1 || p.MaxKeyAge != 365*24*time.Hour {
+		t.Fatalf("Unexpected policy %+v", p)
+	}
+	if err := os.WriteFile(file, []byte(`{"MinRSABits": 3072}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = okapi.LoadPolicy(file); err == nil {
+		t.Fatal("Unknown field accepted")
+	}
+}
+
+func TestPolicyMaxKeyAge(t *testing.T) {
+	pri, err := okapi.ECDSA_SHA256(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := okapi.ExportKey(pri)
+	pri.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	okapi.SetPolicy(&okapi.Policy{MaxKeyAge: 24 * time.Hour})
+	defer okapi.SetPolicy(nil)
+	_, err = okapi.ECDSA_SHA256(okapi.KeyParameters{Parameters: der, Created: time.Now().Add(-48 * time.Hour)})
+	if _, ok := err.(*okapi.PolicyViolation); !ok {
+		t.Fatalf("Expired key not refused: %v", err)
+	}
+	pri, err = okapi.ECDSA_SHA256(okapi.KeyParameters{Parameters: der, Created: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pri.Close()
+	if sized, ok := pri.(interface{ KeySize() int }); !ok || sized.KeySize() != 256 {
+		t.Errorf("Missing KeySize of aged key")
+	}
+	digest := make([]byte, 32)
+	if _, err = pri.Sign(digest); err != nil {
+		t.Fatal(err)
+	}
+	okapi.SetPolicy(&okapi.Policy{MaxKeyAge: time.Minute})
+	if _, err = pri.Sign(digest); err == nil {
+		t.Fatal("Expired key signed")
+	}
+}
@@ -19,3 +19,70 @@ func ExampleRandom() {
 	// Output:
 	// Generated 10 random bytes
 }
+
+func ExampleSeededRandom() {
+	spec := SeededRandom([]byte("seed"))
+	random := spec.New()
+	defer random.Close()
+	out := make([]byte, 16)
+	random.Read(out)
+	fmt.Printf("%x\n", out)
+	// Randoms from the same spec share the stream
+	other := spec.New()
+	defer other.Close()
+	other.Read(out)
+	fmt.Printf("%x\n", out)
+	// a new spec with the same seed repeats it
+	again := SeededRandom([]byte("seed")).New()
+	defer again.Close()
+	again.Read(out)
+	fmt.Printf("%x\n", out)
+	// Output:
+	// dc02ef9afa266dd56cdda5628a82dcdd
+	// d17f007ee61a411d2ec955a5286a906e
+	// dc02ef9afa266dd56cdda5628a82dcdd
+}
+
+// pattern is a faulty Random source repeating the pattern
+type pattern []byte
+
+func (p pattern) New() Random { return &patternReader{pattern: p} }
+
+type patternReader struct {
+	pattern []byte
+	next    int
+}
+
+func (r *patternReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = r.pattern[r.next%len(r.pattern)]
+		r.next++
+	}
+	return len(b), nil
+}
+
+func (r *patternReader) Close() {}
+
+func ExampleHealthTested() {
+	random := HealthTested{}.New()
+	out := make([]byte, 100000)
+	_, err := random.Read(out)
+	fmt.Printf("Default random error: %v\n", err)
+	random.Close()
+	faulty := []RandomSpec{
+		pattern{7},
+		pattern("0a0b0c0d0e0f0g0h0i0j0k0l0m0n0o0p"),
+		pattern("abcdefghijklmnop"),
+	}
+	for _, source := range faulty {
+		random = HealthTested{Source: source}.New()
+		n, err := random.Read(out)
+		fmt.Printf("Read %d bytes, error: %v\n", n, err)
+		random.Close()
+	}
+	// Output:
+	// Default random error: <nil>
+	// Read 0 bytes, error: random repetition count health test failed
+	// Read 0 bytes, error: random adaptive proportion health test failed
+	// Read 0 bytes, error: random stuck output health test failed
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"testing"
+)
+
+func ExampleSecret() {
+	key, _ := okapi.NewSecret(32)
+	defer key.Close()
+	okapi.DefaultRandom.New().Read(key.Bytes())
+	aead := okapi.NewSecretAEAD(okapi.AES_GCM_AEAD, key)
+	defer aead.Close()
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, nonce, []byte("Message in a bottle!"))
+	// decrypt directly into the secret memory
+	plain, _ := okapi.NewSecret(len(sealed) - aead.Overhead())
+	defer plain.Close()
+	_, err := aead.Open(plain.Bytes()[:0], nonce, sealed)
+	fmt.Printf("%s %v\n", plain.Bytes(), err)
+	// Output:
+	// Message in a bottle! <nil>
+}
+
+func TestSecretFrom(t *testing.T) {
+	b := []byte("secret")
+	s, err := okapi.SecretFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Bytes()) != "secret" || s.Len() != 6 {
+		t.Errorf("Unexpected secret %q", s.Bytes())
+	}
+	if string(b) != "secret" {
+		t.Errorf("Source modified: %q", b)
+	}
+	s.Close()
+	s.Close()
+	if s.Bytes() != nil {
+		t.Error("Secret still accessible")
+	}
+	empty, err := okapi.NewSecret(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.Close()
+}
+
+func TestDeriveSecret(t *testing.T) {
+	pri, err := okapi.ECDH(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pri.Close()
+	peer, err := okapi.ECDH(pri.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	pub, peerPub := pri.PublicKey(), peer.PublicKey()
+	defer pub.Close()
+	defer peerPub.Close()
+	secret, err := okapi.DeriveSecret(pri, peerPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secret.Close()
+	expected, err := peer.Derive(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.Bytes(), expected) {
+		t.Fatalf("Secrets differ:\n%x\n%x", secret.Bytes(), expected)
+	}
+	hash := okapi.SHA256.New()
+	defer hash.Close()
+	hash.Write(secret.Bytes())
+	digest, err := okapi.DigestSecret(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer digest.Close()
+	if digest.Len() != 32 || !bytes.Equal(digest.Bytes(), hash.Digest()) {
+		t.Fatalf("Unexpected digest %x", digest.Bytes())
+	}
+}
+
+func TestKDFSecret(t *testing.T) {
+	secret, err := okapi.SecretFrom([]byte("input key material"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secret.Close()
+	kdf := okapi.HKDF{Hash: okapi.SHA256, Salt: []byte("salt")}
+	key, err := okapi.KDFSecret(kdf, secret, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	expected, err := kdf.Derive([]byte("input key material"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Bytes(), expected) {
+		t.Fatalf("Keys differ:\n%x\n%x", key.Bytes(), expected)
+	}
+	mac := okapi.NewSecretMAC(okapi.HMAC, okapi.SHA256, key)
+	defer mac.Close()
+	if len(mac.Digest()) != 32 {
+		t.Fatal("Unexpected MAC")
+	}
+}
+
+func TestCipherBufferZeroed(t *testing.T) {
+	key, iv := make([]byte, 16), make([]byte, 16)
+	buffer := make([]byte, 64)
+	w := okapi.AES_CBC.NewWriter(new(bytes.Buffer), key, iv, buffer)
+	w.Write(make([]byte, 100))
+	w.Write(make([]byte, 28))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffer, make([]byte, 64)) {
+		t.Fatalf("Buffer not zeroed: %x", buffer)
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mkobetic/okapi"
+	_ "github.com/mkobetic/okapi/libcrypto"
+	"testing"
+)
+
+func ExampleSecretKey() {
+	kek, _ := okapi.NewSecretKey(32, okapi.UsageWrap|okapi.UsageUnwrap, false)
+	defer kek.Close()
+	_, err := kek.NewCipher(okapi.AES_CTR, make([]byte, 16), true)
+	fmt.Println(err)
+	_, err = kek.Export()
+	fmt.Println(err)
+	key, _ := okapi.NewSecretKey(16, okapi.UsageEncrypt|okapi.UsageDecrypt, true)
+	defer key.Close()
+	wrapped, _ := kek.Wrap(okapi.AES_KW, key)
+	unwrapped, _ := kek.Unwrap(okapi.AES_KW, wrapped, okapi.UsageDecrypt, false)
+	defer unwrapped.Close()
+	fmt.Println(unwrapped.Size(), unwrapped.Usages())
+	_, err = kek.Wrap(okapi.AES_KW, unwrapped)
+	fmt.Println(err)
+	// Output:
+	// secret key doesn't allow encrypt
+	// secret key doesn't allow export
+	// 16 decrypt
+	// secret key doesn't allow export
+}
+
+func TestSecretKeyCipher(t *testing.T) {
+	key, err := okapi.ImportSecretKey(make([]byte, 16), okapi.UsageEncrypt|okapi.UsageDecrypt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	iv := make([]byte, 16)
+	var encrypted bytes.Buffer
+	w, err := key.NewCipherWriter(&encrypted, okapi.AES_CTR, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Message in a bottle!"))
+	w.Close()
+	decrypter, err := okapi.AES_CTR.NewWithKey(key, iv, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decrypter.Close()
+	decrypted := make([]byte, encrypted.Len())
+	decrypter.Update(encrypted.Bytes(), decrypted)
+	if string(decrypted) != "Message in a bottle!" {
+		t.Fatalf("Unexpected decryption %q", decrypted)
+	}
+	if _, err = okapi.HMAC.NewWithKey(okapi.SHA256, key); err == nil {
+		t.Fatal("Encryption key used for MAC")
+	}
+}
+
+func TestSecretKeyAEAD(t *testing.T) {
+	sealer, err := okapi.NewSecretKey(16, okapi.UsageEncrypt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sealer.Close()
+	material, err := sealer.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opener, err := okapi.ImportSecretKey(material, okapi.UsageDecrypt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opener.Close()
+	if bytes.Equal(material, make([]byte, 16)) {
+		t.Fatal("Imported key material zeroed")
+	}
+	seal, err := sealer.NewAEAD(okapi.AES_GCM_AEAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seal.Close()
+	open, err := opener.NewAEAD(okapi.AES_GCM_AEAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	nonce := make([]byte, seal.NonceSize())
+	sealed := seal.Seal(nil, nonce, []byte("plain"))
+	if plain, err := open.Open(nil, nonce, sealed); err != nil || string(plain) != "plain" {
+		t.Fatalf("Open failed: %q %v", plain, err)
+	}
+	if _, err := seal.Open(nil, nonce, sealed); err == nil {
+		t.Fatal("Encryption key opened")
+	}
+	func() {
+		defer func() {
+			if _, ok := recover().(*okapi.KeyUsageError); !ok {
+				t.Fatal("Decryption key sealed")
+			}
+		}()
+		open.Seal(nil, nonce, []byte("plain"))
+	}()
+}
+
+func TestSecretKeyDerive(t *testing.T) {
+	master, err := okapi.NewSecretKey(32, okapi.UsageDerive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	derived, err := okapi.HKDF{Hash: okapi.SHA256, Info: []byte("mac")}.DeriveKey(master, 32, okapi.UsageSign, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer derived.Close()
+	mac, err := okapi.HMAC.NewWithKey(okapi.SHA256, derived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac.Close()
+	if _, err = derived.Derive(okapi.HKDF{Hash: okapi.SHA256}, 32, okapi.UsageSign, false); err == nil {
+		t.Fatal("MAC key used for derivation")
+	}
+	derived.Close()
+	if _, err = derived.NewMAC(okapi.HMAC, okapi.SHA256); err == nil {
+		t.Fatal("Closed key used")
+	}
+}
+
+func TestNewSecretKeyFrom(t *testing.T) {
+	secret, err := okapi.NewSecret(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := okapi.NewSecretKeyFrom(secret, okapi.UsageSign, false)
+	mac, err := okapi.HMAC.NewWithKey(okapi.SHA256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac.Close()
+	key.Close()
+	if secret.Bytes() != nil {
+		t.Fatal("Secret not closed with the key")
+	}
+}